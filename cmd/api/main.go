@@ -3,12 +3,16 @@ package main
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"tripflow/internal/database"
 	"tripflow/internal/handlers"
 	"tripflow/internal/middleware"
 	"tripflow/internal/repositories"
+	"tripflow/internal/services"
 	"tripflow/pkg/filestorage"
+	"tripflow/pkg/tus"
 
 	"github.com/gin-gonic/gin"
 )
@@ -34,16 +38,32 @@ func main() {
 	// Create Gin router
 	router := gin.Default()
 
+	// Client IPs, which IP-bound file URLs are checked against, are only
+	// taken from X-Forwarded-For when the request comes from a trusted proxy
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// Add security middleware
 	router.Use(middleware.RequestIDMiddleware(nil))
 	
 	// Add CORS middleware
 	router.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-CSRF-Token, X-Request-ID")
+		c.Header("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-CSRF-Token, X-Request-ID, "+
+			"Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, Upload-Checksum")
+		c.Header("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, "+
+			"Tus-Checksum-Algorithm, Upload-Length, Upload-Offset, Upload-Metadata, Upload-Expires, X-File-Id, X-File-Path")
 		
-		if c.Request.Method == "OPTIONS" {
+		// Preflights end here; other OPTIONS requests reach the tus routes
+		if c.Request.Method == "OPTIONS" && c.GetHeader("Access-Control-Request-Method") != "" {
 			c.AbortWithStatus(204)
 			return
 		}
@@ -65,13 +85,59 @@ func main() {
 		log.Fatalf("Failed to initialize file storage: %v", err)
 	}
 
+	// Encrypt files at rest; the first key encrypts new files and the
+	// others stay available to decrypt files from before a rotation
+	if keys := os.Getenv("FILE_STORAGE_ENCRYPTION_KEYS"); keys != "" {
+		keyring, err := filestorage.ParseKeyring(keys)
+		if err != nil {
+			log.Fatalf("Invalid FILE_STORAGE_ENCRYPTION_KEYS: %v", err)
+		}
+		fileStorage = filestorage.NewEncryptedFileStorage(fileStorage, keyring)
+	}
+
+	// Store identical uploads once, counting references in the database
+	if dedup, _ := strconv.ParseBool(os.Getenv("FILE_STORAGE_DEDUP")); dedup {
+		fileStorage = filestorage.NewDedupFileStorage(fileStorage, repositories.NewBlobRepository(db))
+	}
+
+	// Partial resumable uploads are kept on local disk until complete
+	uploadStore, err := tus.NewStore(nil)
+	if err != nil {
+		log.Fatalf("Failed to initialize upload store: %v", err)
+	}
+
 	// Initialize repositories
 	scheduleRepo := repositories.NewScheduleRepository(db)
+	exchangeRateRepo := repositories.NewExchangeRateRepository(db)
+	expenseRepo := repositories.NewExpenseRepository(db)
+	checklistRepo := repositories.NewChecklistRepository(db)
+	fileRepo := repositories.NewFileRepository(db)
+	quotaRepo := repositories.NewQuotaRepository(db)
+
+	// Initialize services
+	quotaService := services.NewQuotaService(quotaRepo, nil)
+	quotaService.SetStagedUploads(uploadStore)
+
+	// Schedules saved before file references were recorded only publish
+	// their images once they are indexed
+	fileAccess := services.NewFileAccess(fileRepo, scheduleRepo, services.NewMarkdownService(fileStorage))
+	if indexed, err := fileAccess.IndexUnindexed(); err != nil {
+		log.Printf("Failed to index schedule file references: %v", err)
+	} else if indexed > 0 {
+		log.Printf("Indexed file references of %d schedules", indexed)
+	}
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler()
-	fileHandler := handlers.NewFileHandler(fileStorage, db)
-	scheduleHandler := handlers.NewScheduleHandler(scheduleRepo, fileStorage)
+	fileHandler := handlers.NewFileHandler(fileStorage, db, quotaService, services.DefaultFileURLSigner())
+	resumableUploadHandler := handlers.NewResumableUploadHandler(fileHandler, uploadStore)
+	scheduleHandler := handlers.NewScheduleHandler(scheduleRepo, exchangeRateRepo, fileRepo, fileStorage)
+	exchangeRateHandler := handlers.NewExchangeRateHandler(exchangeRateRepo)
+	expenseHandler := handlers.NewExpenseHandler(scheduleRepo, expenseRepo, exchangeRateRepo)
+	checklistHandler := handlers.NewChecklistHandler(scheduleRepo, expenseRepo, checklistRepo, fileStorage)
+	exportHandler := handlers.NewExportHandler(scheduleRepo, exchangeRateRepo, fileRepo, fileStorage)
+	quotaHandler := handlers.NewQuotaHandler(quotaService, quotaRepo)
+	storageGCHandler := handlers.NewStorageGCHandler(services.NewFileGC(fileRepo, scheduleRepo, fileStorage, services.DefaultFileGCGrace()))
 
 	// Public routes with rate limiting
 	api := router.Group("/api")
@@ -89,16 +155,36 @@ func main() {
 			auth.POST("/refresh", authHandler.RefreshToken)
 		}
 
-		// File upload routes (public, but rate limited)
-		api.POST("/upload", fileHandler.UploadFile)
-		api.POST("/process-markdown", fileHandler.ProcessMarkdown)
-		api.GET("/file/:path", fileHandler.GetFile)
-		api.GET("/file/:path/info", fileHandler.GetFileInfo)
+		// File upload routes (authenticated, counted against the
+		// uploader's storage quota)
+		api.POST("/upload", middleware.AuthMiddleware(nil), fileHandler.UploadFile)
+
+		// Resumable uploads (tus 1.0); OPTIONS stays public for discovery
+		api.OPTIONS("/uploads", resumableUploadHandler.Options)
+		api.OPTIONS("/uploads/:id", resumableUploadHandler.Options)
+		uploads := api.Group("/uploads")
+		uploads.Use(middleware.AuthMiddleware(nil))
+		{
+			uploads.POST("", resumableUploadHandler.Create)
+			uploads.HEAD("/:id", resumableUploadHandler.Head)
+			uploads.PATCH("/:id", resumableUploadHandler.Patch)
+			uploads.DELETE("/:id", resumableUploadHandler.Terminate)
+		}
+		api.POST("/process-markdown", middleware.OptionalAuthMiddleware(), fileHandler.ProcessMarkdown)
+		// Files of public schedules are public; other files need their
+		// owner's token or a signed URL
+		api.GET("/file/*path", middleware.OptionalAuthMiddleware(), fileHandler.GetFile)
+		api.GET("/file-info/*path", middleware.OptionalAuthMiddleware(), fileHandler.GetFileInfo)
 
 		// Public schedule routes
 		api.GET("/schedules", scheduleHandler.ListSchedules)
 		api.GET("/schedules/:id", scheduleHandler.GetSchedule)
 		api.POST("/schedules/:id/share", scheduleHandler.IncrementShareCount)
+
+		// Offline exports; owners can export their private schedules
+		api.GET("/schedules/:id/export.pdf", middleware.OptionalAuthMiddleware(), exportHandler.ExportPDF)
+		api.GET("/schedules/:id/export.zip", middleware.OptionalAuthMiddleware(), exportHandler.ExportZip)
+		api.GET("/schedules/:id/export.epub", middleware.OptionalAuthMiddleware(), exportHandler.ExportEPUB)
 	}
 
 	// Protected routes (require authentication and CSRF protection)
@@ -122,7 +208,28 @@ func main() {
 			// File management endpoints (admin only)
 			files := protected.Group("/file")
 			{
-				files.DELETE("/:path", fileHandler.DeleteFile)
+				files.DELETE("/*path", fileHandler.DeleteFile)
+			}
+
+			// Orphaned file collection (admin only); a dry run unless
+			// ?dry_run=false
+			protected.POST("/storage/gc", storageGCHandler.RunGC)
+
+			// Storage quota overrides (admin only)
+			quotas := protected.Group("/quotas")
+			{
+				quotas.GET("/:userId", quotaHandler.GetQuota)
+				quotas.PUT("/:userId", quotaHandler.SetQuota)
+				quotas.DELETE("/:userId", quotaHandler.DeleteQuota)
+			}
+
+			// Exchange rate management endpoints (admin only)
+			rates := protected.Group("/exchange-rates")
+			{
+				rates.GET("", exchangeRateHandler.ListRates)
+				rates.POST("", exchangeRateHandler.CreateRate)
+				rates.POST("/import", exchangeRateHandler.ImportRates)
+				rates.DELETE("/:id", exchangeRateHandler.DeleteRate)
 			}
 	}
 
@@ -131,10 +238,28 @@ func main() {
 	user.Use(middleware.AuthMiddleware(nil))
 	user.Use(middleware.CreateRateLimitMiddleware(middleware.AuthenticatedRateLimitConfig()))
 	{
+		// Storage usage and quota of the signed-in user
+		user.GET("/usage", quotaHandler.GetUsage)
+
+		// Signed, expiring URLs for embedding private files
+		user.POST("/files/sign", fileHandler.SignFileURL)
+
 		// Schedule management endpoints
 		user.POST("/schedules", scheduleHandler.CreateSchedule)
 		user.PUT("/schedules/:id", scheduleHandler.UpdateSchedule)
 		user.DELETE("/schedules/:id", scheduleHandler.DeleteSchedule)
+
+		// Shared expense ledger endpoints
+		user.GET("/schedules/:id/expenses", expenseHandler.ListExpenses)
+		user.POST("/schedules/:id/expenses", expenseHandler.CreateExpense)
+		user.GET("/schedules/:id/expenses/:expenseId", expenseHandler.GetExpense)
+		user.PUT("/schedules/:id/expenses/:expenseId", expenseHandler.UpdateExpense)
+		user.DELETE("/schedules/:id/expenses/:expenseId", expenseHandler.DeleteExpense)
+		user.GET("/schedules/:id/settle-up", expenseHandler.SettleUp)
+
+		// Checklist endpoints built from the schedule's task lists
+		user.GET("/schedules/:id/checklist", checklistHandler.GetChecklist)
+		user.PUT("/schedules/:id/checklist/:itemKey", checklistHandler.SetChecklistItem)
 	}
 
 	// Get port from environment or use default
@@ -0,0 +1,153 @@
+// Command tripflow runs maintenance tasks for a TripFlow deployment.
+//
+// Usage:
+//
+//	tripflow storage migrate --from <storage> --to <storage> [flags]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"tripflow/internal/database"
+	"tripflow/internal/repositories"
+	"tripflow/internal/services"
+	"tripflow/pkg/filestorage"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: tripflow storage migrate --from <storage> --to <storage> [flags]
+
+Storages are named as local, local:<dir>, s3 or s3://<bucket>[/<prefix>];
+other settings come from FILE_STORAGE_* and S3_* variables.`
+
+func main() {
+	log.SetFlags(0)
+
+	// Load .env file if it exists (for local development)
+	godotenv.Load()
+
+	if len(os.Args) < 3 || os.Args[1] != "storage" || os.Args[2] != "migrate" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err := migrateStorage(os.Args[3:]); err != nil {
+		log.Fatalf("Storage migration failed: %v", err)
+	}
+}
+
+// migrateStorage copies every stored file from one storage to another
+func migrateStorage(args []string) error {
+	flags := flag.NewFlagSet("storage migrate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), usage)
+		fmt.Fprintln(flags.Output())
+		flags.PrintDefaults()
+	}
+	from := flags.String("from", "", "storage to copy files from")
+	to := flags.String("to", "", "storage to copy files to")
+	prefix := flags.String("prefix", "uploads/", "only copy files under this prefix")
+	workers := flags.Int("workers", 4, "number of files copied at once")
+	journal := flags.String("journal", "tripflow-migrate.journal", "file recording completed copies; running again resumes from it")
+	flags.Parse(args)
+
+	if *from == "" || *to == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *from == *to {
+		return fmt.Errorf("--from and --to name the same storage")
+	}
+
+	fromStorage, err := openStorage(*from)
+	if err != nil {
+		return err
+	}
+	toStorage, err := openStorage(*to)
+	if err != nil {
+		return err
+	}
+
+	// Only a target that picks its own paths changes them, and then the
+	// file records have to follow
+	var paths services.MigrationPathStore
+	if _, ok := toStorage.(filestorage.KeyedUploader); !ok {
+		db, err := database.ConnectDB(nil)
+		if err != nil {
+			return fmt.Errorf("failed to connect to database: %w", err)
+		}
+		defer database.CloseDB(db)
+		paths = repositories.NewFileRepository(db)
+	}
+
+	migration, err := services.NewStorageMigration(*from, fromStorage, *to, toStorage, paths)
+	if err != nil {
+		return err
+	}
+
+	// Stop on Ctrl-C; the journal keeps what was copied
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Copying files under %s from %s to %s with %d workers", *prefix, *from, *to, *workers)
+	if !migration.KeepsPaths() {
+		log.Printf("%s picks new paths; file records will be updated, but links to old paths in schedules will not", *to)
+	}
+	result, err := migration.Run(ctx, services.MigrationOptions{
+		Prefix:  *prefix,
+		Workers: *workers,
+		Journal: *journal,
+		Progress: func(p services.MigrationProgress) {
+			switch {
+			case p.Err != nil:
+				log.Printf("[%d/%d] %s failed: %v", p.Done, p.Total, p.Path, p.Err)
+			case p.NewPath != p.Path:
+				log.Printf("[%d/%d] %s -> %s (%s)", p.Done, p.Total, p.Path, p.NewPath, formatSize(p.Size))
+			default:
+				log.Printf("[%d/%d] %s (%s)", p.Done, p.Total, p.Path, formatSize(p.Size))
+			}
+		},
+	})
+	if result != nil {
+		log.Printf("Copied %d files (%s), %d already copied, %d failed", result.Copied, formatSize(result.Bytes), result.Resumed, result.Failed)
+	}
+	if err != nil {
+		return fmt.Errorf("%w; run again with the same --journal to resume", err)
+	}
+	if result.Failed > 0 {
+		return fmt.Errorf("%d files failed; run again with the same --journal to retry them", result.Failed)
+	}
+	return nil
+}
+
+// openStorage creates the storage named by spec
+func openStorage(spec string) (filestorage.FileStorageService, error) {
+	config, err := filestorage.ParseConfig(spec)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := filestorage.NewFileStorageService(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage %s: %w", spec, err)
+	}
+	return storage, nil
+}
+
+// formatSize formats a byte count for progress output
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -1,9 +1,13 @@
 module tripflow
 
-go 1.20
+// github.com/microcosm-cc/bluemonday v1.0.26 declares go 1.21, which Go
+// toolchains require of the main module too; no newer language features are
+// used.
+go 1.21
 
 require (
 	github.com/gin-gonic/gin v1.9.1
+	github.com/go-pdf/fpdf v0.9.0
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/golang-jwt/jwt/v5 v5.0.0
 	github.com/google/uuid v1.6.0
@@ -13,6 +17,7 @@ require (
 	github.com/ulule/limiter/v3 v3.1.0
 	github.com/yuin/goldmark v1.6.0
 	go.uber.org/zap v1.26.0
+	golang.org/x/net v0.17.0
 	gorm.io/driver/sqlite v1.5.4
 	gorm.io/gorm v1.25.10
 )
@@ -48,7 +53,6 @@ require (
 	go.uber.org/multierr v1.10.0 // indirect
 	golang.org/x/arch v0.3.0 // indirect
 	golang.org/x/crypto v0.14.0 // indirect
-	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
 	google.golang.org/protobuf v1.34.2 // indirect
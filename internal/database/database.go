@@ -79,6 +79,14 @@ func AutoMigrate(db *gorm.DB) error {
 	if err := db.AutoMigrate(
 		&models.File{},
 		&models.Schedule{},
+		&models.ExchangeRate{},
+		&models.Expense{},
+		&models.ExpenseParticipant{},
+		&models.ChecklistCheck{},
+		&models.ImageVariant{},
+		&models.Blob{},
+		&models.StorageQuota{},
+		&models.ScheduleFileRef{},
 	); err != nil {
 		return fmt.Errorf("failed to auto-migrate: %w", err)
 	}
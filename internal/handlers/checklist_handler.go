@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"tripflow/internal/models"
+	"tripflow/internal/repositories"
+	"tripflow/internal/services"
+	"tripflow/pkg/filestorage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ChecklistHandler handles checklists built from a schedule's task-list items
+type ChecklistHandler struct {
+	scheduleRepo    repositories.ScheduleRepository
+	expenseRepo     repositories.ExpenseRepository
+	checklistRepo   repositories.ChecklistRepository
+	markdownService *services.MarkdownService
+
+	// writeMu serializes read-modify-write cycles on schedule markdown
+	writeMu sync.Mutex
+}
+
+// NewChecklistHandler creates a new ChecklistHandler
+func NewChecklistHandler(scheduleRepo repositories.ScheduleRepository, expenseRepo repositories.ExpenseRepository, checklistRepo repositories.ChecklistRepository, fileStorage filestorage.FileStorageService) *ChecklistHandler {
+	return &ChecklistHandler{
+		scheduleRepo:    scheduleRepo,
+		expenseRepo:     expenseRepo,
+		checklistRepo:   checklistRepo,
+		markdownService: services.NewMarkdownService(fileStorage),
+	}
+}
+
+// ChecklistItemResponse is a checklist item with the current user's own state
+type ChecklistItemResponse struct {
+	services.ChecklistItem
+	MyChecked bool `json:"my_checked"`
+}
+
+// ChecklistResponse defines the response for checklist operations
+type ChecklistResponse struct {
+	ScheduleID string                  `json:"schedule_id"`
+	Items      []ChecklistItemResponse `json:"items"`
+	Total      int                     `json:"total"`
+	Checked    int                     `json:"checked"`    // Items ticked in the markdown
+	MyChecked  int                     `json:"my_checked"` // Items ticked by the current user
+}
+
+// SetChecklistItemRequest defines the request for ticking a checklist item.
+// Shared changes are written back into the schedule's markdown and need a
+// schedule member; personal ones only update the current user's state.
+type SetChecklistItemRequest struct {
+	Checked  *bool `json:"checked" binding:"required"`
+	Personal bool  `json:"personal"`
+}
+
+// GetChecklist handles listing the checklist items of a schedule
+func (h *ChecklistHandler) GetChecklist(c *gin.Context) {
+	schedule, userID, _, ok := h.loadChecklistSchedule(c)
+	if !ok {
+		return
+	}
+
+	markdown, err := readScheduleMarkdown(h.markdownService, schedule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to read schedule",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	response, err := h.checklistResponse(schedule, userID, services.ExtractChecklist(markdown))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve checklist",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SetChecklistItem handles ticking or clearing a checklist item
+func (h *ChecklistHandler) SetChecklistItem(c *gin.Context) {
+	schedule, userID, member, ok := h.loadChecklistSchedule(c)
+	if !ok {
+		return
+	}
+
+	var req SetChecklistItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if !req.Personal && !member {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Access denied",
+			"message": "Only schedule members can change the shared checklist",
+		})
+		return
+	}
+
+	itemKey := c.Param("itemKey")
+
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	// Re-read the schedule so concurrent edits are not overwritten
+	schedule, err := h.scheduleRepo.GetByID(schedule.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Schedule not found",
+			"message": "Schedule with the given ID does not exist",
+		})
+		return
+	}
+
+	markdown, err := readScheduleMarkdown(h.markdownService, schedule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to read schedule",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	updated, _, err := services.SetChecklistItem(markdown, itemKey, *req.Checked)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrChecklistItemNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error":   "Checklist item not found",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// The stored content takes precedence over the uploaded file, so the
+	// edited markdown becomes the schedule's source from here on
+	if !req.Personal && updated != markdown {
+		schedule.Content = updated
+		schedule.UpdatedAt = time.Now()
+		if err := h.scheduleRepo.Update(schedule); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to update schedule",
+				"message": err.Error(),
+			})
+			return
+		}
+		h.markdownService.InvalidateContent(markdown)
+		markdown = updated
+	}
+
+	check := &models.ChecklistCheck{
+		ScheduleID: schedule.ID,
+		UserID:     userID,
+		ItemKey:    itemKey,
+		Checked:    *req.Checked,
+		UpdatedAt:  time.Now(),
+	}
+	if err := h.checklistRepo.Set(check); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to save check state",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	response, err := h.checklistResponse(schedule, userID, services.ExtractChecklist(markdown))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve checklist",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// loadChecklistSchedule loads the schedule from the :id parameter and checks
+// that the current user may see it: the owner, people in its expense ledger,
+// or anyone when it is public. member reports whether the user owns the
+// schedule or takes part in its expense ledger, which is needed to change
+// its markdown.
+func (h *ChecklistHandler) loadChecklistSchedule(c *gin.Context) (schedule *models.Schedule, userID uuid.UUID, member bool, ok bool) {
+	userID, ok = requireUserID(c)
+	if !ok {
+		return nil, uuid.Nil, false, false
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid schedule ID",
+			"message": "Schedule ID format is invalid",
+		})
+		return nil, uuid.Nil, false, false
+	}
+
+	schedule, err = h.scheduleRepo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Schedule not found",
+			"message": "Schedule with the given ID does not exist",
+		})
+		return nil, uuid.Nil, false, false
+	}
+
+	member = schedule.IsOwnedBy(userID)
+	if !member {
+		member, err = h.expenseRepo.IsMember(schedule.ID, userID.String())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to check access",
+				"message": err.Error(),
+			})
+			return nil, uuid.Nil, false, false
+		}
+	}
+
+	if !member && !schedule.IsPublic {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Access denied",
+			"message": "Schedule is not public and you are not a member",
+		})
+		return nil, uuid.Nil, false, false
+	}
+
+	return schedule, userID, member, true
+}
+
+// checklistResponse combines checklist items with the user's own state
+func (h *ChecklistHandler) checklistResponse(schedule *models.Schedule, userID uuid.UUID, items []services.ChecklistItem) (*ChecklistResponse, error) {
+	checks, err := h.checklistRepo.ListByUser(schedule.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	mine := make(map[string]bool, len(checks))
+	for _, check := range checks {
+		mine[check.ItemKey] = check.Checked
+	}
+
+	response := &ChecklistResponse{
+		ScheduleID: schedule.ID.String(),
+		Items:      make([]ChecklistItemResponse, len(items)),
+		Total:      len(items),
+	}
+	for i, item := range items {
+		response.Items[i] = ChecklistItemResponse{ChecklistItem: item, MyChecked: mine[item.Key]}
+		if item.Checked {
+			response.Checked++
+		}
+		if mine[item.Key] {
+			response.MyChecked++
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tripflow/internal/models"
+	"tripflow/internal/repositories"
+	"tripflow/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ExchangeRateHandler handles admin management of exchange rates
+type ExchangeRateHandler struct {
+	rateRepo repositories.ExchangeRateRepository
+}
+
+// NewExchangeRateHandler creates a new ExchangeRateHandler
+func NewExchangeRateHandler(rateRepo repositories.ExchangeRateRepository) *ExchangeRateHandler {
+	return &ExchangeRateHandler{
+		rateRepo: rateRepo,
+	}
+}
+
+// CreateExchangeRateRequest defines the request for creating a rate
+type CreateExchangeRateRequest struct {
+	BaseCurrency  string  `json:"base_currency" binding:"required"`
+	QuoteCurrency string  `json:"quote_currency" binding:"required"`
+	EffectiveDate string  `json:"effective_date" binding:"required"` // YYYY-MM-DD
+	Rate          float64 `json:"rate" binding:"required"`
+	Source        string  `json:"source"`
+}
+
+// ListExchangeRatesResponse defines the response for listing rates
+type ListExchangeRatesResponse struct {
+	Rates []*models.ExchangeRate `json:"rates"`
+	Total int64                  `json:"total"`
+	Page  int                    `json:"page"`
+	Limit int                    `json:"limit"`
+}
+
+// ImportExchangeRatesResponse defines the response for a CSV import
+type ImportExchangeRatesResponse struct {
+	Imported int `json:"imported"`
+}
+
+// ListRates handles listing exchange rates with pagination
+func (h *ExchangeRateHandler) ListRates(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	rates, total, err := h.rateRepo.List(c.Query("base"), c.Query("quote"), (page-1)*limit, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve exchange rates",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ListExchangeRatesResponse{
+		Rates: rates,
+		Total: total,
+		Page:  page,
+		Limit: limit,
+	})
+}
+
+// CreateRate handles creating or replacing a single exchange rate
+func (h *ExchangeRateHandler) CreateRate(c *gin.Context) {
+	var req CreateExchangeRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	source := req.Source
+	if source == "" {
+		source = "api"
+	}
+
+	rate, err := newValidatedRate(req.BaseCurrency, req.QuoteCurrency, req.EffectiveDate, req.Rate, source)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid exchange rate",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := h.rateRepo.Upsert(rate); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to save exchange rate",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rate)
+}
+
+// DeleteRate handles deleting an exchange rate
+func (h *ExchangeRateHandler) DeleteRate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid exchange rate ID",
+			"message": "Exchange rate ID format is invalid",
+		})
+		return
+	}
+
+	if _, err := h.rateRepo.GetByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Exchange rate not found",
+			"message": "Exchange rate with the given ID does not exist",
+		})
+		return
+	}
+
+	if err := h.rateRepo.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to delete exchange rate",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ImportRates handles a CSV upload of exchange rates in the 'file' field.
+// The CSV needs a header with date, base, quote and rate columns and may
+// include a source column. The import is all-or-nothing.
+func (h *ExchangeRateHandler) ImportRates(c *gin.Context) {
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "No file provided",
+			"message": "Please provide a CSV file in the 'file' field",
+		})
+		return
+	}
+	defer file.Close()
+
+	rates, rowErrors, err := parseExchangeRateCSV(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid CSV",
+			"message": err.Error(),
+		})
+		return
+	}
+	if len(rowErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid rows",
+			"message": "No rates were imported because some rows are invalid",
+			"rows":    rowErrors,
+		})
+		return
+	}
+
+	if err := h.rateRepo.UpsertBatch(rates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Import failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ImportExchangeRatesResponse{Imported: len(rates)})
+}
+
+// parseExchangeRateCSV reads rates from CSV, returning per-row errors
+func parseExchangeRateCSV(r io.Reader) ([]*models.ExchangeRate, []string, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"date", "base", "quote", "rate"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, fmt.Errorf("missing required column: %s", required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rates []*models.ExchangeRate
+	var rowErrors []string
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, fmt.Sprintf("row %d: %v", row, err))
+			continue
+		}
+
+		value, err := strconv.ParseFloat(field(record, "rate"), 64)
+		if err != nil {
+			rowErrors = append(rowErrors, fmt.Sprintf("row %d: invalid rate %q", row, field(record, "rate")))
+			continue
+		}
+
+		source := field(record, "source")
+		if source == "" {
+			source = "csv"
+		}
+
+		rate, err := newValidatedRate(field(record, "base"), field(record, "quote"), field(record, "date"), value, source)
+		if err != nil {
+			rowErrors = append(rowErrors, fmt.Sprintf("row %d: %v", row, err))
+			continue
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rowErrors, nil
+}
+
+// newValidatedRate checks currency codes, date and rate before building a model
+func newValidatedRate(base, quote, date string, rate float64, source string) (*models.ExchangeRate, error) {
+	baseCurrency, ok := services.LookupCurrency(base)
+	if !ok {
+		return nil, fmt.Errorf("unsupported base currency: %s", base)
+	}
+	quoteCurrency, ok := services.LookupCurrency(quote)
+	if !ok {
+		return nil, fmt.Errorf("unsupported quote currency: %s", quote)
+	}
+	if baseCurrency.Code == quoteCurrency.Code {
+		return nil, fmt.Errorf("base and quote currency must differ")
+	}
+	if rate <= 0 {
+		return nil, fmt.Errorf("rate must be positive")
+	}
+
+	effectiveDate, err := time.Parse(tripDateLayout, date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+	}
+
+	return models.NewExchangeRate(baseCurrency.Code, quoteCurrency.Code, effectiveDate, rate, source), nil
+}
@@ -0,0 +1,490 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"tripflow/internal/models"
+	"tripflow/internal/repositories"
+	"tripflow/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ExpenseHandler handles the shared expense ledger of a schedule
+type ExpenseHandler struct {
+	scheduleRepo      repositories.ScheduleRepository
+	expenseRepo       repositories.ExpenseRepository
+	currencyConverter *services.CurrencyConverter
+}
+
+// NewExpenseHandler creates a new ExpenseHandler
+func NewExpenseHandler(scheduleRepo repositories.ScheduleRepository, expenseRepo repositories.ExpenseRepository, rateRepo repositories.ExchangeRateRepository) *ExpenseHandler {
+	return &ExpenseHandler{
+		scheduleRepo:      scheduleRepo,
+		expenseRepo:       expenseRepo,
+		currencyConverter: services.NewCurrencyConverter(rateRepo),
+	}
+}
+
+// ExpensePersonRequest identifies a payer or participant by JWT user ID or guest name
+type ExpensePersonRequest struct {
+	UserID    string `json:"user_id,omitempty"`
+	GuestName string `json:"guest_name,omitempty"`
+}
+
+// ExpenseParticipantRequest is a participant and their share. The share is
+// a weight for "shares", an amount for "exact", a percentage for "percent"
+// and ignored for "equal".
+type ExpenseParticipantRequest struct {
+	ExpensePersonRequest
+	Share float64 `json:"share,omitempty"`
+}
+
+// ExpenseRequest defines the request for creating or replacing an expense
+type ExpenseRequest struct {
+	Description  string                      `json:"description" binding:"required"`
+	Amount       string                      `json:"amount" binding:"required"` // e.g. "45,000원" or "12.50" with currency
+	Currency     string                      `json:"currency"`
+	Payer        *ExpensePersonRequest       `json:"payer,omitempty"` // Defaults to the current user
+	SplitRule    string                      `json:"split_rule"`      // equal, shares, exact or percent
+	SpentAt      string                      `json:"spent_at"`        // RFC 3339 or YYYY-MM-DD, defaults to now
+	Participants []ExpenseParticipantRequest `json:"participants" binding:"required"`
+}
+
+// ExpenseParticipantResponse is a participant with their computed part
+type ExpenseParticipantResponse struct {
+	UserID    string         `json:"user_id,omitempty"`
+	GuestName string         `json:"guest_name,omitempty"`
+	Share     int64          `json:"share"`
+	Owes      services.Money `json:"owes"`
+}
+
+// ExpenseResponse defines the response for expense operations
+type ExpenseResponse struct {
+	ID             string                       `json:"id"`
+	ScheduleID     string                       `json:"schedule_id"`
+	CreatedBy      string                       `json:"created_by"`
+	Description    string                       `json:"description"`
+	Amount         services.Money               `json:"amount"`
+	PayerUserID    string                       `json:"payer_user_id,omitempty"`
+	PayerGuestName string                       `json:"payer_guest_name,omitempty"`
+	SplitRule      string                       `json:"split_rule"`
+	SpentAt        time.Time                    `json:"spent_at"`
+	Participants   []ExpenseParticipantResponse `json:"participants"`
+	CreatedAt      time.Time                    `json:"created_at"`
+	UpdatedAt      time.Time                    `json:"updated_at"`
+}
+
+// SettleUpResponse defines the response for the settle-up calculation
+type SettleUpResponse struct {
+	ScheduleID  string                  `json:"schedule_id"`
+	Currency    string                  `json:"currency,omitempty"` // Set when everything was converted into one currency
+	Settlements []services.Settlement   `json:"settlements"`
+	Issues      []services.ExpenseIssue `json:"issues,omitempty"`
+}
+
+// ListExpenses handles listing all expenses of a schedule
+func (h *ExpenseHandler) ListExpenses(c *gin.Context) {
+	schedule, _, ok := h.loadLedgerSchedule(c, false)
+	if !ok {
+		return
+	}
+
+	expenses, err := h.expenseRepo.ListBySchedule(schedule.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve expenses",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	response := make([]ExpenseResponse, len(expenses))
+	for i, expense := range expenses {
+		response[i] = expenseToResponse(expense)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"expenses": response,
+		"total":    len(response),
+	})
+}
+
+// GetExpense handles retrieving a single expense
+func (h *ExpenseHandler) GetExpense(c *gin.Context) {
+	schedule, _, ok := h.loadLedgerSchedule(c, false)
+	if !ok {
+		return
+	}
+
+	expense, ok := h.loadExpense(c, schedule)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, expenseToResponse(expense))
+}
+
+// CreateExpense handles adding an expense to a schedule's ledger
+func (h *ExpenseHandler) CreateExpense(c *gin.Context) {
+	schedule, userID, ok := h.loadLedgerSchedule(c, true)
+	if !ok {
+		return
+	}
+
+	var req ExpenseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	expense := &models.Expense{
+		ID:         uuid.New(),
+		ScheduleID: schedule.ID,
+		CreatedBy:  userID,
+	}
+	if err := applyExpenseRequest(expense, &req, userID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid expense",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := h.expenseRepo.Create(expense); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create expense",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, expenseToResponse(expense))
+}
+
+// UpdateExpense handles replacing an expense
+func (h *ExpenseHandler) UpdateExpense(c *gin.Context) {
+	schedule, userID, ok := h.loadLedgerSchedule(c, true)
+	if !ok {
+		return
+	}
+
+	expense, ok := h.loadExpense(c, schedule)
+	if !ok {
+		return
+	}
+
+	if !canModifyExpense(schedule, expense, userID) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Access denied",
+			"message": "Only the schedule owner or the expense creator can change an expense",
+		})
+		return
+	}
+
+	var req ExpenseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := applyExpenseRequest(expense, &req, userID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid expense",
+			"message": err.Error(),
+		})
+		return
+	}
+	expense.UpdatedAt = time.Now()
+
+	if err := h.expenseRepo.Update(expense); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to update expense",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, expenseToResponse(expense))
+}
+
+// DeleteExpense handles removing an expense
+func (h *ExpenseHandler) DeleteExpense(c *gin.Context) {
+	schedule, userID, ok := h.loadLedgerSchedule(c, true)
+	if !ok {
+		return
+	}
+
+	expense, ok := h.loadExpense(c, schedule)
+	if !ok {
+		return
+	}
+
+	if !canModifyExpense(schedule, expense, userID) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Access denied",
+			"message": "Only the schedule owner or the expense creator can delete an expense",
+		})
+		return
+	}
+
+	if err := h.expenseRepo.Delete(expense.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to delete expense",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// SettleUp handles computing the transfers that balance the ledger.
+// Pass ?currency=XXX to convert everything into one currency, or
+// ?currency=home to use the schedule's home currency.
+func (h *ExpenseHandler) SettleUp(c *gin.Context) {
+	schedule, _, ok := h.loadLedgerSchedule(c, false)
+	if !ok {
+		return
+	}
+
+	currency := strings.TrimSpace(c.Query("currency"))
+	if strings.EqualFold(currency, "home") {
+		currency = schedule.HomeCurrency
+	}
+	if currency != "" {
+		target, ok := services.LookupCurrency(currency)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid currency",
+				"message": "Unsupported currency: " + currency,
+			})
+			return
+		}
+		currency = target.Code
+	}
+
+	expenses, err := h.expenseRepo.ListBySchedule(schedule.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve expenses",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	settlements, issues := services.SettleUp(expenses, h.currencyConverter, currency)
+	c.JSON(http.StatusOK, SettleUpResponse{
+		ScheduleID:  schedule.ID.String(),
+		Currency:    currency,
+		Settlements: settlements,
+		Issues:      issues,
+	})
+}
+
+// loadLedgerSchedule loads the schedule from the :id parameter and checks
+// that the current user may use its ledger. The owner and the people the
+// owner added to the ledger may change it; any signed-in user may read the
+// ledger of a public schedule.
+func (h *ExpenseHandler) loadLedgerSchedule(c *gin.Context, write bool) (*models.Schedule, uuid.UUID, bool) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return nil, uuid.Nil, false
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid schedule ID",
+			"message": "Schedule ID format is invalid",
+		})
+		return nil, uuid.Nil, false
+	}
+
+	schedule, err := h.scheduleRepo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Schedule not found",
+			"message": "Schedule with the given ID does not exist",
+		})
+		return nil, uuid.Nil, false
+	}
+
+	if schedule.IsOwnedBy(userID) {
+		return schedule, userID, true
+	}
+
+	member, err := h.expenseRepo.IsMember(schedule.ID, userID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to check access",
+			"message": err.Error(),
+		})
+		return nil, uuid.Nil, false
+	}
+	if !member && (write || !schedule.IsPublic) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Access denied",
+			"message": "You are not a member of this schedule's expense ledger",
+		})
+		return nil, uuid.Nil, false
+	}
+
+	return schedule, userID, true
+}
+
+// loadExpense loads the expense from the :expenseId parameter and checks
+// that it belongs to the schedule
+func (h *ExpenseHandler) loadExpense(c *gin.Context, schedule *models.Schedule) (*models.Expense, bool) {
+	id, err := uuid.Parse(c.Param("expenseId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid expense ID",
+			"message": "Expense ID format is invalid",
+		})
+		return nil, false
+	}
+
+	expense, err := h.expenseRepo.GetByID(id)
+	if err != nil || expense.ScheduleID != schedule.ID {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Expense not found",
+			"message": "Expense with the given ID does not exist",
+		})
+		return nil, false
+	}
+
+	return expense, true
+}
+
+// canModifyExpense reports whether a user may change or delete an expense
+func canModifyExpense(schedule *models.Schedule, expense *models.Expense, userID uuid.UUID) bool {
+	return schedule.IsOwnedBy(userID) || expense.CreatedBy == userID
+}
+
+// applyExpenseRequest validates a request and copies it onto the expense
+func applyExpenseRequest(expense *models.Expense, req *ExpenseRequest, userID uuid.UUID) error {
+	amount, err := parseExpenseAmount(req.Amount, req.Currency)
+	if err != nil {
+		return err
+	}
+
+	splitRule := strings.ToLower(strings.TrimSpace(req.SplitRule))
+	if splitRule == "" {
+		splitRule = models.SplitEqual
+	}
+
+	spentAt := time.Now()
+	if req.SpentAt != "" {
+		if spentAt, err = time.Parse(time.RFC3339, req.SpentAt); err != nil {
+			if spentAt, err = time.Parse(tripDateLayout, req.SpentAt); err != nil {
+				return fmt.Errorf("invalid spent_at %q, expected RFC 3339 or YYYY-MM-DD", req.SpentAt)
+			}
+		}
+	}
+
+	expense.Description = strings.TrimSpace(req.Description)
+	expense.Amount = amount.Amount
+	expense.Currency = amount.Currency
+	expense.SplitRule = splitRule
+	expense.SpentAt = spentAt
+
+	expense.PayerUserID, expense.PayerGuestName = userID.String(), ""
+	if req.Payer != nil {
+		expense.PayerUserID, expense.PayerGuestName = personIdentity(*req.Payer)
+	}
+
+	currency, _ := services.LookupCurrency(amount.Currency)
+	expense.Participants = make([]models.ExpenseParticipant, 0, len(req.Participants))
+	for _, p := range req.Participants {
+		participantUserID, guestName := personIdentity(p.ExpensePersonRequest)
+
+		var share int64
+		switch splitRule {
+		case models.SplitShares:
+			if p.Share != math.Trunc(p.Share) {
+				return fmt.Errorf("shares must be whole numbers")
+			}
+			share = int64(p.Share)
+		case models.SplitExact:
+			share = int64(math.Round(p.Share * math.Pow10(currency.Exponent)))
+		case models.SplitPercent:
+			share = int64(math.Round(p.Share * 100))
+		}
+
+		expense.Participants = append(expense.Participants, models.ExpenseParticipant{
+			ExpenseID: expense.ID,
+			UserID:    participantUserID,
+			GuestName: guestName,
+			Share:     share,
+		})
+	}
+
+	return services.ValidateExpense(expense)
+}
+
+// parseExpenseAmount parses a written amount, using currency when the
+// amount itself does not name one
+func parseExpenseAmount(amount, currency string) (services.Money, error) {
+	money, err := services.ParseAmount(amount)
+	if err == nil {
+		if currency != "" && !strings.EqualFold(currency, money.Currency) {
+			return services.Money{}, fmt.Errorf("amount is in %s but currency is %s", money.Currency, currency)
+		}
+		return money, nil
+	}
+	if currency == "" {
+		return services.Money{}, err
+	}
+	return services.ParseAmount(amount + " " + strings.ToUpper(currency))
+}
+
+// personIdentity normalizes a payer or participant: user IDs are mapped to
+// the same UUIDs used for schedule ownership, guests keep their name
+func personIdentity(person ExpensePersonRequest) (string, string) {
+	if person.UserID != "" {
+		return userIDToUUID(person.UserID).String(), ""
+	}
+	return "", strings.TrimSpace(person.GuestName)
+}
+
+// expenseToResponse converts an expense model to response format
+func expenseToResponse(expense *models.Expense) ExpenseResponse {
+	parts := services.SplitExpense(expense, expense.Amount)
+
+	participants := make([]ExpenseParticipantResponse, len(expense.Participants))
+	for i, p := range expense.Participants {
+		participants[i] = ExpenseParticipantResponse{
+			UserID:    p.UserID,
+			GuestName: p.GuestName,
+			Share:     p.Share,
+			Owes:      services.Money{Amount: parts[i], Currency: expense.Currency},
+		}
+	}
+
+	return ExpenseResponse{
+		ID:             expense.ID.String(),
+		ScheduleID:     expense.ScheduleID.String(),
+		CreatedBy:      expense.CreatedBy.String(),
+		Description:    expense.Description,
+		Amount:         services.Money{Amount: expense.Amount, Currency: expense.Currency},
+		PayerUserID:    expense.PayerUserID,
+		PayerGuestName: expense.PayerGuestName,
+		SplitRule:      expense.SplitRule,
+		SpentAt:        expense.SpentAt,
+		Participants:   participants,
+		CreatedAt:      expense.CreatedAt,
+		UpdatedAt:      expense.UpdatedAt,
+	}
+}
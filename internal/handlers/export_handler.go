@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"tripflow/internal/middleware"
+	"tripflow/internal/models"
+	"tripflow/internal/repositories"
+	"tripflow/internal/services"
+	"tripflow/pkg/filestorage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ExportHandler handles downloading schedules in offline formats
+type ExportHandler struct {
+	scheduleRepo      repositories.ScheduleRepository
+	markdownService   *services.MarkdownService
+	currencyConverter *services.CurrencyConverter
+	pdfExporter       *services.PDFExporter
+	siteExporter      *services.SiteExporter
+	epubExporter      *services.EPUBExporter
+
+	// baseURL is the origin exports link back to; empty uses the origin
+	// the request was made to
+	baseURL string
+}
+
+// NewExportHandler creates a new ExportHandler
+func NewExportHandler(scheduleRepo repositories.ScheduleRepository, rateRepo repositories.ExchangeRateRepository, fileRepo repositories.FileRepository, fileStorage filestorage.FileStorageService) *ExportHandler {
+	imageResolver := services.NewImageResolver(fileRepo, fileStorage)
+	return &ExportHandler{
+		scheduleRepo:      scheduleRepo,
+		markdownService:   services.NewMarkdownService(fileStorage),
+		currencyConverter: services.NewCurrencyConverter(rateRepo),
+		pdfExporter:       services.NewPDFExporter(fileStorage, imageResolver),
+		siteExporter:      services.NewSiteExporter(fileStorage, imageResolver),
+		epubExporter:      services.NewEPUBExporter(fileStorage, imageResolver),
+		baseURL:           publicBaseURL(),
+	}
+}
+
+// ExportPDF handles downloading a schedule as a printable PDF
+func (h *ExportHandler) ExportPDF(c *gin.Context) {
+	export, ok := h.loadExport(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.pdfExporter.Export(&buf, export); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrPDFFontUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{
+			"error":   "Export failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", attachmentDisposition(export.Title, ".pdf"))
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+// ExportZip handles downloading a schedule as a static site that can be
+// opened from disk
+func (h *ExportHandler) ExportZip(c *gin.Context) {
+	export, ok := h.loadExport(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.siteExporter.Export(&buf, export, h.origin(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Export failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", attachmentDisposition(export.Title, ".zip"))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// ExportEPUB handles downloading a schedule as an EPUB book for e-readers
+func (h *ExportHandler) ExportEPUB(c *gin.Context) {
+	export, ok := h.loadExport(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.epubExporter.Export(&buf, export, h.origin(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Export failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", attachmentDisposition(export.Title, ".epub"))
+	c.Data(http.StatusOK, "application/epub+zip", buf.Bytes())
+}
+
+// loadExport loads a schedule the requester may view and prepares it for
+// export, or writes an error response and returns false
+func (h *ExportHandler) loadExport(c *gin.Context) (*services.ScheduleExport, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid schedule ID",
+			"message": "Schedule ID format is invalid",
+		})
+		return nil, false
+	}
+
+	schedule, err := h.scheduleRepo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Schedule not found",
+			"message": "Schedule with the given ID does not exist",
+		})
+		return nil, false
+	}
+
+	if !canViewSchedule(c, schedule) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Access denied",
+			"message": "Schedule is not public and you are not the owner",
+		})
+		return nil, false
+	}
+
+	markdown, err := readScheduleMarkdown(h.markdownService, schedule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to read schedule",
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+
+	export := &services.ScheduleExport{
+		ID:           schedule.ID,
+		Title:        schedule.Title,
+		Description:  schedule.Description,
+		Markdown:     markdown,
+		StartDate:    schedule.StartDate,
+		EndDate:      schedule.EndDate,
+		HomeCurrency: schedule.HomeCurrency,
+		UpdatedAt:    schedule.UpdatedAt,
+		Budget:       services.ExtractBudget(markdown),
+	}
+	author := authorOptions(schedule.File)
+	export.ImageOwnerID = author.ImageOwnerID
+	export.AuthorRole = author.AuthorRole
+	if export.Budget != nil {
+		export.Budget.Converted = h.currencyConverter.ConvertBudget(export.Budget, schedule.HomeCurrency, schedule.StartDate)
+	}
+
+	return export, true
+}
+
+// canViewSchedule reports whether the requester may view a schedule: anyone
+// for public schedules, only the owner otherwise
+func canViewSchedule(c *gin.Context, schedule *models.Schedule) bool {
+	if schedule.IsPublic {
+		return true
+	}
+	userIDStr, exists := middleware.GetUserIDFromContext(c)
+	return exists && userIDToUUID(userIDStr) == schedule.UserID
+}
+
+// origin returns the origin exported links are resolved against: the
+// configured PUBLIC_BASE_URL or, without one, the scheme and host the
+// request reached this server with. Forwarded headers are not trusted, as
+// any client could point the links at another host with them.
+func (h *ExportHandler) origin(c *gin.Context) string {
+	if h.baseURL != "" {
+		return h.baseURL
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// publicBaseURL reads PUBLIC_BASE_URL, the origin the API is served at such
+// as "https://tripflow.example.com". An invalid value is ignored.
+func publicBaseURL() string {
+	value := strings.TrimSpace(os.Getenv("PUBLIC_BASE_URL"))
+	if value == "" {
+		return ""
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		log.Printf("Invalid PUBLIC_BASE_URL %q, using the request's host", value)
+		return ""
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// attachmentDisposition returns a Content-Disposition header that downloads
+// a file named after title. Non-ASCII titles are sent RFC 2231 encoded.
+func attachmentDisposition(title, extension string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if name == "" {
+		name = "schedule"
+	}
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name + extension})
+}
@@ -1,35 +1,76 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"tripflow/internal/middleware"
 	"tripflow/internal/models"
+	"tripflow/internal/repositories"
 	"tripflow/internal/services"
 	"tripflow/pkg/filestorage"
+	"tripflow/pkg/imageproc"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// maxUploadSize is the largest file accepted by single-request and
+// resumable uploads: MAX_UPLOAD_SIZE_MB, or 10MB when unset
+var maxUploadSize = uploadSizeFromEnv()
+
+// uploadSizeFromEnv reads MAX_UPLOAD_SIZE_MB
+func uploadSizeFromEnv() int64 {
+	if mb, err := strconv.ParseInt(os.Getenv("MAX_UPLOAD_SIZE_MB"), 10, 64); err == nil && mb > 0 {
+		return mb << 20
+	}
+	return 10 << 20
+}
+
+// Cache-Control values for downloads. Files of public schedules may be
+// kept by shared caches for a day; other files are only cached by the
+// browser and revalidated with their ETag on every use.
+const (
+	publicFileCacheControl  = "public, max-age=86400"
+	privateFileCacheControl = "private, no-cache"
+)
+
 // FileHandler handles file-related requests
 type FileHandler struct {
 	fileStorage     filestorage.FileStorageService
 	db              *gorm.DB
+	fileRepo        repositories.FileRepository
 	markdownService *services.MarkdownService
+	imageService    *services.ImageService
+	fileAccess      *services.FileAccess
+	quotas          *services.QuotaService
+	signer          *services.FileURLSigner
 }
 
 // NewFileHandler creates a new FileHandler
-func NewFileHandler(fileStorage filestorage.FileStorageService, db *gorm.DB) *FileHandler {
+func NewFileHandler(fileStorage filestorage.FileStorageService, db *gorm.DB, quotas *services.QuotaService, signer *services.FileURLSigner) *FileHandler {
+	fileRepo := repositories.NewFileRepository(db)
 	markdownService := services.NewMarkdownService(fileStorage)
+	imageResolver := services.NewImageResolver(fileRepo, fileStorage)
+	imageResolver.SetURLSigner(signer)
+	markdownService.SetImageResolver(imageResolver)
 	return &FileHandler{
 		fileStorage:     fileStorage,
 		db:              db,
+		fileRepo:        fileRepo,
 		markdownService: markdownService,
+		imageService:    services.NewImageService(fileStorage),
+		fileAccess:      services.NewFileAccess(fileRepo, repositories.NewScheduleRepository(db), markdownService),
+		quotas:          quotas,
+		signer:          signer,
 	}
 }
 
@@ -45,6 +86,21 @@ type UploadFileResponse struct {
 	Filename string `json:"filename"`
 	Size     int64  `json:"size"`
 	MimeType string `json:"mime_type"`
+
+	// Set for image uploads
+	Width    int                    `json:"width,omitempty"`
+	Height   int                    `json:"height,omitempty"`
+	Variants []ImageVariantResponse `json:"variants,omitempty"`
+}
+
+// ImageVariantResponse describes a resized copy of an uploaded image
+type ImageVariantResponse struct {
+	Label    string `json:"label"`
+	FilePath string `json:"file_path"`
+	URL      string `json:"url"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Size     int64  `json:"size"`
 }
 
 // UploadFile handles file upload requests
@@ -60,91 +116,248 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 	}
 	defer file.Close()
 
-	// Validate file size (10MB limit)
-	const maxFileSize = 10 * 1024 * 1024 // 10MB
-	if header.Size > maxFileSize {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "File too large",
-			"message": "File size must be less than 10MB",
-		})
+	// Validate file size
+	if header.Size > maxUploadSize {
+		tooLargeError().respond(c)
 		return
 	}
 
-	// Validate file type (only markdown files for now)
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	if ext != ".md" && ext != ".markdown" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid file type",
-			"message": "Only markdown files (.md, .markdown) are allowed",
-		})
+	response, uploadErr := h.storeUpload(c, file, header.Filename, header.Header.Get("Content-Type"), header.Size)
+	if uploadErr != nil {
+		uploadErr.respond(c)
 		return
 	}
+	c.JSON(http.StatusOK, response)
+}
+
+// uploadError is a failed upload and the response describing it
+type uploadError struct {
+	status  int
+	title   string
+	message string
+}
+
+func (e *uploadError) Error() string {
+	return e.title + ": " + e.message
+}
+
+// respond writes the error response
+func (e *uploadError) respond(c *gin.Context) {
+	c.JSON(e.status, gin.H{
+		"error":   e.title,
+		"message": e.message,
+	})
+}
+
+// quotaError is the error for uploads over the uploader's storage quota
+func quotaError(err error) *uploadError {
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		return &uploadError{http.StatusRequestEntityTooLarge, "Storage quota exceeded", err.Error()}
+	}
+	return &uploadError{http.StatusInternalServerError, "Upload failed", "Failed to check storage quota: " + err.Error()}
+}
+
+// tooLargeError is the error for uploads over maxUploadSize
+func tooLargeError() *uploadError {
+	return &uploadError{http.StatusBadRequest, "File too large", fmt.Sprintf("File size must be less than %dMB", maxUploadSize>>20)}
+}
+
+// checkUploadFilename rejects files that are neither markdown nor images
+func checkUploadFilename(filename string) *uploadError {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext != ".md" && ext != ".markdown" && !services.IsImageFilename(filename) {
+		return &uploadError{http.StatusBadRequest, "Invalid file type", "Only markdown files (.md, .markdown) and images (.jpg, .jpeg, .png, .gif) are allowed"}
+	}
+	return nil
+}
+
+// storeUpload validates an uploaded file of size bytes, stores it and
+// records it in the database. It is shared by single-request and resumable
+// uploads.
+func (h *FileHandler) storeUpload(c *gin.Context, file io.ReadSeeker, filename, contentType string, size int64) (*UploadFileResponse, *uploadError) {
+	// Validate file type (markdown or images)
+	if err := checkUploadFilename(filename); err != nil {
+		return nil, err
+	}
+
+	// Images are validated, stripped of metadata and resized separately
+	if services.IsImageFilename(filename) {
+		return h.uploadImage(c, file, filename, size)
+	}
+
+	// Hold the space in the uploader's quota before anything is stored;
+	// once the record exists it counts towards their usage instead
+	release, err := h.quotas.Reserve(uploaderID(c), uploaderRole(c), size)
+	if err != nil {
+		return nil, quotaError(err)
+	}
+	defer release()
+
+	// Sniff the content so binaries cannot be uploaded under a .md name
+	sniff := make([]byte, 512)
+	n, _ := io.ReadFull(file, sniff)
+	if !strings.HasPrefix(http.DetectContentType(sniff[:n]), "text/") {
+		return nil, &uploadError{http.StatusBadRequest, "Invalid file type", "Markdown files must contain text"}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, &uploadError{http.StatusInternalServerError, "Upload failed", "Failed to read file: " + err.Error()}
+	}
 
 	// Upload the file
-	filePath, err := h.fileStorage.UploadFile(file, header.Filename, header.Header.Get("Content-Type"))
+	filePath, err := h.fileStorage.UploadFile(file, filename, contentType)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Upload failed",
-			"message": "Failed to upload file: " + err.Error(),
-		})
-		return
+		return nil, &uploadError{http.StatusInternalServerError, "Upload failed", "Failed to upload file: " + err.Error()}
 	}
 
 	// Get file info
 	fileInfo, err := h.fileStorage.GetFileInfo(filePath)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "File info failed",
-			"message": "Failed to get file information: " + err.Error(),
-		})
-		return
+		return nil, &uploadError{http.StatusInternalServerError, "File info failed", "Failed to get file information: " + err.Error()}
 	}
 
 	// Generate a unique file ID
 	fileID := uuid.New()
-	
-	// Get schedule_id from form data (optional) - for future use
-	// scheduleIDStr := c.PostForm("schedule_id")
-	// var scheduleID *uuid.UUID
-	// if scheduleIDStr != "" {
-	// 	if parsedID, err := uuid.Parse(scheduleIDStr); err == nil {
-	// 		scheduleID = &parsedID
-	// 	}
-	// }
 
 	// Create file record in database
 	fileRecord := models.File{
-		ID:         fileID,
-		UserID:     uuid.New(), // For MVP, generate a random user ID
-		Filename:   header.Filename,
-		FilePath:   filePath,
-		FileSize:   fileInfo.Size,
-		MimeType:   fileInfo.MimeType,
-		UploadDate: time.Now(),
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+		ID:           fileID,
+		UserID:       uploaderID(c),
+		Filename:     filename,
+		FilePath:     filePath,
+		FileSize:     fileInfo.Size,
+		MimeType:     fileInfo.MimeType,
+		UploaderRole: uploaderRole(c),
+		Checksum:     fileInfo.Checksum,
+		UploadDate:   time.Now(),
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
 	}
 
 	// Save to database
 	if err := h.db.Create(&fileRecord).Error; err != nil {
 		// If database save fails, clean up the uploaded file
 		h.fileStorage.DeleteFile(filePath)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Database save failed",
-			"message": "Failed to save file metadata: " + err.Error(),
-		})
-		return
+		return nil, &uploadError{http.StatusInternalServerError, "Database save failed", "Failed to save file metadata: " + err.Error()}
 	}
 
-	response := UploadFileResponse{
+	return &UploadFileResponse{
 		FileID:   fileID.String(),
 		FilePath: filePath,
-		Filename: header.Filename,
+		Filename: filename,
 		Size:     fileInfo.Size,
 		MimeType: fileInfo.MimeType,
+	}, nil
+}
+
+// uploadImage stores an uploaded image of size bytes with its thumbnail and
+// variants
+func (h *FileHandler) uploadImage(c *gin.Context, file io.Reader, filename string, size int64) (*UploadFileResponse, *uploadError) {
+	// Turn away uploaders already over their quota before decoding anything
+	if err := h.quotas.Check(uploaderID(c), uploaderRole(c), size); err != nil {
+		return nil, quotaError(err)
 	}
 
-	c.JSON(http.StatusOK, response)
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadSize+1))
+	if err != nil {
+		return nil, &uploadError{http.StatusInternalServerError, "Upload failed", "Failed to read file: " + err.Error()}
+	}
+	if int64(len(data)) > maxUploadSize {
+		return nil, tooLargeError()
+	}
+
+	prepared, err := h.imageService.PrepareImage(data, filename)
+	if err != nil {
+		if errors.Is(err, imageproc.ErrUnsupportedFormat) || errors.Is(err, imageproc.ErrTooLarge) {
+			return nil, &uploadError{http.StatusBadRequest, "Invalid image", err.Error()}
+		}
+		return nil, &uploadError{http.StatusInternalServerError, "Upload failed", "Failed to process image: " + err.Error()}
+	}
+
+	// The re-encoded image and every variant count towards the quota, so
+	// their total is held rather than the size of the upload
+	release, err := h.quotas.Reserve(uploaderID(c), uploaderRole(c), prepared.Size())
+	if err != nil {
+		return nil, quotaError(err)
+	}
+	defer release()
+
+	stored, err := h.imageService.StoreImage(prepared)
+	if err != nil {
+		return nil, &uploadError{http.StatusInternalServerError, "Upload failed", "Failed to upload image: " + err.Error()}
+	}
+
+	fileRecord := &models.File{
+		ID:           uuid.New(),
+		UserID:       uploaderID(c),
+		Filename:     filename,
+		FilePath:     stored.FilePath,
+		FileSize:     stored.FileSize,
+		MimeType:     stored.MimeType,
+		Width:        stored.Width,
+		Height:       stored.Height,
+		UploaderRole: uploaderRole(c),
+		Checksum:     stored.Checksum,
+		UploadDate:   time.Now(),
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	if err := h.fileRepo.CreateWithVariants(fileRecord, stored.Variants); err != nil {
+		// If database save fails, clean up the uploaded files
+		h.imageService.DeleteStoredImage(stored)
+		return nil, &uploadError{http.StatusInternalServerError, "Database save failed", "Failed to save file metadata: " + err.Error()}
+	}
+
+	response := &UploadFileResponse{
+		FileID:   fileRecord.ID.String(),
+		FilePath: stored.FilePath,
+		Filename: filename,
+		Size:     stored.FileSize,
+		MimeType: stored.MimeType,
+		Width:    stored.Width,
+		Height:   stored.Height,
+		Variants: make([]ImageVariantResponse, len(stored.Variants)),
+	}
+	for i, variant := range stored.Variants {
+		response.Variants[i] = ImageVariantResponse{
+			Label:    variant.Label,
+			FilePath: variant.FilePath,
+			URL:      services.FileURL(variant.FilePath),
+			Width:    variant.Width,
+			Height:   variant.Height,
+			Size:     variant.FileSize,
+		}
+	}
+	return response, nil
+}
+
+// uploaderID returns the signed-in uploader, who owns the upload and whose
+// markdown can refer to their images by filename. Upload routes require
+// authentication.
+func uploaderID(c *gin.Context) uuid.UUID {
+	userIDStr, _ := middleware.GetUserIDFromContext(c)
+	return userIDToUUID(userIDStr)
+}
+
+// uploaderRole returns the signed-in uploader's role; it selects their
+// quota and the sanitization policy their files are rendered with
+func uploaderRole(c *gin.Context) string {
+	role, _ := middleware.GetUserRoleFromContext(c)
+	return role
+}
+
+// authorOptions returns the processing options that depend on who wrote a
+// schedule's markdown: images are looked up among the uploads of whoever
+// uploaded its file, and their role picks the sanitization policy. Every
+// place that renders a schedule uses it, so they all render it alike.
+func authorOptions(file *models.File) services.ProcessOptions {
+	if file == nil {
+		return services.ProcessOptions{}
+	}
+	return services.ProcessOptions{
+		ImageOwnerID: file.UserID,
+		AuthorRole:   file.UploaderRole,
+	}
 }
 
 // ProcessMarkdownRequest defines the request for markdown processing
@@ -154,9 +367,15 @@ type ProcessMarkdownRequest struct {
 
 // ProcessMarkdownResponse defines the response for markdown processing
 type ProcessMarkdownResponse struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	HTMLContent string `json:"html_content"`
+	Title       string                  `json:"title"`
+	Description string                  `json:"description"`
+	HTMLContent string                  `json:"html_content"`
+	Budget      *services.BudgetSummary `json:"budget,omitempty"`
+	Lint        *services.LintReport    `json:"lint,omitempty"`
+	TOC         []*services.TOCEntry    `json:"toc,omitempty"`
+
+	Directives []*services.TripDirective   `json:"directives,omitempty"`
+	Warnings   []services.ProcessingWarning `json:"warnings,omitempty"`
 }
 
 // ProcessMarkdown processes a markdown file and returns the processed content
@@ -180,8 +399,21 @@ func (h *FileHandler) ProcessMarkdown(c *gin.Context) {
 		return
 	}
 
-	// Process markdown file
-	processedContent, err := h.markdownService.ProcessMarkdownFromFile(file.FilePath)
+	// Private files are only rendered for the people who may read them
+	public, ok := h.authorizeFile(c, file.FilePath)
+	if !ok {
+		return
+	}
+
+	// Process markdown file; ?lint=true adds a validation report and
+	// ?toc=true inserts a table of contents into the HTML
+	opts := authorOptions(&file)
+	opts.Lint = c.Query("lint") == "true"
+	opts.TOC = c.Query("toc") == "true"
+	// Browsers load images without the Authorization header, so the images
+	// of private markdown need signed URLs
+	opts.SignImageURLs = !public
+	processedContent, err := h.markdownService.ProcessMarkdownFromFileWithOptions(file.FilePath, &opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Processing failed",
@@ -194,6 +426,11 @@ func (h *FileHandler) ProcessMarkdown(c *gin.Context) {
 		Title:       processedContent.Title,
 		Description: processedContent.Description,
 		HTMLContent: processedContent.HTMLContent,
+		Budget:      processedContent.Budget,
+		Lint:        processedContent.Lint,
+		TOC:         processedContent.TOC,
+		Directives:  processedContent.Directives,
+		Warnings:    processedContent.Warnings,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -215,10 +452,24 @@ func (h *FileHandler) GetFile(c *gin.Context) {
 		filePath = filePath[1:]
 	}
 
-	// Get the file
-	fileReader, err := h.fileStorage.GetFile(filePath)
+	// /api/file/<path>/info is the route GetFileInfo had before paths
+	// could contain slashes; stored file names never end in /info
+	if infoPath, ok := strings.CutSuffix(filePath, "/info"); ok {
+		h.writeFileInfo(c, infoPath)
+		return
+	}
+
+	// Checked before the file is looked up, so private paths do not
+	// reveal whether a file exists
+	public, ok := h.authorizeFile(c, filePath)
+	if !ok {
+		return
+	}
+
+	storage := filestorage.AdaptV1(h.fileStorage)
+	fileInfo, err := storage.Stat(c.Request.Context(), filePath)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, filestorage.ErrNotFound) || strings.Contains(err.Error(), "not found") {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error":   "File not found",
 				"message": "The requested file does not exist",
@@ -231,23 +482,136 @@ func (h *FileHandler) GetFile(c *gin.Context) {
 		}
 		return
 	}
-	defer func() {
-		if closer, ok := fileReader.(io.Closer); ok {
-			closer.Close()
+
+	if public {
+		c.Header("Cache-Control", publicFileCacheControl)
+	} else {
+		c.Header("Cache-Control", privateFileCacheControl)
+	}
+	c.Header("Content-Type", fileInfo.MimeType)
+	if etag := fileETag(fileInfo); etag != "" {
+		c.Header("ETag", etag)
+	}
+
+	// ServeContent answers conditional and range requests with 304, 206
+	// and 416; the content is only read from storage when it is sent
+	content := filestorage.NewReadSeeker(c.Request.Context(), storage, filePath, fileInfo.Size)
+	defer content.Close()
+	http.ServeContent(c.Writer, c.Request, "", fileInfo.ModTime, content)
+}
+
+// authorizeFile checks that the request may read the file stored at
+// filePath and responds when it may not. Files of public schedules can be
+// read by anyone; other files by their owner, admins, and requests with a
+// valid signed URL. public reports whether the file belongs to a public
+// schedule.
+func (h *FileHandler) authorizeFile(c *gin.Context, filePath string) (public bool, ok bool) {
+	if services.IsSigned(c.Request.URL.Query()) {
+		err := h.signer.Verify(filePath, c.Request.URL.Query(), c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Access denied",
+				"message": err.Error(),
+			})
+			return false, false
 		}
-	}()
+		return false, true
+	}
 
-	// Get file info for content type
-	fileInfo, err := h.fileStorage.GetFileInfo(filePath)
+	public, err := h.fileAccess.IsPublic(filePath)
 	if err != nil {
-		// If we can't get file info, use default content type
-		c.Header("Content-Type", "application/octet-stream")
-	} else {
-		c.Header("Content-Type", fileInfo.MimeType)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "File retrieval failed",
+			"message": "Failed to check file access: " + err.Error(),
+		})
+		return false, false
+	}
+	if public {
+		return true, true
+	}
+
+	if role, _ := middleware.GetUserRoleFromContext(c); role == "admin" {
+		return false, true
+	}
+	if userIDStr, exists := middleware.GetUserIDFromContext(c); exists {
+		owned, err := h.fileRepo.IsOwnedBy(filePath, userIDToUUID(userIDStr))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "File retrieval failed",
+				"message": "Failed to check file access: " + err.Error(),
+			})
+			return false, false
+		}
+		if owned {
+			return false, true
+		}
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "Access denied",
+		"message": "File is not public and you are not the owner",
+	})
+	return false, false
+}
+
+// SignFileURLRequest defines the request for a signed file URL
+type SignFileURLRequest struct {
+	FilePath  string `json:"file_path" binding:"required"`
+	ExpiresIn int64  `json:"expires_in"` // Seconds; 0 uses the default lifetime
+	BindIP    bool   `json:"bind_ip"`    // Only valid from the requesting IP
+}
+
+// SignFileURL handles requests for a signed, expiring URL to a file the
+// user may read, for embedding where credentials cannot be sent
+func (h *FileHandler) SignFileURL(c *gin.Context) {
+	var req SignFileURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+	filePath := strings.TrimPrefix(req.FilePath, "/")
+	if req.ExpiresIn < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": "expires_in must not be negative",
+		})
+		return
+	}
+
+	if _, ok := h.authorizeFile(c, filePath); !ok {
+		return
+	}
+
+	clientIP := ""
+	if req.BindIP {
+		clientIP = c.ClientIP()
+	}
+	signed, err := h.signer.Sign(filePath, time.Duration(req.ExpiresIn)*time.Second, clientIP)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
 	}
 
-	// Stream the file content
-	io.Copy(c.Writer, fileReader)
+	c.JSON(http.StatusOK, signed)
+}
+
+// fileETag returns a strong ETag from the file's checksum, or a weak one
+// from its size and modification time when the storage has no checksum.
+// It returns "" when the storage reports neither.
+func fileETag(info *filestorage.FileInfo) string {
+	switch {
+	case info.Checksum != "":
+		return `"` + info.Checksum + `"`
+	case !info.ModTime.IsZero():
+		return fmt.Sprintf(`W/"%x-%x"`, info.Size, info.ModTime.UnixNano())
+	}
+	return ""
 }
 
 // DeleteFile handles file deletion requests
@@ -266,9 +630,26 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 		filePath = filePath[1:]
 	}
 
-	// Delete the file
-	err := h.fileStorage.DeleteFile(filePath)
+	// Delete the file records and their image variants, then the stored
+	// files. Paths without a record are deleted from storage directly.
+	paths, err := h.fileRepo.DeleteByPath(filePath)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "File deletion failed",
+			"message": "Failed to delete file record: " + err.Error(),
+		})
+		return
+	}
+	if len(paths) == 0 {
+		err = h.fileStorage.DeleteFile(filePath)
+	}
+	for _, path := range paths {
+		if deleteErr := h.fileStorage.DeleteFile(path); deleteErr != nil && path == filePath {
+			// Other stored files are left for the file collector
+			err = deleteErr
+		}
+	}
+	if err != nil && (len(paths) == 0 || !strings.Contains(err.Error(), "not found")) {
 		if strings.Contains(err.Error(), "not found") {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error":   "File not found",
@@ -282,6 +663,7 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 		}
 		return
 	}
+	h.markdownService.InvalidateFile(filePath)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "File deleted successfully",
@@ -304,6 +686,16 @@ func (h *FileHandler) GetFileInfo(c *gin.Context) {
 		filePath = filePath[1:]
 	}
 
+	h.writeFileInfo(c, filePath)
+}
+
+// writeFileInfo responds with the information of the file stored at
+// filePath
+func (h *FileHandler) writeFileInfo(c *gin.Context, filePath string) {
+	if _, ok := h.authorizeFile(c, filePath); !ok {
+		return
+	}
+
 	// Get file info
 	fileInfo, err := h.fileStorage.GetFileInfo(filePath)
 	if err != nil {
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"tripflow/internal/database"
+	"tripflow/internal/models"
+	"tripflow/internal/services"
+	"tripflow/pkg/filestorage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testItinerary = "# 제주 3박 4일\n\n- [ ] 여권\n- [ ] 충전기\n"
+
+// fileHandlerFixture is a FileHandler over an in-memory database with one
+// public and one private markdown file uploaded by owner
+type fileHandlerFixture struct {
+	handler     *FileHandler
+	owner       uuid.UUID
+	publicPath  string
+	privatePath string
+}
+
+func newFileHandlerFixture(t *testing.T, storage filestorage.FileStorageService) *fileHandlerFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file:"+uuid.NewString()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+
+	f := &fileHandlerFixture{
+		handler: NewFileHandler(storage, db, nil, services.NewFileURLSigner([]byte("test secret"), time.Hour)),
+		owner:   uuid.New(),
+	}
+	upload := func(filename string, public bool) string {
+		filePath, err := storage.UploadFile(strings.NewReader(testItinerary), filename, "text/markdown")
+		if err != nil {
+			t.Fatalf("UploadFile() error = %v", err)
+		}
+		file := models.NewFile(f.owner, filename, filePath, int64(len(testItinerary)), "text/markdown")
+		if err := db.Create(file).Error; err != nil {
+			t.Fatalf("creating file record: %v", err)
+		}
+		schedule := &models.Schedule{ID: uuid.New(), UserID: f.owner, Title: filename, FileID: file.ID, IsPublic: public}
+		if err := db.Create(schedule).Error; err != nil {
+			t.Fatalf("creating schedule: %v", err)
+		}
+		return filePath
+	}
+	f.publicPath = upload("public.md", true)
+	f.privatePath = upload("private.md", false)
+	return f
+}
+
+// get requests a stored file as userID, or anonymously when it is uuid.Nil
+func (f *fileHandlerFixture) get(filePath string, userID uuid.UUID, header map[string]string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/api/file/*path", func(c *gin.Context) {
+		if userID != uuid.Nil {
+			c.Set("userID", userID.String())
+		}
+	}, f.handler.GetFile)
+
+	req := httptest.NewRequest(http.MethodGet, services.FileURL(filePath), nil)
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func newLocalTestStorage(t *testing.T) filestorage.FileStorageService {
+	t.Helper()
+	storage, err := filestorage.NewLocalFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalFileStorage() error = %v", err)
+	}
+	return storage
+}
+
+func TestGetFile_CacheControl(t *testing.T) {
+	f := newFileHandlerFixture(t, newLocalTestStorage(t))
+
+	tests := []struct {
+		name   string
+		path   string
+		user   uuid.UUID
+		status int
+		cache  string
+	}{
+		{"public file", f.publicPath, uuid.Nil, http.StatusOK, publicFileCacheControl},
+		{"private file for its owner", f.privatePath, f.owner, http.StatusOK, privateFileCacheControl},
+		{"private file for anyone else", f.privatePath, uuid.New(), http.StatusForbidden, ""},
+		{"private file without a token", f.privatePath, uuid.Nil, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := f.get(tt.path, tt.user, nil)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.cache {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.cache)
+			}
+			if tt.status == http.StatusOK && w.Body.String() != testItinerary {
+				t.Errorf("body = %q, want the file", w.Body)
+			}
+		})
+	}
+}
+
+func TestGetFile_Range(t *testing.T) {
+	f := newFileHandlerFixture(t, newLocalTestStorage(t))
+
+	w := f.get(f.publicPath, uuid.Nil, map[string]string{"Range": "bytes=2-5"})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusPartialContent)
+	}
+	if got := w.Body.String(); got != testItinerary[2:6] {
+		t.Errorf("body = %q, want %q", got, testItinerary[2:6])
+	}
+	if got, want := w.Header().Get("Content-Range"), "bytes 2-5/"+strconv.Itoa(len(testItinerary)); got != want {
+		t.Errorf("Content-Range = %q, want %q", got, want)
+	}
+
+	// A range past the end cannot be satisfied
+	w = f.get(f.publicPath, uuid.Nil, map[string]string{"Range": "bytes=1000-2000"})
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusRequestedRangeNotSatisfiable)
+	}
+	if got, want := w.Header().Get("Content-Range"), "bytes */"+strconv.Itoa(len(testItinerary)); got != want {
+		t.Errorf("Content-Range = %q, want %q", got, want)
+	}
+}
+
+func TestGetFile_ETag(t *testing.T) {
+	f := newFileHandlerFixture(t, newLocalTestStorage(t))
+
+	w := f.get(f.publicPath, uuid.Nil, nil)
+	etag := w.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("ETag = %q, want a strong ETag from the checksum", etag)
+	}
+
+	w = f.get(f.publicPath, uuid.Nil, map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("status = %d with %d bytes, want %d and no body", w.Code, w.Body.Len(), http.StatusNotModified)
+	}
+
+	w = f.get(f.publicPath, uuid.Nil, map[string]string{"If-None-Match": `"stale"`})
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d for a stale ETag, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestGetFile_EncryptedStorage(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := filestorage.NewKeyring(filestorage.MasterKey{ID: "k1", Key: key})
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	f := newFileHandlerFixture(t, filestorage.NewEncryptedFileStorage(newLocalTestStorage(t), keyring))
+
+	// The stored checksum is of the ciphertext, so the ETag falls back to a
+	// weak one from the plaintext size and modification time
+	w := f.get(f.privatePath, f.owner, nil)
+	if w.Code != http.StatusOK || w.Body.String() != testItinerary {
+		t.Fatalf("status = %d, body = %q", w.Code, w.Body)
+	}
+	etag := w.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`+strconv.FormatInt(int64(len(testItinerary)), 16)+"-") {
+		t.Fatalf("ETag = %q, want a weak ETag", etag)
+	}
+
+	w = f.get(f.privatePath, f.owner, map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+
+	// Ranges are of the decrypted content
+	w = f.get(f.privatePath, f.owner, map[string]string{"Range": "bytes=2-5"})
+	if w.Code != http.StatusPartialContent || w.Body.String() != testItinerary[2:6] {
+		t.Errorf("status = %d, body = %q, want %d and %q", w.Code, w.Body, http.StatusPartialContent, testItinerary[2:6])
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"tripflow/internal/middleware"
+	"tripflow/internal/models"
+	"tripflow/internal/repositories"
+	"tripflow/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QuotaHandler reports storage usage and handles admin quota overrides
+type QuotaHandler struct {
+	quotas    *services.QuotaService
+	quotaRepo repositories.QuotaRepository
+}
+
+// NewQuotaHandler creates a new QuotaHandler
+func NewQuotaHandler(quotas *services.QuotaService, quotaRepo repositories.QuotaRepository) *QuotaHandler {
+	return &QuotaHandler{
+		quotas:    quotas,
+		quotaRepo: quotaRepo,
+	}
+}
+
+// UsageResponse defines the response for storage usage
+type UsageResponse struct {
+	Usage services.StorageUsage `json:"usage"`
+	Quota services.Quota        `json:"quota"` // Zero limits are unlimited
+}
+
+// AdminQuotaResponse defines the response for a user's quota override
+type AdminQuotaResponse struct {
+	UserID   string                `json:"user_id"`
+	Usage    services.StorageUsage `json:"usage"`
+	Quota    services.Quota        `json:"quota"`    // For the role in ?role=
+	Override *models.StorageQuota  `json:"override"` // Nil when the role's quota applies
+}
+
+// SetQuotaRequest defines the request for overriding a user's quota.
+// Omitted limits keep the role's limit; 0 is unlimited.
+type SetQuotaRequest struct {
+	MaxBytes *int64 `json:"max_bytes"`
+	MaxFiles *int64 `json:"max_files"`
+}
+
+// GetUsage handles requests for the signed-in user's storage usage
+func (h *QuotaHandler) GetUsage(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	role, _ := middleware.GetUserRoleFromContext(c)
+
+	usage, err := h.quotas.Usage(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve storage usage",
+			"message": err.Error(),
+		})
+		return
+	}
+	quota, err := h.quotas.Limits(userID, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve storage quota",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, UsageResponse{
+		Usage: usage,
+		Quota: quota,
+	})
+}
+
+// GetQuota handles admin requests for a user's usage and quota override.
+// Roles are not stored with users, so ?role= names the role whose quota
+// the override is applied to.
+func (h *QuotaHandler) GetQuota(c *gin.Context) {
+	userID := userIDToUUID(c.Param("userId"))
+
+	usage, err := h.quotas.Usage(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve storage usage",
+			"message": err.Error(),
+		})
+		return
+	}
+	quota, err := h.quotas.Limits(userID, c.Query("role"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve storage quota",
+			"message": err.Error(),
+		})
+		return
+	}
+	override, err := h.quotaRepo.GetOverride(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve storage quota",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, AdminQuotaResponse{
+		UserID:   c.Param("userId"),
+		Usage:    usage,
+		Quota:    quota,
+		Override: override,
+	})
+}
+
+// SetQuota handles admin requests to override a user's quota
+func (h *QuotaHandler) SetQuota(c *gin.Context) {
+	var req SetQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+	if (req.MaxBytes != nil && *req.MaxBytes < 0) || (req.MaxFiles != nil && *req.MaxFiles < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid quota",
+			"message": "Quota limits cannot be negative",
+		})
+		return
+	}
+
+	override := &models.StorageQuota{
+		UserID:    userIDToUUID(c.Param("userId")),
+		MaxBytes:  req.MaxBytes,
+		MaxFiles:  req.MaxFiles,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := h.quotaRepo.SetOverride(override); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to save storage quota",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, override)
+}
+
+// DeleteQuota handles admin requests to remove a user's quota override
+func (h *QuotaHandler) DeleteQuota(c *gin.Context) {
+	if err := h.quotaRepo.DeleteOverride(userIDToUUID(c.Param("userId"))); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to delete storage quota",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Storage quota override removed",
+	})
+}
@@ -1,13 +1,16 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"tripflow/internal/middleware"
 	"tripflow/internal/models"
 	"tripflow/internal/repositories"
+	"tripflow/internal/services"
 	"tripflow/pkg/filestorage"
 
 	"github.com/gin-gonic/gin"
@@ -16,16 +19,25 @@ import (
 
 // ScheduleHandler handles schedule-related requests
 type ScheduleHandler struct {
-	scheduleRepo repositories.ScheduleRepository
-	fileStorage  filestorage.FileStorageService
+	scheduleRepo      repositories.ScheduleRepository
+	fileRepo          repositories.FileRepository
+	fileStorage       filestorage.FileStorageService
+	markdownService   *services.MarkdownService
+	currencyConverter *services.CurrencyConverter
+	fileAccess        *services.FileAccess
 }
 
 // NewScheduleHandler creates a new ScheduleHandler
-func NewScheduleHandler(scheduleRepo repositories.ScheduleRepository, fileStorage filestorage.FileStorageService) *ScheduleHandler {
-	return &ScheduleHandler{
-		scheduleRepo: scheduleRepo,
-		fileStorage:  fileStorage,
-	}
+func NewScheduleHandler(scheduleRepo repositories.ScheduleRepository, rateRepo repositories.ExchangeRateRepository, fileRepo repositories.FileRepository, fileStorage filestorage.FileStorageService) *ScheduleHandler {
+	h := &ScheduleHandler{
+		scheduleRepo:      scheduleRepo,
+		fileRepo:          fileRepo,
+		fileStorage:       fileStorage,
+		markdownService:   services.NewMarkdownService(fileStorage),
+		currencyConverter: services.NewCurrencyConverter(rateRepo),
+	}
+	h.fileAccess = services.NewFileAccess(fileRepo, scheduleRepo, h.markdownService)
+	return h
 }
 
 // CreateScheduleRequest defines the request for creating a schedule
@@ -34,6 +46,10 @@ type CreateScheduleRequest struct {
 	Description string `json:"description"`
 	FileID      string `json:"file_id" binding:"required"`
 	IsPublic    bool   `json:"is_public"`
+
+	HomeCurrency string `json:"home_currency"`        // ISO code, defaults to KRW
+	StartDate    string `json:"start_date,omitempty"` // YYYY-MM-DD
+	EndDate      string `json:"end_date,omitempty"`   // YYYY-MM-DD
 }
 
 // UpdateScheduleRequest defines the request for updating a schedule
@@ -41,6 +57,10 @@ type UpdateScheduleRequest struct {
 	Title       *string `json:"title,omitempty"`
 	Description *string `json:"description,omitempty"`
 	IsPublic    *bool   `json:"is_public,omitempty"`
+
+	HomeCurrency *string `json:"home_currency,omitempty"`
+	StartDate    *string `json:"start_date,omitempty"` // YYYY-MM-DD, empty string clears it
+	EndDate      *string `json:"end_date,omitempty"`   // YYYY-MM-DD, empty string clears it
 }
 
 // ScheduleResponse defines the response for schedule operations
@@ -56,6 +76,13 @@ type ScheduleResponse struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	File        FileInfo  `json:"file,omitempty"`
+
+	HomeCurrency string     `json:"home_currency"`
+	StartDate    *time.Time `json:"start_date,omitempty"`
+	EndDate      *time.Time `json:"end_date,omitempty"`
+
+	// Budget is only populated when a single schedule is requested
+	Budget *services.BudgetSummary `json:"budget,omitempty"`
 }
 
 // FileInfo represents file information in schedule response
@@ -113,20 +140,65 @@ func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
 		return
 	}
 
-	// Check if file exists and belongs to user
-	// Note: In a real implementation, you would need to add a method to check file ownership
-	// For now, we'll assume the file exists and belongs to the user
+	// A schedule can only be made from the user's own upload; otherwise it
+	// would expose someone else's private file
+	file, err := h.fileRepo.GetByID(fileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "File not found",
+			"message": "File with the given ID does not exist",
+		})
+		return
+	}
+	if file.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Access denied",
+			"message": "You can only create schedules from your own files",
+		})
+		return
+	}
+
+	homeCurrency, err := parseHomeCurrency(req.HomeCurrency)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid home currency",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	startDate, endDate, err := parseTripDates(req.StartDate, req.EndDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid trip dates",
+			"message": err.Error(),
+		})
+		return
+	}
 
 	// Create schedule
 	schedule := &models.Schedule{
-		ID:          uuid.New(),
-		UserID:      userID,
-		Title:       req.Title,
-		Description: req.Description,
-		FileID:      fileID,
-		IsPublic:    req.IsPublic,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		ID:           uuid.New(),
+		UserID:       userID,
+		Title:        req.Title,
+		Description:  req.Description,
+		FileID:       fileID,
+		IsPublic:     req.IsPublic,
+		HomeCurrency: homeCurrency,
+		StartDate:    startDate,
+		EndDate:      endDate,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	// A new schedule has no stored content yet, so the file is its source
+	markdown, err := h.markdownService.ReadMarkdownFile(file.FilePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to read schedule",
+			"message": err.Error(),
+		})
+		return
 	}
 
 	if err := h.scheduleRepo.Create(schedule); err != nil {
@@ -137,16 +209,17 @@ func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
 		return
 	}
 
-	// Return created schedule
-	// Note: For now, we'll create a dummy file object
-	dummyFile := models.File{
-		ID:         fileID,
-		Filename:   "dummy.md",
-		FileSize:   0,
-		MimeType:   "text/markdown",
-		UploadDate: time.Now(),
+	// Record the uploads the markdown refers to, which the schedule makes
+	// public along with it
+	if err := h.fileAccess.Index(schedule, markdown); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to index schedule",
+			"message": err.Error(),
+		})
+		return
 	}
-	response := h.scheduleToResponse(schedule, dummyFile)
+
+	response := h.scheduleToResponse(schedule, *file)
 	c.JSON(http.StatusCreated, response)
 }
 
@@ -184,6 +257,16 @@ func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
 	}
 
 	response := h.scheduleToResponse(schedule, *schedule.File)
+
+	// Attach budget totals parsed from the schedule's markdown, converted
+	// into the schedule's home currency with the stored exchange rates
+	if markdown, err := h.scheduleMarkdown(schedule); err == nil {
+		response.Budget = services.ExtractBudget(markdown)
+		if response.Budget != nil {
+			response.Budget.Converted = h.currencyConverter.ConvertBudget(response.Budget, schedule.HomeCurrency, schedule.StartDate)
+		}
+	}
+
 	c.JSON(http.StatusOK, response)
 }
 
@@ -310,6 +393,36 @@ func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
 	if req.IsPublic != nil {
 		schedule.IsPublic = *req.IsPublic
 	}
+	if req.HomeCurrency != nil {
+		homeCurrency, err := parseHomeCurrency(*req.HomeCurrency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid home currency",
+				"message": err.Error(),
+			})
+			return
+		}
+		schedule.HomeCurrency = homeCurrency
+	}
+	if req.StartDate != nil || req.EndDate != nil {
+		startDate, endDate := formatTripDate(schedule.StartDate), formatTripDate(schedule.EndDate)
+		if req.StartDate != nil {
+			startDate = *req.StartDate
+		}
+		if req.EndDate != nil {
+			endDate = *req.EndDate
+		}
+
+		start, end, err := parseTripDates(startDate, endDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid trip dates",
+				"message": err.Error(),
+			})
+			return
+		}
+		schedule.StartDate, schedule.EndDate = start, end
+	}
 
 	schedule.UpdatedAt = time.Now()
 
@@ -374,12 +487,6 @@ func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
 		return
 	}
 
-	// Delete associated file
-	if err := h.fileStorage.DeleteFile(schedule.File.FilePath); err != nil {
-		// Log error but continue with schedule deletion
-		// In production, you might want to handle this differently
-	}
-
 	// Delete schedule
 	if err := h.scheduleRepo.Delete(id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -389,6 +496,25 @@ func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
 		return
 	}
 
+	// Drop cached renderings along with the content
+	if schedule.File != nil {
+		h.markdownService.InvalidateFile(schedule.File.FilePath)
+	}
+	if schedule.Content != "" {
+		h.markdownService.InvalidateContent(schedule.Content)
+	}
+
+	// Delete the markdown file unless another schedule uses it: the record
+	// first, then the stored files. Stored files that fail to delete are
+	// left for the file collector.
+	if _, err := h.scheduleRepo.GetByFileID(schedule.FileID); err != nil {
+		if paths, err := h.fileRepo.Delete(schedule.FileID); err == nil {
+			for _, path := range paths {
+				h.fileStorage.DeleteFile(path)
+			}
+		}
+	}
+
 	c.JSON(http.StatusNoContent, nil)
 }
 
@@ -405,6 +531,10 @@ func (h *ScheduleHandler) scheduleToResponse(schedule *models.Schedule, file mod
 		ShareCount:  schedule.ShareCount,
 		CreatedAt:   schedule.CreatedAt,
 		UpdatedAt:   schedule.UpdatedAt,
+
+		HomeCurrency: schedule.HomeCurrency,
+		StartDate:    schedule.StartDate,
+		EndDate:      schedule.EndDate,
 	}
 
 	response.File = FileInfo{
@@ -418,6 +548,74 @@ func (h *ScheduleHandler) scheduleToResponse(schedule *models.Schedule, file mod
 	return response
 }
 
+// tripDateLayout is the date format used for trip start and end dates and
+// for exchange rate effective dates
+const tripDateLayout = "2006-01-02"
+
+// parseHomeCurrency validates a home currency code, defaulting to KRW
+func parseHomeCurrency(code string) (string, error) {
+	if strings.TrimSpace(code) == "" {
+		return models.DefaultHomeCurrency, nil
+	}
+	currency, ok := services.LookupCurrency(code)
+	if !ok {
+		return "", fmt.Errorf("unsupported currency: %s", code)
+	}
+	return currency.Code, nil
+}
+
+// parseTripDates parses optional YYYY-MM-DD start and end dates
+func parseTripDates(start, end string) (*time.Time, *time.Time, error) {
+	parse := func(value string) (*time.Time, error) {
+		if value == "" {
+			return nil, nil
+		}
+		date, err := time.Parse(tripDateLayout, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+		}
+		return &date, nil
+	}
+
+	startDate, err := parse(start)
+	if err != nil {
+		return nil, nil, err
+	}
+	endDate, err := parse(end)
+	if err != nil {
+		return nil, nil, err
+	}
+	if startDate != nil && endDate != nil && endDate.Before(*startDate) {
+		return nil, nil, fmt.Errorf("end date must not be before start date")
+	}
+	return startDate, endDate, nil
+}
+
+// formatTripDate formats an optional trip date, returning "" for nil
+func formatTripDate(date *time.Time) string {
+	if date == nil {
+		return ""
+	}
+	return date.Format(tripDateLayout)
+}
+
+// scheduleMarkdown returns the markdown source of a schedule
+func (h *ScheduleHandler) scheduleMarkdown(schedule *models.Schedule) (string, error) {
+	return readScheduleMarkdown(h.markdownService, schedule)
+}
+
+// readScheduleMarkdown returns the markdown source of a schedule, preferring
+// the stored content and falling back to the uploaded file
+func readScheduleMarkdown(markdownService *services.MarkdownService, schedule *models.Schedule) (string, error) {
+	if schedule.Content != "" {
+		return schedule.Content, nil
+	}
+	if schedule.File == nil || schedule.File.FilePath == "" {
+		return "", fmt.Errorf("schedule has no markdown source")
+	}
+	return markdownService.ReadMarkdownFile(schedule.File.FilePath)
+}
+
 // IncrementShareCount handles incrementing the share count for a schedule
 func (h *ScheduleHandler) IncrementShareCount(c *gin.Context) {
 	scheduleIDStr := c.Param("id")
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"tripflow/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StorageGCHandler handles admin requests to reconcile file records with
+// storage
+type StorageGCHandler struct {
+	gc *services.FileGC
+}
+
+// NewStorageGCHandler creates a new StorageGCHandler
+func NewStorageGCHandler(gc *services.FileGC) *StorageGCHandler {
+	return &StorageGCHandler{gc: gc}
+}
+
+// RunGC handles requests to collect orphaned and unreferenced files. It is
+// a dry run that only reports what would be removed unless ?dry_run=false.
+func (h *StorageGCHandler) RunGC(c *gin.Context) {
+	dryRun := true
+	if value := c.Query("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid dry_run",
+				"message": "dry_run must be true or false",
+			})
+			return
+		}
+		dryRun = parsed
+	}
+
+	report, err := h.gc.Run(c.Request.Context(), dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "File collection failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"tripflow/pkg/tus"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResumableUploadHandler serves tus 1.0 resumable uploads under
+// /api/uploads. Finished uploads go through the same validation as
+// FileHandler.UploadFile and are committed into file storage and a File
+// record; the final PATCH response carries the record in X-File-Id and
+// X-File-Path.
+type ResumableUploadHandler struct {
+	files *FileHandler
+	store *tus.Store
+}
+
+// NewResumableUploadHandler creates a new ResumableUploadHandler
+func NewResumableUploadHandler(files *FileHandler, store *tus.Store) *ResumableUploadHandler {
+	return &ResumableUploadHandler{
+		files: files,
+		store: store,
+	}
+}
+
+// Options describes the server's tus support
+func (h *ResumableUploadHandler) Options(c *gin.Context) {
+	c.Header("Tus-Resumable", tus.Version)
+	c.Header("Tus-Version", tus.Version)
+	c.Header("Tus-Extension", tus.Extensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(maxUploadSize, 10))
+	c.Header("Tus-Checksum-Algorithm", tus.ChecksumAlgorithms)
+	c.Status(http.StatusNoContent)
+}
+
+// Create starts an upload, storing the request body when it carries the
+// first chunk (creation-with-upload)
+func (h *ResumableUploadHandler) Create(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		h.fail(c, http.StatusBadRequest, "Invalid Upload-Length", "Upload-Length must be a non-negative integer")
+		return
+	}
+	if length > maxUploadSize {
+		h.fail(c, http.StatusRequestEntityTooLarge, "File too large", tooLargeError().message)
+		return
+	}
+
+	metadata, err := tus.ParseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		h.fail(c, http.StatusBadRequest, "Invalid Upload-Metadata", err.Error())
+		return
+	}
+	// Reject unsupported files before any bytes are sent
+	if metadata["filename"] == "" {
+		h.fail(c, http.StatusBadRequest, "Filename required", "Upload-Metadata must include a filename")
+		return
+	}
+	if uploadErr := checkUploadFilename(metadata["filename"]); uploadErr != nil {
+		h.fail(c, uploadErr.status, uploadErr.title, uploadErr.message)
+		return
+	}
+
+	// Hold the declared size until the upload is in the store; from then on
+	// it counts towards the quota as staged until it is committed,
+	// terminated or expires
+	release, err := h.files.quotas.Reserve(uploaderID(c), uploaderRole(c), length)
+	if err != nil {
+		uploadErr := quotaError(err)
+		h.fail(c, uploadErr.status, uploadErr.title, uploadErr.message)
+		return
+	}
+	info, err := h.store.Create(length, metadata, uploadOwner(c))
+	release()
+	if err != nil {
+		h.fail(c, http.StatusInternalServerError, "Upload failed", err.Error())
+		return
+	}
+	c.Header("Location", "/api/uploads/"+info.ID)
+
+	if c.GetHeader("Content-Type") == tus.ContentType {
+		info, ok := h.write(c, info.ID, 0)
+		if !ok {
+			return
+		}
+		h.setOffsetHeaders(c, info)
+		if info.Complete() && !h.commit(c, info.ID) {
+			return
+		}
+	} else {
+		h.setOffsetHeaders(c, info)
+	}
+	c.Status(http.StatusCreated)
+}
+
+// Head reports how much of an upload has been received
+func (h *ResumableUploadHandler) Head(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+	info, ok := h.get(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Length", strconv.FormatInt(info.Length, 10))
+	if len(info.Metadata) > 0 {
+		c.Header("Upload-Metadata", tus.EncodeMetadata(info.Metadata))
+	}
+	h.setOffsetHeaders(c, info)
+	setResultHeaders(c, info)
+	c.Status(http.StatusOK)
+}
+
+// Patch appends a chunk at Upload-Offset, committing the upload once it is
+// complete
+func (h *ResumableUploadHandler) Patch(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+	if c.GetHeader("Content-Type") != tus.ContentType {
+		h.fail(c, http.StatusUnsupportedMediaType, "Invalid Content-Type", "PATCH requests must use "+tus.ContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		h.fail(c, http.StatusBadRequest, "Invalid Upload-Offset", "Upload-Offset must be a non-negative integer")
+		return
+	}
+	if _, ok := h.get(c); !ok {
+		return
+	}
+
+	info, ok := h.write(c, c.Param("id"), offset)
+	if !ok {
+		return
+	}
+	h.setOffsetHeaders(c, info)
+	if info.Complete() && !h.commit(c, info.ID) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Terminate abandons an upload and frees its data
+func (h *ResumableUploadHandler) Terminate(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+	if _, ok := h.get(c); !ok {
+		return
+	}
+	if err := h.store.Terminate(c.Param("id")); err != nil {
+		h.storeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// checkVersion sets Tus-Resumable and rejects requests for other versions
+func (h *ResumableUploadHandler) checkVersion(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tus.Version)
+	if c.GetHeader("Tus-Resumable") != tus.Version {
+		c.Header("Tus-Version", tus.Version)
+		h.fail(c, http.StatusPreconditionFailed, "Unsupported tus version", "Tus-Resumable must be "+tus.Version)
+		return false
+	}
+	return true
+}
+
+// get loads the upload named in the path, which only its creator may use
+func (h *ResumableUploadHandler) get(c *gin.Context) (*tus.Info, bool) {
+	info, err := h.store.Get(c.Param("id"))
+	if err != nil {
+		h.storeError(c, err)
+		return nil, false
+	}
+	if info.Owner != uploadOwner(c) {
+		// Do not reveal uploads of other users
+		h.storeError(c, tus.ErrNotFound)
+		return nil, false
+	}
+	return info, true
+}
+
+// write stores the request body at offset
+func (h *ResumableUploadHandler) write(c *gin.Context, id string, offset int64) (*tus.Info, bool) {
+	var checksum *tus.Checksum
+	if header := c.GetHeader("Upload-Checksum"); header != "" {
+		var err error
+		if checksum, err = tus.ParseChecksum(header); err != nil {
+			h.fail(c, http.StatusBadRequest, "Invalid Upload-Checksum", err.Error())
+			return nil, false
+		}
+	}
+
+	info, err := h.store.Write(c.Request.Context(), id, offset, c.Request.Body, checksum)
+	if err != nil {
+		if info != nil {
+			h.setOffsetHeaders(c, info)
+		}
+		h.storeError(c, err)
+		return nil, false
+	}
+	return info, true
+}
+
+// commit stores a finished upload as a file. Failed validation ends the
+// upload; other failures keep it, so repeating the final PATCH retries.
+func (h *ResumableUploadHandler) commit(c *gin.Context, id string) bool {
+	var uploadErr *uploadError
+	info, err := h.store.Commit(id, func(info *tus.Info, data *os.File) (map[string]string, error) {
+		response, failure := h.files.storeUpload(c, data, info.Metadata["filename"], info.Metadata["filetype"], info.Length)
+		if failure != nil {
+			uploadErr = failure
+			return nil, failure
+		}
+		return map[string]string{"file_id": response.FileID, "file_path": response.FilePath}, nil
+	})
+	if uploadErr != nil {
+		if uploadErr.status < http.StatusInternalServerError {
+			h.store.Terminate(id)
+		}
+		uploadErr.respond(c)
+		return false
+	}
+	if err != nil {
+		h.storeError(c, err)
+		return false
+	}
+	setResultHeaders(c, info)
+	return true
+}
+
+// setOffsetHeaders sets Upload-Offset and Upload-Expires
+func (h *ResumableUploadHandler) setOffsetHeaders(c *gin.Context, info *tus.Info) {
+	c.Header("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	c.Header("Upload-Expires", info.ExpiresAt.UTC().Format(http.TimeFormat))
+}
+
+// setResultHeaders names the File record of a committed upload
+func setResultHeaders(c *gin.Context, info *tus.Info) {
+	if info.Result == nil {
+		return
+	}
+	c.Header("X-File-Id", info.Result["file_id"])
+	c.Header("X-File-Path", info.Result["file_path"])
+}
+
+// storeError responds with the status tus uses for a store error
+func (h *ResumableUploadHandler) storeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, tus.ErrNotFound):
+		h.fail(c, http.StatusNotFound, "Upload not found", "The requested upload does not exist")
+	case errors.Is(err, tus.ErrExpired):
+		h.fail(c, http.StatusGone, "Upload expired", "The upload expired and must be started again")
+	case errors.Is(err, tus.ErrOffsetMismatch):
+		h.fail(c, http.StatusConflict, "Offset mismatch", "Upload-Offset does not match the bytes received")
+	case errors.Is(err, tus.ErrTooLarge):
+		h.fail(c, http.StatusRequestEntityTooLarge, "Upload too large", err.Error())
+	case errors.Is(err, tus.ErrChecksumMismatch):
+		h.fail(c, tus.StatusChecksumMismatch, "Checksum mismatch", "The chunk does not match Upload-Checksum")
+	case errors.Is(err, tus.ErrLocked):
+		h.fail(c, http.StatusLocked, "Upload busy", "Another request is writing this upload")
+	default:
+		h.fail(c, http.StatusInternalServerError, "Upload failed", err.Error())
+	}
+}
+
+// fail writes an error response; HEAD responses have no body
+func (h *ResumableUploadHandler) fail(c *gin.Context, status int, title, message string) {
+	if c.Request.Method == http.MethodHead {
+		c.Status(status)
+		return
+	}
+	c.JSON(status, gin.H{
+		"error":   title,
+		"message": message,
+	})
+}
+
+// uploadOwner identifies the signed-in user creating an upload by the UUID
+// their quota is kept under
+func uploadOwner(c *gin.Context) string {
+	return uploaderID(c).String()
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"tripflow/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// userIDToUUID maps a JWT user ID to the UUID stored on records.
+// For MVP, user IDs that are not UUIDs are mapped to a stable name-based UUID.
+func userIDToUUID(userIDStr string) uuid.UUID {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		userID = uuid.NewSHA1(uuid.NameSpaceOID, []byte(userIDStr))
+	}
+	return userID
+}
+
+// requireUserID returns the authenticated user's UUID, or writes a 401
+// response and returns false when the request is not authenticated
+func requireUserID(c *gin.Context) (uuid.UUID, bool) {
+	userIDStr, exists := middleware.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "User not authenticated",
+			"message": "User ID not found in context",
+		})
+		return uuid.Nil, false
+	}
+	return userIDToUUID(userIDStr), true
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// Blob is a distinct stored content shared by every upload of it
+type Blob struct {
+	Checksum  string    `gorm:"primaryKey;size:64" json:"checksum"` // Hex SHA-256 of the content
+	FilePath  string    `gorm:"not null;uniqueIndex" json:"file_path"`
+	Size      int64     `gorm:"not null" json:"size"`
+	RefCount  int64     `gorm:"not null;default:1" json:"ref_count"` // Uploads referring to the blob
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for the Blob model
+func (Blob) TableName() string {
+	return "blobs"
+}
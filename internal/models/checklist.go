@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ChecklistCheck is one user's own state for a task-list item of a schedule.
+// The shared state lives in the schedule's markdown as "- [x]".
+type ChecklistCheck struct {
+	ID         uuid.UUID `gorm:"primaryKey;type:text" json:"id"`
+	ScheduleID uuid.UUID `gorm:"type:text;not null;uniqueIndex:idx_checklist_checks_item,priority:1" json:"schedule_id"`
+	UserID     uuid.UUID `gorm:"type:text;not null;uniqueIndex:idx_checklist_checks_item,priority:2" json:"user_id"`
+	ItemKey    string    `gorm:"not null;uniqueIndex:idx_checklist_checks_item,priority:3" json:"item_key"`
+	Checked    bool      `gorm:"not null;default:false" json:"checked"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for the ChecklistCheck model
+func (ChecklistCheck) TableName() string {
+	return "checklist_checks"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (c *ChecklistCheck) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ExchangeRate is an admin-maintained conversion rate valid from EffectiveDate.
+// One unit of BaseCurrency buys Rate units of QuoteCurrency.
+type ExchangeRate struct {
+	ID            uuid.UUID `gorm:"primaryKey;type:text" json:"id"`
+	BaseCurrency  string    `gorm:"size:3;not null;uniqueIndex:idx_exchange_rates_pair_date,priority:1" json:"base_currency"`
+	QuoteCurrency string    `gorm:"size:3;not null;uniqueIndex:idx_exchange_rates_pair_date,priority:2" json:"quote_currency"`
+	EffectiveDate time.Time `gorm:"not null;uniqueIndex:idx_exchange_rates_pair_date,priority:3" json:"effective_date"`
+	Rate          float64   `gorm:"not null" json:"rate"`
+	Source        string    `json:"source"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for the ExchangeRate model
+func (ExchangeRate) TableName() string {
+	return "exchange_rates"
+}
+
+// BeforeCreate hook to generate UUID if not set and normalize currency codes
+func (r *ExchangeRate) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	r.BaseCurrency = strings.ToUpper(r.BaseCurrency)
+	r.QuoteCurrency = strings.ToUpper(r.QuoteCurrency)
+	return nil
+}
+
+// NewExchangeRate creates a new ExchangeRate instance with generated UUID.
+// The effective date is truncated to midnight UTC.
+func NewExchangeRate(base, quote string, effectiveDate time.Time, rate float64, source string) *ExchangeRate {
+	y, m, d := effectiveDate.Date()
+	return &ExchangeRate{
+		ID:            uuid.New(),
+		BaseCurrency:  strings.ToUpper(base),
+		QuoteCurrency: strings.ToUpper(quote),
+		EffectiveDate: time.Date(y, m, d, 0, 0, 0, 0, time.UTC),
+		Rate:          rate,
+		Source:        source,
+	}
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Split rules for dividing an expense between its participants
+const (
+	SplitEqual   = "equal"   // Everyone pays the same amount
+	SplitShares  = "shares"  // Share is a whole-number weight
+	SplitExact   = "exact"   // Share is an amount in minor units
+	SplitPercent = "percent" // Share is in basis points (1/100 of a percent)
+)
+
+// Expense represents money actually spent by one participant on behalf of a group
+type Expense struct {
+	ID             uuid.UUID      `gorm:"primaryKey;type:text" json:"id"`
+	ScheduleID     uuid.UUID      `gorm:"type:text;not null;index" json:"schedule_id"`
+	CreatedBy      uuid.UUID      `gorm:"type:text;not null" json:"created_by"`
+	Description    string         `gorm:"not null" json:"description"`
+	Amount         int64          `gorm:"not null" json:"amount"` // Minor units
+	Currency       string         `gorm:"size:3;not null" json:"currency"`
+	PayerUserID    string         `gorm:"type:text" json:"payer_user_id,omitempty"`
+	PayerGuestName string         `json:"payer_guest_name,omitempty"`
+	SplitRule      string         `gorm:"not null;default:equal" json:"split_rule"`
+	SpentAt        time.Time      `json:"spent_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	// Relationships
+	Participants []ExpenseParticipant `gorm:"foreignKey:ExpenseID;constraint:OnDelete:CASCADE" json:"participants"`
+}
+
+// TableName returns the table name for the Expense model
+func (Expense) TableName() string {
+	return "expenses"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (e *Expense) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// ExpenseParticipant is one person an expense is split between, identified
+// either by a registered user ID or by a guest name
+type ExpenseParticipant struct {
+	ID        uuid.UUID `gorm:"primaryKey;type:text" json:"id"`
+	ExpenseID uuid.UUID `gorm:"type:text;not null;index" json:"expense_id"`
+	UserID    string    `gorm:"type:text;index" json:"user_id,omitempty"`
+	GuestName string    `json:"guest_name,omitempty"`
+	Share     int64     `gorm:"not null;default:0" json:"share"` // Meaning depends on the expense's split rule
+}
+
+// TableName returns the table name for the ExpenseParticipant model
+func (ExpenseParticipant) TableName() string {
+	return "expense_participants"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (p *ExpenseParticipant) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+// ParticipantKey returns a stable key for a participant: "user:<id>" for
+// registered users or "guest:<name>" (case-insensitive) for guests
+func ParticipantKey(userID, guestName string) string {
+	if userID != "" {
+		return "user:" + userID
+	}
+	return "guest:" + strings.ToLower(strings.TrimSpace(guestName))
+}
+
+// PayerKey returns the participant key of the expense's payer
+func (e *Expense) PayerKey() string {
+	return ParticipantKey(e.PayerUserID, e.PayerGuestName)
+}
+
+// Key returns the participant key
+func (p *ExpenseParticipant) Key() string {
+	return ParticipantKey(p.UserID, p.GuestName)
+}
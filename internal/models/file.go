@@ -15,10 +15,21 @@ type File struct {
 	FilePath   string    `gorm:"not null" json:"file_path"`
 	FileSize   int64     `gorm:"not null" json:"file_size"`
 	MimeType   string    `json:"mime_type"`
+	Width      int       `json:"width,omitempty"`  // Images only
+	Height     int       `json:"height,omitempty"` // Images only
 	UploadDate time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"upload_date"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	// UploaderRole is the uploader's role at upload time; it selects the
+	// sanitization policy the file is rendered with
+	UploaderRole string `gorm:"size:32" json:"uploader_role,omitempty"`
+
+	// Checksum is the hex SHA-256 of the content. With deduplicating
+	// storage it is the key of the blob the file shares with other uploads
+	// of the same content, and FilePath is the blob's path.
+	Checksum string `gorm:"size:64;index" json:"checksum,omitempty"`
 }
 
 // TableName returns the table name for the File model
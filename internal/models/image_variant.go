@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Image variant labels
+const (
+	VariantThumbnail = "thumb"
+)
+
+// ImageVariant is a resized copy of an uploaded image
+type ImageVariant struct {
+	ID        uuid.UUID `gorm:"primaryKey;type:text" json:"id"`
+	FileID    uuid.UUID `gorm:"type:text;not null;index" json:"file_id"`
+	Label     string    `gorm:"not null" json:"label"` // "thumb" or "w<width>"
+	FilePath  string    `gorm:"not null" json:"file_path"`
+	FileSize  int64     `gorm:"not null" json:"file_size"`
+	MimeType  string    `json:"mime_type"`
+	Width     int       `gorm:"not null" json:"width"`
+	Height    int       `gorm:"not null" json:"height"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for the ImageVariant model
+func (ImageVariant) TableName() string {
+	return "image_variants"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (v *ImageVariant) BeforeCreate(tx *gorm.DB) error {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	return nil
+}
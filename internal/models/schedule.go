@@ -9,18 +9,25 @@ import (
 
 // Schedule represents a travel schedule
 type Schedule struct {
-	ID          uuid.UUID `gorm:"primaryKey;type:text" json:"id"`
-	UserID      uuid.UUID `gorm:"type:text;not null" json:"user_id"`
-	Title       string    `gorm:"not null" json:"title"`
-	Description string    `json:"description"`
-	Content     string    `gorm:"type:text" json:"content"`
-	IsPublic    bool      `gorm:"default:false;not null" json:"is_public"`
-	FileID      uuid.UUID `gorm:"type:text;not null" json:"file_id"`
-	ShareCount  int       `gorm:"default:0" json:"share_count"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
-	
+	ID           uuid.UUID      `gorm:"primaryKey;type:text" json:"id"`
+	UserID       uuid.UUID      `gorm:"type:text;not null" json:"user_id"`
+	Title        string         `gorm:"not null" json:"title"`
+	Description  string         `json:"description"`
+	Content      string         `gorm:"type:text" json:"content"`
+	IsPublic     bool           `gorm:"default:false;not null" json:"is_public"`
+	FileID       uuid.UUID      `gorm:"type:text;not null" json:"file_id"`
+	ShareCount   int            `gorm:"default:0" json:"share_count"`
+	HomeCurrency string         `gorm:"size:3;default:KRW;not null" json:"home_currency"`
+	StartDate    *time.Time     `json:"start_date,omitempty"`
+	EndDate      *time.Time     `json:"end_date,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	// FileRefsIndexed is set once the uploads the markdown refers to have
+	// been recorded as ScheduleFileRefs
+	FileRefsIndexed bool `gorm:"default:false;not null" json:"-"`
+
 	// Relationships
 	File *File `gorm:"foreignKey:FileID;references:ID" json:"file,omitempty"`
 }
@@ -35,21 +42,41 @@ func (s *Schedule) BeforeCreate(tx *gorm.DB) error {
 	if s.ID == uuid.Nil {
 		s.ID = uuid.New()
 	}
+	if s.HomeCurrency == "" {
+		s.HomeCurrency = DefaultHomeCurrency
+	}
 	return nil
 }
 
 // NewSchedule creates a new Schedule instance with generated UUID
 func NewSchedule(userID, fileID uuid.UUID, title, description, content string, isPublic bool) *Schedule {
 	return &Schedule{
-		ID:          uuid.New(),
-		UserID:      userID,
-		Title:       title,
-		Description: description,
-		Content:     content,
-		IsPublic:    isPublic,
-		FileID:      fileID,
-		ShareCount:  0,
+		ID:           uuid.New(),
+		UserID:       userID,
+		Title:        title,
+		Description:  description,
+		Content:      content,
+		IsPublic:     isPublic,
+		FileID:       fileID,
+		ShareCount:   0,
+		HomeCurrency: DefaultHomeCurrency,
+	}
+}
+
+// DefaultHomeCurrency is the currency budgets are converted into when a
+// schedule does not set one
+const DefaultHomeCurrency = "KRW"
+
+// TripDate returns the calendar date of the given 1-based trip day, or the
+// start date for day 0. ok is false when the schedule has no start date.
+func (s *Schedule) TripDate(day int) (time.Time, bool) {
+	if s.StartDate == nil {
+		return time.Time{}, false
+	}
+	if day <= 1 {
+		return *s.StartDate, true
 	}
+	return s.StartDate.AddDate(0, 0, day-1), true
 }
 
 // IncrementShareCount increments the share count for the schedule
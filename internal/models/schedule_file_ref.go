@@ -0,0 +1,20 @@
+package models
+
+import "github.com/google/uuid"
+
+// ScheduleFileRef is an upload a schedule's markdown refers to, recorded
+// when the markdown is saved so that file access checks do not have to
+// read and parse it
+type ScheduleFileRef struct {
+	ScheduleID uuid.UUID `gorm:"primaryKey;type:text" json:"schedule_id"`
+	// Path is a storage path, from a file URL or an image reference
+	Path string `gorm:"primaryKey;index" json:"path"`
+	// Filename is the base name an image reference also matches the
+	// owner's uploads by; empty for file URLs
+	Filename string `gorm:"index" json:"filename"`
+}
+
+// TableName returns the table name for the ScheduleFileRef model
+func (ScheduleFileRef) TableName() string {
+	return "schedule_file_refs"
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StorageQuota is an admin override of a user's storage quota. Nil limits
+// fall back to the quota of the user's role.
+type StorageQuota struct {
+	UserID    uuid.UUID `gorm:"primaryKey;type:text" json:"user_id"`
+	MaxBytes  *int64    `json:"max_bytes"` // 0 means unlimited
+	MaxFiles  *int64    `json:"max_files"` // 0 means unlimited
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for the StorageQuota model
+func (StorageQuota) TableName() string {
+	return "storage_quotas"
+}
@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"tripflow/internal/models"
+	"tripflow/pkg/filestorage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GORMBlobRepository implements filestorage.BlobIndex using GORM
+type GORMBlobRepository struct {
+	db *gorm.DB
+}
+
+// NewBlobRepository creates a new GORM-based blob index
+func NewBlobRepository(db *gorm.DB) *GORMBlobRepository {
+	return &GORMBlobRepository{
+		db: db,
+	}
+}
+
+// Acquire adds a reference to the blob with the given checksum and returns
+// its path
+func (r *GORMBlobRepository) Acquire(ctx context.Context, checksum string) (string, bool, error) {
+	var blob models.Blob
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Blobs are deleted with their last reference; skip one that is
+		// being deleted
+		result := tx.Model(&models.Blob{}).Where("checksum = ? AND ref_count > 0", checksum).
+			UpdateColumn("ref_count", gorm.Expr("ref_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("checksum = ?", checksum).First(&blob).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return blob.FilePath, true, nil
+}
+
+// Create records a new blob with one reference
+func (r *GORMBlobRepository) Create(ctx context.Context, checksum, path string, size int64) error {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Blob{
+		Checksum: checksum,
+		FilePath: path,
+		Size:     size,
+		RefCount: 1,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return filestorage.ErrBlobExists
+	}
+	return nil
+}
+
+// Release drops a reference to the blob stored at path, deleting the blob
+// with its last reference
+func (r *GORMBlobRepository) Release(ctx context.Context, path string) (bool, error) {
+	last := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Decrement before reading so concurrent releases cannot both see
+		// the same count
+		result := tx.Model(&models.Blob{}).Where("file_path = ?", path).
+			UpdateColumn("ref_count", gorm.Expr("ref_count - 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			last = true
+			return nil
+		}
+
+		result = tx.Where("file_path = ? AND ref_count <= 0", path).Delete(&models.Blob{})
+		last = result.RowsAffected > 0
+		return result.Error
+	})
+	return last, err
+}
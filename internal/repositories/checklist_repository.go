@@ -0,0 +1,55 @@
+package repositories
+
+import (
+	"tripflow/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ChecklistRepository defines the interface for per-user checklist state
+type ChecklistRepository interface {
+	// ListByUser retrieves a user's check state for every item of a schedule
+	ListByUser(scheduleID, userID uuid.UUID) ([]*models.ChecklistCheck, error)
+
+	// Set creates or replaces a user's check state for one item
+	Set(check *models.ChecklistCheck) error
+}
+
+// GORMChecklistRepository implements ChecklistRepository using GORM
+type GORMChecklistRepository struct {
+	db *gorm.DB
+}
+
+// NewChecklistRepository creates a new GORM-based checklist repository
+func NewChecklistRepository(db *gorm.DB) ChecklistRepository {
+	return &GORMChecklistRepository{
+		db: db,
+	}
+}
+
+// ListByUser retrieves a user's check state for every item of a schedule
+func (r *GORMChecklistRepository) ListByUser(scheduleID, userID uuid.UUID) ([]*models.ChecklistCheck, error) {
+	var checks []*models.ChecklistCheck
+	err := r.db.Where("schedule_id = ? AND user_id = ?", scheduleID, userID).Find(&checks).Error
+	if err != nil {
+		return nil, err
+	}
+	return checks, nil
+}
+
+// Set creates or replaces a user's check state for one item
+func (r *GORMChecklistRepository) Set(check *models.ChecklistCheck) error {
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "schedule_id"}, {Name: "user_id"}, {Name: "item_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"checked", "updated_at"}),
+	}).Create(check).Error
+	if err != nil {
+		return err
+	}
+
+	// On conflict the existing row keeps its ID, so reload it
+	return r.db.Where("schedule_id = ? AND user_id = ? AND item_key = ?",
+		check.ScheduleID, check.UserID, check.ItemKey).First(check).Error
+}
@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"tripflow/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExchangeRateRepository defines the interface for exchange rate data operations
+type ExchangeRateRepository interface {
+	// Upsert creates a rate or replaces the rate for the same pair and date
+	Upsert(rate *models.ExchangeRate) error
+
+	// UpsertBatch upserts several rates in a single transaction
+	UpsertBatch(rates []*models.ExchangeRate) error
+
+	// GetByID retrieves a rate by its ID
+	GetByID(id uuid.UUID) (*models.ExchangeRate, error)
+
+	// List retrieves rates with pagination, optionally filtered by currency pair
+	List(base, quote string, offset, limit int) ([]*models.ExchangeRate, int64, error)
+
+	// Delete removes a rate by ID
+	Delete(id uuid.UUID) error
+
+	// FindRate returns the rate for a pair that applies on the given date: the
+	// latest rate effective on or before it, or the earliest one after it
+	// when no earlier rate exists
+	FindRate(base, quote string, on time.Time) (*models.ExchangeRate, error)
+}
+
+// GORMExchangeRateRepository implements ExchangeRateRepository using GORM
+type GORMExchangeRateRepository struct {
+	db *gorm.DB
+}
+
+// NewExchangeRateRepository creates a new GORM-based exchange rate repository
+func NewExchangeRateRepository(db *gorm.DB) ExchangeRateRepository {
+	return &GORMExchangeRateRepository{
+		db: db,
+	}
+}
+
+// upsertClause replaces the rate when the pair and date already exist
+var upsertClause = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "base_currency"}, {Name: "quote_currency"}, {Name: "effective_date"}},
+	DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "updated_at"}),
+}
+
+// Upsert creates a rate or replaces the rate for the same pair and date
+func (r *GORMExchangeRateRepository) Upsert(rate *models.ExchangeRate) error {
+	if err := r.db.Clauses(upsertClause).Create(rate).Error; err != nil {
+		return err
+	}
+
+	// On conflict the existing row keeps its ID, so reload it
+	return r.db.Where("base_currency = ? AND quote_currency = ? AND effective_date = ?",
+		rate.BaseCurrency, rate.QuoteCurrency, rate.EffectiveDate).First(rate).Error
+}
+
+// UpsertBatch upserts several rates in a single transaction
+func (r *GORMExchangeRateRepository) UpsertBatch(rates []*models.ExchangeRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, rate := range rates {
+			if err := tx.Clauses(upsertClause).Create(rate).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetByID retrieves a rate by its ID
+func (r *GORMExchangeRateRepository) GetByID(id uuid.UUID) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	if err := r.db.Where("id = ?", id).First(&rate).Error; err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// List retrieves rates with pagination, optionally filtered by currency pair
+func (r *GORMExchangeRateRepository) List(base, quote string, offset, limit int) ([]*models.ExchangeRate, int64, error) {
+	var rates []*models.ExchangeRate
+	var total int64
+
+	query := r.db.Model(&models.ExchangeRate{})
+	if base != "" {
+		query = query.Where("base_currency = ?", strings.ToUpper(base))
+	}
+	if quote != "" {
+		query = query.Where("quote_currency = ?", strings.ToUpper(quote))
+	}
+
+	// Get total count
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Get paginated results, newest first
+	err := query.Order("effective_date DESC").Order("base_currency").Order("quote_currency").
+		Offset(offset).Limit(limit).Find(&rates).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return rates, total, nil
+}
+
+// Delete removes a rate by ID
+func (r *GORMExchangeRateRepository) Delete(id uuid.UUID) error {
+	return r.db.Delete(&models.ExchangeRate{}, "id = ?", id).Error
+}
+
+// FindRate returns the rate for a pair that applies on the given date
+func (r *GORMExchangeRateRepository) FindRate(base, quote string, on time.Time) (*models.ExchangeRate, error) {
+	base, quote = strings.ToUpper(base), strings.ToUpper(quote)
+
+	// Rates are stored at midnight UTC, so compare against the end of the day
+	y, m, d := on.Date()
+	endOfDay := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+
+	var rate models.ExchangeRate
+	err := r.db.Where("base_currency = ? AND quote_currency = ? AND effective_date < ?", base, quote, endOfDay).
+		Order("effective_date DESC").First(&rate).Error
+	if err == nil {
+		return &rate, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	err = r.db.Where("base_currency = ? AND quote_currency = ?", base, quote).
+		Order("effective_date ASC").First(&rate).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"tripflow/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ExpenseRepository defines the interface for expense ledger data operations
+type ExpenseRepository interface {
+	// Create creates a new expense together with its participants
+	Create(expense *models.Expense) error
+
+	// GetByID retrieves an expense and its participants by ID
+	GetByID(id uuid.UUID) (*models.Expense, error)
+
+	// ListBySchedule retrieves all expenses of a schedule, oldest first
+	ListBySchedule(scheduleID uuid.UUID) ([]*models.Expense, error)
+
+	// Update saves an expense and replaces its participants
+	Update(expense *models.Expense) error
+
+	// Delete removes an expense by ID
+	Delete(id uuid.UUID) error
+
+	// IsMember reports whether a user pays for or shares in an expense the
+	// schedule's owner recorded
+	IsMember(scheduleID uuid.UUID, userID string) (bool, error)
+}
+
+// GORMExpenseRepository implements ExpenseRepository using GORM
+type GORMExpenseRepository struct {
+	db *gorm.DB
+}
+
+// NewExpenseRepository creates a new GORM-based expense repository
+func NewExpenseRepository(db *gorm.DB) ExpenseRepository {
+	return &GORMExpenseRepository{
+		db: db,
+	}
+}
+
+// Create creates a new expense together with its participants
+func (r *GORMExpenseRepository) Create(expense *models.Expense) error {
+	return r.db.Create(expense).Error
+}
+
+// GetByID retrieves an expense and its participants by ID
+func (r *GORMExpenseRepository) GetByID(id uuid.UUID) (*models.Expense, error) {
+	var expense models.Expense
+	err := r.db.Preload("Participants").Where("id = ?", id).First(&expense).Error
+	if err != nil {
+		return nil, err
+	}
+	return &expense, nil
+}
+
+// ListBySchedule retrieves all expenses of a schedule, oldest first
+func (r *GORMExpenseRepository) ListBySchedule(scheduleID uuid.UUID) ([]*models.Expense, error) {
+	var expenses []*models.Expense
+	err := r.db.Preload("Participants").Where("schedule_id = ?", scheduleID).
+		Order("spent_at ASC").Order("created_at ASC").Find(&expenses).Error
+	if err != nil {
+		return nil, err
+	}
+	return expenses, nil
+}
+
+// Update saves an expense and replaces its participants
+func (r *GORMExpenseRepository) Update(expense *models.Expense) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expense_id = ?", expense.ID).Delete(&models.ExpenseParticipant{}).Error; err != nil {
+			return err
+		}
+		for i := range expense.Participants {
+			expense.Participants[i].ID = uuid.Nil
+			expense.Participants[i].ExpenseID = expense.ID
+		}
+		if len(expense.Participants) > 0 {
+			if err := tx.Create(&expense.Participants).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Omit("Participants").Save(expense).Error
+	})
+}
+
+// Delete removes an expense by ID. Participants are kept with the
+// soft-deleted expense so it can be restored intact.
+func (r *GORMExpenseRepository) Delete(id uuid.UUID) error {
+	return r.db.Delete(&models.Expense{}, "id = ?", id).Error
+}
+
+// IsMember reports whether a user pays for or shares in an expense the
+// schedule's owner recorded. Expenses recorded by other members do not
+// count, so members cannot let anyone else into the ledger.
+func (r *GORMExpenseRepository) IsMember(scheduleID uuid.UUID, userID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Expense{}).
+		Where("schedule_id = ?", scheduleID).
+		Where("created_by = (?)", r.db.Model(&models.Schedule{}).Select("user_id").Where("id = ?", scheduleID)).
+		Where("payer_user_id = ? OR id IN (?)", userID,
+			r.db.Model(&models.ExpenseParticipant{}).Select("expense_id").Where("user_id = ?", userID)).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,274 @@
+package repositories
+
+import (
+	"errors"
+
+	"tripflow/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FileRepository defines the interface for uploaded file records
+type FileRepository interface {
+	// GetByID retrieves a file record by its ID
+	GetByID(id uuid.UUID) (*models.File, error)
+
+	// GetByPath retrieves a file record by its storage path
+	GetByPath(filePath string) (*models.File, error)
+
+	// FindByFilename retrieves the most recent upload of a user with the
+	// given original filename
+	FindByFilename(userID uuid.UUID, filename string) (*models.File, error)
+
+	// CreateWithVariants creates a file record together with its image variants
+	CreateWithVariants(file *models.File, variants []models.ImageVariant) error
+
+	// ListVariants retrieves the image variants of a file, smallest first
+	ListVariants(fileID uuid.UUID) ([]*models.ImageVariant, error)
+
+	// FindByPath retrieves the file records stored at filePath or, for an
+	// image variant, the file it was made from
+	FindByPath(filePath string) ([]*models.File, error)
+
+	// IsOwnedBy reports whether the file or image variant stored at
+	// filePath was uploaded by the user
+	IsOwnedBy(filePath string, userID uuid.UUID) (bool, error)
+
+	// ListAll retrieves every file record
+	ListAll() ([]*models.File, error)
+
+	// ListAllVariants retrieves every image variant
+	ListAllVariants() ([]*models.ImageVariant, error)
+
+	// Delete removes a file record with its image variants and returns the
+	// storage paths they referred to, one per stored upload
+	Delete(id uuid.UUID) ([]string, error)
+
+	// DeleteByPath removes the file records and image variants stored at
+	// filePath, with the variants of removed files, and returns the storage
+	// paths they referred to, one per stored upload
+	DeleteByPath(filePath string) ([]string, error)
+
+	// UpdatePath points the file records, image variants and blob stored
+	// at oldPath to newPath
+	UpdatePath(oldPath, newPath string) error
+}
+
+// GORMFileRepository implements FileRepository using GORM
+type GORMFileRepository struct {
+	db *gorm.DB
+}
+
+// NewFileRepository creates a new GORM-based file repository
+func NewFileRepository(db *gorm.DB) FileRepository {
+	return &GORMFileRepository{
+		db: db,
+	}
+}
+
+// GetByID retrieves a file record by its ID
+func (r *GORMFileRepository) GetByID(id uuid.UUID) (*models.File, error) {
+	var file models.File
+	err := r.db.Where("id = ?", id).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetByPath retrieves a file record by its storage path
+func (r *GORMFileRepository) GetByPath(filePath string) (*models.File, error) {
+	var file models.File
+	err := r.db.Where("file_path = ?", filePath).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// FindByFilename retrieves the most recent upload of a user with the given
+// original filename
+func (r *GORMFileRepository) FindByFilename(userID uuid.UUID, filename string) (*models.File, error) {
+	var file models.File
+	err := r.db.Where("user_id = ? AND filename = ?", userID, filename).
+		Order("upload_date DESC").First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// CreateWithVariants creates a file record together with its image variants
+func (r *GORMFileRepository) CreateWithVariants(file *models.File, variants []models.ImageVariant) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(file).Error; err != nil {
+			return err
+		}
+		for i := range variants {
+			variants[i].FileID = file.ID
+		}
+		if len(variants) > 0 {
+			if err := tx.Create(&variants).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListVariants retrieves the image variants of a file, smallest first
+func (r *GORMFileRepository) ListVariants(fileID uuid.UUID) ([]*models.ImageVariant, error) {
+	var variants []*models.ImageVariant
+	err := r.db.Where("file_id = ?", fileID).Order("width ASC").Find(&variants).Error
+	if err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+// IsOwnedBy reports whether the file or image variant stored at filePath
+// was uploaded by the user
+func (r *GORMFileRepository) IsOwnedBy(filePath string, userID uuid.UUID) (bool, error) {
+	files, err := r.FindByPath(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	for _, file := range files {
+		if file.UserID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FindByPath retrieves the file records stored at filePath or, for an
+// image variant, the file it was made from. With deduplicating storage
+// several uploads can share a path.
+func (r *GORMFileRepository) FindByPath(filePath string) ([]*models.File, error) {
+	var files []*models.File
+	if err := r.db.Where("file_path = ?", filePath).Find(&files).Error; err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		return files, nil
+	}
+
+	var variants []*models.ImageVariant
+	if err := r.db.Where("file_path = ?", filePath).Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	for _, variant := range variants {
+		file, err := r.GetByID(variant.FileID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// ListAll retrieves every file record
+func (r *GORMFileRepository) ListAll() ([]*models.File, error) {
+	var files []*models.File
+	if err := r.db.Order("created_at ASC").Find(&files).Error; err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ListAllVariants retrieves every image variant
+func (r *GORMFileRepository) ListAllVariants() ([]*models.ImageVariant, error) {
+	var variants []*models.ImageVariant
+	if err := r.db.Order("created_at ASC").Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+// Delete removes a file record with its image variants and returns the
+// storage paths they referred to, one per stored upload
+func (r *GORMFileRepository) Delete(id uuid.UUID) ([]string, error) {
+	var paths []string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		paths, err = deleteFiles(tx, "id = ?", id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// DeleteByPath removes the file records and image variants stored at
+// filePath, with the variants of removed files, and returns the storage
+// paths they referred to, one per stored upload
+func (r *GORMFileRepository) DeleteByPath(filePath string) ([]string, error) {
+	var paths []string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if paths, err = deleteFiles(tx, "file_path = ?", filePath); err != nil {
+			return err
+		}
+
+		var variants []*models.ImageVariant
+		if err := tx.Where("file_path = ?", filePath).Find(&variants).Error; err != nil {
+			return err
+		}
+		for _, variant := range variants {
+			paths = append(paths, variant.FilePath)
+		}
+		return tx.Where("file_path = ?", filePath).Delete(&models.ImageVariant{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// UpdatePath points the file records, image variants and blob stored at
+// oldPath to newPath, for files moved to another storage
+func (r *GORMFileRepository) UpdatePath(oldPath, newPath string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.File{}).Where("file_path = ?", oldPath).Update("file_path", newPath).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ImageVariant{}).Where("file_path = ?", oldPath).Update("file_path", newPath).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Blob{}).Where("file_path = ?", oldPath).Update("file_path", newPath).Error
+	})
+}
+
+// deleteFiles removes the file records matching the condition with their
+// image variants and returns the storage paths they referred to
+func deleteFiles(tx *gorm.DB, condition string, args ...interface{}) ([]string, error) {
+	var files []*models.File
+	if err := tx.Where(condition, args...).Find(&files).Error; err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, file := range files {
+		var variants []*models.ImageVariant
+		if err := tx.Where("file_id = ?", file.ID).Find(&variants).Error; err != nil {
+			return nil, err
+		}
+		paths = append(paths, file.FilePath)
+		for _, variant := range variants {
+			paths = append(paths, variant.FilePath)
+		}
+		if err := tx.Where("file_id = ?", file.ID).Delete(&models.ImageVariant{}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Delete(file).Error; err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
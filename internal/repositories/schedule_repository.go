@@ -32,6 +32,25 @@ type ScheduleRepository interface {
 
 	// GetByFileID retrieves a schedule by its associated file ID
 	GetByFileID(fileID uuid.UUID) (*models.Schedule, error)
+
+	// HasPublicWithFile reports whether any public schedule of ownerID is
+	// made from the file
+	HasPublicWithFile(fileID, ownerID uuid.UUID) (bool, error)
+
+	// SetFileRefs replaces the uploads a schedule's markdown refers to and
+	// marks the schedule as indexed
+	SetFileRefs(scheduleID uuid.UUID, refs []models.ScheduleFileRef) error
+
+	// HasPublicRef reports whether the markdown of any public schedule of
+	// ownerID refers to filePath, or to filename by an image reference
+	HasPublicRef(ownerID uuid.UUID, filePath, filename string) (bool, error)
+
+	// ListUnindexed retrieves the schedules whose file references have not
+	// been recorded yet
+	ListUnindexed() ([]*models.Schedule, error)
+
+	// ListAll retrieves every schedule
+	ListAll() ([]*models.Schedule, error)
 }
 
 // GORMScheduleRepository implements ScheduleRepository using GORM
@@ -126,3 +145,69 @@ func (r *GORMScheduleRepository) GetByFileID(fileID uuid.UUID) (*models.Schedule
 	}
 	return &schedule, nil
 }
+
+// HasPublicWithFile reports whether any public schedule of ownerID is made
+// from the file
+func (r *GORMScheduleRepository) HasPublicWithFile(fileID, ownerID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Schedule{}).
+		Where("file_id = ? AND user_id = ? AND is_public = ?", fileID, ownerID, true).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// SetFileRefs replaces the uploads a schedule's markdown refers to and
+// marks the schedule as indexed
+func (r *GORMScheduleRepository) SetFileRefs(scheduleID uuid.UUID, refs []models.ScheduleFileRef) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("schedule_id = ?", scheduleID).Delete(&models.ScheduleFileRef{}).Error; err != nil {
+			return err
+		}
+		for i := range refs {
+			refs[i].ScheduleID = scheduleID
+		}
+		if len(refs) > 0 {
+			if err := tx.Create(&refs).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Schedule{}).Where("id = ?", scheduleID).Update("file_refs_indexed", true).Error
+	})
+}
+
+// HasPublicRef reports whether the markdown of any public schedule of
+// ownerID refers to filePath, or to filename by an image reference
+func (r *GORMScheduleRepository) HasPublicRef(ownerID uuid.UUID, filePath, filename string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Schedule{}).
+		Joins("JOIN schedule_file_refs ON schedule_file_refs.schedule_id = schedules.id").
+		Where("schedules.user_id = ? AND schedules.is_public = ?", ownerID, true).
+		Where("schedule_file_refs.path = ? OR (schedule_file_refs.filename <> '' AND schedule_file_refs.filename = ?)", filePath, filename).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ListUnindexed retrieves the schedules whose file references have not been
+// recorded yet
+func (r *GORMScheduleRepository) ListUnindexed() ([]*models.Schedule, error) {
+	var schedules []*models.Schedule
+	if err := r.db.Preload("File").Where("file_refs_indexed = ?", false).Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// ListAll retrieves every schedule
+func (r *GORMScheduleRepository) ListAll() ([]*models.Schedule, error) {
+	var schedules []*models.Schedule
+	if err := r.db.Order("created_at ASC").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
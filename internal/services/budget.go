@@ -0,0 +1,614 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Currency describes a currency the budget parser understands
+type Currency struct {
+	Code     string `json:"code"`
+	Symbol   string `json:"symbol"`
+	Exponent int    `json:"exponent"` // Number of minor-unit digits (KRW 0, USD 2)
+}
+
+// supportedCurrencies lists the currencies recognised in budget lines
+var supportedCurrencies = map[string]Currency{
+	"KRW": {Code: "KRW", Symbol: "₩", Exponent: 0},
+	"USD": {Code: "USD", Symbol: "$", Exponent: 2},
+	"EUR": {Code: "EUR", Symbol: "€", Exponent: 2},
+}
+
+// currencyMarker maps a written currency marker to its ISO code
+type currencyMarker struct {
+	text string
+	code string
+}
+
+// currencyPrefixes are markers that may appear before the number.
+// Longer markers come first so "US$" wins over "$".
+var currencyPrefixes = []currencyMarker{
+	{"US$", "USD"},
+	{"KRW", "KRW"},
+	{"USD", "USD"},
+	{"EUR", "EUR"},
+	{"₩", "KRW"},
+	{"$", "USD"},
+	{"€", "EUR"},
+}
+
+// currencySuffixes are markers that may appear after the number
+var currencySuffixes = []currencyMarker{
+	{"KRW", "KRW"},
+	{"USD", "USD"},
+	{"EUR", "EUR"},
+	{"달러", "USD"},
+	{"유로", "EUR"},
+	{"원", "KRW"},
+	{"€", "EUR"},
+}
+
+// koreanMultipliers are unit words written between the number and 원 (e.g. "20만원")
+var koreanMultipliers = []struct {
+	text  string
+	value int64
+}{
+	{"만", 10000},
+	{"천", 1000},
+}
+
+// LookupCurrency returns the currency for an ISO code
+func LookupCurrency(code string) (Currency, bool) {
+	c, ok := supportedCurrencies[strings.ToUpper(strings.TrimSpace(code))]
+	return c, ok
+}
+
+// Money is an amount in a single currency, stored in minor units
+type Money struct {
+	Amount   int64  `json:"amount"`   // Amount in minor units (e.g. cents for USD)
+	Currency string `json:"currency"` // ISO 4217 code
+}
+
+// String formats the amount with its currency symbol and digit grouping
+func (m Money) String() string {
+	currency, ok := supportedCurrencies[m.Currency]
+	if !ok {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	scale := int64(1)
+	for i := 0; i < currency.Exponent; i++ {
+		scale *= 10
+	}
+
+	result := sign + currency.Symbol + groupThousands(amount/scale)
+	if currency.Exponent > 0 {
+		result += fmt.Sprintf(".%0*d", currency.Exponent, amount%scale)
+	}
+	return result
+}
+
+// MarshalJSON adds a human-readable "display" field next to the raw amount
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+		Display  string `json:"display"`
+	}{m.Amount, m.Currency, m.String()})
+}
+
+// groupThousands formats a non-negative integer with comma separators
+func groupThousands(n int64) string {
+	digits := fmt.Sprintf("%d", n)
+	var b strings.Builder
+	for i, r := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ParseAmount parses a written amount such as "200,000원", "₩15000",
+// "USD 12.50", "$1,234.56", "35,50 €" or "20만원" into Money
+func ParseAmount(raw string) (Money, error) {
+	s := strings.TrimSpace(raw)
+	// Drop a trailing note in parentheses, e.g. "50,000원 (왕복)"
+	if idx := strings.IndexAny(s, "(（"); idx > 0 {
+		s = strings.TrimSpace(s[:idx])
+	}
+	s = strings.TrimSpace(strings.TrimPrefix(s, "약"))
+	if s == "" {
+		return Money{}, fmt.Errorf("amount is empty")
+	}
+
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "−") {
+		negative = true
+		s = strings.TrimSpace(strings.TrimLeft(s, "-−"))
+	}
+
+	// Identify the currency from a prefix or suffix marker
+	code := ""
+	for _, marker := range currencyPrefixes {
+		if strings.HasPrefix(strings.ToUpper(s), marker.text) {
+			code = marker.code
+			s = strings.TrimSpace(s[len(marker.text):])
+			break
+		}
+	}
+	for _, marker := range currencySuffixes {
+		if strings.HasSuffix(strings.ToUpper(s), marker.text) {
+			if code != "" && code != marker.code {
+				return Money{}, fmt.Errorf("conflicting currency markers in %q", raw)
+			}
+			code = marker.code
+			s = strings.TrimSpace(s[:len(s)-len(marker.text)])
+			break
+		}
+	}
+	if code == "" {
+		return Money{}, fmt.Errorf("no currency found in %q", raw)
+	}
+
+	// Korean unit words only make sense for won amounts
+	multiplier := int64(1)
+	if code == "KRW" {
+		for _, unit := range koreanMultipliers {
+			if strings.HasSuffix(s, unit.text) {
+				multiplier = unit.value
+				s = strings.TrimSpace(strings.TrimSuffix(s, unit.text))
+				break
+			}
+		}
+	}
+
+	value, err := parseLocalizedNumber(s)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q: %w", raw, err)
+	}
+
+	currency := supportedCurrencies[code]
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(currency.Exponent)), nil)
+	value.Mul(value, new(big.Rat).SetInt64(multiplier))
+	value.Mul(value, new(big.Rat).SetInt(scale))
+
+	minor, err := roundRat(value)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q: %w", raw, err)
+	}
+	if negative {
+		minor = -minor
+	}
+
+	return Money{Amount: minor, Currency: code}, nil
+}
+
+// parseLocalizedNumber parses digits with either "," or "." as the decimal
+// separator. When both appear the last one is the decimal separator; when
+// only one appears, groups of exactly three digits are read as thousands.
+func parseLocalizedNumber(s string) (*big.Rat, error) {
+	s = strings.NewReplacer(" ", "", " ", "", " ", "", "'", "").Replace(s)
+	if s == "" {
+		return nil, fmt.Errorf("no digits")
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && r != ',' && r != '.' {
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+
+	lastComma := strings.LastIndex(s, ",")
+	lastDot := strings.LastIndex(s, ".")
+
+	decimalSep := ""
+	switch {
+	case lastComma >= 0 && lastDot >= 0:
+		if lastComma > lastDot {
+			decimalSep = ","
+		} else {
+			decimalSep = "."
+		}
+	case lastComma >= 0:
+		decimalSep = decimalSeparatorFor(s, ",")
+	case lastDot >= 0:
+		decimalSep = decimalSeparatorFor(s, ".")
+	}
+
+	var intPart, fracPart string
+	if decimalSep != "" {
+		idx := strings.LastIndex(s, decimalSep)
+		intPart, fracPart = s[:idx], s[idx+1:]
+	} else {
+		intPart = s
+	}
+	intPart = strings.NewReplacer(",", "", ".", "").Replace(intPart)
+	if strings.ContainsAny(fracPart, ",.") {
+		return nil, fmt.Errorf("misplaced separator")
+	}
+	if intPart == "" && fracPart == "" {
+		return nil, fmt.Errorf("no digits")
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+
+	value, ok := new(big.Rat).SetString(intPart + "." + fracPart + "0")
+	if !ok {
+		return nil, fmt.Errorf("not a number")
+	}
+	return value, nil
+}
+
+// decimalSeparatorFor decides whether the only separator kind in s is a
+// decimal point or thousands grouping
+func decimalSeparatorFor(s, sep string) string {
+	if strings.Count(s, sep) > 1 {
+		return ""
+	}
+	idx := strings.Index(s, sep)
+	if len(s)-idx-1 == 3 && idx > 0 {
+		return ""
+	}
+	return sep
+}
+
+// roundRat rounds a rational to the nearest integer, halves away from zero
+func roundRat(r *big.Rat) (int64, error) {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("amount out of range")
+	}
+	if r.Sign() < 0 {
+		return -quo.Int64(), nil
+	}
+	return quo.Int64(), nil
+}
+
+// BudgetLine is a single parsed "label: amount" entry
+type BudgetLine struct {
+	Line     int    `json:"line"`          // 1-based line number in the markdown
+	Day      int    `json:"day,omitempty"` // Day number, 0 for trip-wide budget entries
+	Category string `json:"category"`
+	Raw      string `json:"raw"`
+	Amount   Money  `json:"amount"`
+
+	section int // Budget section the line belongs to, -1 outside one
+}
+
+// BudgetIssue describes a line in a budget section that could not be parsed
+type BudgetIssue struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Raw     string `json:"raw"`
+	Message string `json:"message"`
+}
+
+// CategoryTotal holds per-currency totals for one category
+type CategoryTotal struct {
+	Category string  `json:"category"`
+	Totals   []Money `json:"totals"`
+}
+
+// DayTotal holds per-currency totals for one day of the trip
+type DayTotal struct {
+	Day    int     `json:"day"`
+	Totals []Money `json:"totals"`
+}
+
+// StatedTotal is the hand-written total found in the markdown and how it
+// compares to the computed sum
+type StatedTotal struct {
+	Line     int    `json:"line"`
+	Raw      string `json:"raw"`
+	Amount   Money  `json:"amount"`
+	Computed *Money `json:"computed,omitempty"` // Sum of the lines it covers, in the same currency
+	Mismatch bool   `json:"mismatch"`
+	Note     string `json:"note,omitempty"`
+
+	section int
+}
+
+// BudgetSummary is the budget information extracted from a trip's markdown
+type BudgetSummary struct {
+	Lines       []BudgetLine    `json:"lines"`
+	Totals      []Money         `json:"totals"` // One entry per currency
+	ByCategory  []CategoryTotal `json:"by_category"`
+	ByDay       []DayTotal      `json:"by_day"`
+	StatedTotal *StatedTotal    `json:"stated_total,omitempty"`
+	Issues      []BudgetIssue   `json:"issues,omitempty"`
+
+	// Converted holds the totals in the schedule's home currency, when
+	// exchange rates were available to compute them
+	Converted *ConvertedBudget `json:"converted,omitempty"`
+}
+
+var (
+	headingRegex       = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+	fenceRegex         = regexp.MustCompile("^\\s{0,3}(```|~~~)")
+	listItemRegex      = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+(.*)$`)
+	dayHeadingRegex    = regexp.MustCompile(`(?i)(\d+)\s*일차|\bday\s*(\d+)\b`)
+	budgetHeadingRegex = regexp.MustCompile(`(?i)예산|비용|경비|budget|expenses?|costs?`)
+	totalLabelRegex    = regexp.MustCompile(`(?i)^(총\s*(예산|비용|경비|합계|금액)?|합계|총액|total(\s+budget)?|grand\s+total)$`)
+	emphasisReplacer   = strings.NewReplacer("**", "", "__", "", "`", "")
+)
+
+// ParseDayNumber returns the day number in a heading such as "1일차 - 제주시"
+// or "Day 2", or 0 when the heading is not a day heading
+func ParseDayNumber(heading string) int {
+	match := dayHeadingRegex.FindStringSubmatch(heading)
+	if match == nil {
+		return 0
+	}
+	var day int
+	for _, group := range match[1:] {
+		if group != "" {
+			fmt.Sscanf(group, "%d", &day)
+			break
+		}
+	}
+	return day
+}
+
+// isBudgetHeading reports whether a heading introduces a budget section
+func isBudgetHeading(heading string) bool {
+	return budgetHeadingRegex.MatchString(heading)
+}
+
+// splitLabelValue splits "label: value" on the first ASCII or full-width colon
+func splitLabelValue(s string) (label, value string, valueOffset int, ok bool) {
+	idx := strings.IndexAny(s, ":：")
+	if idx < 0 {
+		return "", "", 0, false
+	}
+	_, size := utf8.DecodeRuneInString(s[idx:])
+	value = s[idx+size:]
+	valueOffset = idx + size + (len(value) - len(strings.TrimLeft(value, " \t")))
+	return strings.TrimSpace(s[:idx]), strings.TrimSpace(value), valueOffset, true
+}
+
+// cleanLabel strips emphasis markers from a budget label
+func cleanLabel(label string) string {
+	label = emphasisReplacer.Replace(label)
+	return strings.TrimSpace(strings.Trim(label, "*_"))
+}
+
+// ExtractBudget scans markdown for budget lines and computes totals.
+// Lines under a budget heading ("### 예산", "## Budget") are trip-wide
+// entries unless the heading names a day; "label: amount" list items inside
+// a day section count towards that day. Returns nil when nothing is found.
+func ExtractBudget(markdown string) *BudgetSummary {
+	summary := &BudgetSummary{}
+
+	type sectionState struct {
+		level int
+		id    int
+		day   int
+	}
+	var budgetSection *sectionState
+	currentDay, dayLevel := 0, 0
+	sectionCount := 0
+	inFence := false
+
+	scanner := bufio.NewScanner(strings.NewReader(markdown))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+
+		// Skip fenced code blocks entirely
+		if fenceRegex.MatchString(line) {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+
+		if match := headingRegex.FindStringSubmatch(line); match != nil {
+			level := len(match[1])
+			text := match[2]
+
+			if budgetSection != nil && level <= budgetSection.level {
+				budgetSection = nil
+			}
+			if currentDay != 0 && level <= dayLevel {
+				currentDay, dayLevel = 0, 0
+			}
+
+			if day := ParseDayNumber(text); day > 0 && !isBudgetHeading(text) {
+				currentDay, dayLevel = day, level
+			} else if isBudgetHeading(text) {
+				sectionCount++
+				budgetSection = &sectionState{level: level, id: sectionCount, day: ParseDayNumber(text)}
+			}
+			continue
+		}
+
+		body := line
+		isListItem := false
+		if match := listItemRegex.FindStringSubmatch(line); match != nil {
+			body = match[1]
+			isListItem = true
+		}
+		if strings.TrimSpace(body) == "" {
+			continue
+		}
+
+		// Bold paragraphs like "**총 예산: 500,000원**" wrap the whole line
+		stripped := strings.TrimSpace(body)
+		bodyOffset := strings.Index(line, stripped)
+		if strings.HasPrefix(stripped, "**") && strings.HasSuffix(stripped, "**") && len(stripped) > 4 {
+			stripped = stripped[2 : len(stripped)-2]
+			bodyOffset += 2
+		}
+
+		label, value, valueOffset, ok := splitLabelValue(stripped)
+		if !ok {
+			continue
+		}
+		label = cleanLabel(label)
+		value = strings.TrimSpace(strings.Trim(value, "*_"))
+		column := utf8.RuneCountInString(line[:bodyOffset+valueOffset]) + 1
+
+		inBudget := budgetSection != nil
+		if !inBudget && !isListItem {
+			continue
+		}
+
+		amount, err := ParseAmount(value)
+		if err != nil {
+			// Outside budget sections "label: value" is ordinary itinerary text
+			if inBudget && label != "" {
+				summary.Issues = append(summary.Issues, BudgetIssue{
+					Line:    lineNo,
+					Column:  column,
+					Raw:     strings.TrimSpace(line),
+					Message: err.Error(),
+				})
+			}
+			continue
+		}
+
+		section := -1
+		day := currentDay
+		if inBudget {
+			section = budgetSection.id
+			day = budgetSection.day
+		}
+
+		if totalLabelRegex.MatchString(label) {
+			summary.StatedTotal = &StatedTotal{
+				Line:    lineNo,
+				Raw:     strings.TrimSpace(line),
+				Amount:  amount,
+				section: section,
+			}
+			continue
+		}
+
+		summary.Lines = append(summary.Lines, BudgetLine{
+			Line:     lineNo,
+			Day:      day,
+			Category: label,
+			Raw:      strings.TrimSpace(line),
+			Amount:   amount,
+			section:  section,
+		})
+	}
+
+	if len(summary.Lines) == 0 && summary.StatedTotal == nil && len(summary.Issues) == 0 {
+		return nil
+	}
+
+	summary.computeTotals()
+	return summary
+}
+
+// computeTotals fills in the per-currency, per-category and per-day totals
+// and checks the stated total against the computed sum
+func (b *BudgetSummary) computeTotals() {
+	b.Totals = sumByCurrency(b.Lines)
+
+	var categories []string
+	byCategory := make(map[string][]BudgetLine)
+	var days []int
+	byDay := make(map[int][]BudgetLine)
+	for _, line := range b.Lines {
+		if _, seen := byCategory[line.Category]; !seen {
+			categories = append(categories, line.Category)
+		}
+		byCategory[line.Category] = append(byCategory[line.Category], line)
+		if line.Day > 0 {
+			if _, seen := byDay[line.Day]; !seen {
+				days = append(days, line.Day)
+			}
+			byDay[line.Day] = append(byDay[line.Day], line)
+		}
+	}
+
+	b.ByCategory = make([]CategoryTotal, 0, len(categories))
+	for _, category := range categories {
+		b.ByCategory = append(b.ByCategory, CategoryTotal{
+			Category: category,
+			Totals:   sumByCurrency(byCategory[category]),
+		})
+	}
+
+	sort.Ints(days)
+	b.ByDay = make([]DayTotal, 0, len(days))
+	for _, day := range days {
+		b.ByDay = append(b.ByDay, DayTotal{Day: day, Totals: sumByCurrency(byDay[day])})
+	}
+
+	if b.StatedTotal != nil {
+		b.checkStatedTotal()
+	}
+}
+
+// checkStatedTotal compares the hand-written total with the lines it covers:
+// the lines of its own budget section, or every line when it stands alone
+func (b *BudgetSummary) checkStatedTotal() {
+	stated := b.StatedTotal
+
+	var covered []BudgetLine
+	for _, line := range b.Lines {
+		if stated.section < 0 || line.section == stated.section {
+			covered = append(covered, line)
+		}
+	}
+
+	totals := sumByCurrency(covered)
+	switch {
+	case len(totals) == 0:
+		stated.Note = "no budget lines to compare against"
+	case len(totals) > 1:
+		stated.Note = "budget lines use several currencies; convert them to compare"
+	case totals[0].Currency != stated.Amount.Currency:
+		stated.Note = fmt.Sprintf("stated total is in %s but budget lines are in %s", stated.Amount.Currency, totals[0].Currency)
+	default:
+		computed := totals[0]
+		stated.Computed = &computed
+		stated.Mismatch = computed.Amount != stated.Amount.Amount
+	}
+}
+
+// sumByCurrency adds up line amounts, returning one Money per currency in
+// order of first appearance
+func sumByCurrency(lines []BudgetLine) []Money {
+	var totals []Money
+	index := make(map[string]int)
+	for _, line := range lines {
+		i, ok := index[line.Amount.Currency]
+		if !ok {
+			i = len(totals)
+			index[line.Amount.Currency] = i
+			totals = append(totals, Money{Currency: line.Amount.Currency})
+		}
+		totals[i].Amount += line.Amount.Amount
+	}
+	if totals == nil {
+		totals = []Money{}
+	}
+	return totals
+}
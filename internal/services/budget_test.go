@@ -0,0 +1,145 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const sampleTripMarkdown = "# 제주도 3박 4일 여행\n\n## 1일차 - 제주시\n- **오전**: 제주공항 도착\n- **점심**: 제주시내 맛집 투어\n\n## 2일차 - 서귀포\n- **오전**: 중문관광단지\n- 입장료: 12,000원\n\n## 4일차 - 출발\n- **오전**: 마지막 쇼핑\n\n### 예산\n- 항공료: 200,000원\n- 숙박비: 150,000원\n- 식비: 100,000원\n- 교통비: 50,000원\n\n**총 예산: 500,000원**"
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    Money
+		wantErr bool
+	}{
+		{name: "Won suffix", raw: "200,000원", want: Money{200000, "KRW"}},
+		{name: "Won symbol", raw: "₩15000", want: Money{15000, "KRW"}},
+		{name: "KRW code", raw: "KRW 1,000,000", want: Money{1000000, "KRW"}},
+		{name: "Korean unit", raw: "20만원", want: Money{200000, "KRW"}},
+		{name: "Fractional Korean unit", raw: "1.5만원", want: Money{15000, "KRW"}},
+		{name: "Dollar symbol", raw: "$1,234.56", want: Money{123456, "USD"}},
+		{name: "USD suffix", raw: "12.5 USD", want: Money{1250, "USD"}},
+		{name: "Euro comma decimal", raw: "35,50 €", want: Money{3550, "EUR"}},
+		{name: "Euro grouped", raw: "€1.234,56", want: Money{123456, "EUR"}},
+		{name: "Trailing note", raw: "50,000원 (왕복)", want: Money{50000, "KRW"}},
+		{name: "Negative refund", raw: "-10,000원", want: Money{-10000, "KRW"}},
+		{name: "No currency", raw: "100,000", wantErr: true},
+		{name: "Not a number", raw: "제주공항 도착", wantErr: true},
+		{name: "Conflicting markers", raw: "$100원", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAmount(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseAmount(%q) expected error, got %v", tt.raw, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ParseAmount(%q) error = %v", tt.raw, err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseAmount(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{500000, "KRW"}, "₩500,000"},
+		{Money{123456, "USD"}, "$1,234.56"},
+		{Money{-5, "EUR"}, "-€0.05"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("Money.String() = %v, want %v", got, tt.want)
+		}
+	}
+
+	data, err := json.Marshal(Money{500000, "KRW"})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(data), `"display":"₩500,000"`) {
+		t.Errorf("json.Marshal() = %s, should contain display field", data)
+	}
+}
+
+func TestExtractBudget(t *testing.T) {
+	summary := ExtractBudget(sampleTripMarkdown)
+	if summary == nil {
+		t.Fatal("ExtractBudget() returned nil")
+	}
+
+	if len(summary.Lines) != 5 {
+		t.Fatalf("ExtractBudget() found %d lines, want 5: %+v", len(summary.Lines), summary.Lines)
+	}
+	if len(summary.Totals) != 1 || summary.Totals[0] != (Money{512000, "KRW"}) {
+		t.Errorf("Totals = %v, want [512000 KRW]", summary.Totals)
+	}
+
+	if len(summary.ByDay) != 1 || summary.ByDay[0].Day != 2 || summary.ByDay[0].Totals[0].Amount != 12000 {
+		t.Errorf("ByDay = %+v, want day 2 with 12000", summary.ByDay)
+	}
+	if len(summary.ByCategory) != 5 || summary.ByCategory[1].Category != "항공료" {
+		t.Errorf("ByCategory = %+v", summary.ByCategory)
+	}
+
+	// The stated total covers only the budget section, which sums correctly
+	stated := summary.StatedTotal
+	if stated == nil {
+		t.Fatal("StatedTotal not found")
+	}
+	if stated.Mismatch || stated.Computed == nil || stated.Computed.Amount != 500000 {
+		t.Errorf("StatedTotal = %+v, want matching 500000", stated)
+	}
+}
+
+func TestExtractBudget_Mismatch(t *testing.T) {
+	markdown := "## Budget\n- Flights: $400\n- Hotel: $250.50\n- Food: about forty dollars\n\nTotal: $600"
+
+	summary := ExtractBudget(markdown)
+	if summary == nil {
+		t.Fatal("ExtractBudget() returned nil")
+	}
+
+	if !summary.StatedTotal.Mismatch {
+		t.Errorf("StatedTotal.Mismatch = false, want true (%+v)", summary.StatedTotal)
+	}
+	if summary.StatedTotal.Computed.Amount != 65050 {
+		t.Errorf("Computed = %v, want 65050", summary.StatedTotal.Computed.Amount)
+	}
+
+	if len(summary.Issues) != 1 || summary.Issues[0].Line != 4 || summary.Issues[0].Column != 9 {
+		t.Errorf("Issues = %+v, want one issue at 4:9", summary.Issues)
+	}
+}
+
+func TestExtractBudget_MixedCurrencies(t *testing.T) {
+	markdown := "### 예산\n- 항공료: 300,000원\n- 호텔: €120\n\n총 예산: 500,000원"
+
+	summary := ExtractBudget(markdown)
+	if len(summary.Totals) != 2 {
+		t.Fatalf("Totals = %v, want two currencies", summary.Totals)
+	}
+	if summary.StatedTotal.Mismatch || summary.StatedTotal.Note == "" {
+		t.Errorf("StatedTotal = %+v, want a note instead of a mismatch", summary.StatedTotal)
+	}
+}
+
+func TestExtractBudget_None(t *testing.T) {
+	if summary := ExtractBudget("# Title\n\n- **오전**: 산책\n```\n- 항공료: 200,000원\n```"); summary != nil {
+		t.Errorf("ExtractBudget() = %+v, want nil", summary)
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrChecklistItemNotFound is returned when an item key no longer matches
+// any task-list item, usually because the markdown changed in between
+var ErrChecklistItemNotFound = errors.New("checklist item not found")
+
+// taskItemRegex matches a GFM task-list item: "- [ ] passport", "1. [x] visa"
+var taskItemRegex = regexp.MustCompile(`^(\s*(?:[-*+]|\d+[.)])\s+)\[([ xX])\]\s+(\S.*?)\s*$`)
+
+// ChecklistItem is a task-list item found in a schedule's markdown
+type ChecklistItem struct {
+	Key     string `json:"key"` // Stable while the item text stays the same
+	Text    string `json:"text"`
+	Checked bool   `json:"checked"` // State written in the markdown source
+	Line    int    `json:"line"`    // 1-based
+	Day     int    `json:"day,omitempty"`
+	Section string `json:"section,omitempty"` // Nearest heading above the item
+}
+
+// ExtractChecklist returns every task-list item in markdown, in document
+// order. Items inside fenced code blocks are ignored.
+func ExtractChecklist(markdown string) []ChecklistItem {
+	items := []ChecklistItem{}
+	occurrences := make(map[string]int)
+	section := ""
+	day := 0
+	inFence := false
+
+	for i, line := range strings.Split(markdown, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		if fenceRegex.MatchString(line) {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+
+		if match := headingRegex.FindStringSubmatch(line); match != nil {
+			section = cleanLabel(match[2])
+			if d := ParseDayNumber(match[2]); d > 0 && !isBudgetHeading(match[2]) {
+				day = d
+			} else if len(match[1]) <= 2 {
+				// A new top-level section ends the current day
+				day = 0
+			}
+			continue
+		}
+
+		match := taskItemRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		text := match[3]
+		normalized := strings.ToLower(strings.Join(strings.Fields(cleanLabel(text)), " "))
+		occurrences[normalized]++
+
+		items = append(items, ChecklistItem{
+			Key:     checklistItemKey(normalized, occurrences[normalized]),
+			Text:    text,
+			Checked: match[2] != " ",
+			Line:    i + 1,
+			Day:     day,
+			Section: section,
+		})
+	}
+
+	return items
+}
+
+// checklistItemKey derives an item key from its normalized text and how many
+// items with the same text came before it, so duplicates stay distinct
+func checklistItemKey(normalized string, occurrence int) string {
+	sum := sha1.Sum([]byte(normalized + "\x00" + strconv.Itoa(occurrence)))
+	return hex.EncodeToString(sum[:6])
+}
+
+// SetChecklistItem ticks or clears the task-list item with the given key and
+// returns the updated markdown. Everything except the checkbox itself is
+// left byte-for-byte unchanged.
+func SetChecklistItem(markdown, key string, checked bool) (string, *ChecklistItem, error) {
+	var item *ChecklistItem
+	for _, candidate := range ExtractChecklist(markdown) {
+		if candidate.Key == key {
+			item = &candidate
+			break
+		}
+	}
+	if item == nil {
+		return "", nil, ErrChecklistItemNotFound
+	}
+
+	lines := strings.Split(markdown, "\n")
+	line := lines[item.Line-1]
+	match := taskItemRegex.FindStringSubmatchIndex(strings.TrimSuffix(line, "\r"))
+	if match == nil {
+		return "", nil, ErrChecklistItemNotFound
+	}
+
+	mark := " "
+	if checked {
+		mark = "x"
+	}
+	lines[item.Line-1] = line[:match[4]] + mark + line[match[5]:]
+	item.Checked = checked
+
+	return strings.Join(lines, "\n"), item, nil
+}
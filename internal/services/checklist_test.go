@@ -0,0 +1,64 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractChecklist(t *testing.T) {
+	markdown := "# 제주 여행\n\n## 준비물\n- [ ] 여권\n- [x] **충전기**\n  - [X] 케이블\n\n```\n- [ ] not an item\n```\n\n## 1일차\n1. [ ] 렌터카 예약\n- [ ] 여권\n- [] broken\n"
+
+	items := ExtractChecklist(markdown)
+	if len(items) != 5 {
+		t.Fatalf("ExtractChecklist() = %d items, want 5: %+v", len(items), items)
+	}
+
+	if items[0].Text != "여권" || items[0].Checked || items[0].Line != 4 || items[0].Section != "준비물" {
+		t.Errorf("items[0] = %+v", items[0])
+	}
+	if !items[1].Checked || !items[2].Checked {
+		t.Errorf("checked items = %+v, %+v", items[1], items[2])
+	}
+	if items[3].Day != 1 || items[3].Text != "렌터카 예약" {
+		t.Errorf("items[3] = %+v, want day 1", items[3])
+	}
+
+	// Duplicate text gets a distinct key
+	if items[0].Key == items[4].Key {
+		t.Errorf("duplicate items share key %s", items[0].Key)
+	}
+
+	// Keys survive unrelated edits
+	edited := ExtractChecklist("# New title\n\n" + markdown)
+	if edited[0].Key != items[0].Key || edited[4].Key != items[4].Key {
+		t.Errorf("keys changed after unrelated edit")
+	}
+}
+
+func TestSetChecklistItem(t *testing.T) {
+	markdown := "## 준비물\r\n- [ ] 여권\r\n  * [x] 충전기  \r\n"
+	items := ExtractChecklist(markdown)
+
+	updated, item, err := SetChecklistItem(markdown, items[0].Key, true)
+	if err != nil {
+		t.Fatalf("SetChecklistItem() error = %v", err)
+	}
+	if !item.Checked {
+		t.Errorf("SetChecklistItem() item = %+v, want checked", item)
+	}
+	if want := strings.Replace(markdown, "- [ ]", "- [x]", 1); updated != want {
+		t.Errorf("SetChecklistItem() = %q, want %q", updated, want)
+	}
+
+	updated, _, err = SetChecklistItem(updated, items[1].Key, false)
+	if err != nil {
+		t.Fatalf("SetChecklistItem() error = %v", err)
+	}
+	if !strings.Contains(updated, "  * [ ] 충전기  \r\n") {
+		t.Errorf("SetChecklistItem() = %q, want the nested item cleared in place", updated)
+	}
+
+	if _, _, err := SetChecklistItem(markdown, "missing", true); err != ErrChecklistItemNotFound {
+		t.Errorf("SetChecklistItem() with unknown key error = %v", err)
+	}
+}
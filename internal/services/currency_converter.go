@@ -0,0 +1,271 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"tripflow/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrRateNotFound is returned when no rate exists for a currency pair
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// RateLookup finds the exchange rate that applies to a pair on a date and
+// returns an error when the pair has no rate. Lookups must be served from
+// stored rates only, never from the network.
+type RateLookup interface {
+	FindRate(base, quote string, on time.Time) (*models.ExchangeRate, error)
+}
+
+// CurrencyConverter converts money between currencies using stored rates
+type CurrencyConverter struct {
+	rates RateLookup
+}
+
+// NewCurrencyConverter creates a new CurrencyConverter
+func NewCurrencyConverter(rates RateLookup) *CurrencyConverter {
+	return &CurrencyConverter{
+		rates: rates,
+	}
+}
+
+// AppliedRate records which stored rate a conversion used
+type AppliedRate struct {
+	RateID        string    `json:"rate_id"`
+	BaseCurrency  string    `json:"base_currency"`
+	QuoteCurrency string    `json:"quote_currency"`
+	Rate          float64   `json:"rate"`
+	EffectiveDate time.Time `json:"effective_date"`
+	Inverted      bool      `json:"inverted"` // True when the stored quote→base rate was inverted
+}
+
+// Convert converts an amount into the target currency using the rate in
+// effect on the given date. Same-currency conversions return a nil rate.
+func (c *CurrencyConverter) Convert(amount Money, to string, on time.Time) (Money, *AppliedRate, error) {
+	to = strings.ToUpper(to)
+	target, ok := LookupCurrency(to)
+	if !ok {
+		return Money{}, nil, fmt.Errorf("unsupported currency: %s", to)
+	}
+	source, ok := LookupCurrency(amount.Currency)
+	if !ok {
+		return Money{}, nil, fmt.Errorf("unsupported currency: %s", amount.Currency)
+	}
+	if source.Code == target.Code {
+		return amount, nil, nil
+	}
+
+	applied, factor, err := c.findRate(source.Code, target.Code, on)
+	if err != nil {
+		return Money{}, nil, err
+	}
+
+	// minor_to = minor_from / 10^exp_from * rate * 10^exp_to
+	value := new(big.Rat).SetInt64(amount.Amount)
+	value.Mul(value, factor)
+	value.Mul(value, new(big.Rat).SetFrac(pow10(target.Exponent), pow10(source.Exponent)))
+
+	converted, err := roundRat(value)
+	if err != nil {
+		return Money{}, nil, fmt.Errorf("failed to convert %s: %w", amount, err)
+	}
+
+	return Money{Amount: converted, Currency: target.Code}, applied, nil
+}
+
+// findRate looks up the direct pair first and falls back to the inverse.
+// Only a missing rate falls through; a failed lookup is returned.
+func (c *CurrencyConverter) findRate(from, to string, on time.Time) (*AppliedRate, *big.Rat, error) {
+	if c == nil || c.rates == nil {
+		return nil, nil, fmt.Errorf("%w: %s/%s", ErrRateNotFound, from, to)
+	}
+
+	rate, err := c.lookupRate(from, to, on)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rate != nil {
+		factor := new(big.Rat).SetFloat64(rate.Rate)
+		return newAppliedRate(rate, false), factor, nil
+	}
+
+	rate, err = c.lookupRate(to, from, on)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rate != nil {
+		factor := new(big.Rat).Inv(new(big.Rat).SetFloat64(rate.Rate))
+		return newAppliedRate(rate, true), factor, nil
+	}
+
+	return nil, nil, fmt.Errorf("%w: %s/%s on %s", ErrRateNotFound, from, to, on.Format("2006-01-02"))
+}
+
+// lookupRate returns the usable stored rate for a pair, or nil when there is
+// none
+func (c *CurrencyConverter) lookupRate(base, quote string, on time.Time) (*models.ExchangeRate, error) {
+	rate, err := c.rates.FindRate(base, quote, on)
+	if errors.Is(err, ErrRateNotFound) || errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s/%s rate: %w", base, quote, err)
+	}
+	if rate.Rate <= 0 {
+		return nil, nil
+	}
+	return rate, nil
+}
+
+// newAppliedRate describes a stored rate for API responses
+func newAppliedRate(rate *models.ExchangeRate, inverted bool) *AppliedRate {
+	return &AppliedRate{
+		RateID:        rate.ID.String(),
+		BaseCurrency:  rate.BaseCurrency,
+		QuoteCurrency: rate.QuoteCurrency,
+		Rate:          rate.Rate,
+		EffectiveDate: rate.EffectiveDate,
+		Inverted:      inverted,
+	}
+}
+
+// pow10 returns 10^n as a big.Int
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// ConvertedLine is a budget line converted into the home currency
+type ConvertedLine struct {
+	Line      int          `json:"line"`
+	Day       int          `json:"day,omitempty"`
+	Category  string       `json:"category"`
+	Original  Money        `json:"original"`
+	Converted Money        `json:"converted"`
+	Date      time.Time    `json:"date"`
+	Rate      *AppliedRate `json:"rate,omitempty"`
+}
+
+// ConversionIssue describes a budget line that could not be converted
+type ConversionIssue struct {
+	Line     int    `json:"line"`
+	Currency string `json:"currency"`
+	Message  string `json:"message"`
+}
+
+// ConvertedBudget is a budget summary expressed in a single home currency
+type ConvertedBudget struct {
+	HomeCurrency string            `json:"home_currency"`
+	Total        Money             `json:"total"`
+	ByCategory   []CategoryTotal   `json:"by_category"`
+	ByDay        []DayTotal        `json:"by_day"`
+	Lines        []ConvertedLine   `json:"lines"`
+	Issues       []ConversionIssue `json:"issues,omitempty"`
+	Complete     bool              `json:"complete"` // False when some lines could not be converted
+
+	// StatedTotalMismatch compares the hand-written total with the converted
+	// sum; nil when the comparison could not be made
+	StatedTotalMismatch *bool `json:"stated_total_mismatch,omitempty"`
+}
+
+// ConvertBudget converts every budget line into homeCurrency using the rate
+// for the line's trip date. Day lines use start+day-1, trip-wide lines use
+// the start date, and budgets without a start date use today's rates.
+func (c *CurrencyConverter) ConvertBudget(summary *BudgetSummary, homeCurrency string, startDate *time.Time) *ConvertedBudget {
+	if summary == nil {
+		return nil
+	}
+	homeCurrency = strings.ToUpper(homeCurrency)
+	if homeCurrency == "" {
+		homeCurrency = models.DefaultHomeCurrency
+	}
+
+	schedule := models.Schedule{StartDate: startDate}
+	converted := &ConvertedBudget{
+		HomeCurrency: homeCurrency,
+		Total:        Money{Currency: homeCurrency},
+		Lines:        make([]ConvertedLine, 0, len(summary.Lines)),
+		Complete:     true,
+	}
+
+	// Reuse the summary's aggregation by building home-currency lines
+	homeLines := make([]BudgetLine, 0, len(summary.Lines))
+	for _, line := range summary.Lines {
+		date, ok := schedule.TripDate(line.Day)
+		if !ok {
+			date = time.Now()
+		}
+
+		amount, rate, err := c.Convert(line.Amount, homeCurrency, date)
+		if err != nil {
+			converted.Complete = false
+			converted.Issues = append(converted.Issues, ConversionIssue{
+				Line:     line.Line,
+				Currency: line.Amount.Currency,
+				Message:  err.Error(),
+			})
+			continue
+		}
+
+		converted.Lines = append(converted.Lines, ConvertedLine{
+			Line:      line.Line,
+			Day:       line.Day,
+			Category:  line.Category,
+			Original:  line.Amount,
+			Converted: amount,
+			Date:      date,
+			Rate:      rate,
+		})
+
+		homeLine := line
+		homeLine.Amount = amount
+		homeLines = append(homeLines, homeLine)
+	}
+
+	home := &BudgetSummary{Lines: homeLines}
+	if summary.StatedTotal != nil {
+		stated := *summary.StatedTotal
+		home.StatedTotal = &stated
+	}
+	home.computeTotals()
+
+	if len(home.Totals) == 1 {
+		converted.Total = home.Totals[0]
+	}
+	converted.ByCategory = home.ByCategory
+	converted.ByDay = home.ByDay
+
+	// Compare the stated total once it is in the home currency too
+	if stated := home.StatedTotal; stated != nil && converted.Complete {
+		date, ok := schedule.TripDate(0)
+		if !ok {
+			date = time.Now()
+		}
+		statedHome, _, err := c.Convert(stated.Amount, homeCurrency, date)
+		if err == nil {
+			var covered int64
+			var count int64
+			for _, line := range homeLines {
+				if stated.section < 0 || line.section == stated.section {
+					covered += line.Amount.Amount
+					count++
+				}
+			}
+
+			// Each converted line may be off by one minor unit from rounding
+			tolerance := int64(0)
+			if stated.Amount.Currency != homeCurrency {
+				tolerance = count
+			}
+			diff := covered - statedHome.Amount
+			mismatch := diff > tolerance || diff < -tolerance
+			converted.StatedTotalMismatch = &mismatch
+		}
+	}
+
+	return converted
+}
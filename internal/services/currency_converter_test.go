@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"tripflow/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// memoryRates is an in-memory RateLookup keyed by "BASE/QUOTE"
+type memoryRates map[string][]*models.ExchangeRate
+
+func (m memoryRates) add(base, quote, date string, rate float64) {
+	day, _ := time.Parse("2006-01-02", date)
+	m[base+"/"+quote] = append(m[base+"/"+quote], models.NewExchangeRate(base, quote, day, rate, "test"))
+}
+
+func (m memoryRates) FindRate(base, quote string, on time.Time) (*models.ExchangeRate, error) {
+	var best *models.ExchangeRate
+	for _, rate := range m[base+"/"+quote] {
+		if !rate.EffectiveDate.After(on) && (best == nil || rate.EffectiveDate.After(best.EffectiveDate)) {
+			best = rate
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w: %s/%s", ErrRateNotFound, base, quote)
+	}
+	return best, nil
+}
+
+func TestCurrencyConverter_Convert(t *testing.T) {
+	rates := memoryRates{}
+	rates.add("USD", "KRW", "2025-01-01", 1300)
+	rates.add("USD", "KRW", "2025-02-01", 1400)
+	rates.add("EUR", "USD", "2025-01-01", 1.1)
+	converter := NewCurrencyConverter(rates)
+
+	tests := []struct {
+		name         string
+		amount       Money
+		to           string
+		on           string
+		want         Money
+		wantInverted bool
+		wantErr      bool
+	}{
+		{name: "Direct rate", amount: Money{1050, "USD"}, to: "KRW", on: "2025-01-15", want: Money{13650, "KRW"}},
+		{name: "Later historical rate", amount: Money{1000, "USD"}, to: "KRW", on: "2025-02-10", want: Money{14000, "KRW"}},
+		{name: "Inverted rate", amount: Money{13000, "KRW"}, to: "USD", on: "2025-01-15", want: Money{1000, "USD"}, wantInverted: true},
+		{name: "Same currency", amount: Money{500, "KRW"}, to: "KRW", on: "2025-01-15", want: Money{500, "KRW"}},
+		{name: "Missing pair", amount: Money{100, "EUR"}, to: "KRW", on: "2025-01-15", wantErr: true},
+		{name: "Before any rate", amount: Money{100, "USD"}, to: "KRW", on: "2024-12-31", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			on, _ := time.Parse("2006-01-02", tt.on)
+			got, rate, err := converter.Convert(tt.amount, tt.to, on)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Convert() expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Convert() = %v, want %v", got, tt.want)
+			}
+			if rate != nil && rate.Inverted != tt.wantInverted {
+				t.Errorf("Convert() rate.Inverted = %v, want %v", rate.Inverted, tt.wantInverted)
+			}
+		})
+	}
+}
+
+func TestCurrencyConverter_ConvertBudget(t *testing.T) {
+	rates := memoryRates{}
+	rates.add("USD", "KRW", "2025-03-01", 1300)
+	rates.add("USD", "KRW", "2025-03-02", 1400)
+	converter := NewCurrencyConverter(rates)
+
+	markdown := "## 1일차\n- 택시: $10\n\n## 2일차\n- 택시: $10\n\n### 예산\n- 항공료: 300,000원\n- 호텔: $100\n\n총 예산: 430,000원"
+	summary := ExtractBudget(markdown)
+	start, _ := time.Parse("2006-01-02", "2025-03-01")
+
+	converted := converter.ConvertBudget(summary, "KRW", &start)
+	if !converted.Complete {
+		t.Fatalf("ConvertBudget() incomplete: %+v", converted.Issues)
+	}
+
+	// Day 1 uses the 1300 rate, day 2 the 1400 rate, trip-wide lines the start date
+	if converted.Total != (Money{300000 + 13000 + 14000 + 130000, "KRW"}) {
+		t.Errorf("Total = %v", converted.Total)
+	}
+	if len(converted.ByDay) != 2 || converted.ByDay[1].Totals[0].Amount != 14000 {
+		t.Errorf("ByDay = %+v", converted.ByDay)
+	}
+	if converted.Lines[1].Rate == nil || converted.Lines[1].Rate.Rate != 1400 {
+		t.Errorf("Lines[1].Rate = %+v, want the 1400 rate", converted.Lines[1].Rate)
+	}
+	if converted.StatedTotalMismatch == nil || *converted.StatedTotalMismatch {
+		t.Errorf("StatedTotalMismatch = %v, want false", converted.StatedTotalMismatch)
+	}
+
+	// Without any rates the budget is reported as incomplete
+	incomplete := NewCurrencyConverter(memoryRates{}).ConvertBudget(summary, "KRW", &start)
+	if incomplete.Complete || len(incomplete.Issues) != 3 {
+		t.Errorf("ConvertBudget() without rates = %+v, want 3 issues", incomplete)
+	}
+}
+
+// failingRates is a RateLookup whose store is unavailable
+type failingRates struct{ err error }
+
+func (f failingRates) FindRate(base, quote string, on time.Time) (*models.ExchangeRate, error) {
+	return nil, f.err
+}
+
+func TestCurrencyConverter_ConvertLookupErrors(t *testing.T) {
+	on := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	amount := Money{Amount: 1000, Currency: "USD"}
+
+	// A missing record is a missing rate, whichever way it is reported
+	for _, err := range []error{ErrRateNotFound, gorm.ErrRecordNotFound} {
+		_, _, got := NewCurrencyConverter(failingRates{err}).Convert(amount, "KRW", on)
+		if !errors.Is(got, ErrRateNotFound) {
+			t.Errorf("Convert() with %v error = %v, want %v", err, got, ErrRateNotFound)
+		}
+	}
+
+	// Anything else is a failed lookup, not a missing rate
+	unavailable := errors.New("database is locked")
+	_, _, err := NewCurrencyConverter(failingRates{unavailable}).Convert(amount, "KRW", on)
+	if !errors.Is(err, unavailable) || errors.Is(err, ErrRateNotFound) {
+		t.Errorf("Convert() error = %v, want the lookup error", err)
+	}
+}
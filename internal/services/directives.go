@@ -0,0 +1,318 @@
+package services
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Trip directive kinds
+const (
+	DirectiveFlight = "flight"
+	DirectiveHotel  = "hotel"
+	DirectivePlace  = "place"
+)
+
+// directiveLabels are the card headings of each directive kind
+var directiveLabels = map[string]string{
+	DirectiveFlight: "Flight",
+	DirectiveHotel:  "Hotel",
+	DirectivePlace:  "Place",
+}
+
+// directiveKeyAliases maps common spellings of attribute keys, including
+// Korean ones, to the keys exposed in TripDirective.Attributes
+var directiveKeyAliases = map[string]string{
+	"confirmation number": "confirmation",
+	"booking":             "confirmation",
+	"booking reference":   "confirmation",
+	"reservation":         "confirmation",
+	"pnr":                 "confirmation",
+	"확인번호":                "confirmation",
+	"예약번호":                "confirmation",
+	"checkin":             "check_in",
+	"체크인":                 "check_in",
+	"checkout":            "check_out",
+	"체크아웃":                "check_out",
+	"flight number":       "number",
+	"flight":              "number",
+	"편명":                  "number",
+	"항공사":                 "airline",
+	"출발":                  "departure",
+	"도착":                  "arrival",
+	"출발지":                 "from",
+	"도착지":                 "to",
+	"좌석":                  "seat",
+	"터미널":                 "terminal",
+	"게이트":                 "gate",
+	"주소":                  "address",
+	"tel":                 "phone",
+	"phone number":        "phone",
+	"전화":                  "phone",
+	"전화번호":                "phone",
+	"latitude":            "lat",
+	"위도":                  "lat",
+	"longitude":           "lng",
+	"lon":                 "lng",
+	"경도":                  "lng",
+}
+
+// TripDirective is a booking or place written as a fenced directive. The
+// opening line names the kind and an optional title; the lines up to the
+// closing ::: are "key: value" attributes.
+//
+//	:::hotel Lotte Hotel Jeju
+//	check-in: 2024-05-01 15:00
+//	confirmation: H-12345
+//	:::
+type TripDirective struct {
+	Kind  string `json:"kind"`
+	Title string `json:"title,omitempty"`
+	Day   int    `json:"day,omitempty"` // Day heading the directive is under
+	Line  int    `json:"line"`
+
+	// Attributes by normalized key: lowercase with spaces and hyphens as
+	// underscores, and common aliases such as "체크인" as "check_in"
+	Attributes map[string]string `json:"attributes"`
+	Notes      string            `json:"notes,omitempty"` // Lines without a key
+}
+
+// directiveAttribute is an attribute line as written, for rendering in
+// source order
+type directiveAttribute struct {
+	Label string
+	Value string
+}
+
+// directiveKey normalizes an attribute label to its Attributes key
+func directiveKey(label string) string {
+	key := strings.ToLower(strings.Join(strings.Fields(label), " "))
+	if alias, ok := directiveKeyAliases[key]; ok {
+		return alias
+	}
+	key = strings.NewReplacer(" ", "_", "-", "_").Replace(key)
+	if alias, ok := directiveKeyAliases[strings.ReplaceAll(key, "_", "")]; ok {
+		return alias
+	}
+	return key
+}
+
+// kindTripDirective is the AST node kind of trip directives
+var kindTripDirective = ast.NewNodeKind("TripDirective")
+
+// tripDirectiveNode is a parsed trip directive block
+type tripDirectiveNode struct {
+	ast.BaseBlock
+	Directive  *TripDirective
+	attributes []directiveAttribute
+}
+
+// Kind implements ast.Node
+func (n *tripDirectiveNode) Kind() ast.NodeKind {
+	return kindTripDirective
+}
+
+// IsRaw implements ast.Node; directive lines are not parsed as markdown
+func (n *tripDirectiveNode) IsRaw() bool {
+	return true
+}
+
+// Dump implements ast.Node
+func (n *tripDirectiveNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Kind": n.Directive.Kind, "Title": n.Directive.Title}, nil)
+}
+
+// directiveParser parses :::kind ... ::: blocks
+type directiveParser struct{}
+
+// Trigger implements parser.BlockParser
+func (p *directiveParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+// Open implements parser.BlockParser
+func (p *directiveParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte(":::")) {
+		return nil, parser.NoChildren
+	}
+
+	kind, title, _ := strings.Cut(strings.TrimSpace(string(line[pos+3:])), " ")
+	kind = strings.ToLower(kind)
+	if _, ok := directiveLabels[kind]; !ok {
+		return nil, parser.NoChildren
+	}
+
+	return &tripDirectiveNode{
+		Directive: &TripDirective{
+			Kind:       kind,
+			Title:      strings.TrimSpace(title),
+			Line:       bytes.Count(reader.Source()[:segment.Start], []byte("\n")) + 1,
+			Attributes: make(map[string]string),
+		},
+	}, parser.NoChildren
+}
+
+// Continue implements parser.BlockParser
+func (p *directiveParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	if string(bytes.TrimSpace(line)) == ":::" {
+		newline := 1
+		if line[len(line)-1] != '\n' {
+			newline = 0
+		}
+		reader.Advance(segment.Stop - segment.Start - newline + segment.Padding)
+		return parser.Close
+	}
+
+	node.Lines().Append(segment)
+	reader.Advance(segment.Len() - 1)
+	return parser.Continue | parser.NoChildren
+}
+
+// Close implements parser.BlockParser by parsing the attribute lines
+func (p *directiveParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+	n := node.(*tripDirectiveNode)
+	var notes []string
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		line := strings.TrimSpace(string(segment.Value(reader.Source())))
+		if line == "" {
+			continue
+		}
+		label, value, _, ok := splitLabelValue(line)
+		label, value = strings.TrimSpace(label), strings.TrimSpace(value)
+		if !ok || label == "" || strings.Contains(label, "://") {
+			notes = append(notes, line)
+			continue
+		}
+		n.attributes = append(n.attributes, directiveAttribute{Label: label, Value: value})
+		n.Directive.Attributes[directiveKey(label)] = value
+	}
+	n.Directive.Notes = strings.Join(notes, "\n")
+}
+
+// CanInterruptParagraph implements parser.BlockParser
+func (p *directiveParser) CanInterruptParagraph() bool {
+	return true
+}
+
+// CanAcceptIndentedLine implements parser.BlockParser
+func (p *directiveParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// directiveHTMLRenderer renders trip directives as cards
+type directiveHTMLRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer
+func (r *directiveHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindTripDirective, r.renderDirective)
+}
+
+func (r *directiveHTMLRenderer) renderDirective(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*tripDirectiveNode)
+	directive := n.Directive
+
+	w.WriteString(`<div class="directive directive-` + directive.Kind + `">` + "\n")
+	w.WriteString(`<p class="directive-title"><span class="directive-kind">` + directiveLabels[directive.Kind] + `</span>`)
+	if directive.Title != "" {
+		w.WriteString(" ")
+		w.Write(util.EscapeHTML([]byte(directive.Title)))
+	}
+	w.WriteString("</p>\n")
+
+	if len(n.attributes) > 0 {
+		w.WriteString(`<dl class="directive-attributes">` + "\n")
+		for _, attr := range n.attributes {
+			w.WriteString("<dt>")
+			w.Write(util.EscapeHTML([]byte(attr.Label)))
+			w.WriteString("</dt><dd>")
+			w.Write(util.EscapeHTML([]byte(attr.Value)))
+			w.WriteString("</dd>\n")
+		}
+		w.WriteString("</dl>\n")
+	}
+	if directive.Notes != "" {
+		w.WriteString(`<p class="directive-notes">`)
+		w.Write(util.EscapeHTML([]byte(directive.Notes)))
+		w.WriteString("</p>\n")
+	}
+	if mapURL := directiveMapURL(directive); mapURL != "" {
+		w.WriteString(`<p class="directive-map"><a href="` + mapURL + `">Map</a></p>` + "\n")
+	}
+	w.WriteString("</div>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// directiveMapURL links a place with valid coordinates to OpenStreetMap
+func directiveMapURL(directive *TripDirective) string {
+	lat, err := strconv.ParseFloat(directive.Attributes["lat"], 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return ""
+	}
+	lng, err := strconv.ParseFloat(directive.Attributes["lng"], 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return ""
+	}
+	coordinates := strconv.FormatFloat(lat, 'f', -1, 64) + "&amp;mlon=" + strconv.FormatFloat(lng, 'f', -1, 64)
+	return "https://www.openstreetmap.org/?mlat=" + coordinates
+}
+
+// tripDirectives is the goldmark extension for trip directives
+type tripDirectives struct{}
+
+// Extend implements goldmark.Extender. The parser runs before definition
+// lists, whose descriptions also start with a colon.
+func (e *tripDirectives) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithBlockParsers(util.Prioritized(&directiveParser{}, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&directiveHTMLRenderer{}, 500)))
+}
+
+// allowDirectiveCards keeps the classes directive cards are styled with
+func allowDirectiveCards(p *bluemonday.Policy) {
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^directive directive-(flight|hotel|place)$`)).OnElements("div")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^directive-(title|notes|map)$`)).OnElements("p")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^directive-kind$`)).OnElements("span")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^directive-attributes$`)).OnElements("dl")
+}
+
+// extractDirectives collects the trip directives in a parsed document,
+// noting the day heading each one is under
+func extractDirectives(doc ast.Node, source []byte) []*TripDirective {
+	var directives []*TripDirective
+	day := 0
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *ast.Heading:
+			text := strings.TrimSpace(string(n.Text(source)))
+			if d := ParseDayNumber(text); d > 0 && !isBudgetHeading(text) {
+				day = d
+			}
+			return ast.WalkSkipChildren, nil
+		case *tripDirectiveNode:
+			n.Directive.Day = day
+			directives = append(directives, n.Directive)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return directives
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProcessMarkdown_Directives(t *testing.T) {
+	service := NewMarkdownService(nil)
+	service.SetRenderCache(nil)
+
+	markdown := "# 제주 여행\n\n" +
+		"## 1일차 - 제주시\n\n" +
+		"Arriving early.\n" +
+		":::flight KE1201\n" +
+		"Airline: Korean Air\n" +
+		"From: GMP\n" +
+		"To: CJU\n" +
+		"Departure: 2024-05-01 08:00\n" +
+		"Booking reference: ABC123\n" +
+		":::\n\n" +
+		"## 2일차 - 서귀포\n\n" +
+		":::hotel <b>Lotte</b> Hotel\n" +
+		"체크인: 2024-05-02 15:00\n" +
+		"Check-out: 2024-05-03 11:00\n" +
+		"예약번호：H-99 <script>alert(1)</script>\n" +
+		"Ocean view requested\n" +
+		":::\n\n" +
+		"- :::place 성산일출봉\n" +
+		"  lat: 33.4581\n" +
+		"  lng: 126.9425\n" +
+		"  :::\n\n" +
+		":::unknown\nnot a directive\n"
+
+	processed, err := service.ProcessMarkdown(markdown)
+	if err != nil {
+		t.Fatalf("ProcessMarkdown() error = %v", err)
+	}
+
+	directives := processed.Directives
+	if len(directives) != 3 {
+		t.Fatalf("found %d directives, want 3: %+v", len(directives), directives)
+	}
+
+	flight := directives[0]
+	if flight.Kind != DirectiveFlight || flight.Title != "KE1201" || flight.Day != 1 || flight.Line != 6 {
+		t.Errorf("flight = %+v", flight)
+	}
+	for key, want := range map[string]string{
+		"airline":      "Korean Air",
+		"from":         "GMP",
+		"departure":    "2024-05-01 08:00",
+		"confirmation": "ABC123",
+	} {
+		if got := flight.Attributes[key]; got != want {
+			t.Errorf("flight.Attributes[%q] = %q, want %q", key, got, want)
+		}
+	}
+
+	hotel := directives[1]
+	if hotel.Kind != DirectiveHotel || hotel.Day != 2 || hotel.Notes != "Ocean view requested" {
+		t.Errorf("hotel = %+v", hotel)
+	}
+	if hotel.Attributes["check_in"] != "2024-05-02 15:00" || hotel.Attributes["check_out"] != "2024-05-03 11:00" {
+		t.Errorf("hotel.Attributes = %v", hotel.Attributes)
+	}
+	if hotel.Attributes["confirmation"] != "H-99 <script>alert(1)</script>" {
+		t.Errorf("hotel.Attributes = %v, structured data keeps the raw value", hotel.Attributes)
+	}
+
+	place := directives[2]
+	if place.Kind != DirectivePlace || place.Title != "성산일출봉" || place.Attributes["lat"] != "33.4581" {
+		t.Errorf("place = %+v", place)
+	}
+
+	html := processed.HTMLContent
+	for _, want := range []string{
+		"<p>Arriving early.</p>\n<div class=\"directive directive-flight\">",
+		`<p class="directive-title"><span class="directive-kind">Flight</span> KE1201</p>`,
+		`<dt>Booking reference</dt><dd>ABC123</dd>`,
+		`<span class="directive-kind">Hotel</span> &lt;b&gt;Lotte&lt;/b&gt; Hotel`,
+		`<dd>H-99 &lt;script&gt;alert(1)&lt;/script&gt;</dd>`,
+		`<p class="directive-notes">Ocean view requested</p>`,
+		"<li>\n<div class=\"directive directive-place\">",
+		`<a href="https://www.openstreetmap.org/?mlat=33.4581&amp;mlon=126.9425" rel="nofollow noopener" target="_blank">Map</a>`,
+		`<p>:::unknown`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTMLContent should contain %s:\n%s", want, html)
+		}
+	}
+	if strings.Contains(html, "<script>") || strings.Contains(html, ":::\n") {
+		t.Errorf("HTMLContent = %s", html)
+	}
+}
+
+func TestProcessMarkdown_DirectivesDisabled(t *testing.T) {
+	service := NewMarkdownServiceWithRenderer(nil, &RendererConfig{Extensions: []string{ExtensionGFM}})
+	service.SetRenderCache(nil)
+
+	processed, _ := service.ProcessMarkdown(":::hotel Lotte\ncheck-in: 15:00\n:::\n")
+	if len(processed.Directives) != 0 || strings.Contains(processed.HTMLContent, "directive") {
+		t.Errorf("directives should be plain text without the extension: %+v", processed)
+	}
+}
+
+func TestDirectiveKey(t *testing.T) {
+	tests := map[string]string{
+		"Check-in":          "check_in",
+		"CheckIn":           "check_in",
+		"체크인":               "check_in",
+		"Confirmation  No.": "confirmation_no.",
+		"PNR":               "confirmation",
+		"Room Type":         "room_type",
+	}
+	for label, want := range tests {
+		if got := directiveKey(label); got != want {
+			t.Errorf("directiveKey(%q) = %q, want %q", label, got, want)
+		}
+	}
+}
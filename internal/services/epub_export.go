@@ -0,0 +1,612 @@
+package services
+
+import (
+	"archive/zip"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"tripflow/pkg/filestorage"
+
+	"github.com/google/uuid"
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Paths inside an EPUB container. Content documents live next to the
+// package document so bundled images keep the paths siteBundle gives them.
+const (
+	epubMimetype      = "application/epub+zip"
+	epubContentDir    = "OEBPS/"
+	epubPackageFile   = "content.opf"
+	epubNavFile       = "nav.xhtml"
+	epubTitleFile     = "title.xhtml"
+	epubStylesheet    = "style.css"
+	epubChapterFormat = "chapter-%02d"
+)
+
+// epubVoidElements are written as empty XML elements
+var epubVoidElements = map[atom.Atom]bool{
+	atom.Area: true, atom.Br: true, atom.Col: true, atom.Hr: true,
+	atom.Img: true, atom.Input: true, atom.Wbr: true,
+}
+
+// EPUBExporter lays schedules out as EPUB 3 books for e-readers
+type EPUBExporter struct {
+	markdownService *MarkdownService // Renders with images resolved
+	images          *ImageResolver
+	storage         filestorage.FileStorageService
+}
+
+// NewEPUBExporter creates an EPUBExporter
+func NewEPUBExporter(storage filestorage.FileStorageService, images *ImageResolver) *EPUBExporter {
+	markdownService := NewMarkdownService(storage)
+	markdownService.SetImageResolver(images)
+	return &EPUBExporter{
+		markdownService: markdownService,
+		images:          images,
+		storage:         storage,
+	}
+}
+
+// epubChapter is one content document of a book
+type epubChapter struct {
+	ID        string
+	File      string
+	Title     string
+	HeadingID string // Day heading the chapter starts with, if any
+	Nodes     []*nethtml.Node
+	Body      string
+	Children  []*TOCEntry // Headings listed under the chapter in the nav
+	NavList   string      // Children rendered as a nav list
+}
+
+// Export writes doc as an EPUB 3 book. The title page comes first, then the
+// text before the first day heading and one chapter per day. Uploaded images
+// are embedded; site-absolute links are resolved against baseURL.
+func (e *EPUBExporter) Export(w io.Writer, doc *ScheduleExport, baseURL string) error {
+	processed, err := e.markdownService.ProcessMarkdownWithOptions(doc.Markdown, &ProcessOptions{
+		ImageOwnerID: doc.ImageOwnerID,
+		AuthorRole:   doc.AuthorRole,
+	})
+	if err != nil {
+		return err
+	}
+	nodes, err := parseHTMLFragment(processed.HTMLContent)
+	if err != nil {
+		return fmt.Errorf("failed to parse rendered schedule: %w", err)
+	}
+
+	chapters := splitEPUBChapters(nodes)
+	idFiles := make(map[string]string)
+	for _, chapter := range chapters {
+		for _, node := range chapter.Nodes {
+			collectIDs(node, chapter.File, idFiles)
+		}
+	}
+	attachNavChildren(chapters, processed.TOC, idFiles)
+	for _, chapter := range chapters {
+		chapter.NavList = renderNavList(chapter.Children, idFiles)
+	}
+
+	bundle := newSiteBundle(e.storage, e.images, doc.ImageOwnerID, baseURL)
+	for _, chapter := range chapters {
+		var body strings.Builder
+		for _, node := range chapter.Nodes {
+			rewriteEPUBLinks(node, chapter.File, bundle, idFiles)
+			writeXHTML(&body, node)
+		}
+		chapter.Body = body.String()
+	}
+
+	identifier := doc.ID
+	if identifier == uuid.Nil {
+		identifier = uuid.New()
+	}
+	modified := doc.UpdatedAt
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+	book := &epubBook{
+		Identifier:  "urn:uuid:" + identifier.String(),
+		Title:       doc.Title,
+		Description: doc.Description,
+		Dates:       formatTripDates(doc.StartDate, doc.EndDate),
+		Language:    exportLanguage(doc.Title + doc.Markdown),
+		Modified:    modified.UTC().Format("2006-01-02T15:04:05Z"),
+		Chapters:    chapters,
+	}
+	if doc.StartDate != nil {
+		book.Date = doc.StartDate.Format("2006-01-02")
+	}
+	for i, file := range bundle.files {
+		mediaType := file.MimeType
+		if mediaType == "" {
+			mediaType = mime.TypeByExtension(path.Ext(file.Path))
+		}
+		book.Images = append(book.Images, epubImage{
+			ID:        fmt.Sprintf("image-%d", i+1),
+			Href:      escapeBundlePath(file.Path),
+			MediaType: mediaType,
+		})
+	}
+
+	archive := zip.NewWriter(w)
+	if err := writeEPUBMimetype(archive); err != nil {
+		return err
+	}
+	entries := []struct {
+		name     string
+		template *template.Template
+	}{
+		{"META-INF/container.xml", epubContainerTemplate},
+		{epubContentDir + epubPackageFile, epubPackageTemplate},
+		{epubContentDir + epubNavFile, epubNavTemplate},
+		{epubContentDir + epubTitleFile, epubTitleTemplate},
+	}
+	for _, entry := range entries {
+		var buf strings.Builder
+		if err := entry.template.Execute(&buf, book); err != nil {
+			return fmt.Errorf("failed to render %s: %w", entry.name, err)
+		}
+		if err := writeZipEntry(archive, entry.name, []byte(buf.String()), modified, zip.Deflate); err != nil {
+			return err
+		}
+	}
+	if err := writeZipEntry(archive, epubContentDir+epubStylesheet, []byte(epubCSS), modified, zip.Deflate); err != nil {
+		return err
+	}
+	for _, chapter := range chapters {
+		var buf strings.Builder
+		err := epubChapterTemplate.Execute(&buf, map[string]any{"Book": book, "Chapter": chapter})
+		if err != nil {
+			return fmt.Errorf("failed to render %s: %w", chapter.File, err)
+		}
+		if err := writeZipEntry(archive, epubContentDir+chapter.File, []byte(buf.String()), modified, zip.Deflate); err != nil {
+			return err
+		}
+	}
+	for i, file := range bundle.files {
+		// Image formats are already compressed
+		if err := writeZipEntry(archive, epubContentDir+file.Path, bundle.data[i], modified, zip.Store); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// writeEPUBMimetype writes the mimetype file, which must come first,
+// uncompressed and without extra fields or a data descriptor
+func writeEPUBMimetype(archive *zip.Writer) error {
+	data := []byte(epubMimetype)
+	writer, err := archive.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: uint64(len(data)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add mimetype: %w", err)
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+// splitEPUBChapters splits rendered body nodes into chapters at day
+// headings. The title heading is left out; it is on the title page.
+func splitEPUBChapters(nodes []*nethtml.Node) []*epubChapter {
+	var chapters []*epubChapter
+	current := &epubChapter{Title: "Overview"}
+	skippedTitle := false
+
+	for _, node := range nodes {
+		if level := headingLevel(node); level > 0 {
+			if level == 1 && !skippedTitle {
+				skippedTitle = true
+				continue
+			}
+			text := strings.TrimSpace(nodeText(node))
+			if ParseDayNumber(text) > 0 && !isBudgetHeading(text) {
+				if hasContent(current.Nodes) {
+					chapters = append(chapters, current)
+				}
+				current = &epubChapter{Title: text, HeadingID: attrValue(node, "id")}
+			}
+		}
+		current.Nodes = append(current.Nodes, node)
+	}
+	if hasContent(current.Nodes) || len(chapters) == 0 {
+		chapters = append(chapters, current)
+	}
+
+	for i, chapter := range chapters {
+		chapter.ID = fmt.Sprintf(epubChapterFormat, i+1)
+		chapter.File = chapter.ID + ".xhtml"
+	}
+	return chapters
+}
+
+// attachNavChildren lists the headings under each chapter in the nav: the
+// subheadings of a day, or the top-level headings of the overview
+func attachNavChildren(chapters []*epubChapter, toc []*TOCEntry, idFiles map[string]string) {
+	var walk func(entries []*TOCEntry)
+	walk = func(entries []*TOCEntry) {
+		for _, entry := range entries {
+			for _, chapter := range chapters {
+				if chapter.HeadingID != "" && chapter.HeadingID == entry.ID {
+					chapter.Children = entry.Children
+				}
+			}
+			walk(entry.Children)
+		}
+	}
+	walk(toc)
+
+	for _, chapter := range chapters {
+		if chapter.HeadingID != "" {
+			continue
+		}
+		for _, entry := range toc {
+			if idFiles[entry.ID] == chapter.File {
+				chapter.Children = append(chapter.Children, entry)
+			}
+		}
+	}
+}
+
+// renderNavList renders TOC entries as a nested nav list linking into the
+// chapters the headings ended up in
+func renderNavList(entries []*TOCEntry, idFiles map[string]string) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("<ol>")
+	for _, entry := range entries {
+		href := xhtmlEscape(idFiles[entry.ID] + "#" + entry.ID)
+		b.WriteString(`<li><a href="` + href + `">` + xhtmlEscape(entry.Text) + "</a>")
+		b.WriteString(renderNavList(entry.Children, idFiles))
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ol>")
+	return b.String()
+}
+
+// rewriteEPUBLinks points images at their embedded copies and makes links
+// work inside the book. Images that cannot be embedded are replaced by
+// their alt text, since e-readers are often offline.
+func rewriteEPUBLinks(n *nethtml.Node, file string, bundle *siteBundle, idFiles map[string]string) {
+	if n.Type == nethtml.ElementNode {
+		switch n.DataAtom {
+		case atom.Img:
+			bundle.rewriteImage(n)
+			if !strings.HasPrefix(attrValue(n, "src"), siteImagesDir) {
+				alt := &nethtml.Node{Type: nethtml.TextNode, Data: attrValue(n, "alt")}
+				n.Parent.InsertBefore(alt, n)
+				n.Parent.RemoveChild(n)
+				return
+			}
+		case atom.A:
+			rewriteEPUBAnchor(n, file, bundle.baseURL, idFiles)
+		}
+	}
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		rewriteEPUBLinks(child, file, bundle, idFiles)
+		child = next
+	}
+}
+
+// rewriteEPUBAnchor rewrites a link for the chapter it ends up in. Links to
+// anchors in other chapters get the chapter's file name; links that cannot
+// work inside the book lose their href.
+func rewriteEPUBAnchor(n *nethtml.Node, file, baseURL string, idFiles map[string]string) {
+	for i, attr := range n.Attr {
+		if attr.Key != "href" {
+			continue
+		}
+		href := attr.Val
+
+		var rewritten string
+		switch {
+		case strings.HasPrefix(href, "#"):
+			id, err := url.PathUnescape(strings.TrimPrefix(href, "#"))
+			if target, ok := idFiles[id]; ok && err == nil {
+				rewritten = href
+				if target != file {
+					rewritten = target + href
+				}
+			}
+		case strings.HasPrefix(href, "/") && !strings.HasPrefix(href, "//"):
+			if baseURL != "" {
+				rewritten = baseURL + href
+			}
+		case !isInternalImageRef(href):
+			rewritten = href
+		}
+
+		if rewritten == "" {
+			n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+		} else {
+			n.Attr[i].Val = rewritten
+		}
+		return
+	}
+}
+
+// writeXHTML serializes an HTML node as XHTML
+func writeXHTML(b *strings.Builder, n *nethtml.Node) {
+	switch n.Type {
+	case nethtml.TextNode:
+		b.WriteString(xhtmlEscape(n.Data))
+	case nethtml.ElementNode:
+		b.WriteString("<" + n.Data)
+		for _, attr := range n.Attr {
+			b.WriteString(" " + attr.Key + `="` + xhtmlEscape(attr.Val) + `"`)
+		}
+		if epubVoidElements[n.DataAtom] && n.FirstChild == nil {
+			b.WriteString(" />")
+			return
+		}
+		b.WriteString(">")
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			writeXHTML(b, child)
+		}
+		b.WriteString("</" + n.Data + ">")
+	case nethtml.CommentNode:
+	default:
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			writeXHTML(b, child)
+		}
+	}
+}
+
+// xhtmlEscape escapes text for XML, dropping control characters XML does
+// not allow
+func xhtmlEscape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+	return html.EscapeString(s)
+}
+
+// headingLevel returns the level of an h1–h6 element, or 0
+func headingLevel(n *nethtml.Node) int {
+	if n.Type != nethtml.ElementNode {
+		return 0
+	}
+	switch n.DataAtom {
+	case atom.H1:
+		return 1
+	case atom.H2:
+		return 2
+	case atom.H3:
+		return 3
+	case atom.H4:
+		return 4
+	case atom.H5:
+		return 5
+	case atom.H6:
+		return 6
+	}
+	return 0
+}
+
+// nodeText returns the text content of a node
+func nodeText(n *nethtml.Node) string {
+	if n.Type == nethtml.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(nodeText(child))
+	}
+	return b.String()
+}
+
+// attrValue returns the value of an attribute, or ""
+func attrValue(n *nethtml.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// hasContent reports whether nodes contain anything but whitespace
+func hasContent(nodes []*nethtml.Node) bool {
+	for _, node := range nodes {
+		if node.Type == nethtml.ElementNode || strings.TrimSpace(node.Data) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// collectIDs records which file each element ID ends up in
+func collectIDs(n *nethtml.Node, file string, idFiles map[string]string) {
+	if id := attrValue(n, "id"); id != "" && n.Type == nethtml.ElementNode {
+		idFiles[id] = file
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		collectIDs(child, file, idFiles)
+	}
+}
+
+// exportLanguage guesses the language tag of an exported schedule: Korean
+// when it contains Hangul, English otherwise
+func exportLanguage(text string) string {
+	for _, r := range text {
+		if unicode.Is(unicode.Hangul, r) {
+			return "ko"
+		}
+	}
+	return "en"
+}
+
+// epubBook is the data the EPUB templates are rendered with
+type epubBook struct {
+	Identifier  string
+	Title       string
+	Description string
+	Dates       string
+	Date        string
+	Language    string
+	Modified    string
+	Chapters    []*epubChapter
+	Images      []epubImage
+}
+
+// epubImage is an embedded image listed in the package manifest
+type epubImage struct {
+	ID        string
+	Href      string
+	MediaType string
+}
+
+// epubFuncs are the functions available to the EPUB templates
+var epubFuncs = template.FuncMap{
+	"xml": xhtmlEscape,
+	"href": func(file, id string) string {
+		if id == "" {
+			return xhtmlEscape(file)
+		}
+		return xhtmlEscape(file + "#" + id)
+	},
+}
+
+var epubContainerTemplate = template.Must(template.New("container").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="` + epubContentDir + epubPackageFile + `" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`))
+
+var epubPackageTemplate = template.Must(template.New("package").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="{{.Language}}">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{xml .Identifier}}</dc:identifier>
+    <dc:title>{{xml .Title}}</dc:title>
+    <dc:language>{{.Language}}</dc:language>
+    {{- if .Description}}
+    <dc:description>{{xml .Description}}</dc:description>
+    {{- end}}
+    {{- if .Date}}
+    <dc:date>{{.Date}}</dc:date>
+    {{- end}}
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="` + epubNavFile + `" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="style" href="` + epubStylesheet + `" media-type="text/css"/>
+    <item id="title" href="` + epubTitleFile + `" media-type="application/xhtml+xml"/>
+    {{- range .Chapters}}
+    <item id="{{.ID}}" href="{{xml .File}}" media-type="application/xhtml+xml"/>
+    {{- end}}
+    {{- range .Images}}
+    <item id="{{.ID}}" href="{{xml .Href}}" media-type="{{xml .MediaType}}"/>
+    {{- end}}
+  </manifest>
+  <spine>
+    <itemref idref="title"/>
+    {{- range .Chapters}}
+    <itemref idref="{{.ID}}"/>
+    {{- end}}
+  </spine>
+</package>
+`))
+
+var epubNavTemplate = template.Must(template.New("nav").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{.Language}}" xml:lang="{{.Language}}">
+<head>
+<meta charset="UTF-8"/>
+<title>{{xml .Title}}</title>
+<link rel="stylesheet" type="text/css" href="` + epubStylesheet + `"/>
+</head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>Contents</h1>
+<ol>
+{{- range .Chapters}}
+<li><a href="{{href .File .HeadingID}}">{{xml .Title}}</a>{{.NavList}}</li>
+{{- end}}
+</ol>
+</nav>
+</body>
+</html>
+`))
+
+var epubTitleTemplate = template.Must(template.New("title").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{.Language}}" xml:lang="{{.Language}}">
+<head>
+<meta charset="UTF-8"/>
+<title>{{xml .Title}}</title>
+<link rel="stylesheet" type="text/css" href="` + epubStylesheet + `"/>
+</head>
+<body>
+<section epub:type="titlepage" class="titlepage">
+<h1 class="title">{{xml .Title}}</h1>
+{{- if .Dates}}
+<p class="dates">{{xml .Dates}}</p>
+{{- end}}
+{{- if .Description}}
+<p class="description">{{xml .Description}}</p>
+{{- end}}
+</section>
+</body>
+</html>
+`))
+
+var epubChapterTemplate = template.Must(template.New("chapter").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{.Book.Language}}" xml:lang="{{.Book.Language}}">
+<head>
+<meta charset="UTF-8"/>
+<title>{{xml .Chapter.Title}}</title>
+<link rel="stylesheet" type="text/css" href="` + epubStylesheet + `"/>
+</head>
+<body>
+<section epub:type="chapter">
+{{.Chapter.Body}}
+</section>
+</body>
+</html>
+`))
+
+// epubCSS styles exported books; e-readers apply their own fonts and sizes
+const epubCSS = `
+body { line-height: 1.6; word-break: keep-all; overflow-wrap: break-word; }
+.titlepage { text-align: center; margin-top: 30%; }
+.titlepage .dates { color: #555; }
+h2 { page-break-after: avoid; border-bottom: 1px solid #ccc; }
+h3, h4 { page-break-after: avoid; }
+img { max-width: 100%; height: auto; }
+figure, img, table, pre { page-break-inside: avoid; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.5em; }
+blockquote { margin: 1em 0; padding-left: 1em; border-left: 0.25em solid #ccc; color: #555; }
+pre, code { font-family: monospace; }
+pre { white-space: pre-wrap; }
+.directive { border: 1px solid #ccc; border-left-width: 0.25em; padding: 0.5em 0.75em; margin: 1em 0; page-break-inside: avoid; }
+.directive-title { margin: 0 0 0.5em; font-weight: bold; }
+.directive-kind { font-size: 0.8em; text-transform: uppercase; color: #555; margin-right: 0.5em; }
+.directive-attributes dt { float: left; clear: left; width: 35%; color: #555; }
+.directive-attributes dd { margin-left: 35%; }
+nav#toc ol { list-style: none; padding-left: 1em; }
+`
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// epubPackage is the part of an OPF package document the tests check
+type epubPackage struct {
+	Version          string `xml:"version,attr"`
+	UniqueIdentifier string `xml:"unique-identifier,attr"`
+	Identifiers      []struct {
+		ID    string `xml:"id,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"metadata>identifier"`
+	Titles    []string `xml:"metadata>title"`
+	Languages []string `xml:"metadata>language"`
+	Metas     []struct {
+		Property string `xml:"property,attr"`
+		Value    string `xml:",chardata"`
+	} `xml:"metadata>meta"`
+	Items []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Itemrefs []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// validateEPUB checks the structure of an EPUB 3 container: the mimetype
+// entry, container.xml, required package metadata, that the manifest and
+// the archive list the same files, the spine and nav document, that content
+// documents are well-formed XML and that their links and images resolve.
+// It returns the content documents by path.
+func validateEPUB(t *testing.T, data []byte) (*epubPackage, map[string]string) {
+	t.Helper()
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("output is not a zip: %v", err)
+	}
+	entries := make(map[string][]byte)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		entries[f.Name], _ = io.ReadAll(r)
+	}
+
+	first := archive.File[0]
+	if first.Name != "mimetype" || first.Method != zip.Store || len(first.Extra) != 0 || first.Flags&0x8 != 0 {
+		t.Errorf("first entry = %s (method %d, %d extra bytes, flags %#x), want a plain stored mimetype",
+			first.Name, first.Method, len(first.Extra), first.Flags)
+	}
+	if string(entries["mimetype"]) != "application/epub+zip" {
+		t.Errorf("mimetype = %q", entries["mimetype"])
+	}
+
+	var container struct {
+		Rootfiles []struct {
+			FullPath  string `xml:"full-path,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := xml.Unmarshal(entries["META-INF/container.xml"], &container); err != nil || len(container.Rootfiles) != 1 {
+		t.Fatalf("invalid container.xml (%v): %s", err, entries["META-INF/container.xml"])
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	if container.Rootfiles[0].MediaType != "application/oebps-package+xml" {
+		t.Errorf("rootfile media type = %s", container.Rootfiles[0].MediaType)
+	}
+
+	var pkg epubPackage
+	if err := xml.Unmarshal(entries[opfPath], &pkg); err != nil {
+		t.Fatalf("invalid package document %s: %v", opfPath, err)
+	}
+	if pkg.Version != "3.0" {
+		t.Errorf("package version = %q, want 3.0", pkg.Version)
+	}
+	hasIdentifier := false
+	for _, identifier := range pkg.Identifiers {
+		if identifier.ID == pkg.UniqueIdentifier && strings.TrimSpace(identifier.Value) != "" {
+			hasIdentifier = true
+		}
+	}
+	if !hasIdentifier {
+		t.Errorf("package has no identifier %q", pkg.UniqueIdentifier)
+	}
+	if len(pkg.Titles) == 0 || len(pkg.Languages) == 0 {
+		t.Errorf("package should have a title and a language: %+v", pkg)
+	}
+	modified := regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$`)
+	hasModified := false
+	for _, meta := range pkg.Metas {
+		if meta.Property == "dcterms:modified" {
+			hasModified = modified.MatchString(meta.Value)
+		}
+	}
+	if !hasModified {
+		t.Error("package should have a dcterms:modified date")
+	}
+
+	// The manifest lists every file in the container but the package
+	// document, and nothing else
+	baseDir := path.Dir(opfPath)
+	manifest := make(map[string]string) // Path to media type
+	items := make(map[string]string)    // ID to path
+	navs := 0
+	for _, item := range pkg.Items {
+		href, err := url.PathUnescape(item.Href)
+		if err != nil {
+			t.Errorf("manifest href %q is not a URL path", item.Href)
+		}
+		full := path.Join(baseDir, href)
+		if _, ok := entries[full]; !ok {
+			t.Errorf("manifest item %s is missing from the container", full)
+		}
+		if _, ok := items[item.ID]; ok || item.ID == "" {
+			t.Errorf("manifest item ID %q is empty or repeated", item.ID)
+		}
+		manifest[full] = item.MediaType
+		items[item.ID] = full
+		if strings.Contains(item.Properties, "nav") {
+			navs++
+		}
+	}
+	if navs != 1 {
+		t.Errorf("manifest has %d nav documents, want 1", navs)
+	}
+	for name := range entries {
+		if name == "mimetype" || name == opfPath || strings.HasPrefix(name, "META-INF/") {
+			continue
+		}
+		if _, ok := manifest[name]; !ok {
+			t.Errorf("%s is not in the manifest", name)
+		}
+	}
+
+	if len(pkg.Itemrefs) == 0 {
+		t.Error("spine is empty")
+	}
+	for _, itemref := range pkg.Itemrefs {
+		if manifest[items[itemref.IDRef]] != "application/xhtml+xml" {
+			t.Errorf("spine item %q is not a content document", itemref.IDRef)
+		}
+	}
+
+	// Content documents are well-formed and their references resolve
+	documents := make(map[string]string)
+	ids := make(map[string]map[string]bool)
+	type reference struct{ from, to string }
+	var references []reference
+	for name, mediaType := range manifest {
+		if mediaType != "application/xhtml+xml" {
+			continue
+		}
+		documents[name] = string(entries[name])
+		ids[name] = make(map[string]bool)
+
+		decoder := xml.NewDecoder(bytes.NewReader(entries[name]))
+		for {
+			token, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("%s is not well-formed: %v", name, err)
+				break
+			}
+			element, ok := token.(xml.StartElement)
+			if !ok {
+				continue
+			}
+			for _, attr := range element.Attr {
+				switch attr.Name.Local {
+				case "id":
+					if ids[name][attr.Value] {
+						t.Errorf("%s repeats id %q", name, attr.Value)
+					}
+					ids[name][attr.Value] = true
+				case "href", "src":
+					references = append(references, reference{name, attr.Value})
+				}
+			}
+		}
+	}
+	for _, ref := range references {
+		target, err := url.Parse(ref.to)
+		if err != nil || target.Scheme != "" || target.Host != "" {
+			continue
+		}
+		full := ref.from
+		if target.Path != "" {
+			full = path.Join(path.Dir(ref.from), target.Path)
+		}
+		if _, ok := manifest[full]; !ok {
+			t.Errorf("%s links to %s, which is not in the manifest", ref.from, ref.to)
+			continue
+		}
+		if target.Fragment != "" && !ids[full][target.Fragment] {
+			t.Errorf("%s links to %s, which has no such id", ref.from, ref.to)
+		}
+	}
+
+	return &pkg, documents
+}
+
+func TestEPUBExporter_Export(t *testing.T) {
+	owner := uuid.New()
+	files := &memoryFiles{}
+	files.add(owner, "해변.png", "uploads/a1.png", true)
+	files.data = map[string][]byte{"uploads/a1.png": []byte("png")}
+
+	markdown := "# 제주 여행\n\n" +
+		"Intro with [day 2](#2일차-서귀포), a footnote[^1] & <b onclick=\"steal()\">tags</b>.\n\n" +
+		"## 준비물\n\n- [x] 여권\n\n" +
+		"## 1일차 - 제주시\n\n### 점심\n\n![해변](해변.png) ![remote](https://example.com/x.png)\n\n" +
+		"| 시간 | 장소 |\n|---|---:|\n| 09:00 | 공항 |\n\n---\n\n" +
+		"## 2일차 - 서귀포\n\n[back](#점심), [trip](/schedules/42), [ticket](ticket.pdf)\n\n" +
+		"## 예산\n\n- 숙소: 120,000원\n\n" +
+		"[^1]: Note\n"
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	doc := &ScheduleExport{
+		ID:           uuid.New(),
+		Title:        "제주 & 여행",
+		Description:  "2박 3일",
+		Markdown:     markdown,
+		StartDate:    &start,
+		UpdatedAt:    time.Date(2024, 4, 1, 12, 30, 0, 0, time.FixedZone("KST", 9*60*60)),
+		ImageOwnerID: owner,
+	}
+
+	var out bytes.Buffer
+	exporter := NewEPUBExporter(files, NewImageResolver(files, files))
+	exporter.markdownService.SetRenderCache(nil)
+	if err := exporter.Export(&out, doc, "https://trip.example"); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	pkg, documents := validateEPUB(t, out.Bytes())
+
+	if pkg.Titles[0] != doc.Title || pkg.Languages[0] != "ko" || pkg.Identifiers[0].Value != "urn:uuid:"+doc.ID.String() {
+		t.Errorf("package metadata = %+v", pkg)
+	}
+	if pkg.Metas[0].Value != "2024-04-01T03:30:00Z" {
+		t.Errorf("dcterms:modified = %s", pkg.Metas[0].Value)
+	}
+
+	// Title page, overview and one chapter per day
+	var spine []string
+	for _, itemref := range pkg.Itemrefs {
+		spine = append(spine, itemref.IDRef)
+	}
+	if got := strings.Join(spine, " "); got != "title chapter-01 chapter-02 chapter-03" {
+		t.Errorf("spine = %s", got)
+	}
+
+	overview := documents["OEBPS/chapter-01.xhtml"]
+	day1 := documents["OEBPS/chapter-02.xhtml"]
+	day2 := documents["OEBPS/chapter-03.xhtml"]
+	for _, check := range []struct {
+		document, name, want string
+	}{
+		{overview, "overview", `<a href="chapter-03.xhtml#` + url.PathEscape("2일차-서귀포") + `" rel="nofollow">day 2</a>`},
+		{overview, "overview", `<input checked="" disabled="" type="checkbox" />`},
+		{day1, "day 1", `<img src="images/%ED%95%B4%EB%B3%80.png" alt="해변" loading="lazy" />`},
+		{day1, "day 1", `<hr />`},
+		{day2, "day 2", `<a href="chapter-02.xhtml#` + url.PathEscape("점심") + `" rel="nofollow">back</a>`},
+		{day2, "day 2", `<a href="https://trip.example/schedules/42" rel="nofollow">trip</a>`},
+		{day2, "day 2", `<a rel="nofollow">ticket</a>`},
+		{day2, "day 2", `<h2 id="예산">`},
+	} {
+		if !strings.Contains(check.document, check.want) {
+			t.Errorf("%s should contain %s:\n%s", check.name, check.want, check.document)
+		}
+	}
+	if strings.Contains(day1, "example.com/x.png") || !strings.Contains(day1, "remote") {
+		t.Errorf("remote images should be replaced by their alt text:\n%s", day1)
+	}
+	if strings.Contains(overview, "onclick") || strings.Contains(overview, "제주 여행</h1>") {
+		t.Errorf("overview should be sanitized and leave out the title:\n%s", overview)
+	}
+
+	nav := documents["OEBPS/nav.xhtml"]
+	for _, want := range []string{
+		`<li><a href="chapter-01.xhtml">Overview</a><ol><li><a href="chapter-01.xhtml#준비물">준비물</a></li></ol></li>`,
+		`<li><a href="chapter-02.xhtml#1일차-제주시">1일차 - 제주시</a><ol><li><a href="chapter-02.xhtml#점심">점심</a></li></ol></li>`,
+		`<li><a href="chapter-03.xhtml#2일차-서귀포">2일차 - 서귀포</a>`,
+	} {
+		if !strings.Contains(nav, want) {
+			t.Errorf("nav should contain %s:\n%s", want, nav)
+		}
+	}
+	if title := documents["OEBPS/title.xhtml"]; !strings.Contains(title, "제주 &amp; 여행") || !strings.Contains(title, "2024-05-01") {
+		t.Errorf("title page = %s", title)
+	}
+}
+
+func TestEPUBExporter_Empty(t *testing.T) {
+	files := &memoryFiles{}
+	exporter := NewEPUBExporter(files, NewImageResolver(files, files))
+	exporter.markdownService.SetRenderCache(nil)
+
+	var out bytes.Buffer
+	if err := exporter.Export(&out, &ScheduleExport{Title: "Trip"}, ""); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	pkg, _ := validateEPUB(t, out.Bytes())
+	if pkg.Languages[0] != "en" || len(pkg.Itemrefs) != 2 {
+		t.Errorf("package = %+v", pkg)
+	}
+}
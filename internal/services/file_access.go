@@ -0,0 +1,150 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+
+	"tripflow/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// FileAccessStore finds the file records stored at a path
+type FileAccessStore interface {
+	FindByPath(filePath string) ([]*models.File, error)
+}
+
+// FileAccessSchedules finds the schedules that can make a file public and
+// records the uploads their markdown refers to
+type FileAccessSchedules interface {
+	HasPublicWithFile(fileID, ownerID uuid.UUID) (bool, error)
+	HasPublicRef(ownerID uuid.UUID, filePath, filename string) (bool, error)
+	SetFileRefs(scheduleID uuid.UUID, refs []models.ScheduleFileRef) error
+	ListUnindexed() ([]*models.Schedule, error)
+}
+
+// FileAccess decides which stored files belong to public schedules
+type FileAccess struct {
+	files     FileAccessStore
+	schedules FileAccessSchedules
+	markdown  *MarkdownService
+}
+
+// NewFileAccess creates a FileAccess reading schedules' markdown files
+// through markdown
+func NewFileAccess(files FileAccessStore, schedules FileAccessSchedules, markdown *MarkdownService) *FileAccess {
+	return &FileAccess{
+		files:     files,
+		schedules: schedules,
+		markdown:  markdown,
+	}
+}
+
+// IsPublic reports whether the file or image variant stored at filePath
+// belongs to a public schedule of its uploader: either as the schedule's
+// markdown file, or as an upload the schedule's markdown refers to the way
+// ImageResolver resolves images. References are looked up in the records
+// made by Index, so no markdown is read.
+func (a *FileAccess) IsPublic(filePath string) (bool, error) {
+	files, err := a.files.FindByPath(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	for _, file := range files {
+		// Only schedules of the file's uploader can publish it
+		published, err := a.schedules.HasPublicWithFile(file.ID, file.UserID)
+		if err != nil {
+			return false, err
+		}
+		if published {
+			return true, nil
+		}
+
+		referenced, err := a.schedules.HasPublicRef(file.UserID, file.FilePath, file.Filename)
+		if err != nil {
+			return false, err
+		}
+		if referenced {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Index records the uploads a schedule's markdown refers to. It must be
+// called whenever a schedule's markdown source changes.
+func (a *FileAccess) Index(schedule *models.Schedule, markdown string) error {
+	return a.schedules.SetFileRefs(schedule.ID, FileRefs(markdown))
+}
+
+// IndexUnindexed records the references of schedules saved before they
+// were recorded and returns how many it indexed. A schedule that cannot be
+// indexed is left for the next run, and the others are still indexed.
+func (a *FileAccess) IndexUnindexed() (int, error) {
+	schedules, err := a.schedules.ListUnindexed()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list schedules: %w", err)
+	}
+
+	indexed := 0
+	var errs []error
+	for _, schedule := range schedules {
+		markdown := schedule.Content
+		if markdown == "" && schedule.File != nil {
+			if markdown, err = a.markdown.ReadMarkdownFile(schedule.File.FilePath); err != nil {
+				errs = append(errs, fmt.Errorf("failed to read schedule %s: %w", schedule.ID, err))
+				continue
+			}
+		}
+		if err := a.Index(schedule, markdown); err != nil {
+			errs = append(errs, fmt.Errorf("failed to index schedule %s: %w", schedule.ID, err))
+			continue
+		}
+		indexed++
+	}
+	return indexed, errors.Join(errs...)
+}
+
+// fileURLPattern matches file URLs anywhere in markdown, including inside
+// raw HTML, up to the characters that end a URL there
+var fileURLPattern = regexp.MustCompile(`/api/file/[^\s"'()<>?#,]+`)
+
+// FileRefs returns the uploads markdown refers to: the storage paths of its
+// file URLs, and its internal image references with the filename they
+// also match the owner's uploads by
+func FileRefs(markdown string) []models.ScheduleFileRef {
+	refs := make(map[string]string) // Path to filename
+
+	for _, fileURL := range fileURLPattern.FindAllString(markdown, -1) {
+		if storagePath, ok := fileURLPath(fileURL); ok {
+			if _, seen := refs[storagePath]; !seen {
+				refs[storagePath] = ""
+			}
+		}
+	}
+
+	source := []byte(markdown)
+	doc := goldmark.New().Parser().Parse(text.NewReader(source))
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		image, ok := node.(*ast.Image)
+		if !ok || !entering || !isInternalImageRef(string(image.Destination)) {
+			return ast.WalkContinue, nil
+		}
+		if ref := cleanImageRef(string(image.Destination)); ref != "" {
+			refs[ref] = path.Base(ref)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	result := make([]models.ScheduleFileRef, 0, len(refs))
+	for ref, filename := range refs {
+		result = append(result, models.ScheduleFileRef{Path: ref, Filename: filename})
+	}
+	return result
+}
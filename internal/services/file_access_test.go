@@ -0,0 +1,146 @@
+package services
+
+import (
+	"testing"
+
+	"tripflow/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func (m *memoryFiles) FindByPath(filePath string) ([]*models.File, error) {
+	var files []*models.File
+	for _, f := range m.records {
+		if f.FilePath == filePath {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// memoryAccessSchedules is an in-memory FileAccessSchedules
+type memoryAccessSchedules struct {
+	schedules []*models.Schedule
+	refs      map[uuid.UUID][]models.ScheduleFileRef
+}
+
+func (m *memoryAccessSchedules) HasPublicWithFile(fileID, ownerID uuid.UUID) (bool, error) {
+	for _, s := range m.schedules {
+		if s.FileID == fileID && s.UserID == ownerID && s.IsPublic {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryAccessSchedules) HasPublicRef(ownerID uuid.UUID, filePath, filename string) (bool, error) {
+	for _, s := range m.schedules {
+		if s.UserID != ownerID || !s.IsPublic {
+			continue
+		}
+		for _, ref := range m.refs[s.ID] {
+			if ref.Path == filePath || (ref.Filename != "" && ref.Filename == filename) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryAccessSchedules) SetFileRefs(scheduleID uuid.UUID, refs []models.ScheduleFileRef) error {
+	if m.refs == nil {
+		m.refs = make(map[uuid.UUID][]models.ScheduleFileRef)
+	}
+	m.refs[scheduleID] = refs
+	for _, s := range m.schedules {
+		if s.ID == scheduleID {
+			s.FileRefsIndexed = true
+		}
+	}
+	return nil
+}
+
+func (m *memoryAccessSchedules) ListUnindexed() ([]*models.Schedule, error) {
+	var schedules []*models.Schedule
+	for _, s := range m.schedules {
+		if !s.FileRefsIndexed {
+			schedules = append(schedules, s)
+		}
+	}
+	return schedules, nil
+}
+
+func TestFileAccess_IsPublic(t *testing.T) {
+	owner, other := uuid.New(), uuid.New()
+	files := &memoryFiles{data: map[string][]byte{}}
+	files.add(owner, "trip.md", "uploads/m1.md", true)
+	files.add(owner, "a.png", "uploads/a1.png", true)
+	files.add(owner, "data.png", "uploads/d1.png", true)
+	files.add(owner, "linked.png", "uploads/l1.png", true)
+	files.add(owner, "private.png", "uploads/p1.png", true)
+	files.add(other, "a.png", "uploads/o1.png", true)
+	files.add(owner, "draft.md", "uploads/m2.md", true)
+	files.add(owner, "hidden.png", "uploads/h1.png", true)
+
+	// The public schedule's images are only in its markdown file
+	files.data["uploads/m1.md"] = []byte("# 제주\n\n![섬](images/a.png)\n\n" +
+		"[원본](/api/file/uploads/l1.png)\n\n<img src=\"/api/file/uploads/p1.png.bak\">\n")
+	files.data["uploads/m2.md"] = []byte("![](hidden.png)\n")
+	schedules := &memoryAccessSchedules{schedules: []*models.Schedule{
+		{ID: uuid.New(), UserID: owner, IsPublic: true, FileID: files.records[0].ID, File: files.records[0]},
+		{ID: uuid.New(), UserID: owner, IsPublic: false, FileID: files.records[6].ID, File: files.records[6]},
+		// Another user's public schedule cannot publish the owner's file
+		{ID: uuid.New(), UserID: other, IsPublic: true, FileID: files.records[6].ID, File: files.records[6]},
+	}}
+	access := NewFileAccess(files, schedules, NewMarkdownService(files))
+	if n, err := access.IndexUnindexed(); err != nil || n != 3 {
+		t.Fatalf("IndexUnindexed() = %d, %v, want 3", n, err)
+	}
+	// Markdown is only read when indexing
+	files.data["uploads/m1.md"] = nil
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"uploads/m1.md", true},  // The public schedule's markdown file
+		{"uploads/a1.png", true}, // Referenced by filename
+		{"uploads/l1.png", true}, // Linked by URL
+		{"uploads/d1.png", false},
+		{"uploads/p1.png", false}, // Only a longer URL starts with its URL
+		{"uploads/o1.png", false}, // Same filename, another user's upload
+		{"uploads/m2.md", false},  // A private schedule's markdown file
+		{"uploads/h1.png", false}, // Referenced from a private schedule
+		{"uploads/missing.png", false},
+	}
+	for _, tt := range tests {
+		got, err := access.IsPublic(tt.path)
+		if err != nil || got != tt.want {
+			t.Errorf("IsPublic(%s) = %v, %v, want %v", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestFileRefs(t *testing.T) {
+	markdown := "![섬](./images/%EC%84%AC.png?w=1)\n\n" +
+		"[원본](/api/file/uploads/a%20b.png), <img src=\"/api/file/uploads/c.png\">\n\n" +
+		"![외부](https://example.com/x.png) ![](/static/y.png)\n"
+
+	got := make(map[string]string)
+	for _, ref := range FileRefs(markdown) {
+		got[ref.Path] = ref.Filename
+	}
+	want := map[string]string{
+		"images/섬.png":    "섬.png",
+		"uploads/a b.png": "",
+		"uploads/c.png":   "",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("FileRefs() = %v, want %v", got, want)
+	}
+	for path, filename := range want {
+		if f, ok := got[path]; !ok || f != filename {
+			t.Errorf("FileRefs()[%s] = %q, %v, want %q", path, f, ok, filename)
+		}
+	}
+}
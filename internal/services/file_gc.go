@@ -0,0 +1,310 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"tripflow/internal/models"
+	"tripflow/pkg/filestorage"
+
+	"github.com/google/uuid"
+)
+
+// defaultFileGCGrace is how old unreferenced files and stray storage
+// objects must be before they are collected when FILE_GC_GRACE is unset
+const defaultFileGCGrace = 7 * 24 * time.Hour
+
+// fileGCPrefix is where uploads are stored; nothing outside it is collected
+const fileGCPrefix = "uploads/"
+
+// maxReferenceScan caps how much of a schedule's markdown file is searched
+// for references to uploads
+const maxReferenceScan = 16 << 20
+
+// GCFileStore provides the file records the collector reconciles with
+// storage
+type GCFileStore interface {
+	ListAll() ([]*models.File, error)
+	ListAllVariants() ([]*models.ImageVariant, error)
+	Delete(id uuid.UUID) ([]string, error)
+}
+
+// GCScheduleStore provides the schedules that keep files referenced
+type GCScheduleStore interface {
+	ListAll() ([]*models.Schedule, error)
+}
+
+// GCReport describes what a collection found and, unless it was a dry
+// run, removed
+type GCReport struct {
+	DryRun     bool      `json:"dry_run"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Grace      string    `json:"grace"`
+
+	// Storage objects that no file record or image variant refers to
+	OrphanedObjects []GCItem `json:"orphaned_objects"`
+
+	// File records whose storage object is gone
+	MissingObjects []GCItem `json:"missing_objects"`
+
+	// File records no schedule refers to
+	UnreferencedFiles []GCItem `json:"unreferenced_files"`
+
+	// Failures that did not stop the collection
+	Errors []string `json:"errors,omitempty"`
+}
+
+// GCItem is a storage object or file record found by a collection
+type GCItem struct {
+	Path    string `json:"path"`
+	FileID  string `json:"file_id,omitempty"`
+	Size    int64  `json:"size"`
+	Removed bool   `json:"removed"`
+	Note    string `json:"note,omitempty"`
+}
+
+// FileGC reconciles file records with storage. It finds storage objects
+// without records, records without storage objects and uploads no schedule
+// refers to, and removes them unless asked for a dry run. Stray objects
+// and unreferenced uploads are only collected once they are older than the
+// grace period, so uploads in progress and files waiting to be attached to
+// a schedule are kept.
+type FileGC struct {
+	files     GCFileStore
+	schedules GCScheduleStore
+	storage   filestorage.FileStorageServiceV2
+	grace     time.Duration
+	now       func() time.Time
+
+	mu sync.Mutex // Serializes collections
+}
+
+// NewFileGC creates a FileGC with the given grace period
+func NewFileGC(files GCFileStore, schedules GCScheduleStore, storage filestorage.FileStorageService, grace time.Duration) *FileGC {
+	return &FileGC{
+		files:     files,
+		schedules: schedules,
+		storage:   filestorage.AdaptV1(storage),
+		grace:     grace,
+		now:       time.Now,
+	}
+}
+
+// DefaultFileGCGrace returns the grace period from FILE_GC_GRACE, a Go
+// duration such as "72h", defaulting to 7 days
+func DefaultFileGCGrace() time.Duration {
+	grace := defaultFileGCGrace
+	if value := os.Getenv("FILE_GC_GRACE"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			log.Printf("Invalid FILE_GC_GRACE %q, using %s", value, grace)
+		} else {
+			grace = parsed
+		}
+	}
+	return grace
+}
+
+// Run performs a collection. With dryRun set it only reports what it
+// would remove.
+func (g *FileGC) Run(ctx context.Context, dryRun bool) (*GCReport, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	report := &GCReport{
+		DryRun:            dryRun,
+		StartedAt:         g.now(),
+		Grace:             g.grace.String(),
+		OrphanedObjects:   []GCItem{},
+		MissingObjects:    []GCItem{},
+		UnreferencedFiles: []GCItem{},
+	}
+	cutoff := report.StartedAt.Add(-g.grace)
+
+	objects, err := g.storage.List(ctx, fileGCPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored files: %w", err)
+	}
+	files, err := g.files.ListAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file records: %w", err)
+	}
+	variants, err := g.files.ListAllVariants()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list image variants: %w", err)
+	}
+	schedules, err := g.schedules.ListAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+
+	stored := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		stored[object.Path] = true
+	}
+	recorded := make(map[string]bool, len(files)+len(variants))
+	for _, file := range files {
+		recorded[file.FilePath] = true
+	}
+	for _, variant := range variants {
+		recorded[variant.FilePath] = true
+	}
+
+	// Storage objects without records. Objects are written before their
+	// record, so recent ones may belong to an upload in progress.
+	for _, object := range objects {
+		if recorded[object.Path] || object.ModTime.IsZero() || object.ModTime.After(cutoff) {
+			continue
+		}
+		item := GCItem{Path: object.Path, Size: object.Size}
+		if !dryRun {
+			if err := g.storage.Delete(ctx, object.Path); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("failed to delete %s: %v", object.Path, err))
+			} else {
+				item.Removed = true
+			}
+		}
+		report.OrphanedObjects = append(report.OrphanedObjects, item)
+	}
+
+	// Without every schedule's content no file can be shown to be
+	// unreferenced, so a failed scan keeps them all
+	references, scanErr := g.scanReferences(ctx, schedules, files)
+	if scanErr != nil {
+		report.Errors = append(report.Errors, scanErr.Error())
+	}
+
+	for _, file := range files {
+		referenced := references.refersTo(file)
+
+		// Records whose storage object is gone
+		if !stored[file.FilePath] && strings.HasPrefix(file.FilePath, fileGCPrefix) {
+			item := GCItem{Path: file.FilePath, FileID: file.ID.String(), Size: file.FileSize}
+			switch {
+			case scanErr != nil:
+				item.Note = "kept: schedule references could not be checked"
+			case referenced:
+				item.Note = "kept: referenced by a schedule"
+			case !dryRun:
+				item.Removed = g.remove(ctx, report, file, stored)
+			}
+			report.MissingObjects = append(report.MissingObjects, item)
+			continue
+		}
+
+		// Uploads no schedule refers to
+		if scanErr != nil || referenced || file.CreatedAt.After(cutoff) {
+			continue
+		}
+		item := GCItem{Path: file.FilePath, FileID: file.ID.String(), Size: file.FileSize}
+		if !dryRun {
+			item.Removed = g.remove(ctx, report, file, stored)
+		}
+		report.UnreferencedFiles = append(report.UnreferencedFiles, item)
+	}
+
+	report.FinishedAt = g.now()
+	return report, nil
+}
+
+// remove deletes a file record and then the storage objects it referred
+// to; objects that fail to delete are left for the next collection
+func (g *FileGC) remove(ctx context.Context, report *GCReport, file *models.File, stored map[string]bool) bool {
+	paths, err := g.files.Delete(file.ID)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to delete file record %s: %v", file.ID, err))
+		return false
+	}
+	for _, path := range paths {
+		if !stored[path] {
+			continue
+		}
+		if err := g.storage.Delete(ctx, path); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to delete %s: %v", path, err))
+		}
+	}
+	return true
+}
+
+// gcReferences is what live schedules refer to
+type gcReferences struct {
+	fileIDs map[uuid.UUID]bool
+	all     []string               // Content of every schedule
+	byOwner map[uuid.UUID][]string // Content of each user's schedules
+}
+
+// refersTo reports whether a schedule uses file: as its markdown file, by
+// storage path, or by filename in a schedule of the file's uploader, the
+// references ImageResolver resolves
+func (r *gcReferences) refersTo(file *models.File) bool {
+	if r.fileIDs[file.ID] {
+		return true
+	}
+	for _, content := range r.all {
+		if strings.Contains(content, file.FilePath) {
+			return true
+		}
+	}
+	for _, content := range r.byOwner[file.UserID] {
+		if file.Filename != "" && strings.Contains(content, file.Filename) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanReferences collects the files schedules refer to, reading each
+// schedule's markdown file
+func (g *FileGC) scanReferences(ctx context.Context, schedules []*models.Schedule, files []*models.File) (*gcReferences, error) {
+	byID := make(map[uuid.UUID]*models.File, len(files))
+	for _, file := range files {
+		byID[file.ID] = file
+	}
+
+	references := &gcReferences{
+		fileIDs: make(map[uuid.UUID]bool),
+		byOwner: make(map[uuid.UUID][]string),
+	}
+	for _, schedule := range schedules {
+		references.fileIDs[schedule.FileID] = true
+		contents := []string{schedule.Content}
+
+		if file, ok := byID[schedule.FileID]; ok {
+			markdown, err := g.readMarkdown(ctx, file.FilePath)
+			if err != nil {
+				return references, fmt.Errorf("failed to read schedule %s: %w", schedule.ID, err)
+			}
+			contents = append(contents, markdown)
+		}
+
+		references.all = append(references.all, contents...)
+		references.byOwner[schedule.UserID] = append(references.byOwner[schedule.UserID], contents...)
+	}
+	return references, nil
+}
+
+// readMarkdown reads a schedule's markdown file; a missing file has no
+// references
+func (g *FileGC) readMarkdown(ctx context.Context, path string) (string, error) {
+	rc, err := g.storage.Open(ctx, path)
+	if err != nil {
+		if exists, existsErr := g.storage.Exists(ctx, path); existsErr == nil && !exists {
+			return "", nil
+		}
+		return "", err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxReferenceScan))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tripflow/internal/models"
+	"tripflow/pkg/filestorage"
+
+	"github.com/google/uuid"
+)
+
+// memoryGCStore is an in-memory GCFileStore and GCScheduleStore
+type memoryGCStore struct {
+	files     []*models.File
+	variants  []*models.ImageVariant
+	schedules []*models.Schedule
+}
+
+func (m *memoryGCStore) ListAll() ([]*models.File, error) {
+	return append([]*models.File(nil), m.files...), nil
+}
+
+func (m *memoryGCStore) ListAllVariants() ([]*models.ImageVariant, error) {
+	return append([]*models.ImageVariant(nil), m.variants...), nil
+}
+
+func (m *memoryGCStore) Delete(id uuid.UUID) ([]string, error) {
+	var paths []string
+	for i, file := range m.files {
+		if file.ID == id {
+			paths = append(paths, file.FilePath)
+			m.files = append(m.files[:i], m.files[i+1:]...)
+			break
+		}
+	}
+	kept := m.variants[:0]
+	for _, variant := range m.variants {
+		if variant.FileID == id {
+			paths = append(paths, variant.FilePath)
+		} else {
+			kept = append(kept, variant)
+		}
+	}
+	m.variants = kept
+	return paths, nil
+}
+
+// memoryGCSchedules exposes the schedules of a memoryGCStore
+type memoryGCSchedules struct{ *memoryGCStore }
+
+func (m memoryGCSchedules) ListAll() ([]*models.Schedule, error) {
+	return m.schedules, nil
+}
+
+// gcFixture is a storage and records with files in every state
+type gcFixture struct {
+	gc      *FileGC
+	store   *memoryGCStore
+	storage filestorage.FileStorageService
+	dir     string
+	now     time.Time
+}
+
+func newGCFixture(t *testing.T) *gcFixture {
+	t.Helper()
+	dir := t.TempDir()
+	storage, err := filestorage.NewLocalFileStorage(dir)
+	if err != nil {
+		t.Fatalf("NewLocalFileStorage() error = %v", err)
+	}
+	f := &gcFixture{
+		store:   &memoryGCStore{},
+		storage: storage,
+		dir:     dir,
+		now:     time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+	f.gc = NewFileGC(f.store, memoryGCSchedules{f.store}, storage, 24*time.Hour)
+	f.gc.now = func() time.Time { return f.now }
+	return f
+}
+
+// upload stores content with the given age and records it unless record
+// is false
+func (f *gcFixture) upload(t *testing.T, owner uuid.UUID, filename, content string, age time.Duration, record bool) *models.File {
+	t.Helper()
+	path, err := f.storage.UploadFile(strings.NewReader(content), filename, "")
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	modTime := f.now.Add(-age)
+	if err := os.Chtimes(filepath.Join(f.dir, path), modTime, modTime); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+
+	file := models.NewFile(owner, filename, path, int64(len(content)), "")
+	file.CreatedAt = modTime
+	if record {
+		f.store.files = append(f.store.files, file)
+	}
+	return file
+}
+
+func (f *gcFixture) exists(path string) bool {
+	exists, _ := f.storage.FileExists(path)
+	return exists
+}
+
+func TestFileGC_Run(t *testing.T) {
+	f := newGCFixture(t)
+	owner, other := uuid.New(), uuid.New()
+	old := 48 * time.Hour
+
+	// Referenced as a schedule's markdown file, and from it by filename
+	markdown := f.upload(t, owner, "jeju.md", "# 제주\n\n![일출](sunrise.png)", old, true)
+	image := f.upload(t, owner, "sunrise.png", "png", old, true)
+	// Referenced by storage path from another user's schedule content
+	shared := f.upload(t, other, "map.png", "png", old, true)
+	// Same filename as a referenced image, but another user's upload
+	stranger := f.upload(t, other, "sunrise.png", "png", old, true)
+	// Unreferenced, but within the grace period
+	recent := f.upload(t, owner, "draft.md", "# draft", time.Hour, true)
+	// Unreferenced with an image variant
+	unused := f.upload(t, owner, "unused.png", "png", old, true)
+	variant := f.upload(t, owner, "unused_thumb.png", "thumb", old, false)
+	f.store.variants = append(f.store.variants, &models.ImageVariant{FileID: unused.ID, FilePath: variant.FilePath})
+	// Stored without a record, old and recent
+	stray := f.upload(t, owner, "stray.md", "stray", old, false)
+	inProgress := f.upload(t, owner, "new.md", "new", time.Minute, false)
+	// Recorded without a stored file
+	missing := models.NewFile(owner, "gone.md", "uploads/gone.md", 10, "")
+	missing.CreatedAt = f.now.Add(-old)
+	f.store.files = append(f.store.files, missing)
+
+	f.store.schedules = []*models.Schedule{
+		{ID: uuid.New(), UserID: owner, FileID: markdown.ID},
+		{ID: uuid.New(), UserID: uuid.New(), FileID: uuid.New(), Content: "![지도](/api/file/" + shared.FilePath + ")"},
+	}
+
+	report, err := f.gc.Run(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Run(dry run) error = %v", err)
+	}
+	if got := gcPaths(report.OrphanedObjects); got != stray.FilePath {
+		t.Errorf("orphaned objects = %s, want %s", got, stray.FilePath)
+	}
+	if got := gcPaths(report.MissingObjects); got != missing.FilePath {
+		t.Errorf("missing objects = %s, want %s", got, missing.FilePath)
+	}
+	if got, want := gcPaths(report.UnreferencedFiles), stranger.FilePath+","+unused.FilePath; got != want {
+		t.Errorf("unreferenced files = %s, want %s", got, want)
+	}
+	if !f.exists(stray.FilePath) || len(f.store.files) != 7 {
+		t.Fatal("a dry run should not remove anything")
+	}
+
+	report, err = f.gc.Run(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(report.Errors) > 0 {
+		t.Errorf("Run() errors = %v", report.Errors)
+	}
+	for _, path := range []string{stray.FilePath, stranger.FilePath, unused.FilePath, variant.FilePath} {
+		if f.exists(path) {
+			t.Errorf("%s should be removed", path)
+		}
+	}
+	for _, path := range []string{markdown.FilePath, image.FilePath, shared.FilePath, recent.FilePath, inProgress.FilePath} {
+		if !f.exists(path) {
+			t.Errorf("%s should be kept", path)
+		}
+	}
+	if len(f.store.files) != 4 || len(f.store.variants) != 0 {
+		t.Errorf("%d records and %d variants left, want 4 and 0", len(f.store.files), len(f.store.variants))
+	}
+
+	// Everything left is accounted for
+	report, _ = f.gc.Run(context.Background(), true)
+	if n := len(report.OrphanedObjects) + len(report.MissingObjects) + len(report.UnreferencedFiles); n != 0 {
+		t.Errorf("second run found %d items, want 0", n)
+	}
+}
+
+func TestFileGC_KeepsReferencedMissingFiles(t *testing.T) {
+	f := newGCFixture(t)
+	owner := uuid.New()
+	missing := models.NewFile(owner, "trip.md", "uploads/trip.md", 10, "")
+	missing.CreatedAt = f.now.Add(-48 * time.Hour)
+	f.store.files = []*models.File{missing}
+	f.store.schedules = []*models.Schedule{{ID: uuid.New(), UserID: owner, FileID: missing.ID}}
+
+	report, err := f.gc.Run(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(report.MissingObjects) != 1 || report.MissingObjects[0].Removed || len(f.store.files) != 1 {
+		t.Errorf("a schedule's missing file should be reported and kept, got %+v", report.MissingObjects)
+	}
+}
+
+func gcPaths(items []GCItem) string {
+	paths := make([]string, len(items))
+	for i, item := range items {
+		paths[i] = item.Path
+	}
+	return strings.Join(paths, ",")
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"tripflow/internal/models"
+	"tripflow/pkg/filestorage"
+
+	"github.com/google/uuid"
+)
+
+// Processing warning codes
+const (
+	WarningMissingImage = "missing-image"
+)
+
+// ProcessingWarning is a non-fatal problem found while processing markdown
+type ProcessingWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"` // 1-based, 0 when unknown
+	Ref     string `json:"ref,omitempty"`
+}
+
+// ImageFileLookup finds the file records of uploaded images
+type ImageFileLookup interface {
+	GetByPath(filePath string) (*models.File, error)
+	FindByFilename(userID uuid.UUID, filename string) (*models.File, error)
+	ListVariants(fileID uuid.UUID) ([]*models.ImageVariant, error)
+}
+
+// ResolvedImage is an uploaded image ready to be referenced from HTML
+type ResolvedImage struct {
+	File   *models.File
+	URL    string
+	Srcset string // Empty when the image has no responsive variants
+	Width  int
+	Height int
+}
+
+// ImageResolver resolves relative image references in markdown against
+// files uploaded to storage
+type ImageResolver struct {
+	files   ImageFileLookup
+	storage filestorage.FileStorageService
+
+	// signer signs the URLs of images in markdown that is not public;
+	// without one they are left unsigned
+	signer *FileURLSigner
+}
+
+// NewImageResolver creates a new ImageResolver
+func NewImageResolver(files ImageFileLookup, storage filestorage.FileStorageService) *ImageResolver {
+	return &ImageResolver{
+		files:   files,
+		storage: storage,
+	}
+}
+
+// SetURLSigner enables signed URLs for images resolved with signed set, so
+// browsers can load the images of private markdown without credentials
+func (r *ImageResolver) SetURLSigner(signer *FileURLSigner) {
+	r.signer = signer
+}
+
+// Resolve finds the uploaded file an image reference points to. A reference
+// is either the storage path returned by an upload ("uploads/<id>.png") or
+// the original filename of an image uploaded by ownerID, in which case any
+// directories in the reference are ignored ("images/jeju.png" matches an
+// upload named "jeju.png"). When ownerID is set, storage paths of other
+// users' uploads do not resolve.
+func (r *ImageResolver) Resolve(ref string, ownerID uuid.UUID) (*models.File, error) {
+	cleaned := cleanImageRef(ref)
+	if cleaned == "" {
+		return nil, fmt.Errorf("invalid image reference: %s", ref)
+	}
+
+	file, err := r.files.GetByPath(cleaned)
+	if err == nil && ownerID != uuid.Nil && file.UserID != ownerID {
+		err = fmt.Errorf("image belongs to another user: %s", ref)
+	}
+	if err != nil && ownerID != uuid.Nil {
+		file, err = r.files.FindByFilename(ownerID, path.Base(cleaned))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("image not found: %s", ref)
+	}
+
+	// The record can outlive the stored file
+	exists, err := r.storage.FileExists(file.FilePath)
+	if err != nil || !exists {
+		return nil, fmt.Errorf("image file missing from storage: %s", ref)
+	}
+
+	return file, nil
+}
+
+// ResolveImage is like Resolve but also builds the image's URL and a srcset
+// listing its responsive variants. With signed set and a signer configured
+// the URLs are signed, for images of markdown that is not public.
+func (r *ImageResolver) ResolveImage(ref string, ownerID uuid.UUID, signed bool) (*ResolvedImage, error) {
+	file, err := r.Resolve(ref, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	fileURL := FileURL
+	if signed && r.signer != nil {
+		fileURL = r.signer.SignEmbedded
+	}
+
+	resolved := &ResolvedImage{
+		File:   file,
+		URL:    fileURL(file.FilePath),
+		Width:  file.Width,
+		Height: file.Height,
+	}
+
+	// Thumbnails are for listings, not for content images
+	variants, err := r.files.ListVariants(file.ID)
+	if err == nil {
+		var candidates []string
+		for _, variant := range variants {
+			if variant.Label != models.VariantThumbnail {
+				candidates = append(candidates, fmt.Sprintf("%s %dw", fileURL(variant.FilePath), variant.Width))
+			}
+		}
+		if len(candidates) > 0 && file.Width > 0 {
+			candidates = append(candidates, fmt.Sprintf("%s %dw", resolved.URL, file.Width))
+			resolved.Srcset = strings.Join(candidates, ", ")
+		}
+	}
+
+	return resolved, nil
+}
+
+// FileURL returns the API URL that serves a stored file
+func FileURL(filePath string) string {
+	segments := strings.Split(strings.TrimPrefix(filePath, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/api/file/" + strings.Join(segments, "/")
+}
+
+// isInternalImageRef reports whether an image destination refers to an
+// uploaded file rather than an external URL, a site path or inline data
+func isInternalImageRef(destination string) bool {
+	destination = strings.TrimSpace(destination)
+	if destination == "" || strings.HasPrefix(destination, "/") || strings.HasPrefix(destination, "#") {
+		return false
+	}
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return false
+	}
+	return parsed.Scheme == "" && parsed.Host == ""
+}
+
+// cleanImageRef normalizes a relative image reference: it decodes percent
+// escapes, drops any query or fragment and removes "./" segments. Returns
+// "" when nothing that could name a file is left.
+func cleanImageRef(ref string) string {
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		ref = ref[:i]
+	}
+	if decoded, err := url.PathUnescape(ref); err == nil {
+		ref = decoded
+	}
+	ref = path.Clean(strings.ReplaceAll(ref, "\\", "/"))
+	if ref == "." || ref == ".." || ref == "/" || strings.HasSuffix(ref, "/..") {
+		return ""
+	}
+	return ref
+}
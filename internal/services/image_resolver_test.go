@@ -0,0 +1,195 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"tripflow/internal/models"
+	"tripflow/pkg/filestorage"
+
+	"github.com/google/uuid"
+)
+
+// memoryFiles is an in-memory ImageFileLookup and FileStorageService
+type memoryFiles struct {
+	records  []*models.File
+	stored   map[string]bool
+	variants map[uuid.UUID][]*models.ImageVariant
+	data     map[string][]byte
+}
+
+func (m *memoryFiles) add(owner uuid.UUID, filename, filePath string, stored bool) {
+	m.records = append(m.records, models.NewFile(owner, filename, filePath, 1, "image/png"))
+	if m.stored == nil {
+		m.stored = make(map[string]bool)
+	}
+	m.stored[filePath] = stored
+}
+
+func (m *memoryFiles) GetByPath(filePath string) (*models.File, error) {
+	for _, f := range m.records {
+		if f.FilePath == filePath {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("record not found")
+}
+
+func (m *memoryFiles) FindByFilename(userID uuid.UUID, filename string) (*models.File, error) {
+	for _, f := range m.records {
+		if f.UserID == userID && f.Filename == filename {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("record not found")
+}
+
+func (m *memoryFiles) ListVariants(fileID uuid.UUID) ([]*models.ImageVariant, error) {
+	return m.variants[fileID], nil
+}
+
+func (m *memoryFiles) UploadFile(io.Reader, string, string) (string, error) { return "", nil }
+func (m *memoryFiles) GetFile(path string) (io.Reader, error) {
+	return bytes.NewReader(m.data[path]), nil
+}
+func (m *memoryFiles) DeleteFile(string) error                           { return nil }
+func (m *memoryFiles) FileExists(path string) (bool, error)              { return m.stored[path], nil }
+func (m *memoryFiles) GetFileInfo(string) (*filestorage.FileInfo, error) { return nil, nil }
+
+func TestProcessMarkdown_Images(t *testing.T) {
+	owner, other := uuid.New(), uuid.New()
+	files := &memoryFiles{}
+	files.add(owner, "제주.png", "uploads/a1.png", true)
+	files.add(other, "secret.png", "uploads/b2.png", true)
+	files.add(owner, "gone.png", "uploads/c3.png", false)
+
+	service := NewMarkdownService(files)
+	service.SetImageResolver(NewImageResolver(files, files))
+
+	markdown := "# Trip\n\n" +
+		"![섬](images/제주.png \"title\")\n" +
+		"![by path](./uploads/a1.png)\n" +
+		"![other user](secret.png)\n" +
+		"![other path](uploads/b2.png)\n" +
+		"![deleted](gone.png)\n" +
+		"![ref][logo]\n" +
+		"![remote](https://example.com/x.png)\n\n" +
+		"[logo]: missing.png\n"
+
+	processed, err := service.ProcessMarkdownWithOptions(markdown, &ProcessOptions{ImageOwnerID: owner})
+	if err != nil {
+		t.Fatalf("ProcessMarkdownWithOptions() error = %v", err)
+	}
+
+	html := processed.HTMLContent
+	for _, want := range []string{
+		`<img src="/api/file/uploads/a1.png" alt="섬" title="title" loading="lazy">`,
+		`<img src="/api/file/uploads/a1.png" alt="by path" loading="lazy">`,
+		`<img src="https://example.com/x.png" alt="remote">`,
+		"other user", "other path", "deleted", "ref",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTMLContent = %s, should contain %s", html, want)
+		}
+	}
+	if strings.Contains(html, "b2.png") || strings.Contains(html, "secret.png") || strings.Contains(html, "missing.png") {
+		t.Errorf("HTMLContent = %s, unresolved images should be dropped", html)
+	}
+
+	var refs []string
+	for _, w := range processed.Warnings {
+		if w.Code != WarningMissingImage {
+			t.Errorf("warning code = %s", w.Code)
+		}
+		refs = append(refs, fmt.Sprintf("%s@%d", w.Ref, w.Line))
+	}
+	if got := strings.Join(refs, ","); got != "secret.png@5,uploads/b2.png@6,gone.png@7,missing.png@11" {
+		t.Errorf("Warnings = %s", got)
+	}
+}
+
+func TestFileURL(t *testing.T) {
+	if got := FileURL("uploads/제주 1.png"); got != "/api/file/uploads/%EC%A0%9C%EC%A3%BC%201.png" {
+		t.Errorf("FileURL() = %s", got)
+	}
+}
+
+func TestProcessMarkdown_ResponsiveImages(t *testing.T) {
+	owner := uuid.New()
+	files := &memoryFiles{}
+	files.add(owner, "beach.jpg", "uploads/a1.jpg", true)
+	file := files.records[0]
+	file.Width, file.Height = 1200, 800
+	files.variants = map[uuid.UUID][]*models.ImageVariant{
+		file.ID: {
+			{Label: models.VariantThumbnail, FilePath: "uploads/t.jpg", Width: 240, Height: 160},
+			{Label: "w480", FilePath: "uploads/s.jpg", Width: 480, Height: 320},
+			{Label: "w960", FilePath: "uploads/m.jpg", Width: 960, Height: 640},
+		},
+	}
+
+	service := NewMarkdownService(files)
+	service.SetImageResolver(NewImageResolver(files, files))
+
+	processed, err := service.ProcessMarkdownWithOptions("![beach](beach.jpg)", &ProcessOptions{ImageOwnerID: owner})
+	if err != nil {
+		t.Fatalf("ProcessMarkdownWithOptions() error = %v", err)
+	}
+
+	html := processed.HTMLContent
+	for _, want := range []string{
+		`src="/api/file/uploads/a1.jpg"`,
+		`srcset="/api/file/uploads/s.jpg 480w, /api/file/uploads/m.jpg 960w, /api/file/uploads/a1.jpg 1200w"`,
+		`sizes="(max-width: 960px) 100vw, 960px"`,
+		`width="1200"`, `height="800"`, `loading="lazy"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTMLContent = %s, should contain %s", html, want)
+		}
+	}
+	if strings.Contains(html, "uploads/t.jpg") {
+		t.Errorf("HTMLContent = %s, thumbnail should not be in srcset", html)
+	}
+}
+
+func TestProcessMarkdown_SignedImages(t *testing.T) {
+	owner := uuid.New()
+	files := &memoryFiles{}
+	files.add(owner, "beach.jpg", "uploads/a1.jpg", true)
+	file := files.records[0]
+	file.Width = 1200
+	files.variants = map[uuid.UUID][]*models.ImageVariant{
+		file.ID: {{Label: "w480", FilePath: "uploads/s.jpg", Width: 480, Height: 320}},
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	signer := newTestSigner(&now)
+	resolver := NewImageResolver(files, files)
+	resolver.SetURLSigner(signer)
+	service := NewMarkdownService(files)
+	service.SetImageResolver(resolver)
+	service.SetRenderCache(nil)
+
+	public, err := service.ProcessMarkdownWithOptions("![beach](beach.jpg)", &ProcessOptions{ImageOwnerID: owner})
+	if err != nil {
+		t.Fatalf("ProcessMarkdownWithOptions() error = %v", err)
+	}
+	if !strings.Contains(public.HTMLContent, `src="/api/file/uploads/a1.jpg"`) {
+		t.Errorf("HTMLContent = %s, public images should not be signed", public.HTMLContent)
+	}
+
+	private, err := service.ProcessMarkdownWithOptions("![beach](beach.jpg)", &ProcessOptions{ImageOwnerID: owner, SignImageURLs: true})
+	if err != nil {
+		t.Fatalf("ProcessMarkdownWithOptions() error = %v", err)
+	}
+	html := strings.ReplaceAll(private.HTMLContent, "&amp;", "&")
+	for _, filePath := range []string{"uploads/a1.jpg", "uploads/s.jpg"} {
+		if !strings.Contains(html, signer.SignEmbedded(filePath)) {
+			t.Errorf("HTMLContent = %s, should contain a signed URL for %s", html, filePath)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"tripflow/internal/models"
+	"tripflow/pkg/filestorage"
+	"tripflow/pkg/imageproc"
+)
+
+// ThumbnailWidth is the width of the thumbnail generated for every image
+const ThumbnailWidth = 240
+
+// VariantWidths are the responsive widths generated for uploaded images;
+// widths not smaller than the original are skipped
+var VariantWidths = []int{480, 960, 1600}
+
+// imageExtensions maps accepted image file extensions to their format
+var imageExtensions = map[string]string{
+	".jpg":  imageproc.FormatJPEG,
+	".jpeg": imageproc.FormatJPEG,
+	".png":  imageproc.FormatPNG,
+	".gif":  imageproc.FormatGIF,
+}
+
+// IsImageFilename reports whether filename has an accepted image extension
+func IsImageFilename(filename string) bool {
+	_, ok := imageExtensions[strings.ToLower(filepath.Ext(filename))]
+	return ok
+}
+
+// StoredImage is a sanitized image and its variants after upload. Variant
+// FileIDs are left for the caller to fill in once the file record exists.
+type StoredImage struct {
+	FilePath string
+	FileSize int64
+	MimeType string
+	Width    int
+	Height   int
+	Checksum string // Hex SHA-256 of the stored image
+	Variants []models.ImageVariant
+}
+
+// ImageService validates uploaded images and stores them with their variants
+type ImageService struct {
+	fileStorage filestorage.FileStorageService
+	limits      imageproc.Limits
+}
+
+// NewImageService creates a new ImageService
+func NewImageService(fileStorage filestorage.FileStorageService) *ImageService {
+	return &ImageService{
+		fileStorage: fileStorage,
+		limits:      imageproc.DefaultLimits,
+	}
+}
+
+// PreparedImage is a sanitized image and its encoded variants, ready to be
+// stored
+type PreparedImage struct {
+	filename string
+	image    *imageproc.Image
+	variants []preparedVariant
+}
+
+// preparedVariant is an encoded variant of a PreparedImage
+type preparedVariant struct {
+	label    string
+	data     []byte
+	mimeType string
+	width    int
+	height   int
+}
+
+// Size returns the bytes the image and its variants take up once stored
+func (p *PreparedImage) Size() int64 {
+	size := int64(len(p.image.Data))
+	for _, variant := range p.variants {
+		size += int64(len(variant.data))
+	}
+	return size
+}
+
+// PrepareImage checks that data really is an image of the type its filename
+// claims, strips its metadata and encodes a thumbnail and resized variants,
+// without storing anything
+func (s *ImageService) PrepareImage(data []byte, filename string) (*PreparedImage, error) {
+	claimed := imageExtensions[strings.ToLower(filepath.Ext(filename))]
+	format, _, err := imageproc.Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	if format != claimed {
+		return nil, fmt.Errorf("%w: %s content in a %s file", imageproc.ErrUnsupportedFormat, format, filepath.Ext(filename))
+	}
+
+	img, err := imageproc.Sanitize(data, s.limits)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := []variantTarget{{models.VariantThumbnail, ThumbnailWidth}}
+	for _, width := range VariantWidths {
+		if width < img.Width {
+			targets = append(targets, variantTarget{fmt.Sprintf("w%d", width), width})
+		}
+	}
+
+	prepared := &PreparedImage{filename: filename, image: img}
+	for _, target := range targets {
+		resized := imageproc.Resize(img.Image, target.width)
+		encoded, mimeType, err := imageproc.Encode(resized, img.Format)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s variant: %w", target.label, err)
+		}
+
+		bounds := resized.Bounds()
+		prepared.variants = append(prepared.variants, preparedVariant{
+			label:    target.label,
+			data:     encoded,
+			mimeType: mimeType,
+			width:    bounds.Dx(),
+			height:   bounds.Dy(),
+		})
+	}
+
+	return prepared, nil
+}
+
+// StoreImage stores a prepared image together with its variants. Nothing is
+// left in storage when an error is returned.
+func (s *ImageService) StoreImage(prepared *PreparedImage) (*StoredImage, error) {
+	img := prepared.image
+
+	var uploaded []string
+	cleanup := func() {
+		for _, path := range uploaded {
+			s.fileStorage.DeleteFile(path)
+		}
+	}
+
+	filePath, err := s.fileStorage.UploadFile(bytes.NewReader(img.Data), prepared.filename, img.MimeType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store image: %w", err)
+	}
+	uploaded = append(uploaded, filePath)
+
+	stored := &StoredImage{
+		FilePath: filePath,
+		FileSize: int64(len(img.Data)),
+		MimeType: img.MimeType,
+		Width:    img.Width,
+		Height:   img.Height,
+		Checksum: fmt.Sprintf("%x", sha256.Sum256(img.Data)),
+	}
+
+	for _, variant := range prepared.variants {
+		variantName := strings.TrimSuffix(prepared.filename, filepath.Ext(prepared.filename)) + "_" + variant.label + variantExtension(variant.mimeType)
+		variantPath, err := s.fileStorage.UploadFile(bytes.NewReader(variant.data), variantName, variant.mimeType)
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to store %s variant: %w", variant.label, err)
+		}
+		uploaded = append(uploaded, variantPath)
+
+		stored.Variants = append(stored.Variants, models.ImageVariant{
+			Label:    variant.label,
+			FilePath: variantPath,
+			FileSize: int64(len(variant.data)),
+			MimeType: variant.mimeType,
+			Width:    variant.width,
+			Height:   variant.height,
+		})
+	}
+
+	return stored, nil
+}
+
+// DeleteStoredImage removes an image and its variants from storage
+func (s *ImageService) DeleteStoredImage(stored *StoredImage) {
+	s.fileStorage.DeleteFile(stored.FilePath)
+	for _, variant := range stored.Variants {
+		s.fileStorage.DeleteFile(variant.FilePath)
+	}
+}
+
+// variantTarget is a variant to generate
+type variantTarget struct {
+	label string
+	width int
+}
+
+// variantExtension returns the file extension for a variant's MIME type
+func variantExtension(mimeType string) string {
+	if mimeType == "image/jpeg" {
+		return ".jpg"
+	}
+	return ".png"
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Severity is how serious a lint diagnostic is
+type Severity string
+
+// Lint severities; SeverityOff disables a rule
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+	SeverityOff     Severity = "off"
+)
+
+// Lint rule IDs
+const (
+	RuleMissingTitle   = "missing-title"
+	RuleDuplicateDay   = "duplicate-day"
+	RuleMissingDay     = "missing-day"
+	RuleDayOrder       = "day-order"
+	RuleEmptyDay       = "empty-day"
+	RuleEmptySlot      = "empty-slot"
+	RuleBudgetParse    = "budget-parse"
+	RuleBudgetMismatch = "budget-total-mismatch"
+)
+
+// defaultRuleSeverities lists every lint rule with its default severity
+var defaultRuleSeverities = map[string]Severity{
+	RuleMissingTitle:   SeverityWarning,
+	RuleDuplicateDay:   SeverityError,
+	RuleMissingDay:     SeverityWarning,
+	RuleDayOrder:       SeverityWarning,
+	RuleEmptyDay:       SeverityWarning,
+	RuleEmptySlot:      SeverityWarning,
+	RuleBudgetParse:    SeverityError,
+	RuleBudgetMismatch: SeverityWarning,
+}
+
+// Diagnostic is a single lint finding
+type Diagnostic struct {
+	Line     int      `json:"line"`   // 1-based
+	Column   int      `json:"column"` // 1-based, in characters
+	Severity Severity `json:"severity"`
+	RuleID   string   `json:"rule_id"`
+	Message  string   `json:"message"`
+}
+
+// LintReport is the result of linting a markdown itinerary
+type LintReport struct {
+	Diagnostics []Diagnostic `json:"diagnostics"`
+	Errors      int          `json:"errors"`
+	Warnings    int          `json:"warnings"`
+	Infos       int          `json:"infos"`
+}
+
+// LintConfig holds per-deployment lint rule settings
+type LintConfig struct {
+	// Severities overrides the default severity of rules by ID; set a rule
+	// to SeverityOff to disable it
+	Severities map[string]Severity
+}
+
+// DefaultLintConfig returns lint configuration from the environment.
+// LINT_RULES is a comma-separated list of rule=severity pairs, for example
+// "empty-slot=off,missing-day=error".
+func DefaultLintConfig() *LintConfig {
+	config := &LintConfig{Severities: make(map[string]Severity)}
+
+	for _, pair := range strings.Split(os.Getenv("LINT_RULES"), ",") {
+		rule, severity, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		rule = strings.TrimSpace(rule)
+		severity = strings.ToLower(strings.TrimSpace(severity))
+		if _, known := defaultRuleSeverities[rule]; !known {
+			continue
+		}
+		switch Severity(severity) {
+		case SeverityError, SeverityWarning, SeverityInfo, SeverityOff:
+			config.Severities[rule] = Severity(severity)
+		}
+	}
+
+	return config
+}
+
+// severity returns the configured severity of a rule
+func (c *LintConfig) severity(rule string) Severity {
+	if c != nil {
+		if severity, ok := c.Severities[rule]; ok {
+			return severity
+		}
+	}
+	return defaultRuleSeverities[rule]
+}
+
+// linter collects diagnostics while honouring the rule configuration
+type linter struct {
+	config *LintConfig
+	report *LintReport
+}
+
+// add records a diagnostic unless its rule is turned off
+func (l *linter) add(rule string, line, column int, format string, args ...interface{}) {
+	severity := l.config.severity(rule)
+	if severity == SeverityOff || severity == "" {
+		return
+	}
+	l.report.Diagnostics = append(l.report.Diagnostics, Diagnostic{
+		Line:     line,
+		Column:   column,
+		Severity: severity,
+		RuleID:   rule,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// dayHeading is a day section found while linting
+type dayHeading struct {
+	day     int
+	line    int
+	column  int
+	level   int
+	content bool // Whether anything but blank lines follows before the next section
+}
+
+// emptySlot is a "label:" list item waiting to see whether a nested list follows
+type emptySlot struct {
+	line   int
+	column int
+	indent int
+	label  string
+}
+
+// LintMarkdown checks a markdown itinerary for structural problems: missing
+// or duplicate day numbers, empty days and time slots, and budget lines
+// that do not parse or do not add up. A nil config uses the defaults.
+func LintMarkdown(markdown string, config *LintConfig) *LintReport {
+	l := &linter{config: config, report: &LintReport{Diagnostics: []Diagnostic{}}}
+
+	var days []*dayHeading
+	var current *dayHeading
+	var pendingSlot *emptySlot
+	hasTitle := false
+	inFence := false
+
+	flushSlot := func() {
+		if pendingSlot != nil {
+			l.add(RuleEmptySlot, pendingSlot.line, pendingSlot.column, "time slot %q has no activity", pendingSlot.label)
+			pendingSlot = nil
+		}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(markdown))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+
+		if fenceRegex.MatchString(line) {
+			flushSlot()
+			inFence = !inFence
+			if current != nil {
+				current.content = true
+			}
+			continue
+		}
+		if inFence {
+			continue
+		}
+
+		if match := headingRegex.FindStringSubmatch(line); match != nil {
+			flushSlot()
+			level := len(match[1])
+			text := match[2]
+			column := runeColumn(line, strings.Index(line, text))
+
+			if level == 1 {
+				hasTitle = true
+			}
+
+			// A sub-heading inside a day counts as content of that day
+			if current != nil && level > current.level {
+				current.content = true
+				continue
+			}
+			current = nil
+
+			if day := ParseDayNumber(text); day > 0 && !isBudgetHeading(text) {
+				current = &dayHeading{day: day, line: lineNo, column: column, level: level}
+				days = append(days, current)
+			}
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if current != nil {
+			current.content = true
+		}
+
+		// A label whose items follow as a nested list is not empty
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if pendingSlot != nil && listItemRegex.MatchString(line) && indent > pendingSlot.indent {
+			pendingSlot = nil
+		}
+		flushSlot()
+
+		// "- **오전**:" with nothing after the colon is an empty time slot
+		if match := listItemRegex.FindStringSubmatch(line); match != nil {
+			label, value, _, ok := splitLabelValue(match[1])
+			if ok && label != "" && strings.Trim(value, "*_ ") == "" {
+				pendingSlot = &emptySlot{
+					line:   lineNo,
+					column: runeColumn(line, strings.Index(line, match[1])),
+					indent: indent,
+					label:  cleanLabel(label),
+				}
+			}
+		}
+	}
+	flushSlot()
+
+	if !hasTitle {
+		l.add(RuleMissingTitle, 1, 1, "itinerary has no top-level '# title' heading")
+	}
+
+	l.checkDays(days)
+	l.checkBudget(ExtractBudget(markdown))
+
+	sort.SliceStable(l.report.Diagnostics, func(i, j int) bool {
+		a, b := l.report.Diagnostics[i], l.report.Diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	for _, d := range l.report.Diagnostics {
+		switch d.Severity {
+		case SeverityError:
+			l.report.Errors++
+		case SeverityWarning:
+			l.report.Warnings++
+		case SeverityInfo:
+			l.report.Infos++
+		}
+	}
+
+	return l.report
+}
+
+// checkDays reports duplicate, out-of-order, missing and empty days
+func (l *linter) checkDays(days []*dayHeading) {
+	firstSeen := make(map[int]*dayHeading)
+	highest := 0
+	for _, d := range days {
+		if first, ok := firstSeen[d.day]; ok {
+			l.add(RuleDuplicateDay, d.line, d.column, "day %d is already defined on line %d", d.day, first.line)
+			continue
+		}
+		firstSeen[d.day] = d
+
+		if d.day < highest {
+			l.add(RuleDayOrder, d.line, d.column, "day %d comes after day %d", d.day, highest)
+		}
+		if d.day > highest {
+			highest = d.day
+		}
+
+		if !d.content {
+			l.add(RuleEmptyDay, d.line, d.column, "day %d has no plans", d.day)
+		}
+	}
+
+	// Report each gap once, at the first heading after it
+	for day := 1; day < highest; day++ {
+		if _, ok := firstSeen[day]; ok {
+			continue
+		}
+		next := day + 1
+		for ; next <= highest; next++ {
+			if _, ok := firstSeen[next]; ok {
+				break
+			}
+		}
+		anchor := firstSeen[next]
+		if next-day == 1 {
+			l.add(RuleMissingDay, anchor.line, anchor.column, "day %d is missing", day)
+		} else {
+			l.add(RuleMissingDay, anchor.line, anchor.column, "days %d-%d are missing", day, next-1)
+		}
+		day = next
+	}
+}
+
+// checkBudget reports unparsable budget lines and a stated total that does
+// not match the computed sum
+func (l *linter) checkBudget(budget *BudgetSummary) {
+	if budget == nil {
+		return
+	}
+
+	for _, issue := range budget.Issues {
+		l.add(RuleBudgetParse, issue.Line, issue.Column, "budget line could not be parsed: %s", issue.Message)
+	}
+
+	if stated := budget.StatedTotal; stated != nil && stated.Mismatch {
+		l.add(RuleBudgetMismatch, stated.Line, 1, "stated total %s does not match the computed sum %s",
+			stated.Amount, stated.Computed)
+	}
+}
+
+// runeColumn converts a byte offset in line to a 1-based character column
+func runeColumn(line string, offset int) int {
+	if offset < 0 {
+		return 1
+	}
+	return utf8.RuneCountInString(line[:offset]) + 1
+}
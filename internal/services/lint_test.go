@@ -0,0 +1,135 @@
+package services
+
+import (
+	"testing"
+)
+
+// findDiagnostic returns the first diagnostic for rule, or nil
+func findDiagnostic(report *LintReport, rule string) *Diagnostic {
+	for i := range report.Diagnostics {
+		if report.Diagnostics[i].RuleID == rule {
+			return &report.Diagnostics[i]
+		}
+	}
+	return nil
+}
+
+func TestLintMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		rule     string
+		wantLine int
+		wantCol  int
+		wantNone bool
+	}{
+		{
+			name:     "Duplicate day",
+			markdown: "# 여행\n## 1일차\n- 공항\n## 1일차\n- 호텔",
+			rule:     RuleDuplicateDay,
+			wantLine: 4,
+			wantCol:  4,
+		},
+		{
+			name:     "Missing day",
+			markdown: "# 여행\n## Day 1\n- Airport\n## Day 3\n- Hotel",
+			rule:     RuleMissingDay,
+			wantLine: 4,
+			wantCol:  4,
+		},
+		{
+			name:     "Empty day",
+			markdown: "# 여행\n## 1일차\n\n## 2일차\n- 호텔",
+			rule:     RuleEmptyDay,
+			wantLine: 2,
+			wantCol:  4,
+		},
+		{
+			name:     "Empty slot",
+			markdown: "# 여행\n## 1일차\n- **오전**:\n- **오후**: 박물관",
+			rule:     RuleEmptySlot,
+			wantLine: 3,
+			wantCol:  3,
+		},
+		{
+			name:     "Slot with nested list",
+			markdown: "# 여행\n## 1일차\n- **오전**:\n  - 박물관",
+			rule:     RuleEmptySlot,
+			wantNone: true,
+		},
+		{
+			name:     "Missing title",
+			markdown: "## 1일차\n- 공항",
+			rule:     RuleMissingTitle,
+			wantLine: 1,
+			wantCol:  1,
+		},
+		{
+			name:     "Unparsable budget line",
+			markdown: "# 여행\n## 예산\n- 항공료: 많이",
+			rule:     RuleBudgetParse,
+			wantLine: 3,
+		},
+		{
+			name:     "Stated total mismatch",
+			markdown: "# 여행\n## 예산\n- 항공료: 300,000원\n- 호텔: 200,000원\n\n총 예산: 600,000원",
+			rule:     RuleBudgetMismatch,
+			wantLine: 6,
+			wantCol:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := LintMarkdown(tt.markdown, nil)
+			d := findDiagnostic(report, tt.rule)
+			if tt.wantNone {
+				if d != nil {
+					t.Errorf("LintMarkdown() unexpected %s: %+v", tt.rule, d)
+				}
+				return
+			}
+			if d == nil {
+				t.Fatalf("LintMarkdown() missing %s in %+v", tt.rule, report.Diagnostics)
+			}
+			if d.Line != tt.wantLine {
+				t.Errorf("%s line = %d, want %d", tt.rule, d.Line, tt.wantLine)
+			}
+			if tt.wantCol != 0 && d.Column != tt.wantCol {
+				t.Errorf("%s column = %d, want %d", tt.rule, d.Column, tt.wantCol)
+			}
+		})
+	}
+}
+
+func TestLintMarkdown_Clean(t *testing.T) {
+	markdown := "# 여행\n## 1일차\n- **오전**: 공항\n## 2일차\n- 호텔\n\n## 예산\n- 항공료: 300,000원"
+
+	report := LintMarkdown(markdown, nil)
+	if len(report.Diagnostics) != 0 {
+		t.Errorf("LintMarkdown() = %+v, want no diagnostics", report.Diagnostics)
+	}
+}
+
+func TestLintMarkdown_Config(t *testing.T) {
+	t.Setenv("LINT_RULES", "empty-slot=off, missing-day=error,unknown=error,day-order=loud")
+	config := DefaultLintConfig()
+
+	if len(config.Severities) != 2 {
+		t.Errorf("DefaultLintConfig() = %v, want 2 overrides", config.Severities)
+	}
+
+	markdown := "# 여행\n## 1일차\n- **오전**:\n## 3일차\n- 호텔"
+	report := LintMarkdown(markdown, config)
+
+	if d := findDiagnostic(report, RuleEmptySlot); d != nil {
+		t.Errorf("empty-slot should be off, got %+v", d)
+	}
+	d := findDiagnostic(report, RuleMissingDay)
+	if d == nil || d.Severity != SeverityError {
+		t.Errorf("missing-day = %+v, want error severity", d)
+	}
+	if report.Errors != 1 || report.Warnings != 0 {
+		t.Errorf("counts = %d errors, %d warnings; want 1, 0", report.Errors, report.Warnings)
+	}
+}
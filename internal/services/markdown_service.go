@@ -2,14 +2,15 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"regexp"
+	"strconv"
 	"strings"
 
 	"tripflow/pkg/filestorage"
 
-	"github.com/microcosm-cc/bluemonday"
+	"github.com/google/uuid"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/text"
@@ -18,64 +19,172 @@ import (
 // MarkdownService handles markdown processing
 type MarkdownService struct {
 	fileStorage filestorage.FileStorageService
+	lintConfig  *LintConfig
+	renderer    *Renderer
+	cache       *RenderCache // nil disables caching
+
+	// imageResolver resolves relative image references; without one they
+	// are left as written
+	imageResolver *ImageResolver
 }
 
 // NewMarkdownService creates a new MarkdownService
 func NewMarkdownService(fileStorage filestorage.FileStorageService) *MarkdownService {
 	return &MarkdownService{
 		fileStorage: fileStorage,
+		lintConfig:  DefaultLintConfig(),
+		renderer:    sharedDefaultRenderer(),
+		cache:       sharedRenderCache(),
 	}
 }
 
+// NewMarkdownServiceWithRenderer creates a MarkdownService that renders with
+// the given extension configuration instead of MARKDOWN_EXTENSIONS
+func NewMarkdownServiceWithRenderer(fileStorage filestorage.FileStorageService, config *RendererConfig) *MarkdownService {
+	service := NewMarkdownService(fileStorage)
+	service.renderer = NewRenderer(config)
+	return service
+}
+
+// SetImageResolver enables resolving relative image references against
+// uploaded files
+func (s *MarkdownService) SetImageResolver(resolver *ImageResolver) {
+	s.imageResolver = resolver
+}
+
+// SetRenderCache replaces the cache used for rendered markdown; nil
+// disables caching
+func (s *MarkdownService) SetRenderCache(cache *RenderCache) {
+	s.cache = cache
+}
+
+// InvalidateFile drops cached data for a stored markdown file that was
+// deleted or replaced
+func (s *MarkdownService) InvalidateFile(filePath string) {
+	s.cache.InvalidateFile(filePath)
+}
+
+// InvalidateContent drops cached renderings of markdown that was replaced,
+// such as a schedule's previous content
+func (s *MarkdownService) InvalidateContent(markdown string) {
+	s.cache.InvalidateContent(markdown)
+}
+
 // ProcessedContent represents the result of markdown processing
 type ProcessedContent struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	HTMLContent string `json:"html_content"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	HTMLContent string         `json:"html_content"`
+	Budget      *BudgetSummary `json:"budget,omitempty"`
+	Lint        *LintReport    `json:"lint,omitempty"`
+	TOC         []*TOCEntry    `json:"toc,omitempty"`
+
+	// Directives are the bookings and places written as :::flight,
+	// :::hotel and :::place blocks
+	Directives []*TripDirective `json:"directives,omitempty"`
+
+	Warnings []ProcessingWarning `json:"warnings,omitempty"`
+}
+
+// ProcessOptions selects optional processing steps
+type ProcessOptions struct {
+	Lint bool // Include a lint report in the result
+	TOC  bool // Insert a rendered table of contents into the HTML
+
+	// ImageOwnerID is the user whose uploads image filenames are looked up
+	// in; uuid.Nil only resolves references to storage paths
+	ImageOwnerID uuid.UUID
+
+	// AuthorRole is the role of whoever wrote the markdown and selects the
+	// sanitization policy; empty gets the deployment default
+	AuthorRole string
+
+	// SignImageURLs points images at signed URLs, for markdown that is not
+	// public: browsers send no credentials when they load images
+	SignImageURLs bool
 }
 
 // ProcessMarkdown processes markdown content and returns processed content
 func (s *MarkdownService) ProcessMarkdown(markdownContent string) (*ProcessedContent, error) {
-	// Convert markdown to HTML
-	htmlContent, err := s.markdownToHTML(markdownContent)
+	return s.ProcessMarkdownWithOptions(markdownContent, nil)
+}
+
+// ProcessMarkdownWithOptions processes markdown content with optional steps
+func (s *MarkdownService) ProcessMarkdownWithOptions(markdownContent string, opts *ProcessOptions) (*ProcessedContent, error) {
+	if opts == nil {
+		opts = &ProcessOptions{}
+	}
+
+	renderer := s.getRenderer()
+	policy := renderer.PolicyFor(opts.AuthorRole)
+
+	// A cached rendering is only valid while its images resolve the same way
+	cacheKey := renderCacheKey(markdownContent, renderer.Version(), policy, s.imageResolver != nil, opts, s.lintConfig)
+	if entry, ok := s.cache.getEntry(cacheKey); ok {
+		images, warnings := s.resolveImageRefs(markdownContent, entry.ImageRefs, opts)
+		if imageFingerprint(images, warnings) == entry.Images {
+			cached := *entry.Content
+			return &cached, nil
+		}
+	}
+
+	// Resolve internal images up front so each reference is looked up once
+	refs := s.internalImageRefs(markdownContent)
+	images, warnings := s.resolveImageRefs(markdownContent, refs, opts)
+
+	// Convert markdown to HTML, pointing images at their stored files
+	var toc []*TOCEntry
+	var directives []*TripDirective
+	processedHTML, err := renderer.RenderWithPolicy(markdownContent, policy, func(doc ast.Node, source []byte) {
+		s.processImages(doc, source, images)
+		toc = extractTOC(doc, source)
+		directives = extractDirectives(doc, source)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert markdown to HTML: %w", err)
 	}
+	if opts.TOC {
+		processedHTML = injectTOC(processedHTML, renderTOC(toc))
+	}
 
 	// Extract title and description
 	title, description := s.extractTitleAndDescription(markdownContent)
 
-	// Process images in HTML
-	processedHTML, err := s.processImages(htmlContent)
-	if err != nil {
-		return nil, fmt.Errorf("failed to process images: %w", err)
-	}
-
-	return &ProcessedContent{
+	processed := &ProcessedContent{
 		Title:       title,
 		Description: description,
 		HTMLContent: processedHTML,
-	}, nil
+		Budget:      ExtractBudget(markdownContent),
+		TOC:         toc,
+		Directives:  directives,
+		Warnings:    warnings,
+	}
+	if opts.Lint {
+		processed.Lint = LintMarkdown(markdownContent, s.lintConfig)
+	}
+
+	cached := *processed
+	s.cache.setEntry(cacheKey, &renderCacheEntry{
+		Content:   &cached,
+		ImageRefs: refs,
+		Images:    imageFingerprint(images, warnings),
+	})
+
+	return processed, nil
 }
 
 // markdownToHTML converts markdown to HTML with XSS protection
 func (s *MarkdownService) markdownToHTML(markdown string) (string, error) {
-	// Create goldmark instance
-	md := goldmark.New(
-		goldmark.WithExtensions(),
-	)
+	return s.getRenderer().Render(markdown)
+}
 
-	// Convert markdown to HTML
-	var buf bytes.Buffer
-	if err := md.Convert([]byte(markdown), &buf); err != nil {
-		return "", err
+// getRenderer returns the configured renderer, or the shared default for
+// services not built with NewMarkdownService
+func (s *MarkdownService) getRenderer() *Renderer {
+	if s.renderer == nil {
+		return sharedDefaultRenderer()
 	}
-
-	// Sanitize HTML to prevent XSS
-	p := bluemonday.UGCPolicy()
-	sanitizedHTML := p.Sanitize(buf.String())
-
-	return sanitizedHTML, nil
+	return s.renderer
 }
 
 // extractTitleAndDescription extracts title and description from markdown
@@ -123,52 +232,169 @@ func (s *MarkdownService) extractTitleAndDescription(markdown string) (string, s
 	return title, description
 }
 
-// processImages processes images in HTML content
-func (s *MarkdownService) processImages(htmlContent string) (string, error) {
-	// For now, return the HTML content as-is
-	// TODO: Implement image processing in future subtasks
-	return htmlContent, nil
+// imageSizes tells browsers how wide content images are displayed, so they
+// can pick a variant from the srcset
+const imageSizes = "(max-width: 960px) 100vw, 960px"
+
+// internalImageRefs returns the internal image references in markdown when
+// they are resolved at all
+func (s *MarkdownService) internalImageRefs(markdown string) []string {
+	if s.imageResolver == nil {
+		return nil
+	}
+	refs, err := s.findInternalImages(markdown)
+	if err != nil {
+		return nil
+	}
+	return refs
+}
+
+// resolveImageRefs looks up the internal image references found in markdown
+// and returns the URL for each one found, plus a warning for each one missing
+func (s *MarkdownService) resolveImageRefs(markdown string, refs []string, opts *ProcessOptions) (map[string]*ResolvedImage, []ProcessingWarning) {
+	if s.imageResolver == nil || len(refs) == 0 {
+		return nil, nil
+	}
+
+	images := make(map[string]*ResolvedImage, len(refs))
+	var warnings []ProcessingWarning
+	missing := make(map[string]bool)
+	for _, ref := range refs {
+		if _, done := images[ref]; done || missing[ref] {
+			continue
+		}
+		image, err := s.imageResolver.ResolveImage(ref, opts.ImageOwnerID, opts.SignImageURLs)
+		if err != nil {
+			missing[ref] = true
+			warnings = append(warnings, ProcessingWarning{
+				Code:    WarningMissingImage,
+				Message: err.Error(),
+				Line:    findLine(markdown, ref),
+				Ref:     ref,
+			})
+			continue
+		}
+		images[ref] = image
+	}
+
+	return images, warnings
+}
+
+// processImages points internal images at the URLs of their uploaded files
+// and adds a srcset of their resized variants. Images that could not be
+// resolved are replaced by their alt text rather than left as broken links.
+func (s *MarkdownService) processImages(doc ast.Node, source []byte, images map[string]*ResolvedImage) {
+	if s.imageResolver == nil {
+		return
+	}
+
+	var unresolved []*ast.Image
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		image, ok := node.(*ast.Image)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		destination := string(image.Destination)
+		if !isInternalImageRef(destination) {
+			return ast.WalkContinue, nil
+		}
+		if resolved, ok := images[destination]; ok {
+			image.Destination = []byte(resolved.URL)
+			if resolved.Srcset != "" {
+				image.SetAttributeString("srcset", []byte(resolved.Srcset))
+				image.SetAttributeString("sizes", []byte(imageSizes))
+			}
+			if resolved.Width > 0 && resolved.Height > 0 {
+				image.SetAttributeString("width", []byte(strconv.Itoa(resolved.Width)))
+				image.SetAttributeString("height", []byte(strconv.Itoa(resolved.Height)))
+			}
+			image.SetAttributeString("loading", []byte("lazy"))
+		} else {
+			unresolved = append(unresolved, image)
+		}
+		return ast.WalkSkipChildren, nil
+	})
+
+	for _, image := range unresolved {
+		parent := image.Parent()
+		for child := image.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			parent.InsertBefore(parent, image, child)
+			child = next
+		}
+		parent.RemoveChild(parent, image)
+	}
+}
+
+// findLine returns the 1-based line of the first occurrence of s in text, or 0
+func findLine(text, s string) int {
+	idx := strings.Index(text, s)
+	if idx < 0 {
+		return 0
+	}
+	return strings.Count(text[:idx], "\n") + 1
 }
 
 // ProcessMarkdownFromFile processes markdown from a file path
 func (s *MarkdownService) ProcessMarkdownFromFile(filePath string) (*ProcessedContent, error) {
-	// Read file from storage
-	fileReader, err := s.fileStorage.GetFile(filePath)
+	return s.ProcessMarkdownFromFileWithOptions(filePath, nil)
+}
+
+// ProcessMarkdownFromFileWithOptions processes markdown from a file path with optional steps
+func (s *MarkdownService) ProcessMarkdownFromFileWithOptions(filePath string, opts *ProcessOptions) (*ProcessedContent, error) {
+	content, err := s.ReadMarkdownFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+		return nil, err
 	}
-	
-	// Check if fileReader implements io.Closer
-	if closer, ok := fileReader.(io.Closer); ok {
-		defer closer.Close()
+
+	// Process markdown
+	return s.ProcessMarkdownWithOptions(content, opts)
+}
+
+// ReadMarkdownFile reads the raw markdown source stored at filePath
+func (s *MarkdownService) ReadMarkdownFile(filePath string) (string, error) {
+	// Uploaded files are never modified in place, so their source can be
+	// kept until the file is deleted
+	if source, ok := s.cache.getSource(filePath); ok {
+		return source, nil
+	}
+
+	// Read file from storage
+	fileReader, err := filestorage.AdaptV1(s.fileStorage).Open(context.Background(), filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
 	}
+	defer fileReader.Close()
 
 	// Read file content
 	content, err := io.ReadAll(fileReader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file content: %w", err)
+		return "", fmt.Errorf("failed to read file content: %w", err)
 	}
 
-	// Process markdown
-	return s.ProcessMarkdown(string(content))
+	s.cache.setSource(filePath, string(content))
+	return string(content), nil
 }
 
 // findInternalImages finds internal image paths in markdown content
 func (s *MarkdownService) findInternalImages(markdownContent string) ([]string, error) {
-	var internalImages []string
+	internalImages := []string{}
 
-	// Regex to find image links: ![alt](path)
-	imageRegex := regexp.MustCompile(`!\[.*?\]\(([^)]+)\)`)
-	matches := imageRegex.FindAllStringSubmatch(markdownContent, -1)
+	// Parse so that reference-style images and titles are handled
+	source := []byte(markdownContent)
+	doc := goldmark.New().Parser().Parse(text.NewReader(source))
 
-	for _, match := range matches {
-		if len(match) > 1 {
-			imagePath := match[1]
-			// Check if it's an internal path (not starting with http:// or https://)
-			if !strings.HasPrefix(imagePath, "http://") && !strings.HasPrefix(imagePath, "https://") {
+	err := ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if image, ok := node.(*ast.Image); ok && entering {
+			// Internal paths are relative ones, not URLs or site paths
+			if imagePath := string(image.Destination); isInternalImageRef(imagePath) {
 				internalImages = append(internalImages, imagePath)
 			}
 		}
+		return ast.WalkContinue, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return internalImages, nil
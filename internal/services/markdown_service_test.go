@@ -16,7 +16,7 @@ func TestMarkdownToHTML(t *testing.T) {
 		{
 			name:     "Simple heading",
 			markdown: "# Hello World",
-			contains: []string{"<h1>Hello World</h1>"},
+			contains: []string{`<h1 id="hello-world">Hello World</h1>`},
 		},
 		{
 			name:     "Paragraph",
@@ -33,6 +33,11 @@ func TestMarkdownToHTML(t *testing.T) {
 			markdown: "- Item 1\n- Item 2",
 			contains: []string{"<ul>", "<li>Item 1</li>", "<li>Item 2</li>", "</ul>"},
 		},
+		{
+			name:     "Task list",
+			markdown: "- [ ] passport\n- [x] visa",
+			contains: []string{`<input disabled="" type="checkbox"> passport`, `<input checked="" disabled="" type="checkbox"> visa`},
+		},
 		{
 			name:     "XSS protection",
 			markdown: "<script>alert('xss')</script>",
@@ -0,0 +1,823 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Registered for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"tripflow/pkg/filestorage"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/google/uuid"
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+)
+
+// ErrPDFFontUnavailable is returned when no TrueType font could be found for
+// PDF export
+var ErrPDFFontUnavailable = errors.New("no font available for PDF export; set PDF_FONT_PATH to a TrueType font with Hangul glyphs")
+
+// PDF page layout, in millimetres and points
+const (
+	pdfFontFamily   = "body"
+	pdfMargin       = 18.0
+	pdfBodySize     = 10.5
+	pdfLineHeight   = 5.5
+	pdfListIndent   = 6.0
+	pdfMaxImageSize = 120.0 // Tallest an image may be drawn
+	pdfTablePadding = 1.5
+)
+
+// pdfHeadingSizes are the font sizes of heading levels 1-6
+var pdfHeadingSizes = [...]float64{20, 16, 13.5, 12, 11, 10.5}
+
+// pdfFontCandidates are regular and bold TrueType fonts looked for when
+// PDF_FONT_PATH is unset. All of them have Hangul glyphs; Latin-only fonts
+// are not used, since schedules would export with blank Korean text. fpdf
+// embeds TrueType outlines only, so OpenType/CFF and .ttc collections
+// cannot be used.
+var pdfFontCandidates = [][2]string{
+	{"fonts/NanumGothic.ttf", "fonts/NanumGothicBold.ttf"},
+	{"/usr/share/fonts/truetype/nanum/NanumGothic.ttf", "/usr/share/fonts/truetype/nanum/NanumGothicBold.ttf"},
+	{"/usr/share/fonts/nanum/NanumGothic.ttf", "/usr/share/fonts/nanum/NanumGothicBold.ttf"},
+	{"/usr/share/fonts/truetype/unfonts-core/UnDotum.ttf", "/usr/share/fonts/truetype/unfonts-core/UnDotumBold.ttf"},
+	{"/Library/Fonts/NanumGothic.ttf", "/Library/Fonts/NanumGothicBold.ttf"},
+	{"/System/Library/Fonts/Supplemental/AppleGothic.ttf", ""},
+	{`C:\Windows\Fonts\malgun.ttf`, `C:\Windows\Fonts\malgunbd.ttf`},
+}
+
+// PDFFonts holds the TrueType fonts embedded in exported PDFs
+type PDFFonts struct {
+	Regular []byte
+	Bold    []byte // Optional; the regular font is used for bold text without it
+}
+
+// LoadPDFFonts loads the fonts named by PDF_FONT_PATH and PDF_BOLD_FONT_PATH,
+// or the first installed font from a list of common Korean fonts
+func LoadPDFFonts() (*PDFFonts, error) {
+	if path := os.Getenv("PDF_FONT_PATH"); path != "" {
+		regular, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PDF_FONT_PATH: %w", err)
+		}
+		fonts := &PDFFonts{Regular: regular}
+		if boldPath := os.Getenv("PDF_BOLD_FONT_PATH"); boldPath != "" {
+			if fonts.Bold, err = os.ReadFile(boldPath); err != nil {
+				return nil, fmt.Errorf("failed to read PDF_BOLD_FONT_PATH: %w", err)
+			}
+		}
+		return fonts, nil
+	}
+
+	for _, candidate := range pdfFontCandidates {
+		regular, err := os.ReadFile(candidate[0])
+		if err != nil {
+			continue
+		}
+		fonts := &PDFFonts{Regular: regular}
+		if candidate[1] != "" {
+			fonts.Bold, _ = os.ReadFile(candidate[1])
+		}
+		return fonts, nil
+	}
+	return nil, ErrPDFFontUnavailable
+}
+
+// ScheduleExport is a schedule's content prepared for export
+type ScheduleExport struct {
+	ID           uuid.UUID
+	Title        string
+	Description  string
+	Markdown     string
+	StartDate    *time.Time
+	EndDate      *time.Time
+	HomeCurrency string
+	UpdatedAt    time.Time
+	Budget       *BudgetSummary // Optional
+
+	// ImageOwnerID is the user whose uploads images are looked up in
+	ImageOwnerID uuid.UUID
+
+	// AuthorRole selects the sanitization policy of rendered HTML, as in
+	// ProcessOptions
+	AuthorRole string
+}
+
+// PDFExporter lays schedules out as printable PDF documents
+type PDFExporter struct {
+	renderer *Renderer
+	images   *ImageResolver // Optional; without it images are left out
+	storage  filestorage.FileStorageService
+
+	fonts     *PDFFonts
+	fontsErr  error
+	fontsOnce sync.Once
+}
+
+// NewPDFExporter creates a PDFExporter. Fonts are loaded with LoadPDFFonts
+// on first use unless set with SetFonts.
+func NewPDFExporter(storage filestorage.FileStorageService, images *ImageResolver) *PDFExporter {
+	return &PDFExporter{
+		renderer: sharedDefaultRenderer(),
+		images:   images,
+		storage:  storage,
+	}
+}
+
+// SetFonts sets the fonts embedded in exported documents
+func (e *PDFExporter) SetFonts(fonts *PDFFonts) {
+	e.fontsOnce.Do(func() {})
+	e.fonts, e.fontsErr = fonts, nil
+}
+
+// getFonts returns the configured fonts, loading them once
+func (e *PDFExporter) getFonts() (*PDFFonts, error) {
+	e.fontsOnce.Do(func() {
+		e.fonts, e.fontsErr = LoadPDFFonts()
+	})
+	return e.fonts, e.fontsErr
+}
+
+// Export writes doc as a PDF: a cover page, any introduction, one section
+// per day starting on its own page and a budget summary
+func (e *PDFExporter) Export(w io.Writer, doc *ScheduleExport) error {
+	fonts, err := e.getFonts()
+	if err != nil {
+		return err
+	}
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.SetTitle(doc.Title, true)
+	pdf.SetCreator("TripFlow", true)
+	pdf.SetLang("ko")
+	pdf.AddUTF8FontFromBytes(pdfFontFamily, "", fonts.Regular)
+	bold := fonts.Bold
+	if bold == nil {
+		bold = fonts.Regular
+	}
+	pdf.AddUTF8FontFromBytes(pdfFontFamily, "B", bold)
+	if pdf.Err() {
+		return fmt.Errorf("failed to load PDF font: %w", pdf.Error())
+	}
+
+	pageWidth, pageHeight := pdf.GetPageSize()
+	writer := &pdfWriter{
+		pdf:          pdf,
+		exporter:     e,
+		doc:          doc,
+		contentWidth: pageWidth - 2*pdfMargin,
+		pageBottom:   pageHeight - pdfMargin,
+	}
+	writer.setupPage()
+	writer.writeCover()
+	writer.writeBody()
+	writer.writeBudget()
+
+	if pdf.Err() {
+		return fmt.Errorf("failed to lay out PDF: %w", pdf.Error())
+	}
+	return pdf.Output(w)
+}
+
+// pdfWriter holds the layout state of one exported document
+type pdfWriter struct {
+	pdf          *fpdf.Fpdf
+	exporter     *PDFExporter
+	doc          *ScheduleExport
+	source       []byte
+	contentWidth float64
+	pageBottom   float64
+
+	bold         bool
+	pageIsEmpty  bool // Nothing written since the last page break
+	hasBookmarks bool // A top-level bookmark exists, so nested ones may follow
+}
+
+// setupPage adds the running header and page numbers to every page but
+// the cover
+func (w *pdfWriter) setupPage() {
+	pdf := w.pdf
+	pdf.AliasNbPages("")
+	pdf.SetHeaderFunc(func() {
+		if pdf.PageNo() == 1 {
+			return
+		}
+		pdf.SetFont(pdfFontFamily, "", 8)
+		pdf.SetTextColor(130, 130, 130)
+		pdf.CellFormat(0, 5, w.doc.Title, "", 1, "R", false, 0, "")
+		pdf.Ln(3)
+	})
+	pdf.SetFooterFunc(func() {
+		if pdf.PageNo() == 1 {
+			return
+		}
+		pdf.SetY(-12)
+		pdf.SetFont(pdfFontFamily, "", 8)
+		pdf.SetTextColor(130, 130, 130)
+		pdf.CellFormat(0, 5, fmt.Sprintf("%d / {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+}
+
+// addPage starts a new page for body text
+func (w *pdfWriter) addPage() {
+	w.pdf.AddPage()
+	w.setFont(pdfBodySize, false)
+	w.pdf.SetTextColor(0, 0, 0)
+	w.pageIsEmpty = true
+}
+
+// setFont switches between the regular and bold body font
+func (w *pdfWriter) setFont(size float64, bold bool) {
+	style := ""
+	if bold {
+		style = "B"
+	}
+	w.bold = bold
+	w.pdf.SetFont(pdfFontFamily, style, size)
+}
+
+// writeCover writes the title page
+func (w *pdfWriter) writeCover() {
+	pdf := w.pdf
+	w.addPage()
+	pdf.SetY(85)
+
+	w.setFont(26, true)
+	pdf.MultiCell(0, 12, w.doc.Title, "", "C", false)
+
+	if dates := formatTripDates(w.doc.StartDate, w.doc.EndDate); dates != "" {
+		pdf.Ln(4)
+		w.setFont(12, false)
+		pdf.SetTextColor(90, 90, 90)
+		pdf.MultiCell(0, 7, dates, "", "C", false)
+	}
+
+	if w.doc.Description != "" {
+		pdf.Ln(10)
+		w.setFont(12, false)
+		pdf.SetTextColor(40, 40, 40)
+		pdf.MultiCell(0, 7, w.doc.Description, "", "C", false)
+	}
+	pdf.SetTextColor(0, 0, 0)
+}
+
+// formatTripDates formats a trip's date range for the cover page
+func formatTripDates(start, end *time.Time) string {
+	switch {
+	case start != nil && end != nil:
+		days := int(end.Sub(*start).Hours()/24) + 1
+		return fmt.Sprintf("%s – %s (%d days)", start.Format("2006-01-02"), end.Format("2006-01-02"), days)
+	case start != nil:
+		return start.Format("2006-01-02")
+	case end != nil:
+		return end.Format("2006-01-02")
+	}
+	return ""
+}
+
+// writeBody lays out the markdown. The title heading is already on the
+// cover; each day heading starts a new page.
+func (w *pdfWriter) writeBody() {
+	w.source = []byte(w.doc.Markdown)
+	root := w.exporter.renderer.Parse(w.source)
+
+	w.addPage()
+	skippedTitle := false
+	for node := root.FirstChild(); node != nil; node = node.NextSibling() {
+		if heading, ok := node.(*ast.Heading); ok {
+			if heading.Level == 1 && !skippedTitle {
+				skippedTitle = true
+				continue
+			}
+			text := strings.TrimSpace(string(heading.Text(w.source)))
+			if ParseDayNumber(text) > 0 && !w.pageIsEmpty {
+				w.addPage()
+			}
+			w.bookmark(text, heading.Level)
+		}
+		w.writeBlock(node)
+	}
+}
+
+// bookmark adds a heading to the PDF outline. Day headings and second-level
+// headings are top-level entries, third-level headings are nested under them.
+func (w *pdfWriter) bookmark(text string, level int) {
+	switch {
+	case level <= 2 || ParseDayNumber(text) > 0:
+		w.pdf.Bookmark(text, 0, -1)
+		w.hasBookmarks = true
+	case level == 3 && w.hasBookmarks:
+		w.pdf.Bookmark(text, 1, -1)
+	}
+}
+
+// writeBlock lays out a block-level node
+func (w *pdfWriter) writeBlock(node ast.Node) {
+	pdf := w.pdf
+	w.pageIsEmpty = false
+
+	switch n := node.(type) {
+	case *ast.Heading:
+		size := pdfHeadingSizes[len(pdfHeadingSizes)-1]
+		if n.Level <= len(pdfHeadingSizes) {
+			size = pdfHeadingSizes[n.Level-1]
+		}
+		pdf.Ln(3)
+		w.setFont(size, true)
+		pdf.MultiCell(0, size*0.5, strings.TrimSpace(string(n.Text(w.source))), "", "L", false)
+		w.setFont(pdfBodySize, false)
+		pdf.Ln(2)
+
+	case *ast.Paragraph, *ast.TextBlock:
+		w.writeInline(n)
+		pdf.Ln(pdfLineHeight)
+		if _, ok := n.(*ast.Paragraph); ok {
+			pdf.Ln(1.5)
+		}
+
+	case *ast.List:
+		w.writeList(n)
+		pdf.Ln(1.5)
+
+	case *ast.Blockquote:
+		w.indent(pdfListIndent, func() {
+			pdf.SetTextColor(90, 90, 90)
+			w.writeChildren(n)
+			pdf.SetTextColor(0, 0, 0)
+		})
+
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		var code strings.Builder
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			segment := lines.At(i)
+			code.Write(segment.Value(w.source))
+		}
+		pdf.SetFillColor(242, 242, 242)
+		w.setFont(pdfBodySize-1, false)
+		pdf.MultiCell(0, pdfLineHeight-0.5, strings.TrimRight(code.String(), "\n"), "", "L", true)
+		w.setFont(pdfBodySize, false)
+		pdf.Ln(2)
+
+	case *ast.ThematicBreak:
+		y := pdf.GetY() + 2
+		left, _, _, _ := pdf.GetMargins()
+		pdf.SetDrawColor(200, 200, 200)
+		pdf.Line(left, y, left+w.contentWidth, y)
+		pdf.SetY(y + 3)
+
+	case *extast.Table:
+		w.writeMarkdownTable(n)
+
+	case *extast.DefinitionTerm:
+		w.setFont(pdfBodySize, true)
+		w.writeInline(n)
+		w.setFont(pdfBodySize, false)
+		pdf.Ln(pdfLineHeight)
+
+	case *extast.DefinitionDescription:
+		w.indent(pdfListIndent, func() { w.writeChildren(n) })
+
+	case *tripDirectiveNode:
+		w.writeDirective(n)
+
+	case *ast.HTMLBlock:
+		// Raw HTML has no printable equivalent
+
+	default:
+		w.writeChildren(n)
+	}
+}
+
+// writeChildren lays out the block children of node
+func (w *pdfWriter) writeChildren(node ast.Node) {
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		w.writeBlock(child)
+	}
+}
+
+// indent runs fn with the left margin moved right by by
+func (w *pdfWriter) indent(by float64, fn func()) {
+	left, _, _, _ := w.pdf.GetMargins()
+	w.pdf.SetLeftMargin(left + by)
+	w.pdf.SetX(left + by)
+	w.contentWidth -= by
+	fn()
+	w.contentWidth += by
+	w.pdf.SetLeftMargin(left)
+	w.pdf.SetX(left)
+}
+
+// writeList lays out a list with bullets, numbers or task-list boxes
+func (w *pdfWriter) writeList(list *ast.List) {
+	pdf := w.pdf
+	number := list.Start
+	if number == 0 {
+		number = 1
+	}
+
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		marker := "•"
+		if list.IsOrdered() {
+			marker = fmt.Sprintf("%d.", number)
+			number++
+		}
+		if checkbox := taskCheckBox(item); checkbox != nil {
+			// Ballot box symbols are missing from many Korean fonts
+			marker = "[ ]"
+			if checkbox.IsChecked {
+				marker = "[x]"
+			}
+		}
+
+		left, _, _, _ := pdf.GetMargins()
+		pdf.SetX(left)
+		pdf.CellFormat(pdfListIndent, pdfLineHeight, marker, "", 0, "L", false, 0, "")
+		w.indent(pdfListIndent, func() {
+			pdf.SetX(left + pdfListIndent)
+			for child := item.FirstChild(); child != nil; child = child.NextSibling() {
+				w.writeBlock(child)
+			}
+		})
+	}
+}
+
+// taskCheckBox returns the checkbox of a task-list item, or nil
+func taskCheckBox(item ast.Node) *extast.TaskCheckBox {
+	block := item.FirstChild()
+	if block == nil {
+		return nil
+	}
+	checkbox, _ := block.FirstChild().(*extast.TaskCheckBox)
+	return checkbox
+}
+
+// writeInline writes the inline content of a block, wrapping at the margins
+func (w *pdfWriter) writeInline(node ast.Node) {
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		w.writeInlineNode(child)
+	}
+}
+
+// writeInlineNode writes one inline node
+func (w *pdfWriter) writeInlineNode(node ast.Node) {
+	pdf := w.pdf
+	switch n := node.(type) {
+	case *ast.Text:
+		pdf.Write(pdfLineHeight, string(n.Segment.Value(w.source)))
+		if n.HardLineBreak() {
+			pdf.Ln(pdfLineHeight)
+		} else if n.SoftLineBreak() {
+			pdf.Write(pdfLineHeight, " ")
+		}
+
+	case *ast.String:
+		pdf.Write(pdfLineHeight, string(n.Value))
+
+	case *ast.CodeSpan:
+		pdf.Write(pdfLineHeight, string(n.Text(w.source)))
+
+	case *ast.Emphasis:
+		if n.Level < 2 || w.bold {
+			w.writeInline(n)
+			return
+		}
+		size, _ := pdf.GetFontSize()
+		w.setFont(size, true)
+		w.writeInline(n)
+		w.setFont(size, false)
+
+	case *ast.Link:
+		w.writeLink(string(n.Text(w.source)), string(n.Destination))
+
+	case *ast.AutoLink:
+		w.writeLink(string(n.Label(w.source)), string(n.URL(w.source)))
+
+	case *ast.Image:
+		w.writeImage(n)
+
+	case *extast.TaskCheckBox, *ast.RawHTML:
+		// Checkboxes are drawn as the list marker; raw HTML is dropped
+
+	case *extast.FootnoteLink:
+		pdf.Write(pdfLineHeight, fmt.Sprintf("[%d]", n.Index))
+
+	case *extast.FootnoteBacklink:
+		// Back links only make sense on screen
+
+	default:
+		w.writeInline(n)
+	}
+}
+
+// writeLink writes link text, clickable for web and mail links
+func (w *pdfWriter) writeLink(text, destination string) {
+	if !strings.HasPrefix(destination, "http://") && !strings.HasPrefix(destination, "https://") && !strings.HasPrefix(destination, "mailto:") {
+		w.pdf.Write(pdfLineHeight, text)
+		return
+	}
+	w.pdf.SetTextColor(30, 90, 180)
+	w.pdf.WriteLinkString(pdfLineHeight, text, destination)
+	w.pdf.SetTextColor(0, 0, 0)
+}
+
+// writeImage draws an uploaded image at the full content width or its
+// natural size, whichever is smaller. Images that cannot be embedded, such
+// as external ones, are replaced by their alt text.
+func (w *pdfWriter) writeImage(img *ast.Image) {
+	pdf := w.pdf
+	alt := string(img.Text(w.source))
+
+	name, info := w.registerImage(string(img.Destination))
+	if info == nil {
+		if alt != "" {
+			pdf.SetTextColor(110, 110, 110)
+			pdf.Write(pdfLineHeight, "["+alt+"]")
+			pdf.SetTextColor(0, 0, 0)
+		}
+		return
+	}
+
+	width, height := info.Extent()
+	if width > w.contentWidth {
+		height *= w.contentWidth / width
+		width = w.contentWidth
+	}
+	if height > pdfMaxImageSize {
+		width *= pdfMaxImageSize / height
+		height = pdfMaxImageSize
+	}
+
+	left, _, _, _ := pdf.GetMargins()
+	if pdf.GetX() > left {
+		pdf.Ln(pdfLineHeight)
+	}
+	if pdf.GetY()+height > w.pageBottom {
+		w.addPage()
+	}
+	y := pdf.GetY()
+	pdf.ImageOptions(name, left, y, width, height, false, fpdf.ImageOptions{}, 0, "")
+	pdf.SetXY(left, y+height+2)
+}
+
+// registerImage loads an uploaded image into the document once and returns
+// its name, or nil info when it cannot be embedded
+func (w *pdfWriter) registerImage(ref string) (string, *fpdf.ImageInfoType) {
+	if w.exporter.images == nil || !isInternalImageRef(ref) {
+		return "", nil
+	}
+	file, err := w.exporter.images.Resolve(ref, w.doc.ImageOwnerID)
+	if err != nil {
+		return "", nil
+	}
+
+	name := file.FilePath
+	if info := w.pdf.GetImageInfo(name); info != nil {
+		return name, info
+	}
+
+	data, err := readStoredFile(w.exporter.storage, file.FilePath)
+	if err != nil {
+		log.Printf("PDF export skipped image %s: %v", file.FilePath, err)
+		return "", nil
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", nil
+	}
+
+	imageType := map[string]string{"jpeg": "JPG", "png": "PNG", "gif": "GIF"}[format]
+	info := w.pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: imageType}, bytes.NewReader(data))
+	if w.pdf.Err() {
+		// Formats fpdf cannot embed, such as interlaced PNG, must not
+		// abort the whole document
+		log.Printf("PDF export skipped image %s: %v", file.FilePath, w.pdf.Error())
+		w.pdf.ClearError()
+		return "", nil
+	}
+	return name, info
+}
+
+// readStoredFile reads a whole file from storage
+func readStoredFile(storage filestorage.FileStorageService, filePath string) ([]byte, error) {
+	reader, err := filestorage.AdaptV1(storage).Open(context.Background(), filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// writeMarkdownTable draws a GFM table
+func (w *pdfWriter) writeMarkdownTable(table *extast.Table) {
+	var header []string
+	var rows [][]string
+	aligns := make([]string, len(table.Alignments))
+	for i, alignment := range table.Alignments {
+		aligns[i] = map[extast.Alignment]string{extast.AlignRight: "R", extast.AlignCenter: "C"}[alignment]
+	}
+
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		var cells []string
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			cells = append(cells, strings.TrimSpace(string(cell.Text(w.source))))
+		}
+		if _, ok := row.(*extast.TableHeader); ok {
+			header = cells
+		} else {
+			rows = append(rows, cells)
+		}
+	}
+
+	w.writeTable(header, rows, nil, aligns)
+}
+
+// writeTable draws a table with wrapped cells, repeating the header after
+// page breaks. nil widths share the content width equally; aligns holds
+// "L", "C" or "R" per column and may be short.
+func (w *pdfWriter) writeTable(header []string, rows [][]string, widths []float64, aligns []string) {
+	pdf := w.pdf
+	columns := len(header)
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	if columns == 0 {
+		return
+	}
+	if widths == nil {
+		widths = make([]float64, columns)
+		for i := range widths {
+			widths[i] = w.contentWidth / float64(columns)
+		}
+	}
+
+	drawRow := func(cells []string, isHeader bool) {
+		w.setFont(pdfBodySize-1, isHeader)
+		lineHeight := pdfLineHeight - 0.5
+
+		// Every cell of a row gets the height of the tallest one
+		lines := make([][]string, columns)
+		height := lineHeight
+		for i := 0; i < columns; i++ {
+			text := ""
+			if i < len(cells) {
+				text = cells[i]
+			}
+			lines[i] = pdf.SplitText(text, widths[i]-2*pdfTablePadding)
+			if h := float64(len(lines[i])) * lineHeight; h > height {
+				height = h
+			}
+		}
+		height += 2 * pdfTablePadding
+
+		if pdf.GetY()+height > w.pageBottom {
+			w.addPage()
+			w.pageIsEmpty = false
+			w.setFont(pdfBodySize-1, isHeader)
+		}
+
+		left, _, _, _ := pdf.GetMargins()
+		x, y := left, pdf.GetY()
+		pdf.SetDrawColor(190, 190, 190)
+		pdf.SetFillColor(238, 238, 238)
+		for i := 0; i < columns; i++ {
+			style := "D"
+			if isHeader {
+				style = "FD"
+			}
+			pdf.Rect(x, y, widths[i], height, style)
+
+			align := "L"
+			if i < len(aligns) && aligns[i] != "" {
+				align = aligns[i]
+			}
+			for j, line := range lines[i] {
+				pdf.SetXY(x+pdfTablePadding, y+pdfTablePadding+float64(j)*lineHeight)
+				pdf.CellFormat(widths[i]-2*pdfTablePadding, lineHeight, line, "", 0, align, false, 0, "")
+			}
+			x += widths[i]
+		}
+		pdf.SetXY(left, y+height)
+	}
+
+	if header != nil {
+		drawRow(header, true)
+	}
+	for _, row := range rows {
+		if pdf.GetY()+pdfLineHeight+2*pdfTablePadding > w.pageBottom && header != nil {
+			w.addPage()
+			w.pageIsEmpty = false
+			drawRow(header, true)
+		}
+		drawRow(row, false)
+	}
+	w.setFont(pdfBodySize, false)
+	pdf.Ln(4)
+}
+
+// writeDirective lays out a trip directive as a table of its attributes
+// under a heading naming the booking or place
+func (w *pdfWriter) writeDirective(n *tripDirectiveNode) {
+	title := directiveLabels[n.Directive.Kind]
+	if n.Directive.Title != "" {
+		title += " · " + n.Directive.Title
+	}
+
+	rows := make([][]string, 0, len(n.attributes)+1)
+	for _, attr := range n.attributes {
+		rows = append(rows, []string{attr.Label, attr.Value})
+	}
+	if n.Directive.Notes != "" {
+		rows = append(rows, []string{"Notes", n.Directive.Notes})
+	}
+	labelWidth := w.contentWidth * 0.3
+	w.writeTable([]string{title, ""}, rows, []float64{labelWidth, w.contentWidth - labelWidth}, nil)
+}
+
+// writeBudget adds the budget summary tables after the itinerary
+func (w *pdfWriter) writeBudget() {
+	budget := w.doc.Budget
+	if budget == nil || len(budget.Lines) == 0 {
+		return
+	}
+	pdf := w.pdf
+
+	w.addPage()
+	pdf.Bookmark("Budget", 0, -1)
+	w.setFont(pdfHeadingSizes[1], true)
+	pdf.MultiCell(0, pdfHeadingSizes[1]*0.5, "Budget", "", "L", false)
+	pdf.Ln(3)
+
+	rows := make([][]string, len(budget.Lines))
+	for i, line := range budget.Lines {
+		rows[i] = []string{formatBudgetDay(line.Day), line.Category, line.Amount.String()}
+	}
+	amountWidth := 45.0
+	w.writeTable([]string{"Day", "Item", "Amount"}, rows,
+		[]float64{25, w.contentWidth - 25 - amountWidth, amountWidth}, []string{"L", "L", "R"})
+
+	if len(budget.ByDay) > 0 {
+		w.writeBudgetHeading("By day")
+		rows := make([][]string, len(budget.ByDay))
+		for i, day := range budget.ByDay {
+			rows[i] = []string{formatBudgetDay(day.Day), joinMoney(day.Totals)}
+		}
+		w.writeTable([]string{"Day", "Total"}, rows, nil, []string{"L", "R"})
+	}
+
+	if len(budget.ByCategory) > 0 {
+		w.writeBudgetHeading("By category")
+		rows := make([][]string, len(budget.ByCategory))
+		for i, category := range budget.ByCategory {
+			rows[i] = []string{category.Category, joinMoney(category.Totals)}
+		}
+		w.writeTable([]string{"Category", "Total"}, rows, nil, []string{"L", "R"})
+	}
+
+	w.writeBudgetHeading("Total")
+	totals := [][]string{{"Total", joinMoney(budget.Totals)}}
+	if converted := budget.Converted; converted != nil {
+		totals = append(totals, []string{"Total in " + converted.HomeCurrency, converted.Total.String()})
+	}
+	w.writeTable(nil, totals, nil, []string{"L", "R"})
+}
+
+// writeBudgetHeading writes a subheading of the budget page
+func (w *pdfWriter) writeBudgetHeading(text string) {
+	w.setFont(pdfHeadingSizes[3], true)
+	w.pdf.MultiCell(0, pdfLineHeight+1, text, "", "L", false)
+	w.setFont(pdfBodySize, false)
+	w.pdf.Ln(1)
+}
+
+// formatBudgetDay labels a budget day, 0 being trip-wide entries
+func formatBudgetDay(day int) string {
+	if day == 0 {
+		return "Trip"
+	}
+	return fmt.Sprintf("Day %d", day)
+}
+
+// joinMoney formats per-currency totals on one line
+func joinMoney(amounts []Money) string {
+	parts := make([]string, len(amounts))
+	for i, amount := range amounts {
+		parts[i] = amount.String()
+	}
+	return strings.Join(parts, " + ")
+}
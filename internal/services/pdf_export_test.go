@@ -0,0 +1,121 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testPDFLatinFont is used to lay out test PDFs when no Hangul font is
+// installed; Hangul text then has no glyphs, which does not affect layout
+const testPDFLatinFont = "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"
+
+// testPDFExporter returns an exporter using whichever font is installed
+func testPDFExporter(t *testing.T, files *memoryFiles) *PDFExporter {
+	t.Helper()
+	fonts, err := LoadPDFFonts()
+	if errors.Is(err, ErrPDFFontUnavailable) {
+		regular, readErr := os.ReadFile(testPDFLatinFont)
+		if readErr != nil {
+			t.Skip("no TrueType font installed")
+		}
+		fonts, err = &PDFFonts{Regular: regular}, nil
+	}
+	if err != nil {
+		t.Fatalf("LoadPDFFonts() error = %v", err)
+	}
+
+	exporter := NewPDFExporter(files, NewImageResolver(files, files))
+	exporter.SetFonts(fonts)
+	return exporter
+}
+
+func TestPDFExporter_Export(t *testing.T) {
+	owner := uuid.New()
+	files := &memoryFiles{}
+	files.add(owner, "beach.png", "uploads/beach.png", true)
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 400, 200)))
+	files.data = map[string][]byte{"uploads/beach.png": img.Bytes()}
+
+	markdown := "# 제주 여행\n\n" +
+		"Intro with **bold** and a [link](https://example.com).\n\n" +
+		"## 1일차 - 제주시\n\n- [x] 렌터카 픽업\n- [ ] 점심\n\n![해변](beach.png)\n\n" +
+		"| 시간 | 장소 |\n|---|---:|\n| 09:00 | 공항 |\n\n" +
+		"## 2일차 - 서귀포\n\n:::hotel 서귀포 호텔\n체크인: 15:00\n:::\n\n1. 정방폭포\n2. 올레시장\n\n![again](beach.png) ![remote](https://example.com/x.png)\n\n" +
+		"## 예산\n\n- 숙소: 120,000원\n- 식비: 80,000원\n"
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+	doc := &ScheduleExport{
+		Title:        "제주 여행",
+		Description:  "2박 3일 제주도 일정",
+		Markdown:     markdown,
+		StartDate:    &start,
+		EndDate:      &end,
+		Budget:       ExtractBudget(markdown),
+		ImageOwnerID: owner,
+	}
+
+	var out bytes.Buffer
+	if err := testPDFExporter(t, files).Export(&out, doc); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	pdf := out.String()
+
+	if !strings.HasPrefix(pdf, "%PDF-") {
+		t.Fatalf("output is not a PDF: %q", pdf[:20])
+	}
+	if !strings.Contains(pdf, "/FontFile2") {
+		t.Error("font should be embedded")
+	}
+
+	// Cover, introduction, two days (the budget heading stays on day 2)
+	// and the budget summary
+	pages := regexp.MustCompile(`/Type /Page\b[^s]`).FindAllString(pdf, -1)
+	if len(pages) != 5 {
+		t.Errorf("PDF has %d pages, want 5", len(pages))
+	}
+
+	// The image is embedded once however often it appears
+	if got := strings.Count(pdf, "/Subtype /Image"); got != 1 {
+		t.Errorf("PDF embeds %d images, want 1", got)
+	}
+	if !strings.Contains(pdf, "/Outlines") {
+		t.Error("PDF should have an outline of the days")
+	}
+}
+
+func TestPDFExporter_NoBudget(t *testing.T) {
+	files := &memoryFiles{}
+	doc := &ScheduleExport{Title: "Trip", Markdown: "Just notes, no days."}
+
+	var out bytes.Buffer
+	if err := testPDFExporter(t, files).Export(&out, doc); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	pages := regexp.MustCompile(`/Type /Page\b[^s]`).FindAllString(out.String(), -1)
+	if len(pages) != 2 {
+		t.Errorf("PDF has %d pages, want cover and body", len(pages))
+	}
+}
+
+func TestFormatTripDates(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)
+	if got := formatTripDates(&start, &end); got != "2024-05-01 – 2024-05-03 (3 days)" {
+		t.Errorf("formatTripDates() = %q", got)
+	}
+	if got := formatTripDates(nil, nil); got != "" {
+		t.Errorf("formatTripDates(nil, nil) = %q", got)
+	}
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tripflow/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrQuotaExceeded is returned when an upload would take a user over their
+// storage quota
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// Default quotas used when STORAGE_QUOTA_MB and STORAGE_QUOTA_FILES are unset
+const (
+	defaultQuotaBytes = 100 << 20
+	defaultQuotaFiles = 500
+)
+
+// defaultRoleQuotas is the role mapping used when STORAGE_ROLE_QUOTAS is
+// unset; admins are not limited
+var defaultRoleQuotas = map[string]Quota{"admin": {}}
+
+// Quota limits the storage of a user. Zero limits are unlimited.
+type Quota struct {
+	MaxBytes int64 `json:"max_bytes"`
+	MaxFiles int64 `json:"max_files"`
+}
+
+// StorageUsage is the storage taken by a user's uploads
+type StorageUsage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+
+	// Unfinished resumable uploads, included in Bytes and Files
+	StagedBytes int64 `json:"staged_bytes"`
+	StagedFiles int64 `json:"staged_files"`
+}
+
+// QuotaConfig holds configuration for QuotaService
+type QuotaConfig struct {
+	Default Quota            // Quota of users whose role is not in Roles
+	Roles   map[string]Quota // Quotas by role
+}
+
+// DefaultQuotaConfig returns quota configuration from the environment.
+// STORAGE_QUOTA_MB and STORAGE_QUOTA_FILES set the default quota, and
+// STORAGE_ROLE_QUOTAS sets quotas by role as "<MB>:<files>" pairs, such as
+// "admin=0:0,editor=500:2000". 0 means unlimited.
+func DefaultQuotaConfig() *QuotaConfig {
+	config := &QuotaConfig{
+		Default: Quota{MaxBytes: defaultQuotaBytes, MaxFiles: defaultQuotaFiles},
+		Roles:   defaultRoleQuotas,
+	}
+	if value := os.Getenv("STORAGE_QUOTA_MB"); value != "" {
+		if mb, err := strconv.ParseInt(value, 10, 64); err == nil && mb >= 0 {
+			config.Default.MaxBytes = mb << 20
+		} else {
+			log.Printf("Invalid STORAGE_QUOTA_MB %q, using %dMB", value, config.Default.MaxBytes>>20)
+		}
+	}
+	if value := os.Getenv("STORAGE_QUOTA_FILES"); value != "" {
+		if files, err := strconv.ParseInt(value, 10, 64); err == nil && files >= 0 {
+			config.Default.MaxFiles = files
+		} else {
+			log.Printf("Invalid STORAGE_QUOTA_FILES %q, using %d", value, config.Default.MaxFiles)
+		}
+	}
+
+	if value := strings.TrimSpace(os.Getenv("STORAGE_ROLE_QUOTAS")); value != "" {
+		config.Roles = make(map[string]Quota)
+		for _, pair := range strings.Split(value, ",") {
+			role, limits, ok := strings.Cut(pair, "=")
+			quota, err := parseQuota(limits)
+			if !ok || err != nil {
+				log.Printf("Invalid STORAGE_ROLE_QUOTAS entry %q, ignoring it", pair)
+				continue
+			}
+			config.Roles[strings.TrimSpace(role)] = quota
+		}
+	}
+	return config
+}
+
+// parseQuota parses "<MB>:<files>"
+func parseQuota(value string) (Quota, error) {
+	mbValue, filesValue, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok {
+		return Quota{}, fmt.Errorf("quota %q must be <MB>:<files>", value)
+	}
+	mb, err := strconv.ParseInt(mbValue, 10, 64)
+	if err != nil || mb < 0 {
+		return Quota{}, fmt.Errorf("invalid quota size %q", mbValue)
+	}
+	files, err := strconv.ParseInt(filesValue, 10, 64)
+	if err != nil || files < 0 {
+		return Quota{}, fmt.Errorf("invalid quota file count %q", filesValue)
+	}
+	return Quota{MaxBytes: mb << 20, MaxFiles: files}, nil
+}
+
+// QuotaStore provides stored usage and per-user quota overrides
+type QuotaStore interface {
+	Usage(userID uuid.UUID) (bytes int64, files int64, err error)
+	GetOverride(userID uuid.UUID) (*models.StorageQuota, error)
+}
+
+// StagedUploads reports the declared size of uploads a user has started
+// but not finished, keyed by the user's UUID as a string
+type StagedUploads interface {
+	Staged(owner string) (bytes int64, uploads int64, err error)
+}
+
+// QuotaService enforces storage quotas. A user's quota is the quota of
+// their role, with the limits an admin override sets replacing it.
+type QuotaService struct {
+	store  QuotaStore
+	config *QuotaConfig
+	staged StagedUploads // Nil when resumable uploads are not counted
+
+	// Uploads reserved but not yet recorded, so concurrent uploads of one
+	// user cannot each fit the same free space
+	mu      sync.Mutex
+	pending map[uuid.UUID]StorageUsage
+}
+
+// NewQuotaService creates a QuotaService, using DefaultQuotaConfig when
+// config is nil
+func NewQuotaService(store QuotaStore, config *QuotaConfig) *QuotaService {
+	if config == nil {
+		config = DefaultQuotaConfig()
+	}
+	return &QuotaService{
+		store:   store,
+		config:  config,
+		pending: make(map[uuid.UUID]StorageUsage),
+	}
+}
+
+// SetStagedUploads counts unfinished resumable uploads towards usage, so
+// that their space is held from the moment they are started
+func (s *QuotaService) SetStagedUploads(staged StagedUploads) {
+	s.staged = staged
+}
+
+// Limits returns the quota that applies to a user with the given role
+func (s *QuotaService) Limits(userID uuid.UUID, role string) (Quota, error) {
+	quota, ok := s.config.Roles[role]
+	if !ok {
+		quota = s.config.Default
+	}
+
+	override, err := s.store.GetOverride(userID)
+	if err != nil {
+		return Quota{}, fmt.Errorf("failed to get quota override: %w", err)
+	}
+	if override != nil {
+		if override.MaxBytes != nil {
+			quota.MaxBytes = *override.MaxBytes
+		}
+		if override.MaxFiles != nil {
+			quota.MaxFiles = *override.MaxFiles
+		}
+	}
+	return quota, nil
+}
+
+// Usage returns the storage taken by a user's recorded uploads and their
+// unfinished resumable uploads
+func (s *QuotaService) Usage(userID uuid.UUID) (StorageUsage, error) {
+	bytes, files, err := s.store.Usage(userID)
+	if err != nil {
+		return StorageUsage{}, fmt.Errorf("failed to get storage usage: %w", err)
+	}
+	usage := StorageUsage{Bytes: bytes, Files: files}
+
+	if s.staged != nil {
+		usage.StagedBytes, usage.StagedFiles, err = s.staged.Staged(userID.String())
+		if err != nil {
+			return StorageUsage{}, fmt.Errorf("failed to get staged uploads: %w", err)
+		}
+		usage.Bytes += usage.StagedBytes
+		usage.Files += usage.StagedFiles
+	}
+	return usage, nil
+}
+
+// Check returns an error wrapping ErrQuotaExceeded if one more upload of
+// size bytes would take the user over their quota
+func (s *QuotaService) Check(userID uuid.UUID, role string, size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.check(userID, role, size)
+}
+
+// Reserve checks an upload of size bytes like Check and holds its space
+// until release is called, which must happen once the upload has been
+// recorded or has failed
+func (s *QuotaService) Reserve(userID uuid.UUID, role string, size int64) (release func(), err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(userID, role, size); err != nil {
+		return nil, err
+	}
+	s.add(userID, size, 1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.add(userID, -size, -1)
+		})
+	}, nil
+}
+
+// check is Check with s.mu held
+func (s *QuotaService) check(userID uuid.UUID, role string, size int64) error {
+	quota, err := s.Limits(userID, role)
+	if err != nil {
+		return err
+	}
+	if quota.MaxBytes == 0 && quota.MaxFiles == 0 {
+		return nil
+	}
+
+	usage, err := s.Usage(userID)
+	if err != nil {
+		return err
+	}
+	pending := s.pending[userID]
+	usage.Bytes += pending.Bytes
+	usage.Files += pending.Files
+
+	if quota.MaxFiles > 0 && usage.Files+1 > quota.MaxFiles {
+		return fmt.Errorf("%w: the quota allows %d files and %d are stored", ErrQuotaExceeded, quota.MaxFiles, usage.Files)
+	}
+	if quota.MaxBytes > 0 && usage.Bytes+size > quota.MaxBytes {
+		return fmt.Errorf("%w: %s more would exceed the %s quota, %s are used",
+			ErrQuotaExceeded, formatBytes(size), formatBytes(quota.MaxBytes), formatBytes(usage.Bytes))
+	}
+	return nil
+}
+
+// add adjusts a user's pending usage
+func (s *QuotaService) add(userID uuid.UUID, bytes, files int64) {
+	pending := s.pending[userID]
+	pending.Bytes += bytes
+	pending.Files += files
+	if pending.Files == 0 {
+		delete(s.pending, userID)
+		return
+	}
+	s.pending[userID] = pending
+}
+
+// formatBytes formats a byte count for messages, such as "1.5MB"
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return strconv.FormatFloat(float64(n)/(1<<20), 'f', 1, 64) + "MB"
+	case n >= 1<<10:
+		return strconv.FormatFloat(float64(n)/(1<<10), 'f', 1, 64) + "KB"
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"tripflow/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// memoryQuotaStore is an in-memory QuotaStore
+type memoryQuotaStore struct {
+	usage     map[uuid.UUID]StorageUsage
+	overrides map[uuid.UUID]*models.StorageQuota
+}
+
+func newMemoryQuotaStore() *memoryQuotaStore {
+	return &memoryQuotaStore{
+		usage:     map[uuid.UUID]StorageUsage{},
+		overrides: map[uuid.UUID]*models.StorageQuota{},
+	}
+}
+
+func (m *memoryQuotaStore) Usage(userID uuid.UUID) (int64, int64, error) {
+	usage := m.usage[userID]
+	return usage.Bytes, usage.Files, nil
+}
+
+func (m *memoryQuotaStore) GetOverride(userID uuid.UUID) (*models.StorageQuota, error) {
+	return m.overrides[userID], nil
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func TestQuotaService_Limits(t *testing.T) {
+	store := newMemoryQuotaStore()
+	quotas := NewQuotaService(store, &QuotaConfig{
+		Default: Quota{MaxBytes: 10 << 20, MaxFiles: 100},
+		Roles:   map[string]Quota{"admin": {}, "editor": {MaxBytes: 50 << 20, MaxFiles: 500}},
+	})
+	user := uuid.New()
+
+	tests := []struct {
+		role     string
+		override *models.StorageQuota
+		want     Quota
+	}{
+		{"", nil, Quota{MaxBytes: 10 << 20, MaxFiles: 100}},
+		{"admin", nil, Quota{}},
+		{"editor", nil, Quota{MaxBytes: 50 << 20, MaxFiles: 500}},
+		{"editor", &models.StorageQuota{MaxFiles: int64Ptr(5)}, Quota{MaxBytes: 50 << 20, MaxFiles: 5}},
+		{"admin", &models.StorageQuota{MaxBytes: int64Ptr(1 << 20)}, Quota{MaxBytes: 1 << 20}},
+		{"", &models.StorageQuota{MaxBytes: int64Ptr(0), MaxFiles: int64Ptr(0)}, Quota{}},
+	}
+	for _, tt := range tests {
+		if tt.override != nil {
+			store.overrides[user] = tt.override
+		} else {
+			delete(store.overrides, user)
+		}
+		got, err := quotas.Limits(user, tt.role)
+		if err != nil || got != tt.want {
+			t.Errorf("Limits(%q, %+v) = %+v, %v; want %+v", tt.role, tt.override, got, err, tt.want)
+		}
+	}
+}
+
+func TestQuotaService_Reserve(t *testing.T) {
+	store := newMemoryQuotaStore()
+	quotas := NewQuotaService(store, &QuotaConfig{Default: Quota{MaxBytes: 1000, MaxFiles: 3}})
+	user := uuid.New()
+	store.usage[user] = StorageUsage{Bytes: 600, Files: 1}
+
+	if err := quotas.Check(user, "", 500); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Check() over the byte limit error = %v, want ErrQuotaExceeded", err)
+	}
+
+	// A pending upload holds its space until released
+	release, err := quotas.Reserve(user, "", 300)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	if err := quotas.Check(user, "", 200); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Check() while 300 bytes are reserved error = %v, want ErrQuotaExceeded", err)
+	}
+	release()
+	release()
+	if err := quotas.Check(user, "", 400); err != nil {
+		t.Errorf("Check() after release error = %v", err)
+	}
+
+	// The file count is limited independently of the size
+	store.usage[user] = StorageUsage{Bytes: 0, Files: 2}
+	release, err = quotas.Reserve(user, "", 1)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	if _, err := quotas.Reserve(user, "", 1); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Reserve() over the file limit error = %v, want ErrQuotaExceeded", err)
+	}
+	release()
+
+	// Other users are not affected
+	if err := quotas.Check(uuid.New(), "", 1000); err != nil {
+		t.Errorf("Check() for another user error = %v", err)
+	}
+}
+
+// memoryStaged is an in-memory StagedUploads
+type memoryStaged map[string]StorageUsage
+
+func (m memoryStaged) Staged(owner string) (int64, int64, error) {
+	return m[owner].Bytes, m[owner].Files, nil
+}
+
+func TestQuotaService_StagedUploads(t *testing.T) {
+	store := newMemoryQuotaStore()
+	quotas := NewQuotaService(store, &QuotaConfig{Default: Quota{MaxBytes: 1000, MaxFiles: 3}})
+	user := uuid.New()
+	store.usage[user] = StorageUsage{Bytes: 300, Files: 1}
+	staged := memoryStaged{user.String(): {Bytes: 500, Files: 1}}
+	quotas.SetStagedUploads(staged)
+
+	usage, err := quotas.Usage(user)
+	want := StorageUsage{Bytes: 800, Files: 2, StagedBytes: 500, StagedFiles: 1}
+	if err != nil || usage != want {
+		t.Errorf("Usage() = %+v, %v; want %+v", usage, err, want)
+	}
+	if err := quotas.Check(user, "", 300); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Check() over the space held by a staged upload error = %v, want ErrQuotaExceeded", err)
+	}
+
+	// The space is free again once the upload is gone
+	delete(staged, user.String())
+	if err := quotas.Check(user, "", 300); err != nil {
+		t.Errorf("Check() after the staged upload ended error = %v", err)
+	}
+}
+
+func TestDefaultQuotaConfig(t *testing.T) {
+	t.Setenv("STORAGE_QUOTA_MB", "20")
+	t.Setenv("STORAGE_QUOTA_FILES", "0")
+	t.Setenv("STORAGE_ROLE_QUOTAS", "admin=0:0, editor=500:2000,broken=5")
+
+	config := DefaultQuotaConfig()
+	if config.Default != (Quota{MaxBytes: 20 << 20}) {
+		t.Errorf("Default = %+v", config.Default)
+	}
+	if config.Roles["editor"] != (Quota{MaxBytes: 500 << 20, MaxFiles: 2000}) {
+		t.Errorf("Roles[editor] = %+v", config.Roles["editor"])
+	}
+	if _, ok := config.Roles["admin"]; !ok {
+		t.Error("Roles should include admin")
+	}
+	if _, ok := config.Roles["broken"]; ok {
+		t.Error("invalid entries should be ignored")
+	}
+}
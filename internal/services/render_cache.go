@@ -0,0 +1,398 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Render cache defaults, overridable with RENDER_CACHE_SIZE and RENDER_CACHE_TTL
+const (
+	defaultRenderCacheSize = 512
+	defaultRenderCacheTTL  = 24 * time.Hour
+)
+
+// ErrCacheMiss is returned by a RenderCacheStore for keys it does not hold
+var ErrCacheMiss = errors.New("cache miss")
+
+// RenderCacheStore is a cache tier shared between processes, such as Redis,
+// consulted when the in-process LRU misses
+type RenderCacheStore interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// renderCacheEntry is a rendered document. Image references are resolved
+// against uploads, which can change without the markdown changing, so the
+// references and a fingerprint of how they resolved are kept to validate
+// the entry on every hit.
+type renderCacheEntry struct {
+	Content   *ProcessedContent `json:"content"`
+	ImageRefs []string          `json:"image_refs,omitempty"`
+	Images    string            `json:"images,omitempty"`
+}
+
+// RenderCache caches rendered markdown in an in-process LRU with an
+// optional shared tier behind it. Keys are derived from the markdown itself
+// plus the renderer version, so edited content or a renderer change never
+// hits a stale entry. A nil *RenderCache caches nothing.
+type RenderCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List               // Most recently used at the front
+	entries  map[string]*list.Element // Values are *lruItem
+	variants map[string][]string      // Content hash to its cached keys
+	remote   RenderCacheStore
+}
+
+// lruItem is an element of the LRU list
+type lruItem struct {
+	key   string
+	value any
+}
+
+// NewRenderCache creates a RenderCache holding up to capacity entries in
+// memory. remote may be nil.
+func NewRenderCache(capacity int, remote RenderCacheStore) *RenderCache {
+	return &RenderCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		variants: make(map[string][]string),
+		remote:   remote,
+	}
+}
+
+// DefaultRenderCache returns a render cache configured from the environment.
+// RENDER_CACHE_SIZE is the number of in-process entries (0 disables
+// caching), RENDER_CACHE_REDIS_URL enables the Redis tier and
+// RENDER_CACHE_TTL is how long Redis keeps entries, e.g. "6h".
+func DefaultRenderCache() *RenderCache {
+	size := defaultRenderCacheSize
+	if value := os.Getenv("RENDER_CACHE_SIZE"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			log.Printf("Invalid RENDER_CACHE_SIZE %q, using %d", value, size)
+		} else {
+			size = parsed
+		}
+	}
+	if size <= 0 {
+		return nil
+	}
+
+	ttl := defaultRenderCacheTTL
+	if value := os.Getenv("RENDER_CACHE_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid RENDER_CACHE_TTL %q, using %s", value, ttl)
+		} else {
+			ttl = parsed
+		}
+	}
+
+	var remote RenderCacheStore
+	if redisURL := os.Getenv("RENDER_CACHE_REDIS_URL"); redisURL != "" {
+		opt, err := redis.ParseURL(redisURL)
+		if err != nil {
+			log.Printf("Failed to parse RENDER_CACHE_REDIS_URL, using in-process cache only: %v", err)
+		} else {
+			remote = NewRedisRenderCacheStore(redis.NewClient(opt), ttl)
+		}
+	}
+
+	return NewRenderCache(size, remote)
+}
+
+var (
+	defaultRenderCache     *RenderCache
+	defaultRenderCacheOnce sync.Once
+)
+
+// sharedRenderCache returns a render cache built from the environment once,
+// so every handler's MarkdownService shares entries and invalidations
+func sharedRenderCache() *RenderCache {
+	defaultRenderCacheOnce.Do(func() {
+		defaultRenderCache = DefaultRenderCache()
+	})
+	return defaultRenderCache
+}
+
+// getEntry returns the rendered entry stored under key
+func (c *RenderCache) getEntry(key string) (*renderCacheEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+	if value, ok := c.getLocal(key); ok {
+		entry, ok := value.(*renderCacheEntry)
+		return entry, ok
+	}
+	if c.remote == nil {
+		return nil, false
+	}
+
+	data, err := c.remote.Get(context.Background(), key)
+	if err != nil {
+		if !errors.Is(err, ErrCacheMiss) {
+			log.Printf("Render cache read failed: %v", err)
+		}
+		return nil, false
+	}
+	var entry renderCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Content == nil {
+		return nil, false
+	}
+	c.setLocal(key, &entry)
+	return &entry, true
+}
+
+// setEntry stores a rendered entry under key in both tiers
+func (c *RenderCache) setEntry(key string, entry *renderCacheEntry) {
+	if c == nil {
+		return
+	}
+	c.setLocal(key, entry)
+	if c.remote == nil {
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := c.remote.Set(context.Background(), key, data); err != nil {
+		log.Printf("Render cache write failed: %v", err)
+	}
+}
+
+// getSource returns cached markdown source read from filePath. Sources are
+// only kept in process since reading them from storage is cheap compared to
+// a round trip to the shared tier.
+func (c *RenderCache) getSource(filePath string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	value, ok := c.getLocal(sourceCacheKey(filePath))
+	if !ok {
+		return "", false
+	}
+	source, ok := value.(string)
+	return source, ok
+}
+
+// setSource caches markdown source read from filePath
+func (c *RenderCache) setSource(filePath, source string) {
+	if c == nil {
+		return
+	}
+	c.setLocal(sourceCacheKey(filePath), source)
+}
+
+// InvalidateFile drops the cached source of a stored file, for when the
+// file is deleted or replaced
+func (c *RenderCache) InvalidateFile(filePath string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(sourceCacheKey(filePath))
+}
+
+// InvalidateContent drops every rendering of markdown, for when a schedule's
+// content changes and the old version will not be requested again
+func (c *RenderCache) InvalidateContent(markdown string) {
+	if c == nil {
+		return
+	}
+
+	hash := contentHash(markdown)
+	c.mu.Lock()
+	keys := c.variants[hash]
+	delete(c.variants, hash)
+	for _, key := range keys {
+		c.removeLocked(key)
+	}
+	c.mu.Unlock()
+
+	if c.remote != nil && len(keys) > 0 {
+		if err := c.remote.Delete(context.Background(), keys...); err != nil {
+			log.Printf("Render cache invalidation failed: %v", err)
+		}
+	}
+}
+
+// getLocal looks key up in the LRU and marks it as recently used
+func (c *RenderCache) getLocal(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruItem).value, true
+}
+
+// setLocal stores key in the LRU, evicting the least recently used entries
+// beyond capacity
+func (c *RenderCache) setLocal(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*lruItem).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruItem{key: key, value: value})
+	if hash, ok := renderKeyContentHash(key); ok {
+		c.variants[hash] = append(c.variants[hash], key)
+	}
+	for c.order.Len() > c.capacity {
+		c.removeLocked(c.order.Back().Value.(*lruItem).key)
+	}
+}
+
+// removeLocked removes key from the LRU; c.mu must be held
+func (c *RenderCache) removeLocked(key string) {
+	element, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	c.order.Remove(element)
+	delete(c.entries, key)
+
+	hash, ok := renderKeyContentHash(key)
+	if !ok {
+		return
+	}
+	keys := c.variants[hash]
+	for i, k := range keys {
+		if k == key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(c.variants, hash)
+	} else {
+		c.variants[hash] = keys
+	}
+}
+
+// renderCacheKey identifies one rendering of markdown: the content hash
+// followed by a hash of everything else the output depends on
+func renderCacheKey(markdown, rendererVersion, policy string, resolvesImages bool, opts *ProcessOptions, lintConfig *LintConfig) string {
+	variant := sha256.New()
+	variant.Write([]byte(rendererVersion))
+	variant.Write([]byte{0})
+	variant.Write([]byte(policy))
+	variant.Write([]byte{0})
+	variant.Write([]byte(strconv.FormatBool(resolvesImages)))
+	variant.Write([]byte(opts.ImageOwnerID.String()))
+	variant.Write([]byte(strconv.FormatBool(opts.TOC)))
+	variant.Write([]byte(strconv.FormatBool(opts.SignImageURLs)))
+	if opts.Lint {
+		// Lint severities are configurable, so they are part of the output
+		config, _ := json.Marshal(lintConfig)
+		variant.Write([]byte{0})
+		variant.Write(config)
+	}
+	return "render:" + contentHash(markdown) + ":" + hex.EncodeToString(variant.Sum(nil))[:16]
+}
+
+// renderKeyContentHash returns the content hash part of a render cache key
+func renderKeyContentHash(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, "render:")
+	if !ok {
+		return "", false
+	}
+	hash, _, ok := strings.Cut(rest, ":")
+	return hash, ok
+}
+
+// sourceCacheKey is the LRU key of a stored file's markdown source
+func sourceCacheKey(filePath string) string {
+	return "source:" + filePath
+}
+
+// contentHash returns the hex SHA-256 of markdown
+func contentHash(markdown string) string {
+	sum := sha256.Sum256([]byte(markdown))
+	return hex.EncodeToString(sum[:])
+}
+
+// imageFingerprint summarizes how image references resolved, so a cached
+// rendering is discarded once an image is uploaded, replaced or deleted
+func imageFingerprint(images map[string]*ResolvedImage, warnings []ProcessingWarning) string {
+	if len(images) == 0 && len(warnings) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(images)+len(warnings))
+	for ref, image := range images {
+		parts = append(parts, ref+"="+image.URL+"|"+image.Srcset+"|"+strconv.Itoa(image.Width)+"x"+strconv.Itoa(image.Height))
+	}
+	for _, warning := range warnings {
+		parts = append(parts, warning.Ref+"!")
+	}
+	sort.Strings(parts)
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// RedisRenderCacheStore keeps rendered markdown in Redis
+type RedisRenderCacheStore struct {
+	client *redis.Client
+	ttl    time.Duration
+	prefix string
+}
+
+// NewRedisRenderCacheStore creates a RenderCacheStore backed by Redis whose
+// entries expire after ttl
+func NewRedisRenderCacheStore(client *redis.Client, ttl time.Duration) *RedisRenderCacheStore {
+	return &RedisRenderCacheStore{
+		client: client,
+		ttl:    ttl,
+		prefix: "tripflow:",
+	}
+}
+
+// Get returns the value stored under key, or ErrCacheMiss
+func (s *RedisRenderCacheStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrCacheMiss
+	}
+	return data, err
+}
+
+// Set stores value under key
+func (s *RedisRenderCacheStore) Set(ctx context.Context, key string, value []byte) error {
+	return s.client.Set(ctx, s.prefix+key, value, s.ttl).Err()
+}
+
+// Delete removes keys
+func (s *RedisRenderCacheStore) Delete(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = s.prefix + key
+	}
+	return s.client.Del(ctx, prefixed...).Err()
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"tripflow/pkg/filestorage"
+
+	"github.com/google/uuid"
+)
+
+// memoryStore is an in-memory RenderCacheStore that counts calls
+type memoryStore struct {
+	data       map[string][]byte
+	gets, sets int
+}
+
+func (m *memoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	m.gets++
+	data, ok := m.data[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return data, nil
+}
+
+func (m *memoryStore) Set(_ context.Context, key string, value []byte) error {
+	m.sets++
+	if m.data == nil {
+		m.data = make(map[string][]byte)
+	}
+	m.data[key] = value
+	return nil
+}
+
+func (m *memoryStore) Delete(_ context.Context, keys ...string) error {
+	for _, key := range keys {
+		delete(m.data, key)
+	}
+	return nil
+}
+
+// countingStorage serves one markdown file and counts reads
+type countingStorage struct {
+	content string
+	reads   int
+}
+
+func (s *countingStorage) UploadFile(io.Reader, string, string) (string, error) { return "", nil }
+func (s *countingStorage) DeleteFile(string) error                              { return nil }
+func (s *countingStorage) FileExists(string) (bool, error)                      { return true, nil }
+func (s *countingStorage) GetFileInfo(string) (*filestorage.FileInfo, error)    { return nil, nil }
+func (s *countingStorage) GetFile(string) (io.Reader, error) {
+	s.reads++
+	return strings.NewReader(s.content), nil
+}
+
+func TestRenderCache_LRU(t *testing.T) {
+	cache := NewRenderCache(2, nil)
+	cache.setSource("a", "A")
+	cache.setSource("b", "B")
+	cache.getSource("a") // a is now more recent than b
+	cache.setSource("c", "C")
+
+	if _, ok := cache.getSource("b"); ok {
+		t.Error("least recently used entry should have been evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.getSource(key); !ok {
+			t.Errorf("entry %s should still be cached", key)
+		}
+	}
+
+	var disabled *RenderCache
+	disabled.setSource("a", "A")
+	if _, ok := disabled.getSource("a"); ok {
+		t.Error("nil cache should not hold entries")
+	}
+}
+
+func TestProcessMarkdown_Cache(t *testing.T) {
+	store := &memoryStore{}
+	service := NewMarkdownService(nil)
+	service.SetRenderCache(NewRenderCache(8, store))
+
+	markdown := "# Osaka\n\nDay one."
+	first, err := service.ProcessMarkdown(markdown)
+	if err != nil {
+		t.Fatalf("ProcessMarkdown() error = %v", err)
+	}
+	// The first call missed both tiers; the second never leaves the process
+	second, _ := service.ProcessMarkdown(markdown)
+	if second.HTMLContent != first.HTMLContent || store.sets != 1 || store.gets != 1 {
+		t.Errorf("second call should be served in process: sets = %d, gets = %d", store.sets, store.gets)
+	}
+
+	// Another process with an empty LRU is served from the shared tier
+	other := NewMarkdownService(nil)
+	other.SetRenderCache(NewRenderCache(8, store))
+	shared, _ := other.ProcessMarkdown(markdown)
+	if shared.HTMLContent != first.HTMLContent || shared.Title != "Osaka" || store.gets != 2 || store.sets != 1 {
+		t.Errorf("expected a shared-tier hit: %+v, sets = %d, gets = %d", shared, store.sets, store.gets)
+	}
+
+	// A different renderer configuration must not reuse the entry
+	plain := NewMarkdownServiceWithRenderer(nil, &RendererConfig{Extensions: []string{}})
+	plain.SetRenderCache(NewRenderCache(8, store))
+	plain.ProcessMarkdown(markdown)
+	if store.sets != 2 {
+		t.Errorf("renderer change should miss, sets = %d", store.sets)
+	}
+
+	// Lint reports are cached separately from plain renderings
+	linted, _ := service.ProcessMarkdownWithOptions(markdown, &ProcessOptions{Lint: true})
+	if linted.Lint == nil {
+		t.Error("lint option should not be served a cached rendering without a report")
+	}
+
+	service.InvalidateContent(markdown)
+	if len(store.data) != 1 {
+		t.Errorf("InvalidateContent() left %d shared entries, want only the other renderer's", len(store.data))
+	}
+	service.ProcessMarkdown(markdown)
+	if store.sets != 4 {
+		t.Errorf("invalidated content should be rendered again, sets = %d", store.sets)
+	}
+}
+
+func TestReadMarkdownFile_Cache(t *testing.T) {
+	storage := &countingStorage{content: "# Trip"}
+	service := NewMarkdownService(storage)
+	service.SetRenderCache(NewRenderCache(8, nil))
+
+	for i := 0; i < 3; i++ {
+		if _, err := service.ProcessMarkdownFromFile("uploads/a.md"); err != nil {
+			t.Fatalf("ProcessMarkdownFromFile() error = %v", err)
+		}
+	}
+	if storage.reads != 1 {
+		t.Errorf("file read %d times, want 1", storage.reads)
+	}
+
+	service.InvalidateFile("uploads/a.md")
+	service.ProcessMarkdownFromFile("uploads/a.md")
+	if storage.reads != 2 {
+		t.Errorf("file read %d times after invalidation, want 2", storage.reads)
+	}
+}
+
+func TestProcessMarkdown_CacheImages(t *testing.T) {
+	owner := uuid.New()
+	files := &memoryFiles{}
+	service := NewMarkdownService(files)
+	service.SetImageResolver(NewImageResolver(files, files))
+	service.SetRenderCache(NewRenderCache(8, nil))
+
+	opts := &ProcessOptions{ImageOwnerID: owner}
+	markdown := "![map](map.png)"
+	before, _ := service.ProcessMarkdownWithOptions(markdown, opts)
+	if len(before.Warnings) != 1 || strings.Contains(before.HTMLContent, "<img") {
+		t.Fatalf("missing image should be reported: %+v", before)
+	}
+
+	// Uploading the image changes the output of unchanged markdown
+	files.add(owner, "map.png", "uploads/m.png", true)
+	after, _ := service.ProcessMarkdownWithOptions(markdown, opts)
+	if len(after.Warnings) != 0 || !strings.Contains(after.HTMLContent, `src="/api/file/uploads/m.png"`) {
+		t.Errorf("cached rendering should be discarded after upload: %+v", after)
+	}
+}
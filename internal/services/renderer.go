@@ -0,0 +1,293 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// RendererVersion is bumped whenever rendering or sanitization changes in a
+// way that alters the HTML produced for the same markdown
+const RendererVersion = "6"
+
+// Markdown extension names accepted in MARKDOWN_EXTENSIONS
+const (
+	ExtensionGFM            = "gfm" // Shorthand for table, strikethrough, linkify and tasklist
+	ExtensionTable          = "table"
+	ExtensionStrikethrough  = "strikethrough"
+	ExtensionLinkify        = "linkify"
+	ExtensionTaskList       = "tasklist"
+	ExtensionFootnote       = "footnote"
+	ExtensionDefinitionList = "definition-list"
+	ExtensionTypographer    = "typographer"
+	ExtensionDirectives     = "directives" // :::flight, :::hotel and :::place cards
+)
+
+// defaultExtensions is the extension set used when MARKDOWN_EXTENSIONS is unset
+var defaultExtensions = []string{ExtensionGFM, ExtensionFootnote, ExtensionDefinitionList, ExtensionTypographer, ExtensionDirectives}
+
+// gfmExtensions are the extensions the "gfm" shorthand expands to
+var gfmExtensions = []string{ExtensionTable, ExtensionStrikethrough, ExtensionLinkify, ExtensionTaskList}
+
+// rendererExtension pairs a goldmark extension with the sanitizer rules its
+// output needs to survive bluemonday
+type rendererExtension struct {
+	extender    goldmark.Extender
+	allowPolicy func(p *bluemonday.Policy)
+}
+
+// rendererExtensions lists every supported extension by name
+var rendererExtensions = map[string]rendererExtension{
+	ExtensionTable: {
+		// Render alignment as the align attribute, which every policy
+		// allows, instead of an inline style, which they strip
+		extender: extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+	},
+	ExtensionStrikethrough: {extender: extension.Strikethrough},
+	ExtensionLinkify:       {extender: extension.Linkify},
+	ExtensionTaskList: {
+		extender: extension.TaskList,
+		allowPolicy: func(p *bluemonday.Policy) {
+			// Keep the read-only checkboxes rendered for task-list items
+			p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+			p.AllowAttrs("checked", "disabled").OnElements("input")
+		},
+	},
+	ExtensionFootnote: {
+		extender: extension.Footnote,
+		allowPolicy: func(p *bluemonday.Policy) {
+			p.AllowAttrs("class").Matching(regexp.MustCompile(`^footnote-(ref|backref)$`)).OnElements("a")
+			p.AllowAttrs("class").Matching(regexp.MustCompile(`^footnotes$`)).OnElements("div")
+			p.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-(noteref|backlink)$`)).OnElements("a")
+			p.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-endnotes$`)).OnElements("div")
+		},
+	},
+	ExtensionDefinitionList: {extender: extension.DefinitionList},
+	ExtensionTypographer:    {extender: extension.Typographer},
+	ExtensionDirectives: {
+		extender:    &tripDirectives{},
+		allowPolicy: allowDirectiveCards,
+	},
+}
+
+// RendererConfig selects the markdown extensions and sanitization policies
+// used for rendering
+type RendererConfig struct {
+	Extensions []string
+
+	// Policy is the sanitization policy for authors without a role
+	// mapping; empty means PolicyUGC
+	Policy string
+
+	// RolePolicies maps author roles to sanitization policies
+	RolePolicies map[string]string
+
+	// EmbedHosts are the hosts iframes may embed under the ugc and
+	// trusted-admin policies
+	EmbedHosts []string
+}
+
+// DefaultRendererConfig returns renderer configuration from the environment.
+// MARKDOWN_EXTENSIONS is a comma-separated list of extension names such as
+// "gfm,footnote"; "none" disables every extension.
+func DefaultRendererConfig() *RendererConfig {
+	config := &RendererConfig{Extensions: defaultExtensions}
+	sanitizeConfigFromEnv(config)
+
+	value := strings.TrimSpace(os.Getenv("MARKDOWN_EXTENSIONS"))
+	if value == "" {
+		return config
+	}
+
+	config.Extensions = []string{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && name != "none" {
+			config.Extensions = append(config.Extensions, name)
+		}
+	}
+	return config
+}
+
+// Renderer converts markdown to sanitized HTML with a fixed set of extensions
+type Renderer struct {
+	markdown   goldmark.Markdown
+	extensions []string
+
+	policies      map[string]*bluemonday.Policy
+	defaultPolicy string
+	rolePolicies  map[string]string
+	embedHosts    []string
+}
+
+// NewRenderer builds a renderer for the given configuration. Unknown
+// extension names are ignored, and unknown policy names fall back to
+// PolicyUGC.
+func NewRenderer(config *RendererConfig) *Renderer {
+	if config == nil {
+		config = &RendererConfig{Extensions: defaultExtensions}
+	}
+
+	enabled := make(map[string]bool)
+	for _, name := range config.Extensions {
+		if name == ExtensionGFM {
+			for _, gfm := range gfmExtensions {
+				enabled[gfm] = true
+			}
+			continue
+		}
+		if _, ok := rendererExtensions[name]; ok {
+			enabled[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(enabled))
+	for name := range enabled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	embedHosts := normalizeEmbedHosts(config.EmbedHosts)
+	policies := make(map[string]*bluemonday.Policy, len(sanitizePolicyNames))
+	for _, name := range sanitizePolicyNames {
+		policies[name] = newSanitizePolicy(name, embedHosts)
+	}
+
+	extenders := make([]goldmark.Extender, 0, len(names))
+	for _, name := range names {
+		ext := rendererExtensions[name]
+		extenders = append(extenders, ext.extender)
+		if ext.allowPolicy != nil {
+			for _, policy := range policies {
+				ext.allowPolicy(policy)
+			}
+		}
+	}
+
+	defaultPolicy := config.Policy
+	if !isSanitizePolicy(defaultPolicy) {
+		defaultPolicy = PolicyUGC
+	}
+	rolePolicies := make(map[string]string, len(config.RolePolicies))
+	for role, policy := range config.RolePolicies {
+		if isSanitizePolicy(policy) {
+			rolePolicies[role] = policy
+		}
+	}
+
+	return &Renderer{
+		// Raw HTML is passed through to the sanitizer, which decides what
+		// survives, so policies can allow embeds
+		markdown: goldmark.New(
+			goldmark.WithExtensions(extenders...),
+			goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+			goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+		),
+		extensions:    names,
+		policies:      policies,
+		defaultPolicy: defaultPolicy,
+		rolePolicies:  rolePolicies,
+		embedHosts:    embedHosts,
+	}
+}
+
+// allowResponsiveImages keeps the srcset, sizes and loading attributes added
+// to uploaded images; srcset may only point at files served by the API
+func allowResponsiveImages(p *bluemonday.Policy) {
+	p.AllowAttrs("srcset").Matching(regexp.MustCompile(`^/api/file/[^\s,]+ \d+w(, /api/file/[^\s,]+ \d+w)*$`)).OnElements("img")
+	p.AllowAttrs("sizes").Matching(regexp.MustCompile(`^[a-z0-9():,\s-]+$`)).OnElements("img")
+	p.AllowAttrs("loading").Matching(regexp.MustCompile(`^(lazy|eager)$`)).OnElements("img")
+}
+
+// allowHeadingIDs keeps the generated heading IDs, which may contain
+// letters of any script
+func allowHeadingIDs(p *bluemonday.Policy) {
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{N}\p{M}_-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+}
+
+// Extensions returns the names of the enabled extensions, sorted
+func (r *Renderer) Extensions() []string {
+	return append([]string(nil), r.extensions...)
+}
+
+// Version identifies the renderer output format: the renderer version plus
+// the enabled extensions and embed hosts, so a configuration change yields
+// a new version
+func (r *Renderer) Version() string {
+	return RendererVersion + ":" + strings.Join(r.extensions, ",") + ":" + strings.Join(r.embedHosts, ",")
+}
+
+// PolicyFor returns the name of the sanitization policy applied to markdown
+// written by an author with the given role; unmapped roles, including the
+// empty role of anonymous authors, get the default policy
+func (r *Renderer) PolicyFor(role string) string {
+	if policy, ok := r.rolePolicies[role]; ok {
+		return policy
+	}
+	return r.defaultPolicy
+}
+
+// Render converts markdown to HTML and sanitizes it to prevent XSS
+func (r *Renderer) Render(markdown string) (string, error) {
+	return r.RenderWith(markdown, nil)
+}
+
+// RenderWith is like Render but lets transform rewrite the parsed document
+// before it is rendered
+func (r *Renderer) RenderWith(markdown string, transform func(doc ast.Node, source []byte)) (string, error) {
+	return r.RenderWithPolicy(markdown, r.defaultPolicy, transform)
+}
+
+// RenderWithPolicy is like RenderWith but sanitizes with the named policy
+// instead of the default one
+func (r *Renderer) RenderWithPolicy(markdown, policy string, transform func(doc ast.Node, source []byte)) (string, error) {
+	sanitizer, ok := r.policies[policy]
+	if !ok {
+		sanitizer = r.policies[r.defaultPolicy]
+	}
+
+	source := []byte(markdown)
+	doc := r.Parse(source)
+	if transform != nil {
+		transform(doc, source)
+	}
+
+	var buf bytes.Buffer
+	if err := r.markdown.Renderer().Render(&buf, source, doc); err != nil {
+		return "", err
+	}
+	return sanitizer.Sanitize(buf.String()), nil
+}
+
+// Parse parses markdown with the renderer's extensions, for callers such as
+// exporters that lay the document out themselves
+func (r *Renderer) Parse(source []byte) ast.Node {
+	// Heading IDs are generated per document so repeated headings in
+	// different documents do not affect each other
+	pc := parser.NewContext(parser.WithIDs(newHeadingIDs()))
+	return r.markdown.Parser().Parse(text.NewReader(source), parser.WithContext(pc))
+}
+
+var (
+	defaultRenderer     *Renderer
+	defaultRendererOnce sync.Once
+)
+
+// sharedDefaultRenderer returns a renderer built from the environment once
+func sharedDefaultRenderer() *Renderer {
+	defaultRendererOnce.Do(func() {
+		defaultRenderer = NewRenderer(DefaultRendererConfig())
+	})
+	return defaultRenderer
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderer_Extensions(t *testing.T) {
+	renderer := NewRenderer(&RendererConfig{Extensions: defaultExtensions})
+
+	tests := []struct {
+		name     string
+		markdown string
+		contains []string
+	}{
+		{
+			name:     "Table with alignment",
+			markdown: "| 항목 | 금액 |\n|:---|---:|\n| 항공료 | 300,000원 |",
+			contains: []string{"<table>", `<th align="left">항목</th>`, `<td align="right">300,000원</td>`},
+		},
+		{
+			name:     "Strikethrough",
+			markdown: "~~취소~~",
+			contains: []string{"<del>취소</del>"},
+		},
+		{
+			name:     "Autolink",
+			markdown: "See https://example.com",
+			contains: []string{`<a href="https://example.com" rel="nofollow noopener" target="_blank">https://example.com</a>`},
+		},
+		{
+			name:     "Footnote",
+			markdown: "Ferry[^1]\n\n[^1]: Book early",
+			contains: []string{`class="footnote-ref"`, `role="doc-noteref"`, `<div class="footnotes" role="doc-endnotes">`, `class="footnote-backref"`},
+		},
+		{
+			name:     "Definition list",
+			markdown: "Ferry\n: Leaves at 9",
+			contains: []string{"<dl>", "<dt>Ferry</dt>", "<dd>Leaves at 9</dd>"},
+		},
+		{
+			name:     "Typographer",
+			markdown: `"quoted" -- and...`,
+			contains: []string{"“quoted”", "–", "…"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := renderer.Render(tt.markdown)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			for _, expected := range tt.contains {
+				if !strings.Contains(html, expected) {
+					t.Errorf("Render() = %v, should contain %v", html, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderer_Config(t *testing.T) {
+	t.Setenv("MARKDOWN_EXTENSIONS", "table, FOOTNOTE,unknown")
+	renderer := NewRenderer(DefaultRendererConfig())
+
+	if got := strings.Join(renderer.Extensions(), ","); got != "footnote,table" {
+		t.Errorf("Extensions() = %s, want footnote,table", got)
+	}
+
+	html, _ := renderer.Render("~~kept~~ and [x]")
+	if strings.Contains(html, "<del>") {
+		t.Errorf("Render() = %v, strikethrough should be disabled", html)
+	}
+
+	t.Setenv("MARKDOWN_EXTENSIONS", "none")
+	if none := NewRenderer(DefaultRendererConfig()); len(none.Extensions()) != 0 || none.Version() == renderer.Version() {
+		t.Errorf("none renderer = %v (version %s)", none.Extensions(), none.Version())
+	}
+}
+
+func TestRenderer_Sanitize(t *testing.T) {
+	renderer := NewRenderer(&RendererConfig{Extensions: defaultExtensions})
+
+	html, err := renderer.Render("<div class=\"footnotes\" onclick=\"x()\">a</div>\n\n<a class=\"evil\" href=\"javascript:alert(1)\">b</a>")
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if strings.Contains(html, "onclick") || strings.Contains(html, "javascript:") || strings.Contains(html, "evil") {
+		t.Errorf("Render() = %v, should be sanitized", html)
+	}
+}
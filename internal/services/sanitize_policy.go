@@ -0,0 +1,148 @@
+package services
+
+import (
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// Sanitization policy names accepted in SANITIZE_POLICY and
+// SANITIZE_ROLE_POLICIES
+const (
+	PolicyStrict       = "strict"        // Markdown formatting only: no raw HTML elements, embeds or external images
+	PolicyUGC          = "ugc"           // Untrusted user content with allow-listed embeds
+	PolicyTrustedAdmin = "trusted-admin" // Content written by admins: adds classes and media
+)
+
+// sanitizePolicyNames lists every policy, in the order they are built
+var sanitizePolicyNames = []string{PolicyStrict, PolicyUGC, PolicyTrustedAdmin}
+
+// defaultRolePolicies is the role mapping used when SANITIZE_ROLE_POLICIES
+// is unset
+var defaultRolePolicies = map[string]string{"admin": PolicyTrustedAdmin}
+
+// isSanitizePolicy reports whether name is a known policy
+func isSanitizePolicy(name string) bool {
+	for _, policy := range sanitizePolicyNames {
+		if policy == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeConfigFromEnv fills the sanitization part of a renderer
+// configuration. SANITIZE_POLICY names the default policy,
+// SANITIZE_ROLE_POLICIES maps author roles to policies as
+// "admin=trusted-admin,guest=strict", and SANITIZE_EMBED_HOSTS lists the
+// hosts iframes may embed, such as "www.youtube-nocookie.com,player.vimeo.com".
+func sanitizeConfigFromEnv(config *RendererConfig) {
+	config.Policy = strings.ToLower(strings.TrimSpace(os.Getenv("SANITIZE_POLICY")))
+
+	config.RolePolicies = defaultRolePolicies
+	if value := strings.TrimSpace(os.Getenv("SANITIZE_ROLE_POLICIES")); value != "" {
+		config.RolePolicies = make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			role, policy, ok := strings.Cut(pair, "=")
+			if !ok {
+				continue
+			}
+			config.RolePolicies[strings.TrimSpace(role)] = strings.ToLower(strings.TrimSpace(policy))
+		}
+	}
+
+	for _, host := range strings.Split(os.Getenv("SANITIZE_EMBED_HOSTS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			config.EmbedHosts = append(config.EmbedHosts, host)
+		}
+	}
+}
+
+// normalizeEmbedHosts returns the valid, distinct embed hosts, sorted
+func normalizeEmbedHosts(hosts []string) []string {
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		// Only bare host names are accepted; anything with a scheme, path
+		// or port would widen the pattern built from it
+		if u, err := url.Parse("https://" + host); err != nil || u.Host != host || u.Port() != "" || host == "" {
+			continue
+		}
+		if !seen[host] {
+			seen[host] = true
+			normalized = append(normalized, host)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// newSanitizePolicy builds the named policy. Every policy adds
+// rel="nofollow noopener" and target="_blank" to external links.
+func newSanitizePolicy(name string, embedHosts []string) *bluemonday.Policy {
+	var p *bluemonday.Policy
+	switch name {
+	case PolicyStrict:
+		p = strictPolicy()
+	case PolicyTrustedAdmin:
+		p = bluemonday.UGCPolicy()
+		// Admins' own links are trusted, so only external ones get nofollow
+		p.RequireNoFollowOnLinks(false)
+		p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-zA-Z0-9_ -]+$`)).Globally()
+		p.AllowElements("video", "source")
+		p.AllowAttrs("src").Matching(regexp.MustCompile(`^/api/file/`)).OnElements("video", "source")
+		p.AllowAttrs("type").Matching(regexp.MustCompile(`^video/[a-z0-9.+-]+$`)).OnElements("source")
+		p.AllowAttrs("controls", "muted", "loop").OnElements("video")
+		allowEmbeds(p, embedHosts)
+	default:
+		p = bluemonday.UGCPolicy()
+		allowEmbeds(p, embedHosts)
+	}
+
+	p.RequireNoFollowOnFullyQualifiedLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	allowResponsiveImages(p)
+	allowHeadingIDs(p)
+	return p
+}
+
+// strictPolicy allows the elements markdown itself produces and nothing
+// else; images may only be files served by the API
+func strictPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowStandardURLs()
+	p.AllowElements("p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6",
+		"em", "strong", "del", "code", "pre", "blockquote", "sup",
+		"ul", "ol", "li", "dl", "dt", "dd",
+		"table", "thead", "tbody", "tr", "th", "td")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	p.AllowAttrs("src").Matching(regexp.MustCompile(`^/api/file/`)).OnElements("img")
+	p.AllowAttrs("alt", "title").OnElements("img")
+	p.AllowAttrs("width", "height").Matching(bluemonday.Integer).OnElements("img")
+	return p
+}
+
+// allowEmbeds lets iframes through when their source is an https URL on
+// one of the allow-listed hosts
+func allowEmbeds(p *bluemonday.Policy, hosts []string) {
+	if len(hosts) == 0 {
+		return
+	}
+	quoted := make([]string, len(hosts))
+	for i, host := range hosts {
+		quoted[i] = regexp.QuoteMeta(host)
+	}
+	p.AllowElements("iframe")
+	p.AllowAttrs("src").Matching(regexp.MustCompile(`^https://(` + strings.Join(quoted, "|") + `)/[^\s]*$`)).OnElements("iframe")
+	p.AllowAttrs("width", "height").Matching(bluemonday.Integer).OnElements("iframe")
+	p.AllowAttrs("title").OnElements("iframe")
+	p.AllowAttrs("allowfullscreen").OnElements("iframe")
+	p.AllowAttrs("loading").Matching(regexp.MustCompile(`^(lazy|eager)$`)).OnElements("iframe")
+}
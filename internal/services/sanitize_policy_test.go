@@ -0,0 +1,299 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// xssPayloads are known XSS vectors, written as markdown authors could
+// submit them
+var xssPayloads = []string{
+	`<script>alert(1)</script>`,
+	`<SCRIPT SRC=https://evil.example/xss.js></SCRIPT>`,
+	`<img src=x onerror=alert(1)>`,
+	`<img src="javascript:alert(1)">`,
+	`<img src=/api/file/a.png onload="alert(1)">`,
+	`<svg onload=alert(1)><circle r=1 /></svg>`,
+	`<svg><script>alert(1)</script></svg>`,
+	`<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`,
+	`<body onload=alert(1)>`,
+	`<iframe src="javascript:alert(1)"></iframe>`,
+	`<iframe src="https://evil.example/embed"></iframe>`,
+	`<iframe src="https://www.youtube-nocookie.com.evil.example/embed/x"></iframe>`,
+	`<iframe srcdoc="<script>alert(1)</script>" src="https://www.youtube-nocookie.com/embed/x"></iframe>`,
+	`<iframe src="//evil.example/embed"></iframe>`,
+	`<object data="javascript:alert(1)"></object>`,
+	`<embed src="javascript:alert(1)">`,
+	`<a href="javascript:alert(1)">click</a>`,
+	`<a href="JaVaScRiPt:alert(1)">click</a>`,
+	`<a href="jav&#x09;ascript:alert(1)">click</a>`,
+	`<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">click</a>`,
+	`<a href="vbscript:msgbox(1)">click</a>`,
+	`<a href="https://example.com" onmouseover="alert(1)">hover</a>`,
+	`[click](javascript:alert(1))`,
+	`[click](data:text/html,<script>alert(1)</script>)`,
+	`![img](javascript:alert(1))`,
+	`[ref][x]` + "\n\n" + `[x]: javascript:alert(1)`,
+	`<div style="background:url(javascript:alert(1))">styled</div>`,
+	`<p style="width: expression(alert(1))">styled</p>`,
+	`<form action="javascript:alert(1)"><button formaction="javascript:alert(1)">go</button></form>`,
+	`<input type="text" onfocus="alert(1)" autofocus>`,
+	`<input type="image" src="javascript:alert(1)">`,
+	`<base href="javascript:alert(1)//">`,
+	`<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`,
+	`<link rel="stylesheet" href="https://evil.example/x.css">`,
+	`<style>@import "https://evil.example/x.css";</style>`,
+	`<details open ontoggle=alert(1)>x</details>`,
+	`<video><source onerror="alert(1)"></video>`,
+	`<video src="https://evil.example/v.mp4" poster="javascript:alert(1)"></video>`,
+	`<a href="#" class="directive" onclick="alert(1)">x</a>`,
+	`<div class="footnotes" onclick="alert(1)">x</div>`,
+	`<img srcset="javascript:alert(1) 1w" src=/api/file/a.png>`,
+	`<noscript><p title="</noscript><img src=x onerror=alert(1)>">`,
+	`<!--<img src="--><img src=x onerror=alert(1)//">`,
+	"```\n</code><script>alert(1)</script>\n```",
+	":::place Beach\nmap: javascript:alert(1)\n:::",
+}
+
+// forbiddenElements must never survive sanitization
+var forbiddenElements = map[string]bool{
+	"script": true, "style": true, "object": true, "embed": true, "svg": true,
+	"math": true, "form": true, "button": true, "base": true, "meta": true,
+	"link": true, "frame": true, "frameset": true, "applet": true, "body": true,
+}
+
+func TestSanitizePolicies_XSSCorpus(t *testing.T) {
+	renderer := NewRenderer(&RendererConfig{
+		Extensions: defaultExtensions,
+		EmbedHosts: []string{"www.youtube-nocookie.com"},
+	})
+
+	for _, policy := range sanitizePolicyNames {
+		for _, payload := range xssPayloads {
+			output, err := renderer.RenderWithPolicy(payload, policy, nil)
+			if err != nil {
+				t.Fatalf("%s: Render(%q) error = %v", policy, payload, err)
+			}
+			if problem := unsafeHTML(t, output); problem != "" {
+				t.Errorf("%s: Render(%q) = %s: %s", policy, payload, output, problem)
+			}
+		}
+	}
+}
+
+// unsafeHTML parses sanitized output and describes the first element,
+// attribute or URL that could run script, or returns ""
+func unsafeHTML(t *testing.T, output string) string {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(output))
+	if err != nil {
+		t.Fatalf("html.Parse() error = %v", err)
+	}
+
+	var problem string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if problem != "" {
+			return
+		}
+		// html.Parse adds the document's own html, head and body
+		if n.Type == html.ElementNode && n.Parent != nil && n.Parent.Type != html.DocumentNode && n.Parent.Data != "html" {
+			if forbiddenElements[n.Data] {
+				problem = "element " + n.Data
+				return
+			}
+			for _, attr := range n.Attr {
+				key := strings.ToLower(attr.Key)
+				switch {
+				case strings.HasPrefix(key, "on"), key == "style", key == "srcdoc", key == "formaction", key == "poster":
+					problem = "attribute " + key
+				case key == "href" || key == "src" || key == "cite" || key == "action":
+					if !safeURL(attr.Val) {
+						problem = key + " " + attr.Val
+					}
+				case key == "srcset":
+					for _, candidate := range strings.Split(attr.Val, ",") {
+						if fields := strings.Fields(candidate); len(fields) > 0 && !safeURL(fields[0]) {
+							problem = "srcset " + attr.Val
+						}
+					}
+				case key == "type" && n.Data == "input" && attr.Val != "checkbox":
+					problem = "input type " + attr.Val
+				}
+				if n.Data == "iframe" && key == "src" && !strings.HasPrefix(attr.Val, "https://www.youtube-nocookie.com/") {
+					problem = "iframe src " + attr.Val
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	return problem
+}
+
+// safeURL reports whether a URL is relative or uses a scheme that cannot
+// run script
+func safeURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+func TestSanitizePolicies_Embeds(t *testing.T) {
+	renderer := NewRenderer(&RendererConfig{
+		Extensions: defaultExtensions,
+		EmbedHosts: []string{"www.youtube-nocookie.com", "https://bad.example/path", "player.vimeo.com"},
+	})
+	embed := `<iframe src="https://www.youtube-nocookie.com/embed/abc" width="560" height="315" allowfullscreen></iframe>`
+	other := `<iframe src="https://maps.example/embed"></iframe>`
+
+	tests := []struct {
+		policy    string
+		wantEmbed bool
+	}{
+		{PolicyStrict, false},
+		{PolicyUGC, true},
+		{PolicyTrustedAdmin, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			output, err := renderer.RenderWithPolicy(embed+"\n\n"+other, tt.policy, nil)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if got := strings.Contains(output, `src="https://www.youtube-nocookie.com/embed/abc"`); got != tt.wantEmbed {
+				t.Errorf("Render() = %s, embed kept = %v, want %v", output, got, tt.wantEmbed)
+			}
+			if strings.Contains(output, "maps.example") {
+				t.Errorf("Render() = %s, should drop embeds from other hosts", output)
+			}
+		})
+	}
+
+	if got := renderer.Version(); !strings.HasSuffix(got, ":player.vimeo.com,www.youtube-nocookie.com") {
+		t.Errorf("Version() = %s, should end with the valid embed hosts", got)
+	}
+}
+
+func TestSanitizePolicies_Links(t *testing.T) {
+	renderer := NewRenderer(&RendererConfig{Extensions: defaultExtensions})
+	markdown := "[out](https://example.com) and [in](/schedules/42)"
+
+	tests := []struct {
+		policy   string
+		contains []string
+	}{
+		{PolicyStrict, []string{
+			`<a href="https://example.com" rel="nofollow noopener" target="_blank">out</a>`,
+			`<a href="/schedules/42" rel="nofollow">in</a>`,
+		}},
+		{PolicyUGC, []string{
+			`<a href="https://example.com" rel="nofollow noopener" target="_blank">out</a>`,
+			`<a href="/schedules/42" rel="nofollow">in</a>`,
+		}},
+		{PolicyTrustedAdmin, []string{
+			`<a href="https://example.com" rel="nofollow noopener" target="_blank">out</a>`,
+			`<a href="/schedules/42">in</a>`,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			output, err := renderer.RenderWithPolicy(markdown, tt.policy, nil)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			for _, expected := range tt.contains {
+				if !strings.Contains(output, expected) {
+					t.Errorf("Render() = %v, should contain %v", output, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizePolicies_Strict(t *testing.T) {
+	renderer := NewRenderer(&RendererConfig{Extensions: defaultExtensions})
+	markdown := "<b>bold</b> ![local](/api/file/a.png) ![remote](https://example.com/b.png)\n\n" +
+		"- [x] passport\n\n| a |\n|--:|\n| 1 |"
+
+	output, err := renderer.RenderWithPolicy(markdown, PolicyStrict, nil)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	for _, expected := range []string{`<img src="/api/file/a.png" alt="local"`, `type="checkbox"`, `<td align="right">1</td>`, "bold"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Render() = %v, should contain %v", output, expected)
+		}
+	}
+	if strings.Contains(output, "<b>") || strings.Contains(output, "example.com/b.png") {
+		t.Errorf("Render() = %v, should drop raw tags and remote images", output)
+	}
+}
+
+func TestRenderer_PolicyFor(t *testing.T) {
+	t.Setenv("SANITIZE_POLICY", "Strict")
+	t.Setenv("SANITIZE_ROLE_POLICIES", "admin=trusted-admin, editor = ugc, guest=unknown")
+	renderer := NewRenderer(DefaultRendererConfig())
+
+	tests := map[string]string{
+		"admin":  PolicyTrustedAdmin,
+		"editor": PolicyUGC,
+		"guest":  PolicyStrict,
+		"":       PolicyStrict,
+	}
+	for role, want := range tests {
+		if got := renderer.PolicyFor(role); got != want {
+			t.Errorf("PolicyFor(%q) = %s, want %s", role, got, want)
+		}
+	}
+
+	t.Setenv("SANITIZE_POLICY", "")
+	t.Setenv("SANITIZE_ROLE_POLICIES", "")
+	renderer = NewRenderer(DefaultRendererConfig())
+	if got := renderer.PolicyFor("admin"); got != PolicyTrustedAdmin {
+		t.Errorf("PolicyFor(admin) = %s, want %s by default", got, PolicyTrustedAdmin)
+	}
+	if got := renderer.PolicyFor("user"); got != PolicyUGC {
+		t.Errorf("PolicyFor(user) = %s, want %s by default", got, PolicyUGC)
+	}
+}
+
+func TestProcessMarkdown_AuthorRole(t *testing.T) {
+	service := NewMarkdownServiceWithRenderer(nil, &RendererConfig{
+		Extensions:   defaultExtensions,
+		RolePolicies: map[string]string{"admin": PolicyTrustedAdmin},
+	})
+	service.SetRenderCache(NewRenderCache(8, nil))
+	markdown := `<p class="callout">Check in at 3pm</p>`
+
+	// The cached rendering for one policy must not be served for another
+	for _, tt := range []struct {
+		role      string
+		wantClass bool
+	}{
+		{"", false},
+		{"admin", true},
+		{"user", false},
+	} {
+		processed, err := service.ProcessMarkdownWithOptions(markdown, &ProcessOptions{AuthorRole: tt.role})
+		if err != nil {
+			t.Fatalf("ProcessMarkdownWithOptions() error = %v", err)
+		}
+		if got := strings.Contains(processed.HTMLContent, `class="callout"`); got != tt.wantClass {
+			t.Errorf("role %q: HTMLContent = %s, class kept = %v, want %v", tt.role, processed.HTMLContent, got, tt.wantClass)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"tripflow/internal/models"
+)
+
+// maxExactSettlementSize is the largest group settled with the exact
+// minimum-transfer search; bigger groups fall back to greedy matching
+const maxExactSettlementSize = 16
+
+// LedgerParticipant identifies someone in the expense ledger
+type LedgerParticipant struct {
+	Key       string `json:"key"`
+	UserID    string `json:"user_id,omitempty"`
+	GuestName string `json:"guest_name,omitempty"`
+}
+
+// ParticipantBalance is what one participant paid, owes and nets out to
+type ParticipantBalance struct {
+	Participant LedgerParticipant `json:"participant"`
+	Paid        Money             `json:"paid"`
+	Owed        Money             `json:"owed"`
+	Net         Money             `json:"net"` // Positive means the participant should receive money
+}
+
+// Transfer is a single payment needed to settle up
+type Transfer struct {
+	From   LedgerParticipant `json:"from"`
+	To     LedgerParticipant `json:"to"`
+	Amount Money             `json:"amount"`
+}
+
+// Settlement holds the balances and transfers for one currency
+type Settlement struct {
+	Currency  string               `json:"currency"`
+	Balances  []ParticipantBalance `json:"balances"`
+	Transfers []Transfer           `json:"transfers"`
+}
+
+// ExpenseIssue describes an expense that was left out of a settlement
+type ExpenseIssue struct {
+	ExpenseID string `json:"expense_id"`
+	Message   string `json:"message"`
+}
+
+// ValidateExpense checks an expense's split rule, participants and shares
+func ValidateExpense(expense *models.Expense) error {
+	if _, ok := LookupCurrency(expense.Currency); !ok {
+		return fmt.Errorf("unsupported currency: %s", expense.Currency)
+	}
+	if expense.Amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	if expense.PayerUserID == "" && strings.TrimSpace(expense.PayerGuestName) == "" {
+		return fmt.Errorf("payer must have a user ID or guest name")
+	}
+	if len(expense.Participants) == 0 {
+		return fmt.Errorf("at least one participant is required")
+	}
+
+	seen := make(map[string]bool)
+	var total int64
+	for _, p := range expense.Participants {
+		if p.UserID == "" && strings.TrimSpace(p.GuestName) == "" {
+			return fmt.Errorf("each participant needs a user ID or guest name")
+		}
+		if seen[p.Key()] {
+			return fmt.Errorf("participant listed twice: %s", p.Key())
+		}
+		seen[p.Key()] = true
+
+		if expense.SplitRule != models.SplitEqual && p.Share <= 0 {
+			return fmt.Errorf("participant %s needs a positive share", p.Key())
+		}
+		total += p.Share
+	}
+
+	switch expense.SplitRule {
+	case models.SplitEqual, models.SplitShares:
+	case models.SplitExact:
+		if total != expense.Amount {
+			return fmt.Errorf("exact shares add up to %s, expected %s",
+				Money{total, expense.Currency}, Money{expense.Amount, expense.Currency})
+		}
+	case models.SplitPercent:
+		if total != 10000 {
+			return fmt.Errorf("percentages add up to %.2f%%, expected 100%%", float64(total)/100)
+		}
+	default:
+		return fmt.Errorf("unknown split rule: %s", expense.SplitRule)
+	}
+
+	return nil
+}
+
+// SplitExpense divides amount (the expense amount, possibly converted into
+// another currency) between the participants according to the split rule.
+// Rounding leftovers go to the participants with the largest remainders so
+// the parts always add up to amount. Returns one part per participant.
+func SplitExpense(expense *models.Expense, amount int64) []int64 {
+	weights := make([]int64, len(expense.Participants))
+	for i, p := range expense.Participants {
+		if expense.SplitRule == models.SplitEqual {
+			weights[i] = 1
+		} else {
+			weights[i] = p.Share
+		}
+	}
+	return allocate(amount, weights)
+}
+
+// allocate splits amount proportionally to weights using the largest
+// remainder method
+func allocate(amount int64, weights []int64) []int64 {
+	parts := make([]int64, len(weights))
+	var totalWeight int64
+	for _, w := range weights {
+		totalWeight += w
+	}
+	if totalWeight == 0 {
+		return parts
+	}
+
+	sign := int64(1)
+	if amount < 0 {
+		sign, amount = -1, -amount
+	}
+
+	remainders := make([]int64, len(weights))
+	var assigned int64
+	for i, w := range weights {
+		parts[i] = amount * w / totalWeight
+		remainders[i] = amount * w % totalWeight
+		assigned += parts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := 0; assigned < amount; i++ {
+		parts[order[i%len(order)]]++
+		assigned++
+	}
+
+	for i := range parts {
+		parts[i] *= sign
+	}
+	return parts
+}
+
+// SettleUp computes balances and the fewest transfers that settle every
+// expense. With an empty currency each currency is settled separately;
+// otherwise every expense is converted into that currency at the rate for
+// its spending date, and expenses that cannot be converted are reported.
+func SettleUp(expenses []*models.Expense, converter *CurrencyConverter, currency string) ([]Settlement, []ExpenseIssue) {
+	type ledger struct {
+		paid map[string]int64
+		owed map[string]int64
+	}
+	ledgers := make(map[string]*ledger)
+	participants := make(map[string]LedgerParticipant)
+	var currencies []string
+	var issues []ExpenseIssue
+
+	for _, expense := range expenses {
+		amount := Money{Amount: expense.Amount, Currency: expense.Currency}
+		if currency != "" {
+			converted, _, err := converter.Convert(amount, currency, expense.SpentAt)
+			if err != nil {
+				issues = append(issues, ExpenseIssue{ExpenseID: expense.ID.String(), Message: err.Error()})
+				continue
+			}
+			amount = converted
+		}
+
+		l, ok := ledgers[amount.Currency]
+		if !ok {
+			l = &ledger{paid: make(map[string]int64), owed: make(map[string]int64)}
+			ledgers[amount.Currency] = l
+			currencies = append(currencies, amount.Currency)
+		}
+
+		payer := expense.PayerKey()
+		participants[payer] = LedgerParticipant{Key: payer, UserID: expense.PayerUserID, GuestName: expense.PayerGuestName}
+		l.paid[payer] += amount.Amount
+
+		parts := SplitExpense(expense, amount.Amount)
+		for i, p := range expense.Participants {
+			key := p.Key()
+			if _, ok := participants[key]; !ok {
+				participants[key] = LedgerParticipant{Key: key, UserID: p.UserID, GuestName: p.GuestName}
+			}
+			l.owed[key] += parts[i]
+		}
+	}
+
+	sort.Strings(currencies)
+	settlements := make([]Settlement, 0, len(currencies))
+	for _, code := range currencies {
+		l := ledgers[code]
+
+		var keys []string
+		for key := range participants {
+			if _, paid := l.paid[key]; paid {
+				keys = append(keys, key)
+			} else if _, owes := l.owed[key]; owes {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		settlement := Settlement{Currency: code, Balances: make([]ParticipantBalance, 0, len(keys))}
+		nets := make([]int64, len(keys))
+		for i, key := range keys {
+			nets[i] = l.paid[key] - l.owed[key]
+			settlement.Balances = append(settlement.Balances, ParticipantBalance{
+				Participant: participants[key],
+				Paid:        Money{l.paid[key], code},
+				Owed:        Money{l.owed[key], code},
+				Net:         Money{nets[i], code},
+			})
+		}
+
+		settlement.Transfers = make([]Transfer, 0)
+		for _, t := range minimizeTransfers(nets) {
+			settlement.Transfers = append(settlement.Transfers, Transfer{
+				From:   participants[keys[t.from]],
+				To:     participants[keys[t.to]],
+				Amount: Money{t.amount, code},
+			})
+		}
+		settlements = append(settlements, settlement)
+	}
+
+	return settlements, issues
+}
+
+// indexTransfer is a transfer between positions in a balance slice
+type indexTransfer struct {
+	from, to int
+	amount   int64
+}
+
+// minimizeTransfers returns transfers that bring every balance to zero.
+// A group of k people whose balances sum to zero can always be settled with
+// k-1 transfers, so the fewest transfers overall comes from splitting people
+// into as many zero-sum groups as possible; that is found exactly with a
+// subset search for small groups and approximated greedily otherwise.
+func minimizeTransfers(balances []int64) []indexTransfer {
+	var active []int
+	for i, b := range balances {
+		if b != 0 {
+			active = append(active, i)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+	if len(active) > maxExactSettlementSize {
+		return settleGreedy(balances, active)
+	}
+
+	n := len(active)
+	full := 1<<n - 1
+	sums := make([]int64, full+1)
+	best := make([]int, full+1)
+	for mask := 1; mask <= full; mask++ {
+		low := mask & -mask
+		bit := 0
+		for 1<<bit != low {
+			bit++
+		}
+		sums[mask] = sums[mask^low] + balances[active[bit]]
+
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && best[mask^(1<<i)] > best[mask] {
+				best[mask] = best[mask^(1<<i)]
+			}
+		}
+		if sums[mask] == 0 {
+			best[mask]++
+		}
+	}
+
+	// Walk back from the full set, cutting a group at every zero-sum subset
+	var transfers []indexTransfer
+	groupStart := full
+	mask := full
+	for mask != 0 {
+		target := best[mask]
+		if sums[mask] == 0 {
+			target--
+		}
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && best[mask^(1<<i)] == target {
+				mask ^= 1 << i
+				break
+			}
+		}
+
+		if sums[mask] == 0 {
+			var group []int
+			for i := 0; i < n; i++ {
+				if (groupStart^mask)&(1<<i) != 0 {
+					group = append(group, active[i])
+				}
+			}
+			transfers = append(transfers, settleGreedy(balances, group)...)
+			groupStart = mask
+		}
+	}
+
+	return transfers
+}
+
+// settleGreedy settles a zero-sum group by repeatedly paying the largest
+// creditor from the largest debtor
+func settleGreedy(balances []int64, group []int) []indexTransfer {
+	remaining := make(map[int]int64, len(group))
+	for _, i := range group {
+		remaining[i] = balances[i]
+	}
+
+	var transfers []indexTransfer
+	for {
+		creditor, debtor := -1, -1
+		for _, i := range group {
+			if remaining[i] > 0 && (creditor < 0 || remaining[i] > remaining[creditor]) {
+				creditor = i
+			}
+			if remaining[i] < 0 && (debtor < 0 || remaining[i] < remaining[debtor]) {
+				debtor = i
+			}
+		}
+		if creditor < 0 || debtor < 0 {
+			return transfers
+		}
+
+		amount := remaining[creditor]
+		if -remaining[debtor] < amount {
+			amount = -remaining[debtor]
+		}
+		transfers = append(transfers, indexTransfer{from: debtor, to: creditor, amount: amount})
+		remaining[creditor] -= amount
+		remaining[debtor] += amount
+	}
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"tripflow/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// newTestExpense builds an expense paid by payer and split between guests
+func newTestExpense(payer string, amount int64, currency, rule string, shares map[string]int64, guests ...string) *models.Expense {
+	expense := &models.Expense{
+		ID:             uuid.New(),
+		Amount:         amount,
+		Currency:       currency,
+		PayerGuestName: payer,
+		SplitRule:      rule,
+		SpentAt:        time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	for _, guest := range guests {
+		expense.Participants = append(expense.Participants, models.ExpenseParticipant{GuestName: guest, Share: shares[guest]})
+	}
+	return expense
+}
+
+func TestSplitExpense(t *testing.T) {
+	tests := []struct {
+		name    string
+		expense *models.Expense
+		want    []int64
+	}{
+		{
+			name:    "Equal with remainder",
+			expense: newTestExpense("a", 1000, "KRW", models.SplitEqual, nil, "a", "b", "c"),
+			want:    []int64{334, 333, 333},
+		},
+		{
+			name:    "Shares",
+			expense: newTestExpense("a", 1000, "USD", models.SplitShares, map[string]int64{"a": 1, "b": 3}, "a", "b"),
+			want:    []int64{250, 750},
+		},
+		{
+			name:    "Percent",
+			expense: newTestExpense("a", 999, "USD", models.SplitPercent, map[string]int64{"a": 3333, "b": 6667}, "a", "b"),
+			want:    []int64{333, 666},
+		},
+		{
+			name:    "Exact",
+			expense: newTestExpense("a", 700, "USD", models.SplitExact, map[string]int64{"a": 200, "b": 500}, "a", "b"),
+			want:    []int64{200, 500},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateExpense(tt.expense); err != nil {
+				t.Fatalf("ValidateExpense() error = %v", err)
+			}
+			got := SplitExpense(tt.expense, tt.expense.Amount)
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("SplitExpense() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestValidateExpense(t *testing.T) {
+	tests := []struct {
+		name    string
+		expense *models.Expense
+	}{
+		{"No participants", newTestExpense("a", 100, "KRW", models.SplitEqual, nil)},
+		{"Duplicate participant", newTestExpense("a", 100, "KRW", models.SplitEqual, nil, "a", "A")},
+		{"Exact does not add up", newTestExpense("a", 100, "KRW", models.SplitExact, map[string]int64{"a": 10, "b": 20}, "a", "b")},
+		{"Percent does not add up", newTestExpense("a", 100, "KRW", models.SplitPercent, map[string]int64{"a": 5000, "b": 4000}, "a", "b")},
+		{"Unknown rule", newTestExpense("a", 100, "KRW", "random", map[string]int64{"a": 1}, "a")},
+		{"Unsupported currency", newTestExpense("a", 100, "GBP", models.SplitEqual, nil, "a")},
+		{"No payer", newTestExpense("", 100, "KRW", models.SplitEqual, nil, "a")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateExpense(tt.expense); err == nil {
+				t.Errorf("ValidateExpense() expected error")
+			}
+		})
+	}
+}
+
+func TestSettleUp(t *testing.T) {
+	expenses := []*models.Expense{
+		newTestExpense("alice", 30000, "KRW", models.SplitEqual, nil, "alice", "bob", "carol"),
+		newTestExpense("bob", 6000, "KRW", models.SplitEqual, nil, "bob", "carol"),
+		newTestExpense("carol", 2000, "USD", models.SplitEqual, nil, "alice", "carol"),
+	}
+
+	settlements, issues := SettleUp(expenses, nil, "")
+	if len(issues) != 0 {
+		t.Fatalf("SettleUp() issues = %v", issues)
+	}
+	if len(settlements) != 2 || settlements[0].Currency != "KRW" || settlements[1].Currency != "USD" {
+		t.Fatalf("SettleUp() = %+v, want KRW and USD settlements", settlements)
+	}
+
+	// alice +20000, bob -7000, carol -13000
+	krw := settlements[0]
+	if len(krw.Transfers) != 2 {
+		t.Fatalf("KRW transfers = %+v, want 2", krw.Transfers)
+	}
+	received := map[string]int64{}
+	for _, transfer := range krw.Transfers {
+		received[transfer.To.Key] += transfer.Amount.Amount
+		received[transfer.From.Key] -= transfer.Amount.Amount
+	}
+	if received["guest:alice"] != 20000 || received["guest:bob"] != -7000 || received["guest:carol"] != -13000 {
+		t.Errorf("KRW transfers = %+v", krw.Transfers)
+	}
+
+	usd := settlements[1]
+	if len(usd.Transfers) != 1 || usd.Transfers[0].From.Key != "guest:alice" || usd.Transfers[0].Amount.Amount != 1000 {
+		t.Errorf("USD transfers = %+v", usd.Transfers)
+	}
+
+	// Converting without rates reports every foreign-currency expense
+	_, issues = SettleUp(expenses, NewCurrencyConverter(memoryRates{}), "KRW")
+	if len(issues) != 1 {
+		t.Errorf("SettleUp() with missing rates issues = %v, want 1", issues)
+	}
+}
+
+func TestMinimizeTransfers(t *testing.T) {
+	// Greedy matching needs 4 transfers here; {+3,-3} and {+2,+2,-4} need 3
+	balances := []int64{2, 2, 3, -3, -4}
+
+	if greedy := settleGreedy(balances, []int{0, 1, 2, 3, 4}); len(greedy) != 4 {
+		t.Fatalf("settleGreedy() = %d transfers, expected 4 for this fixture", len(greedy))
+	}
+
+	transfers := minimizeTransfers(balances)
+	if len(transfers) != 3 {
+		t.Errorf("minimizeTransfers() = %+v, want 3 transfers", transfers)
+	}
+
+	remaining := append([]int64(nil), balances...)
+	for _, transfer := range transfers {
+		remaining[transfer.from] += transfer.amount
+		remaining[transfer.to] -= transfer.amount
+	}
+	for i, r := range remaining {
+		if r != 0 {
+			t.Errorf("balance %d not settled: %d", i, r)
+		}
+	}
+
+	if transfers := minimizeTransfers([]int64{0, 0}); len(transfers) != 0 {
+		t.Errorf("minimizeTransfers() on settled balances = %+v", transfers)
+	}
+}
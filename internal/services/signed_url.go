@@ -0,0 +1,176 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"tripflow/internal/auth"
+)
+
+// Query parameters of a signed file URL
+const (
+	signedURLExpires   = "expires"
+	signedURLSignature = "signature"
+	signedURLBound     = "ip_bound"
+)
+
+// defaultSignedURLTTL is how long signed URLs stay valid when neither the
+// request nor FILE_URL_TTL sets a lifetime
+const defaultSignedURLTTL = time.Hour
+
+// maxSignedURLTTL is the longest lifetime a signed URL can be given
+const maxSignedURLTTL = 7 * 24 * time.Hour
+
+var (
+	// ErrSignatureExpired is returned for a signed URL past its expiry
+	ErrSignatureExpired = errors.New("signed URL has expired")
+
+	// ErrSignatureInvalid is returned for a missing, malformed or forged
+	// signature, or one bound to another client IP
+	ErrSignatureInvalid = errors.New("invalid URL signature")
+)
+
+// SignedURL is a file URL that grants access until it expires
+type SignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	BoundIP   string    `json:"bound_ip,omitempty"`
+}
+
+// FileURLSigner signs and verifies file URLs with HMAC-SHA256. A signature
+// covers the storage path, the expiry and, for URLs bound to a client, the
+// client's IP, so a URL can be embedded where the viewer cannot send
+// credentials without exposing any other file.
+type FileURLSigner struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewFileURLSigner creates a FileURLSigner issuing URLs valid for ttl by
+// default
+func NewFileURLSigner(secret []byte, ttl time.Duration) *FileURLSigner {
+	if ttl <= 0 || ttl > maxSignedURLTTL {
+		ttl = defaultSignedURLTTL
+	}
+	return &FileURLSigner{
+		secret: secret,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// DefaultFileURLSigner creates a FileURLSigner keyed with FILE_URL_SECRET
+// and valid for FILE_URL_TTL, a Go duration defaulting to 1 hour. Without
+// FILE_URL_SECRET the key is derived from the JWT secret, so every
+// instance verifies the URLs the others sign.
+func DefaultFileURLSigner() *FileURLSigner {
+	secret := []byte(os.Getenv("FILE_URL_SECRET"))
+	if len(secret) == 0 {
+		mac := hmac.New(sha256.New, []byte(auth.LoadJWTSecret()))
+		mac.Write([]byte("tripflow file URLs"))
+		secret = mac.Sum(nil)
+	}
+
+	ttl := defaultSignedURLTTL
+	if value := os.Getenv("FILE_URL_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > maxSignedURLTTL {
+			log.Printf("Invalid FILE_URL_TTL %q, using %s", value, ttl)
+		} else {
+			ttl = parsed
+		}
+	}
+	return NewFileURLSigner(secret, ttl)
+}
+
+// Sign returns a URL for the file stored at filePath that is valid for ttl,
+// or the default lifetime when ttl is 0. When clientIP is set the URL only
+// works for requests from that IP.
+func (s *FileURLSigner) Sign(filePath string, ttl time.Duration, clientIP string) (*SignedURL, error) {
+	if ttl == 0 {
+		ttl = s.ttl
+	}
+	if ttl < 0 || ttl > maxSignedURLTTL {
+		return nil, fmt.Errorf("signed URL lifetime must be between 1s and %s", maxSignedURLTTL)
+	}
+
+	return s.signUntil(filePath, s.now().Add(ttl).Truncate(time.Second), clientIP), nil
+}
+
+// SignEmbedded returns a URL for the file stored at filePath to embed in
+// rendered HTML. The expiry is rounded so the URL stays the same for a
+// whole default lifetime, which keeps renderings embedding it cacheable,
+// and the URL stays valid for at least one default lifetime after that.
+func (s *FileURLSigner) SignEmbedded(filePath string) string {
+	expiresAt := s.now().Truncate(s.ttl).Add(2 * s.ttl)
+	return s.signUntil(filePath, expiresAt, "").URL
+}
+
+// signUntil returns a URL for the file stored at filePath valid until
+// expiresAt, bound to clientIP when it is set
+func (s *FileURLSigner) signUntil(filePath string, expiresAt time.Time, clientIP string) *SignedURL {
+	filePath = strings.TrimPrefix(filePath, "/")
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	query := url.Values{}
+	query.Set(signedURLExpires, expires)
+	if clientIP != "" {
+		query.Set(signedURLBound, "1")
+	}
+	query.Set(signedURLSignature, s.signature(filePath, expires, clientIP))
+
+	return &SignedURL{
+		URL:       FileURL(filePath) + "?" + query.Encode(),
+		ExpiresAt: expiresAt,
+		BoundIP:   clientIP,
+	}
+}
+
+// IsSigned reports whether a request's query carries a signature
+func IsSigned(query url.Values) bool {
+	return query.Has(signedURLSignature)
+}
+
+// Verify checks the signature in a request's query for the file stored at
+// filePath, requested from clientIP
+func (s *FileURLSigner) Verify(filePath string, query url.Values, clientIP string) error {
+	filePath = strings.TrimPrefix(filePath, "/")
+	expires := query.Get(signedURLExpires)
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+
+	boundIP := ""
+	if query.Get(signedURLBound) == "1" {
+		boundIP = clientIP
+	}
+	want := s.signature(filePath, expires, boundIP)
+	if !hmac.Equal([]byte(query.Get(signedURLSignature)), []byte(want)) {
+		return ErrSignatureInvalid
+	}
+
+	// Checked after the signature so a forged expiry is never reported as
+	// merely expired
+	if !s.now().Before(time.Unix(expiresAt, 0)) {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+// signature returns the base64url HMAC of a path, expiry and bound IP
+func (s *FileURLSigner) signature(filePath, expires, clientIP string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(filePath + "\n" + expires + "\n" + clientIP))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSigner(now *time.Time) *FileURLSigner {
+	signer := NewFileURLSigner([]byte("test secret"), time.Hour)
+	signer.now = func() time.Time { return *now }
+	return signer
+}
+
+// signedQuery signs filePath and returns the query of the signed URL
+func signedQuery(t *testing.T, signer *FileURLSigner, filePath string, ttl time.Duration, clientIP string) url.Values {
+	t.Helper()
+	signed, err := signer.Sign(filePath, ttl, clientIP)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	parsed, err := url.Parse(signed.URL)
+	if err != nil {
+		t.Fatalf("Sign() returned invalid URL %q", signed.URL)
+	}
+	return parsed.Query()
+}
+
+func TestFileURLSigner_Sign(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	signer := newTestSigner(&now)
+
+	signed, err := signer.Sign("/uploads/제주 일정.md", 0, "")
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if !strings.HasPrefix(signed.URL, "/api/file/uploads/%EC%A0%9C%EC%A3%BC%20%EC%9D%BC%EC%A0%95.md?") {
+		t.Errorf("Sign() URL = %s", signed.URL)
+	}
+	if !signed.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Sign() expires at %s, want the default lifetime", signed.ExpiresAt)
+	}
+
+	for _, ttl := range []time.Duration{-time.Second, 8 * 24 * time.Hour} {
+		if _, err := signer.Sign("uploads/a.md", ttl, ""); err == nil {
+			t.Errorf("Sign() with lifetime %s should fail", ttl)
+		}
+	}
+}
+
+func TestFileURLSigner_SignEmbedded(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 10, 0, 0, time.UTC)
+	signer := newTestSigner(&now)
+
+	embedded := signer.SignEmbedded("uploads/a.png")
+	parsed, err := url.Parse(embedded)
+	if err != nil || parsed.Path != "/api/file/uploads/a.png" {
+		t.Fatalf("SignEmbedded() = %s", embedded)
+	}
+	if err := signer.Verify("uploads/a.png", parsed.Query(), ""); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	// The URL stays the same within the hour, so renderings can be cached
+	now = now.Add(40 * time.Minute)
+	if again := signer.SignEmbedded("uploads/a.png"); again != embedded {
+		t.Errorf("SignEmbedded() = %s, want %s", again, embedded)
+	}
+	now = now.Add(10 * time.Minute)
+	if again := signer.SignEmbedded("uploads/a.png"); again == embedded {
+		t.Errorf("SignEmbedded() should change in the next hour")
+	}
+
+	// And is valid for at least an hour after the last time it was issued
+	now = now.Add(59*time.Minute + 59*time.Second)
+	if err := signer.Verify("uploads/a.png", parsed.Query(), ""); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := signer.Verify("uploads/a.png", parsed.Query(), ""); !errors.Is(err, ErrSignatureExpired) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrSignatureExpired)
+	}
+}
+
+func TestFileURLSigner_Verify(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	signer := newTestSigner(&now)
+	query := signedQuery(t, signer, "uploads/a.md", 10*time.Minute, "")
+	bound := signedQuery(t, signer, "uploads/a.md", 10*time.Minute, "203.0.113.7")
+
+	tampered := url.Values{}
+	for key, values := range query {
+		tampered[key] = values
+	}
+	tampered.Set(signedURLExpires, "9999999999")
+	unbound := url.Values{}
+	for key, values := range bound {
+		unbound[key] = values
+	}
+	unbound.Del(signedURLBound)
+
+	tests := []struct {
+		name     string
+		filePath string
+		query    url.Values
+		clientIP string
+		want     error
+	}{
+		{"valid", "uploads/a.md", query, "198.51.100.1", nil},
+		{"leading slash", "/uploads/a.md", query, "", nil},
+		{"other file", "uploads/b.md", query, "", ErrSignatureInvalid},
+		{"extended expiry", "uploads/a.md", tampered, "", ErrSignatureInvalid},
+		{"unsigned", "uploads/a.md", url.Values{}, "", ErrSignatureInvalid},
+		{"bound to client", "uploads/a.md", bound, "203.0.113.7", nil},
+		{"bound to other client", "uploads/a.md", bound, "198.51.100.1", ErrSignatureInvalid},
+		{"binding removed", "uploads/a.md", unbound, "203.0.113.7", ErrSignatureInvalid},
+	}
+	for _, tt := range tests {
+		if err := signer.Verify(tt.filePath, tt.query, tt.clientIP); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Verify() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	now = now.Add(10 * time.Minute)
+	if err := signer.Verify("uploads/a.md", query, ""); !errors.Is(err, ErrSignatureExpired) {
+		t.Errorf("Verify() at expiry error = %v, want ErrSignatureExpired", err)
+	}
+
+	other := NewFileURLSigner([]byte("other secret"), time.Hour)
+	other.now = signer.now
+	if err := other.Verify("uploads/a.md", query, ""); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("Verify() with another key error = %v, want ErrSignatureInvalid", err)
+	}
+}
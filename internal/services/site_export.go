@@ -0,0 +1,433 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"tripflow/internal/models"
+	"tripflow/pkg/filestorage"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Paths inside a site export bundle
+const (
+	siteIndexFile    = "index.html"
+	siteMarkdownFile = "schedule.md"
+	siteMetadataFile = "metadata.json"
+	siteImagesDir    = "images/"
+	siteFilesDir     = "files/"
+)
+
+// SiteMetadata describes an exported schedule in metadata.json
+type SiteMetadata struct {
+	ID              string         `json:"id"`
+	Title           string         `json:"title"`
+	Description     string         `json:"description"`
+	StartDate       *time.Time     `json:"start_date,omitempty"`
+	EndDate         *time.Time     `json:"end_date,omitempty"`
+	HomeCurrency    string         `json:"home_currency,omitempty"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	ExportedAt      time.Time      `json:"exported_at"`
+	RendererVersion string         `json:"renderer_version"`
+	TOC             []*TOCEntry    `json:"toc,omitempty"`
+	Budget          *BudgetSummary `json:"budget,omitempty"`
+	Files           []SiteFile     `json:"files"`
+}
+
+// SiteFile is an uploaded file included in a site export bundle
+type SiteFile struct {
+	Path     string `json:"path"` // Path inside the bundle
+	Filename string `json:"filename"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+}
+
+// SiteExporter bundles a schedule as a static site that works offline
+type SiteExporter struct {
+	markdownService *MarkdownService // Renders with images resolved
+	images          *ImageResolver
+	storage         filestorage.FileStorageService
+}
+
+// NewSiteExporter creates a SiteExporter
+func NewSiteExporter(storage filestorage.FileStorageService, images *ImageResolver) *SiteExporter {
+	markdownService := NewMarkdownService(storage)
+	markdownService.SetImageResolver(images)
+	return &SiteExporter{
+		markdownService: markdownService,
+		images:          images,
+		storage:         storage,
+	}
+}
+
+// Export writes doc as a zip containing index.html with inlined CSS, the
+// images and files it references, the original markdown and metadata.json.
+// Links are rewritten to point inside the bundle; site-absolute links are
+// resolved against baseURL, the origin the schedule was exported from.
+func (e *SiteExporter) Export(w io.Writer, doc *ScheduleExport, baseURL string) error {
+	processed, err := e.markdownService.ProcessMarkdownWithOptions(doc.Markdown, &ProcessOptions{
+		TOC:          true,
+		ImageOwnerID: doc.ImageOwnerID,
+		AuthorRole:   doc.AuthorRole,
+	})
+	if err != nil {
+		return err
+	}
+
+	bundle := newSiteBundle(e.storage, e.images, doc.ImageOwnerID, baseURL)
+	body, err := bundle.rewriteLinks(processed.HTMLContent)
+	if err != nil {
+		return fmt.Errorf("failed to rewrite links: %w", err)
+	}
+
+	var index bytes.Buffer
+	err = siteTemplate.Execute(&index, map[string]any{
+		"Title":       doc.Title,
+		"Description": doc.Description,
+		"Dates":       formatTripDates(doc.StartDate, doc.EndDate),
+		"CSS":         template.CSS(siteCSS),
+		"Body":        template.HTML(body),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render index.html: %w", err)
+	}
+
+	metadata, err := json.MarshalIndent(&SiteMetadata{
+		ID:              doc.ID.String(),
+		Title:           doc.Title,
+		Description:     doc.Description,
+		StartDate:       doc.StartDate,
+		EndDate:         doc.EndDate,
+		HomeCurrency:    doc.HomeCurrency,
+		UpdatedAt:       doc.UpdatedAt,
+		ExportedAt:      time.Now().UTC(),
+		RendererVersion: e.markdownService.getRenderer().Version(),
+		TOC:             processed.TOC,
+		Budget:          doc.Budget,
+		Files:           bundle.files,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	modified := doc.UpdatedAt
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+	archive := zip.NewWriter(w)
+	entries := []struct {
+		name string
+		data []byte
+	}{
+		{siteIndexFile, index.Bytes()},
+		{siteMarkdownFile, []byte(doc.Markdown)},
+		{siteMetadataFile, metadata},
+	}
+	for _, entry := range entries {
+		if err := writeZipEntry(archive, entry.name, entry.data, modified, zip.Deflate); err != nil {
+			return err
+		}
+	}
+	for i, file := range bundle.files {
+		method := zip.Deflate
+		if strings.HasPrefix(file.MimeType, "image/") {
+			// Image formats are already compressed
+			method = zip.Store
+		}
+		if err := writeZipEntry(archive, file.Path, bundle.data[i], modified, method); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// writeZipEntry adds one file to a zip archive
+func writeZipEntry(archive *zip.Writer, name string, data []byte, modified time.Time, method uint16) error {
+	writer, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: modified,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+// siteBundle collects the stored files a page links to while its links are
+// rewritten
+type siteBundle struct {
+	storage filestorage.FileStorageService
+	images  *ImageResolver
+	ownerID uuid.UUID
+	baseURL string
+
+	files []SiteFile
+	data  [][]byte
+	paths map[string]string // Storage path to path inside the bundle
+	used  map[string]bool   // Bundle paths taken
+}
+
+// newSiteBundle creates an empty siteBundle. Site-absolute links are
+// resolved against baseURL.
+func newSiteBundle(storage filestorage.FileStorageService, images *ImageResolver, ownerID uuid.UUID, baseURL string) *siteBundle {
+	return &siteBundle{
+		storage: storage,
+		images:  images,
+		ownerID: ownerID,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		paths:   make(map[string]string),
+		used:    make(map[string]bool),
+	}
+}
+
+// parseHTMLFragment parses rendered HTML as the content of a body element
+func parseHTMLFragment(fragment string) ([]*html.Node, error) {
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	return html.ParseFragment(strings.NewReader(fragment), context)
+}
+
+// rewriteLinks rewrites image sources and links in rendered HTML so they
+// work from disk. Responsive variants are not bundled, so srcset and sizes
+// are dropped.
+func (b *siteBundle) rewriteLinks(fragment string) (string, error) {
+	nodes, err := parseHTMLFragment(fragment)
+	if err != nil {
+		return "", err
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Img:
+				b.rewriteImage(n)
+			case atom.A:
+				b.rewriteAnchor(n)
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+
+	var out strings.Builder
+	for _, node := range nodes {
+		walk(node)
+		if err := html.Render(&out, node); err != nil {
+			return "", err
+		}
+	}
+	return out.String(), nil
+}
+
+// rewriteImage points an uploaded image at its bundled copy
+func (b *siteBundle) rewriteImage(n *html.Node) {
+	attrs := n.Attr[:0]
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "srcset", "sizes":
+			continue
+		case "src":
+			if storagePath, ok := fileURLPath(attr.Val); ok {
+				if local, ok := b.include(storagePath, siteImagesDir); ok {
+					attr.Val = local
+				}
+			}
+		}
+		attrs = append(attrs, attr)
+	}
+	n.Attr = attrs
+}
+
+// rewriteAnchor makes a link work from disk: uploaded files are bundled,
+// site-absolute links go to the live site and anchors are kept
+func (b *siteBundle) rewriteAnchor(n *html.Node) {
+	for i, attr := range n.Attr {
+		if attr.Key != "href" {
+			continue
+		}
+		href := attr.Val
+
+		switch {
+		case strings.HasPrefix(href, "#"):
+		case strings.HasPrefix(href, "/api/file/"):
+			if storagePath, ok := fileURLPath(href); ok {
+				if local, ok := b.include(storagePath, siteFilesDir); ok {
+					n.Attr[i].Val = local
+				}
+			}
+		case strings.HasPrefix(href, "/") && !strings.HasPrefix(href, "//"):
+			if b.baseURL != "" {
+				n.Attr[i].Val = b.baseURL + href
+			}
+		case isInternalImageRef(href):
+			// A relative link such as "tickets/ferry.pdf" names an upload
+			if file, err := b.images.Resolve(href, b.ownerID); err == nil {
+				if local, ok := b.include(file.FilePath, siteFilesDir); ok {
+					n.Attr[i].Val = local
+				}
+			}
+		}
+	}
+}
+
+// include adds a stored file to the bundle once and returns its relative
+// path there. Only uploads of the schedule's owner are bundled, so a link
+// to someone else's file cannot copy it into the export.
+func (b *siteBundle) include(storagePath, dir string) (string, bool) {
+	if local, ok := b.paths[storagePath]; ok {
+		return local, true
+	}
+
+	record, err := b.images.files.GetByPath(storagePath)
+	if err != nil || record.UserID != b.ownerID {
+		return "", false
+	}
+
+	data, err := readStoredFile(b.storage, storagePath)
+	if err != nil {
+		return "", false
+	}
+
+	// Prefer the name the file was uploaded with over its storage name
+	filename := bundleFilename(record, path.Base(storagePath))
+	mimeType := record.MimeType
+
+	local := dir + filename
+	for i := 2; b.used[local]; i++ {
+		local = fmt.Sprintf("%s%d-%s", dir, i, filename)
+	}
+	b.used[local] = true
+	b.paths[storagePath] = local
+
+	b.files = append(b.files, SiteFile{
+		Path:     local,
+		Filename: filename,
+		MimeType: mimeType,
+		Size:     int64(len(data)),
+	})
+	b.data = append(b.data, data)
+
+	return escapeBundlePath(local), true
+}
+
+// escapeBundlePath escapes a path inside a bundle as a relative URL, so
+// names with spaces or Hangul work
+func escapeBundlePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// bundleFilename returns a safe file name for an uploaded file, keeping the
+// original name when it has no path separators or control characters
+func bundleFilename(record *models.File, fallback string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(record.Filename))
+	if name == "" || name == "." || name == ".." {
+		return fallback
+	}
+	return name
+}
+
+// fileURLPath returns the storage path of a FileURL
+func fileURLPath(fileURL string) (string, bool) {
+	escaped, ok := strings.CutPrefix(fileURL, "/api/file/")
+	if !ok {
+		return "", false
+	}
+	storagePath, err := url.PathUnescape(escaped)
+	if err != nil || storagePath == "" {
+		return "", false
+	}
+	return storagePath, true
+}
+
+// siteTemplate is the page wrapping an exported schedule
+var siteTemplate = template.Must(template.New("site").Parse(`<!DOCTYPE html>
+<html lang="ko">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>{{.CSS}}</style>
+</head>
+<body>
+<header class="cover">
+<h1 class="title">{{.Title}}</h1>
+{{- if .Dates}}
+<p class="dates">{{.Dates}}</p>
+{{- end}}
+{{- if .Description}}
+<p class="description">{{.Description}}</p>
+{{- end}}
+</header>
+<main>
+{{.Body}}
+</main>
+</body>
+</html>
+`))
+
+// siteCSS is inlined into exported pages so they need no network access
+const siteCSS = `
+:root { color-scheme: light dark; }
+body { margin: 0 auto; max-width: 960px; padding: 2rem 1.25rem 4rem; font: 16px/1.7 -apple-system, BlinkMacSystemFont, "Apple SD Gothic Neo", "Malgun Gothic", "Noto Sans KR", sans-serif; color: #1f2328; background: #fff; word-break: keep-all; overflow-wrap: anywhere; }
+.cover { border-bottom: 1px solid #d0d7de; margin-bottom: 2rem; padding-bottom: 1rem; }
+.cover .title { font-size: 2.25rem; margin: 0 0 .25rem; }
+.cover .dates { color: #57606a; margin: 0; }
+.cover .description { font-size: 1.1rem; }
+main > h1:first-child { display: none; }
+h2 { border-bottom: 1px solid #d0d7de; padding-bottom: .3rem; margin-top: 2.5rem; }
+a { color: #0969da; }
+img { max-width: 100%; height: auto; border-radius: 6px; }
+table { border-collapse: collapse; margin: 1rem 0; }
+th, td { border: 1px solid #d0d7de; padding: .4rem .75rem; }
+th { background: #f6f8fa; }
+blockquote { margin: 1rem 0; padding: 0 1rem; color: #57606a; border-left: .25rem solid #d0d7de; }
+pre, code { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; background: #f6f8fa; border-radius: 6px; }
+code { padding: .1rem .3rem; }
+pre { padding: 1rem; overflow: auto; }
+pre code { padding: 0; }
+ul.contains-task-list, li:has(> input[type=checkbox]) { list-style: none; }
+nav.toc { background: #f6f8fa; border-radius: 6px; padding: .75rem 1.25rem; margin: 1.5rem 0; }
+nav.toc ul { margin: 0; padding-left: 1.25rem; }
+.directive { border: 1px solid #d0d7de; border-left: 4px solid #6366f1; border-radius: 6px; padding: .75rem 1rem; margin: 1rem 0; }
+.directive-hotel { border-left-color: #f59e0b; }
+.directive-place { border-left-color: #10b981; }
+.directive-title { margin: 0 0 .5rem; font-weight: 600; }
+.directive-kind { font-size: .75rem; text-transform: uppercase; letter-spacing: .05em; color: #57606a; margin-right: .5rem; }
+.directive-attributes { display: grid; grid-template-columns: max-content 1fr; gap: .25rem 1rem; margin: 0; }
+.directive-attributes dt { color: #57606a; }
+.directive-attributes dd { margin: 0; }
+.directive-notes, .directive-map { margin: .5rem 0 0; }
+.footnotes { font-size: .9rem; color: #57606a; border-top: 1px solid #d0d7de; margin-top: 3rem; }
+@media (prefers-color-scheme: dark) {
+  body { color: #e6edf3; background: #0d1117; }
+  a { color: #4493f8; }
+  .cover, h2, .footnotes, .directive { border-color: #30363d; }
+  th { background: #161b22; }
+  th, td, blockquote { border-color: #30363d; }
+  pre, code, nav.toc { background: #161b22; }
+}
+@media print { body { max-width: none; } nav.toc { display: none; } }
+`
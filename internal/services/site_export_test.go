@@ -0,0 +1,119 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSiteExporter_Export(t *testing.T) {
+	owner, other := uuid.New(), uuid.New()
+	files := &memoryFiles{}
+	files.add(owner, "해변 사진.png", "uploads/a1.png", true)
+	files.add(owner, "ticket.pdf", "uploads/b2.pdf", true)
+	files.records[1].MimeType = "application/pdf"
+	files.add(owner, "해변 사진.png", "uploads/c3.png", true)
+	files.add(other, "passport.pdf", "uploads/s9.pdf", true)
+	files.data = map[string][]byte{
+		"uploads/a1.png": []byte("png-1"),
+		"uploads/b2.pdf": []byte("pdf"),
+		"uploads/c3.png": []byte("png-2"),
+		"uploads/s9.pdf": []byte("secret"),
+	}
+
+	markdown := "# 제주 여행\n\n" +
+		"## 1일차\n\n![해변](해변%20사진.png) ![again](uploads/a1.png) ![second](uploads/c3.png)\n\n" +
+		"[Ticket](tickets/ticket.pdf), [day 1](#1일차), [other trip](/schedules/42), " +
+		"[site](https://example.com), [missing](nowhere.pdf), [not mine](/api/file/uploads/s9.pdf)\n"
+
+	updated := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	doc := &ScheduleExport{
+		ID:           uuid.New(),
+		Title:        "제주 <여행>",
+		Markdown:     markdown,
+		UpdatedAt:    updated,
+		ImageOwnerID: owner,
+	}
+
+	var out bytes.Buffer
+	exporter := NewSiteExporter(files, NewImageResolver(files, files))
+	exporter.markdownService.SetRenderCache(nil)
+	if err := exporter.Export(&out, doc, "https://trip.example/"); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("output is not a zip: %v", err)
+	}
+	entries := make(map[string]string)
+	for _, f := range archive.File {
+		r, _ := f.Open()
+		data, _ := io.ReadAll(r)
+		entries[f.Name] = string(data)
+		if !f.Modified.Equal(updated) {
+			t.Errorf("%s modified = %v, want %v", f.Name, f.Modified, updated)
+		}
+	}
+
+	want := map[string]string{
+		"schedule.md":        markdown,
+		"images/해변 사진.png":   "png-1",
+		"images/2-해변 사진.png": "png-2",
+		"files/ticket.pdf":   "pdf",
+		"index.html":         "",
+		"metadata.json":      "",
+	}
+	if len(entries) != len(want) {
+		t.Errorf("bundle has %d entries, want %d", len(entries), len(want))
+	}
+	for name, content := range want {
+		got, ok := entries[name]
+		if !ok {
+			t.Errorf("bundle is missing %s", name)
+		} else if content != "" && got != content {
+			t.Errorf("%s = %q, want %q", name, got, content)
+		}
+	}
+
+	index := entries["index.html"]
+	for _, want := range []string{
+		"<title>제주 &lt;여행&gt;</title>",
+		"<style>",
+		`<nav class="toc"`,
+		`src="images/%ED%95%B4%EB%B3%80%20%EC%82%AC%EC%A7%84.png"`,
+		`src="images/2-%ED%95%B4%EB%B3%80%20%EC%82%AC%EC%A7%84.png"`,
+		`href="files/ticket.pdf"`,
+		`href="#1일차"`,
+		`href="https://trip.example/schedules/42"`,
+		`href="https://example.com"`,
+		`href="nowhere.pdf"`,
+		`href="/api/file/uploads/s9.pdf"`, // Another user's file is not bundled
+	} {
+		if !strings.Contains(index, want) {
+			t.Errorf("index.html should contain %s:\n%s", want, index)
+		}
+	}
+	for _, unwanted := range []string{`src="/api/file/`, "srcset", "<link"} {
+		if strings.Contains(index, unwanted) {
+			t.Errorf("index.html should not contain %s:\n%s", unwanted, index)
+		}
+	}
+
+	var metadata SiteMetadata
+	if err := json.Unmarshal([]byte(entries["metadata.json"]), &metadata); err != nil {
+		t.Fatalf("metadata.json is invalid: %v", err)
+	}
+	if metadata.ID != doc.ID.String() || metadata.Title != doc.Title || len(metadata.TOC) != 1 {
+		t.Errorf("metadata = %+v", metadata)
+	}
+	if len(metadata.Files) != 3 || metadata.Files[0].Filename != "해변 사진.png" || metadata.Files[0].MimeType != "image/png" {
+		t.Errorf("metadata.Files = %+v", metadata.Files)
+	}
+}
@@ -0,0 +1,364 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+
+	"tripflow/pkg/filestorage"
+)
+
+// defaultMigrationWorkers is how many files are copied at once when
+// MigrationOptions.Workers is unset
+const defaultMigrationWorkers = 4
+
+// MigrationPathStore updates the records that refer to a stored file when
+// it is copied to a new path
+type MigrationPathStore interface {
+	UpdatePath(oldPath, newPath string) error
+}
+
+// MigrationOptions configures a storage migration
+type MigrationOptions struct {
+	Prefix  string // Only files under this prefix are copied; defaults to uploads/
+	Workers int    // Files copied at once; defaults to 4
+
+	// Journal is the file completed copies are appended to. A migration
+	// started again with the same journal skips the files it lists.
+	// Empty disables resuming.
+	Journal string
+
+	// Progress is called after each file is copied, skipped or fails
+	Progress func(MigrationProgress)
+}
+
+// MigrationProgress reports a file handled by a migration
+type MigrationProgress struct {
+	Path    string
+	NewPath string // Differs from Path when the target chose a new path
+	Size    int64
+	Err     error
+
+	Done  int // Files handled so far, including this one
+	Total int // Files to copy, excluding those already in the journal
+}
+
+// MigrationResult summarizes a migration
+type MigrationResult struct {
+	Copied  int
+	Resumed int // Files skipped because the journal lists them
+	Failed  int
+	Bytes   int64
+	Renamed int // Files stored under a new path, with their records updated
+}
+
+// migrationJournalHeader is the first line of a journal and names the
+// storages it belongs to
+type migrationJournalHeader struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// migrationJournalEntry is a line of a journal recording a completed copy
+type migrationJournalEntry struct {
+	Path     string `json:"path"`
+	NewPath  string `json:"new_path"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"sha256"`
+}
+
+// StorageMigration copies every stored file from one storage to another.
+// Files are copied byte for byte, so encrypted files stay encrypted with
+// the same keys, and each copy is verified against the SHA-256 of the
+// source before it counts as done. Targets that implement
+// filestorage.KeyedUploader keep each file's path; on other targets the
+// records of files that got a new path are updated.
+type StorageMigration struct {
+	from  filestorage.FileStorageServiceV2
+	to    filestorage.FileStorageServiceV2
+	keyed filestorage.KeyedUploader // Nil when the target picks paths
+	paths MigrationPathStore
+
+	fromName, toName string
+}
+
+// NewStorageMigration creates a StorageMigration between two storages,
+// named in the journal so it cannot be resumed against other storages.
+// paths may be nil when the target implements filestorage.KeyedUploader.
+func NewStorageMigration(fromName string, from filestorage.FileStorageService, toName string, to filestorage.FileStorageService, paths MigrationPathStore) (*StorageMigration, error) {
+	keyed, _ := to.(filestorage.KeyedUploader)
+	if keyed == nil && paths == nil {
+		return nil, fmt.Errorf("storage %s chooses its own paths, so file records must be updated", toName)
+	}
+	return &StorageMigration{
+		from:     filestorage.AdaptV1(from),
+		to:       filestorage.AdaptV1(to),
+		keyed:    keyed,
+		paths:    paths,
+		fromName: fromName,
+		toName:   toName,
+	}, nil
+}
+
+// KeepsPaths reports whether files keep their paths in the target storage
+func (m *StorageMigration) KeepsPaths() bool {
+	return m.keyed != nil
+}
+
+// Run copies the files. Failed files are reported through Progress and
+// counted in the result; running again with the same journal retries them.
+// It stops early when ctx is cancelled.
+func (m *StorageMigration) Run(ctx context.Context, opts MigrationOptions) (*MigrationResult, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = fileGCPrefix
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = defaultMigrationWorkers
+	}
+
+	done, journal, err := m.openJournal(opts.Journal)
+	if err != nil {
+		return nil, err
+	}
+	if journal != nil {
+		defer journal.Close()
+	}
+
+	objects, err := m.from.List(ctx, opts.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files in %s: %w", m.fromName, err)
+	}
+
+	result := &MigrationResult{}
+	var pending []*filestorage.FileInfo
+	for _, object := range objects {
+		if done[object.Path] {
+			result.Resumed++
+		} else {
+			pending = append(pending, object)
+		}
+	}
+
+	var mu sync.Mutex // Guards result, journal and the progress count
+	var journalErr error
+	work := make(chan *filestorage.FileInfo)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for object := range work {
+				entry, err := m.copy(ctx, object)
+
+				mu.Lock()
+				if err == nil && journal != nil {
+					if err = journal.append(entry); err != nil {
+						journalErr = err
+					}
+				}
+				progress := MigrationProgress{Path: object.Path, Size: object.Size, Err: err, Total: len(pending)}
+				if err != nil {
+					result.Failed++
+				} else {
+					result.Copied++
+					result.Bytes += entry.Size
+					progress.NewPath = entry.NewPath
+					if entry.NewPath != entry.Path {
+						result.Renamed++
+					}
+				}
+				progress.Done = result.Copied + result.Failed
+				if opts.Progress != nil {
+					opts.Progress(progress)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, object := range pending {
+		select {
+		case work <- object:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if journalErr != nil {
+		return result, fmt.Errorf("failed to write journal: %w", journalErr)
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// copy copies a file to the target and verifies the copy
+func (m *StorageMigration) copy(ctx context.Context, object *filestorage.FileInfo) (*migrationJournalEntry, error) {
+	rc, err := m.from.Open(ctx, object.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", object.Path, err)
+	}
+	defer rc.Close()
+
+	hash := sha256.New()
+	counter := &countingReader{r: io.TeeReader(rc, hash)}
+	newPath := object.Path
+	if m.keyed != nil {
+		err = m.keyed.UploadAt(ctx, object.Path, counter, object.MimeType)
+	} else {
+		newPath, err = m.to.Upload(ctx, counter, path.Base(object.Path), object.MimeType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", object.Path, err)
+	}
+	entry := &migrationJournalEntry{
+		Path:     object.Path,
+		NewPath:  newPath,
+		Size:     counter.n,
+		Checksum: hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	if err := m.verify(ctx, entry); err != nil {
+		if newPath != object.Path {
+			m.to.Delete(ctx, newPath)
+		}
+		return nil, err
+	}
+
+	if newPath != object.Path {
+		if err := m.paths.UpdatePath(object.Path, newPath); err != nil {
+			m.to.Delete(ctx, newPath)
+			return nil, fmt.Errorf("failed to update records of %s: %w", object.Path, err)
+		}
+	}
+	return entry, nil
+}
+
+// verify checks that the target holds exactly the copied content, using
+// the checksum the target reports or else reading the copy back
+func (m *StorageMigration) verify(ctx context.Context, entry *migrationJournalEntry) error {
+	info, err := m.to.Stat(ctx, entry.NewPath)
+	if err != nil {
+		return fmt.Errorf("failed to verify %s: %w", entry.NewPath, err)
+	}
+	if info.Size != entry.Size {
+		return fmt.Errorf("verification of %s failed: copied %d bytes, target has %d", entry.Path, entry.Size, info.Size)
+	}
+
+	checksum := info.Checksum
+	if checksum == "" {
+		rc, err := m.to.Open(ctx, entry.NewPath)
+		if err != nil {
+			return fmt.Errorf("failed to verify %s: %w", entry.NewPath, err)
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to verify %s: %w", entry.NewPath, err)
+		}
+		checksum = hex.EncodeToString(hash.Sum(nil))
+	}
+	if checksum != entry.Checksum {
+		return fmt.Errorf("verification of %s failed: checksum mismatch", entry.Path)
+	}
+	return nil
+}
+
+// migrationJournal appends completed copies to a journal file
+type migrationJournal struct {
+	file *os.File
+}
+
+func (j *migrationJournal) append(entry *migrationJournalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *migrationJournal) Close() error {
+	return j.file.Close()
+}
+
+// openJournal reads the paths a journal lists as copied and opens it for
+// appending, creating it when it does not exist. A journal of a migration
+// between other storages is rejected.
+func (m *StorageMigration) openJournal(name string) (map[string]bool, *migrationJournal, error) {
+	done := make(map[string]bool)
+	if name == "" {
+		return done, nil, nil
+	}
+
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	header := migrationJournalHeader{From: m.fromName, To: m.toName}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if scanner.Scan() {
+		var existing migrationJournalHeader
+		if err := json.Unmarshal(scanner.Bytes(), &existing); err != nil || existing != header {
+			file.Close()
+			return nil, nil, fmt.Errorf("journal %s belongs to another migration", name)
+		}
+		for scanner.Scan() {
+			var entry migrationJournalEntry
+			// A line cut short by an interruption is not a completed copy
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil && entry.Path != "" {
+				done[entry.Path] = true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	// Start appending on a new line, after any line cut short
+	end, err := file.Seek(0, io.SeekEnd)
+	if err == nil && end == 0 {
+		line, _ := json.Marshal(header)
+		_, err = file.Write(append(line, '\n'))
+	} else if err == nil {
+		last := make([]byte, 1)
+		if _, err = file.ReadAt(last, end-1); err == nil && last[0] != '\n' {
+			_, err = file.Write([]byte("\n"))
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to write journal: %w", err)
+	}
+	return done, &migrationJournal{file: file}, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
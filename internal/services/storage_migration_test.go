@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tripflow/pkg/filestorage"
+)
+
+// pathChoosingStorage hides UploadAt, like a storage that picks its own
+// paths
+type pathChoosingStorage struct {
+	filestorage.FileStorageService
+}
+
+// truncatingStorage stores all but the last byte of every file
+type truncatingStorage struct {
+	*filestorage.LocalFileStorage
+}
+
+func (s truncatingStorage) UploadAt(ctx context.Context, path string, file io.Reader, mimeType string) error {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	return s.LocalFileStorage.UploadAt(ctx, path, strings.NewReader(string(data[:len(data)-1])), mimeType)
+}
+
+// memoryPathStore records path updates
+type memoryPathStore map[string]string
+
+func (m memoryPathStore) UpdatePath(oldPath, newPath string) error {
+	m[oldPath] = newPath
+	return nil
+}
+
+func newTestLocalStorage(t *testing.T) filestorage.FileStorageService {
+	t.Helper()
+	storage, err := filestorage.NewLocalFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalFileStorage() error = %v", err)
+	}
+	return storage
+}
+
+// uploadFiles stores the contents and returns their paths
+func uploadFiles(t *testing.T, storage filestorage.FileStorageService, contents ...string) []string {
+	t.Helper()
+	paths := make([]string, len(contents))
+	for i, content := range contents {
+		path, err := storage.UploadFile(strings.NewReader(content), "file.md", "text/markdown")
+		if err != nil {
+			t.Fatalf("UploadFile() error = %v", err)
+		}
+		paths[i] = path
+	}
+	return paths
+}
+
+func readFile(t *testing.T, storage filestorage.FileStorageService, path string) string {
+	t.Helper()
+	reader, err := storage.GetFile(path)
+	if err != nil {
+		t.Fatalf("GetFile(%s) error = %v", path, err)
+	}
+	defer reader.(io.Closer).Close()
+	data, _ := io.ReadAll(reader)
+	return string(data)
+}
+
+func TestStorageMigration_Run(t *testing.T) {
+	from, to := newTestLocalStorage(t), newTestLocalStorage(t)
+	contents := []string{"# 제주", "# 부산", strings.Repeat("큰 파일 ", 100000)}
+	paths := uploadFiles(t, from, contents...)
+	journal := filepath.Join(t.TempDir(), "migrate.journal")
+
+	migration, err := NewStorageMigration("local:a", from, "local:b", to, nil)
+	if err != nil || !migration.KeepsPaths() {
+		t.Fatalf("NewStorageMigration() = %v, %v", migration, err)
+	}
+	var progress []MigrationProgress
+	result, err := migration.Run(context.Background(), MigrationOptions{
+		Workers:  2,
+		Journal:  journal,
+		Progress: func(p MigrationProgress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Copied != 3 || result.Failed != 0 || result.Renamed != 0 || len(progress) != 3 || progress[2].Done != 3 {
+		t.Errorf("Run() = %+v, progress %+v", result, progress)
+	}
+	for i, path := range paths {
+		if got := readFile(t, to, path); got != contents[i] {
+			t.Errorf("%s copied as %d bytes, want %d", path, len(got), len(contents[i]))
+		}
+	}
+
+	// A second run resumes from the journal, copying only new files
+	paths = append(paths, uploadFiles(t, from, "# 강릉")...)
+	result, err = migration.Run(context.Background(), MigrationOptions{Journal: journal})
+	if err != nil || result.Copied != 1 || result.Resumed != 3 {
+		t.Errorf("resumed Run() = %+v, %v", result, err)
+	}
+	if got := readFile(t, to, paths[3]); got != "# 강릉" {
+		t.Errorf("%s copied as %q", paths[3], got)
+	}
+
+	// A line cut short by an interruption is ignored
+	f, _ := os.OpenFile(journal, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"path":"uploads/`)
+	f.Close()
+	result, err = migration.Run(context.Background(), MigrationOptions{Journal: journal})
+	if err != nil || result.Copied != 0 || result.Resumed != 4 {
+		t.Errorf("Run() after an interrupted write = %+v, %v", result, err)
+	}
+
+	other, _ := NewStorageMigration("local:a", from, "s3://archive", to, nil)
+	if _, err := other.Run(context.Background(), MigrationOptions{Journal: journal}); err == nil {
+		t.Error("Run() with another migration's journal should fail")
+	}
+}
+
+func TestStorageMigration_NewPaths(t *testing.T) {
+	from := newTestLocalStorage(t)
+	to := pathChoosingStorage{newTestLocalStorage(t)}
+	paths := uploadFiles(t, from, "# 제주", "# 부산")
+
+	if _, err := NewStorageMigration("a", from, "b", to, nil); err == nil {
+		t.Error("NewStorageMigration() to a storage that picks paths needs a MigrationPathStore")
+	}
+	records := memoryPathStore{}
+	migration, err := NewStorageMigration("a", from, "b", to, records)
+	if err != nil {
+		t.Fatalf("NewStorageMigration() error = %v", err)
+	}
+	result, err := migration.Run(context.Background(), MigrationOptions{})
+	if err != nil || result.Copied != 2 || result.Renamed != 2 {
+		t.Fatalf("Run() = %+v, %v", result, err)
+	}
+	for i, path := range paths {
+		newPath := records[path]
+		if newPath == "" || newPath == path {
+			t.Fatalf("records of %s were not updated: %v", path, records)
+		}
+		if got, want := readFile(t, to, newPath), []string{"# 제주", "# 부산"}[i]; got != want {
+			t.Errorf("%s copied as %q, want %q", newPath, got, want)
+		}
+	}
+}
+
+func TestStorageMigration_Verify(t *testing.T) {
+	from := newTestLocalStorage(t)
+	to := truncatingStorage{newTestLocalStorage(t).(*filestorage.LocalFileStorage)}
+	uploadFiles(t, from, "# 제주")
+	journal := filepath.Join(t.TempDir(), "migrate.journal")
+
+	migration, _ := NewStorageMigration("a", from, "b", to, nil)
+	var failure error
+	result, err := migration.Run(context.Background(), MigrationOptions{
+		Journal:  journal,
+		Progress: func(p MigrationProgress) { failure = p.Err },
+	})
+	if err != nil || result.Failed != 1 || result.Copied != 0 {
+		t.Fatalf("Run() = %+v, %v", result, err)
+	}
+	if failure == nil || !strings.Contains(failure.Error(), "verification") {
+		t.Errorf("Progress error = %v, want a verification failure", failure)
+	}
+
+	// A failed copy is not journaled, so it is retried
+	result, _ = migration.Run(context.Background(), MigrationOptions{Journal: journal})
+	if result.Resumed != 0 || result.Failed != 1 {
+		t.Errorf("second Run() = %+v", result)
+	}
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+)
+
+// tocMarker is the paragraph replaced by the table of contents when one is
+// requested; without it the table goes after the title heading
+const tocMarker = "<p>[TOC]</p>"
+
+// Markdown syntax that should not end up in a heading's ID: the "(url)"
+// part of inline links and raw HTML tags
+var (
+	markdownLinkDestination = regexp.MustCompile(`\]\([^)]*\)`)
+	inlineHTMLTag           = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+)
+
+// TOCEntry is a heading in a document's table of contents
+type TOCEntry struct {
+	ID       string      `json:"id"`
+	Text     string      `json:"text"`
+	Level    int         `json:"level"`
+	Children []*TOCEntry `json:"children,omitempty"`
+}
+
+// headingIDs generates heading IDs from heading text. Unlike goldmark's
+// default, which drops every non-ASCII character, letters and digits of
+// any script are kept, so "1일차 - 제주시" becomes "1일차-제주시". IDs
+// only depend on the headings before them, which keeps links stable while
+// the rest of the document is edited.
+type headingIDs struct {
+	used map[string]bool
+}
+
+// newHeadingIDs creates an ID generator for one document
+func newHeadingIDs() parser.IDs {
+	return &headingIDs{used: make(map[string]bool)}
+}
+
+// Generate returns a unique ID for a heading, adding "-1", "-2" and so on
+// to repeated headings
+func (h *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	text := markdownLinkDestination.ReplaceAllString(string(value), "]")
+	base := slugify(inlineHTMLTag.ReplaceAllString(text, ""))
+	if base == "" {
+		base = "section"
+	}
+
+	id := base
+	for i := 1; h.used[id]; i++ {
+		id = base + "-" + strconv.Itoa(i)
+	}
+	h.used[id] = true
+	return []byte(id)
+}
+
+// Put marks an ID set explicitly in the document as used
+func (h *headingIDs) Put(value []byte) {
+	h.used[string(value)] = true
+}
+
+// slugify lowercases text, keeps letters and digits, turns whitespace,
+// hyphens and underscores into single hyphens and drops everything else
+func slugify(text string) string {
+	var b strings.Builder
+	pendingHyphen := false
+	for _, r := range strings.TrimSpace(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingHyphen = false
+			b.WriteRune(unicode.ToLower(r))
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			pendingHyphen = true
+		}
+	}
+	return b.String()
+}
+
+// extractTOC builds the nested table of contents of a parsed document. The
+// first level-1 heading is the document title and is left out.
+func extractTOC(doc ast.Node, source []byte) []*TOCEntry {
+	var root []*TOCEntry
+	var stack []*TOCEntry
+	skippedTitle := false
+
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		if heading.Level == 1 && !skippedTitle {
+			skippedTitle = true
+			return ast.WalkSkipChildren, nil
+		}
+
+		entry := &TOCEntry{
+			Text:  strings.TrimSpace(string(heading.Text(source))),
+			Level: heading.Level,
+		}
+		if id, ok := heading.AttributeString("id"); ok {
+			if value, ok := id.([]byte); ok {
+				entry.ID = string(value)
+			}
+		}
+
+		// Attach to the closest preceding heading of a higher level
+		for len(stack) > 0 && stack[len(stack)-1].Level >= entry.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			root = append(root, entry)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, entry)
+		}
+		stack = append(stack, entry)
+
+		return ast.WalkSkipChildren, nil
+	})
+
+	return root
+}
+
+// renderTOC renders a table of contents as a navigation list
+func renderTOC(entries []*TOCEntry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(`<nav class="toc" aria-label="Table of contents">`)
+	writeTOCList(&b, entries)
+	b.WriteString("</nav>\n")
+	return b.String()
+}
+
+// writeTOCList writes one nesting level of a table of contents
+func writeTOCList(b *strings.Builder, entries []*TOCEntry) {
+	b.WriteString("<ul>")
+	for _, entry := range entries {
+		b.WriteString(`<li><a href="#`)
+		b.WriteString(html.EscapeString(entry.ID))
+		b.WriteString(`">`)
+		b.WriteString(html.EscapeString(entry.Text))
+		b.WriteString("</a>")
+		if len(entry.Children) > 0 {
+			writeTOCList(b, entry.Children)
+		}
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ul>")
+}
+
+// injectTOC places a rendered table of contents in sanitized HTML: at the
+// [TOC] marker if there is one, otherwise after the title heading, otherwise
+// at the top
+func injectTOC(htmlContent string, toc string) string {
+	if toc == "" {
+		return htmlContent
+	}
+	if strings.Contains(htmlContent, tocMarker) {
+		return strings.Replace(htmlContent, tocMarker, strings.TrimSuffix(toc, "\n"), 1)
+	}
+	if idx := strings.Index(htmlContent, "</h1>"); idx >= 0 && strings.HasPrefix(htmlContent, "<h1") {
+		idx += len("</h1>\n")
+		if idx > len(htmlContent) {
+			idx = len(htmlContent)
+		}
+		return htmlContent[:idx] + toc + htmlContent[idx:]
+	}
+	return toc + htmlContent
+}
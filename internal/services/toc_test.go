@@ -0,0 +1,93 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"1일차 - 제주시", "1일차-제주시"},
+		{"Day 2: Osaka & Kyoto", "day-2-osaka-kyoto"},
+		{"  Crème brûlée_stop  ", "crème-brûlée-stop"},
+		{"東京 タワー", "東京-タワー"},
+		{"!!!", ""},
+	}
+
+	for _, tt := range tests {
+		if got := slugify(tt.text); got != tt.want {
+			t.Errorf("slugify(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestProcessMarkdown_TOC(t *testing.T) {
+	service := NewMarkdownService(nil)
+	service.SetRenderCache(nil)
+
+	markdown := "# 제주 여행\n\n" +
+		"## 1일차 - 제주시\n\n### 점심\n\n### 저녁\n\n" +
+		"## 2일차 - [서귀포](https://example.com)\n\n### 점심\n\n" +
+		"## !!!\n\n## <em>x</em>Day\n"
+
+	processed, err := service.ProcessMarkdownWithOptions(markdown, &ProcessOptions{TOC: true})
+	if err != nil {
+		t.Fatalf("ProcessMarkdownWithOptions() error = %v", err)
+	}
+
+	html := processed.HTMLContent
+	for _, want := range []string{
+		`<h2 id="1일차-제주시">1일차 - 제주시</h2>`,
+		`<h3 id="점심">점심</h3>`,
+		`<h3 id="점심-1">점심</h3>`,
+		`<h2 id="2일차-서귀포">`,
+		`<h2 id="section">`,
+		`<h2 id="xday">`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTMLContent = %s, should contain %s", html, want)
+		}
+	}
+
+	toc := processed.TOC
+	if len(toc) != 4 {
+		t.Fatalf("TOC has %d top-level entries, want 4: %+v", len(toc), toc)
+	}
+	if toc[0].ID != "1일차-제주시" || toc[0].Level != 2 || len(toc[0].Children) != 2 {
+		t.Errorf("TOC[0] = %+v", toc[0])
+	}
+	if toc[1].Text != "2일차 - 서귀포" || toc[1].Children[0].ID != "점심-1" {
+		t.Errorf("TOC[1] = %+v", toc[1])
+	}
+
+	// The table goes right after the title
+	nav := strings.Index(html, `<nav class="toc"`)
+	if nav < 0 || nav < strings.Index(html, "</h1>") || nav > strings.Index(html, "<h2") {
+		t.Errorf("HTMLContent = %s, TOC should follow the title", html)
+	}
+	if !strings.Contains(html, `<li><a href="#1일차-제주시">1일차 - 제주시</a><ul><li><a href="#점심">점심</a></li>`) {
+		t.Errorf("HTMLContent = %s, TOC should nest subheadings", html)
+	}
+}
+
+func TestProcessMarkdown_TOCMarker(t *testing.T) {
+	service := NewMarkdownService(nil)
+	service.SetRenderCache(nil)
+
+	markdown := "Intro\n\n[TOC]\n\n## <script>x</script>Day\n"
+	withTOC, _ := service.ProcessMarkdownWithOptions(markdown, &ProcessOptions{TOC: true})
+	if strings.Contains(withTOC.HTMLContent, "[TOC]") || !strings.Contains(withTOC.HTMLContent, "<p>Intro</p>\n<nav") {
+		t.Errorf("HTMLContent = %s, marker should be replaced", withTOC.HTMLContent)
+	}
+	if strings.Contains(withTOC.HTMLContent, "<script>") {
+		t.Errorf("HTMLContent = %s, TOC text should be escaped", withTOC.HTMLContent)
+	}
+
+	without, _ := service.ProcessMarkdown(markdown)
+	if strings.Contains(without.HTMLContent, "<nav") || len(without.TOC) != 1 {
+		t.Errorf("TOC should only be injected on request: %+v", without)
+	}
+}
@@ -0,0 +1,12 @@
+CREATE TABLE exchange_rates (
+    id TEXT PRIMARY KEY,
+    base_currency TEXT NOT NULL,
+    quote_currency TEXT NOT NULL,
+    effective_date TIMESTAMP NOT NULL,
+    rate REAL NOT NULL,
+    source TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_exchange_rates_pair_date ON exchange_rates(base_currency, quote_currency, effective_date);
@@ -0,0 +1,3 @@
+ALTER TABLE schedules DROP COLUMN end_date;
+ALTER TABLE schedules DROP COLUMN start_date;
+ALTER TABLE schedules DROP COLUMN home_currency;
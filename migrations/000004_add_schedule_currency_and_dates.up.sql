@@ -0,0 +1,3 @@
+ALTER TABLE schedules ADD COLUMN home_currency TEXT NOT NULL DEFAULT 'KRW';
+ALTER TABLE schedules ADD COLUMN start_date TIMESTAMP;
+ALTER TABLE schedules ADD COLUMN end_date TIMESTAMP;
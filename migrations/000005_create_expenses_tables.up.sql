@@ -0,0 +1,31 @@
+CREATE TABLE expenses (
+    id TEXT PRIMARY KEY,
+    schedule_id TEXT NOT NULL,
+    created_by TEXT NOT NULL,
+    description TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    currency TEXT NOT NULL,
+    payer_user_id TEXT,
+    payer_guest_name TEXT,
+    split_rule TEXT NOT NULL DEFAULT 'equal',
+    spent_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP,
+    FOREIGN KEY (schedule_id) REFERENCES schedules(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_expenses_schedule_id ON expenses(schedule_id);
+CREATE INDEX idx_expenses_deleted_at ON expenses(deleted_at);
+
+CREATE TABLE expense_participants (
+    id TEXT PRIMARY KEY,
+    expense_id TEXT NOT NULL,
+    user_id TEXT,
+    guest_name TEXT,
+    share INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (expense_id) REFERENCES expenses(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_expense_participants_expense_id ON expense_participants(expense_id);
+CREATE INDEX idx_expense_participants_user_id ON expense_participants(user_id);
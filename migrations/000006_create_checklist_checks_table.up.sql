@@ -0,0 +1,12 @@
+CREATE TABLE checklist_checks (
+    id TEXT PRIMARY KEY,
+    schedule_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    item_key TEXT NOT NULL,
+    checked BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (schedule_id) REFERENCES schedules(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_checklist_checks_item ON checklist_checks(schedule_id, user_id, item_key);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS image_variants;
+
+ALTER TABLE files DROP COLUMN height;
+ALTER TABLE files DROP COLUMN width;
@@ -0,0 +1 @@
+ALTER TABLE files ADD COLUMN uploader_role TEXT;
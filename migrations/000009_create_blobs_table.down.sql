@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_files_checksum;
+
+ALTER TABLE files DROP COLUMN checksum;
+
+DROP TABLE IF EXISTS blobs;
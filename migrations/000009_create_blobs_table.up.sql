@@ -0,0 +1,14 @@
+CREATE TABLE blobs (
+    checksum TEXT PRIMARY KEY,
+    file_path TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_blobs_file_path ON blobs(file_path);
+
+ALTER TABLE files ADD COLUMN checksum TEXT;
+
+CREATE INDEX idx_files_checksum ON files(checksum);
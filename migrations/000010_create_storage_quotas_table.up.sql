@@ -0,0 +1,7 @@
+CREATE TABLE storage_quotas (
+    user_id TEXT PRIMARY KEY,
+    max_bytes INTEGER,
+    max_files INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
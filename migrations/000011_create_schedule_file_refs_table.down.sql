@@ -0,0 +1,2 @@
+ALTER TABLE schedules DROP COLUMN file_refs_indexed;
+DROP TABLE IF EXISTS schedule_file_refs;
@@ -0,0 +1,11 @@
+CREATE TABLE schedule_file_refs (
+    schedule_id TEXT NOT NULL,
+    path TEXT NOT NULL,
+    filename TEXT,
+    PRIMARY KEY (schedule_id, path)
+);
+
+CREATE INDEX idx_schedule_file_refs_path ON schedule_file_refs(path);
+CREATE INDEX idx_schedule_file_refs_filename ON schedule_file_refs(filename);
+
+ALTER TABLE schedules ADD COLUMN file_refs_indexed BOOLEAN NOT NULL DEFAULT FALSE;
@@ -1,13 +1,24 @@
 package filestorage
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Storage backends accepted in FILE_STORAGE_BACKEND
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
 )
 
 // Config holds configuration for file storage services
 type Config struct {
-	BaseDir string // Base directory for file storage
+	Backend string    // BackendLocal (default) or BackendS3
+	BaseDir string    // Base directory for file storage
+	S3      *S3Config // Object store settings for BackendS3
 }
 
 // DefaultConfig returns the default configuration
@@ -24,10 +35,74 @@ func DefaultConfig() *Config {
 			baseDir = filepath.Join(os.TempDir(), "tripflow-files")
 		}
 	}
-	
+
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("FILE_STORAGE_BACKEND")))
+	if backend == "" {
+		backend = BackendLocal
+	}
+
 	return &Config{
+		Backend: backend,
 		BaseDir: baseDir,
+		S3:      s3ConfigFromEnv(),
+	}
+}
+
+// ParseConfig returns the configuration of a storage named by spec:
+//   - "local" or "s3": the backend configured by the environment
+//   - "local:<dir>": files under dir
+//   - "s3://<bucket>[/<prefix>]": a bucket with the other S3_* settings
+//     from the environment
+func ParseConfig(spec string) (*Config, error) {
+	config := DefaultConfig()
+	switch {
+	case spec == BackendLocal || spec == BackendS3:
+		config.Backend = spec
+	case strings.HasPrefix(spec, BackendLocal+":"):
+		config.Backend = BackendLocal
+		config.BaseDir = strings.TrimPrefix(spec, BackendLocal+":")
+		if config.BaseDir == "" {
+			return nil, fmt.Errorf("invalid storage %q: directory cannot be empty", spec)
+		}
+	case strings.HasPrefix(spec, BackendS3+"://"):
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(spec, BackendS3+"://"), "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("invalid storage %q: bucket cannot be empty", spec)
+		}
+		config.Backend = BackendS3
+		config.S3.Bucket = bucket
+		config.S3.Prefix = prefix
+	default:
+		return nil, fmt.Errorf("invalid storage %q: want local, local:<dir>, s3 or s3://<bucket>[/<prefix>]", spec)
 	}
+	return config, nil
+}
+
+// s3ConfigFromEnv reads object store settings from S3_* variables, falling
+// back to the standard AWS credential variables
+func s3ConfigFromEnv() *S3Config {
+	partSize, _ := strconv.ParseInt(os.Getenv("S3_PART_SIZE"), 10, 64)
+	forcePathStyle, _ := strconv.ParseBool(os.Getenv("S3_FORCE_PATH_STYLE"))
+
+	return &S3Config{
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		Region:          envOr("S3_REGION", envOr("AWS_REGION", "us-east-1")),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		AccessKeyID:     envOr("S3_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID")),
+		SecretAccessKey: envOr("S3_SECRET_ACCESS_KEY", os.Getenv("AWS_SECRET_ACCESS_KEY")),
+		SessionToken:    envOr("S3_SESSION_TOKEN", os.Getenv("AWS_SESSION_TOKEN")),
+		Prefix:          os.Getenv("S3_PREFIX"),
+		ForcePathStyle:  forcePathStyle,
+		PartSize:        partSize,
+	}
+}
+
+// envOr returns the environment variable key, or fallback when it is unset
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
 }
 
 // NewFileStorageService creates a file storage service based on configuration
@@ -35,6 +110,13 @@ func NewFileStorageService(config *Config) (FileStorageService, error) {
 	if config == nil {
 		config = DefaultConfig()
 	}
-	
-	return NewLocalFileStorage(config.BaseDir)
+
+	switch config.Backend {
+	case "", BackendLocal:
+		return NewLocalFileStorage(config.BaseDir)
+	case BackendS3:
+		return NewS3FileStorage(config.S3)
+	default:
+		return nil, fmt.Errorf("unknown file storage backend %q", config.Backend)
+	}
 }
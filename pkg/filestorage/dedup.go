@@ -0,0 +1,171 @@
+package filestorage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrBlobExists is returned by BlobIndex.Create when a blob with the same
+// checksum was recorded first
+var ErrBlobExists = errors.New("blob already exists")
+
+// BlobIndex records which stored file holds each distinct content and how
+// many uploads refer to it. Implementations must make each call atomic.
+type BlobIndex interface {
+	// Acquire adds a reference to the blob with the given SHA-256 and
+	// returns its path; found is false when there is no such blob
+	Acquire(ctx context.Context, checksum string) (path string, found bool, err error)
+
+	// Create records a new blob stored at path with one reference
+	Create(ctx context.Context, checksum, path string, size int64) error
+
+	// Release drops a reference to the blob stored at path and reports
+	// whether it was the last one. Paths that are not blobs, such as files
+	// stored before deduplication was enabled, report true.
+	Release(ctx context.Context, path string) (last bool, err error)
+}
+
+// DedupFileStorage stores each distinct content once on top of another
+// storage. Uploads are hashed with SHA-256; an upload whose content is
+// already stored gets the existing path and adds a reference to it, and
+// deleting a path only removes the stored file with its last reference.
+//
+// Every path returned by Upload must be deleted exactly once, so callers
+// that keep one record per upload stay consistent even when records share
+// a path.
+type DedupFileStorage struct {
+	storage FileStorageServiceV2
+	index   BlobIndex
+}
+
+// NewDedupFileStorage creates a deduplicating storage over storage, keeping
+// its references in index
+func NewDedupFileStorage(storage FileStorageService, index BlobIndex) *DedupFileStorage {
+	return &DedupFileStorage{
+		storage: AdaptV1(storage),
+		index:   index,
+	}
+}
+
+// UploadFile stores a file unless the same content is already stored
+func (d *DedupFileStorage) UploadFile(file io.Reader, filename string, mimeType string) (string, error) {
+	return d.Upload(context.Background(), file, filename, mimeType)
+}
+
+// GetFile retrieves a file from the underlying storage
+func (d *DedupFileStorage) GetFile(path string) (io.Reader, error) {
+	return d.Open(context.Background(), path)
+}
+
+// DeleteFile drops a reference to a file, removing it with the last one
+func (d *DedupFileStorage) DeleteFile(path string) error {
+	return d.Delete(context.Background(), path)
+}
+
+// FileExists checks if a file exists in the underlying storage
+func (d *DedupFileStorage) FileExists(path string) (bool, error) {
+	return d.Exists(context.Background(), path)
+}
+
+// GetFileInfo returns information about a file
+func (d *DedupFileStorage) GetFileInfo(path string) (*FileInfo, error) {
+	return d.Stat(context.Background(), path)
+}
+
+// Upload hashes file into a temporary file and stores it, or adds a
+// reference to the stored file with the same content. The stored file
+// keeps the extension of the first upload of its content.
+func (d *DedupFileStorage) Upload(ctx context.Context, file io.Reader, filename string, mimeType string) (string, error) {
+	if file == nil {
+		return "", fmt.Errorf("file reader cannot be nil")
+	}
+
+	// The hash is needed before the underlying storage sees the content
+	spool, err := os.CreateTemp("", "tripflow-upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(spool, io.TeeReader(&contextReader{ctx: ctx, r: file}, hash))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file content: %w", err)
+	}
+	if size == 0 {
+		return "", fmt.Errorf("file is empty")
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	for {
+		path, found, err := d.index.Acquire(ctx, checksum)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up blob: %w", err)
+		}
+		if found {
+			return path, nil
+		}
+
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return "", fmt.Errorf("failed to rewind temporary file: %w", err)
+		}
+		path, err = d.storage.Upload(ctx, spool, filename, mimeType)
+		if err != nil {
+			return "", err
+		}
+
+		err = d.index.Create(ctx, checksum, path, size)
+		if err == nil {
+			return path, nil
+		}
+		d.storage.Delete(context.Background(), path)
+		if !errors.Is(err, ErrBlobExists) {
+			return "", fmt.Errorf("failed to record blob: %w", err)
+		}
+		// A concurrent upload of the same content won; refer to its copy
+	}
+}
+
+// Open opens a file in the underlying storage
+func (d *DedupFileStorage) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	return d.storage.Open(ctx, path)
+}
+
+// OpenRange opens part of a file in the underlying storage
+func (d *DedupFileStorage) OpenRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	return d.storage.OpenRange(ctx, path, offset, length)
+}
+
+// Delete drops a reference to a file and removes it from the underlying
+// storage once no references are left
+func (d *DedupFileStorage) Delete(ctx context.Context, path string) error {
+	last, err := d.index.Release(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to release blob: %w", err)
+	}
+	if !last {
+		return nil
+	}
+	return d.storage.Delete(ctx, path)
+}
+
+// Exists checks if a file exists in the underlying storage
+func (d *DedupFileStorage) Exists(ctx context.Context, path string) (bool, error) {
+	return d.storage.Exists(ctx, path)
+}
+
+// Stat returns information about a file in the underlying storage
+func (d *DedupFileStorage) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	return d.storage.Stat(ctx, path)
+}
+
+// List lists the files in the underlying storage
+func (d *DedupFileStorage) List(ctx context.Context, prefix string) ([]*FileInfo, error) {
+	return d.storage.List(ctx, prefix)
+}
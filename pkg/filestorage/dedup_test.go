@@ -0,0 +1,176 @@
+package filestorage
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoryBlobIndex is an in-memory BlobIndex
+type memoryBlobIndex struct {
+	mu     sync.Mutex
+	paths  map[string]string // checksum -> path
+	counts map[string]int64  // path -> references
+
+	// raceOnce makes the next Acquire miss and the following Create fail,
+	// as if another upload of the same content finished in between
+	raceOnce bool
+}
+
+func newMemoryBlobIndex() *memoryBlobIndex {
+	return &memoryBlobIndex{paths: map[string]string{}, counts: map[string]int64{}}
+}
+
+func (m *memoryBlobIndex) Acquire(ctx context.Context, checksum string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, ok := m.paths[checksum]
+	if !ok || m.raceOnce {
+		return "", false, nil
+	}
+	m.counts[path]++
+	return path, true, nil
+}
+
+func (m *memoryBlobIndex) Create(ctx context.Context, checksum, path string, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.paths[checksum]; ok {
+		m.raceOnce = false
+		return ErrBlobExists
+	}
+	m.paths[checksum] = path
+	m.counts[path] = 1
+	return nil
+}
+
+func (m *memoryBlobIndex) Release(ctx context.Context, path string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count, ok := m.counts[path]
+	if !ok {
+		return true, nil
+	}
+	if count > 1 {
+		m.counts[path] = count - 1
+		return false, nil
+	}
+	delete(m.counts, path)
+	for checksum, p := range m.paths {
+		if p == path {
+			delete(m.paths, checksum)
+		}
+	}
+	return true, nil
+}
+
+func newTestDedupStorage(t *testing.T) (*DedupFileStorage, FileStorageService, *memoryBlobIndex) {
+	t.Helper()
+	local, err := NewLocalFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalFileStorage() error = %v", err)
+	}
+	index := newMemoryBlobIndex()
+	return NewDedupFileStorage(local, index), local, index
+}
+
+func TestDedupFileStorage_SharesContent(t *testing.T) {
+	storage, local, _ := newTestDedupStorage(t)
+	ctx := context.Background()
+
+	itinerary := "# 제주 여행\n\nDay 1: 성산일출봉"
+	var paths []string
+	for i := 0; i < 3; i++ {
+		path, err := storage.UploadFile(strings.NewReader(itinerary), "trip.md", "text/markdown")
+		if err != nil {
+			t.Fatalf("UploadFile() error = %v", err)
+		}
+		paths = append(paths, path)
+	}
+	if paths[0] != paths[1] || paths[1] != paths[2] {
+		t.Errorf("uploads of the same content got paths %v, want one path", paths)
+	}
+
+	other, err := storage.UploadFile(strings.NewReader("# 부산 여행"), "trip.md", "text/markdown")
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	if other == paths[0] {
+		t.Error("different content should get its own path")
+	}
+
+	files, err := AdaptV1(local).List(ctx, "")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(files) != 2 {
+		t.Errorf("underlying storage holds %d files, want 2", len(files))
+	}
+
+	// The stored file goes with its last reference
+	for i := range paths {
+		if err := storage.DeleteFile(paths[i]); err != nil {
+			t.Fatalf("DeleteFile() error = %v", err)
+		}
+		exists, _ := local.FileExists(paths[i])
+		if want := i < len(paths)-1; exists != want {
+			t.Errorf("after %d of %d deletes exists = %v, want %v", i+1, len(paths), exists, want)
+		}
+	}
+
+	// Uploading the content again after it was removed stores it anew
+	again, err := storage.UploadFile(strings.NewReader(itinerary), "trip.md", "text/markdown")
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	if exists, _ := local.FileExists(again); !exists {
+		t.Error("re-uploaded content should be stored")
+	}
+}
+
+func TestDedupFileStorage_ConcurrentUpload(t *testing.T) {
+	storage, local, index := newTestDedupStorage(t)
+
+	first, err := storage.UploadFile(strings.NewReader("same"), "a.md", "text/markdown")
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+
+	index.raceOnce = true
+	second, err := storage.UploadFile(strings.NewReader("same"), "a.md", "text/markdown")
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	if second != first {
+		t.Errorf("losing upload got %s, want the winner's path %s", second, first)
+	}
+	if index.counts[first] != 2 {
+		t.Errorf("references = %d, want 2", index.counts[first])
+	}
+
+	files, _ := AdaptV1(local).List(context.Background(), "")
+	if len(files) != 1 {
+		t.Errorf("underlying storage holds %d files, want the losing copy removed", len(files))
+	}
+}
+
+func TestDedupFileStorage_UnindexedFiles(t *testing.T) {
+	storage, local, _ := newTestDedupStorage(t)
+
+	// Files stored before deduplication was enabled have no blob
+	path, err := local.UploadFile(strings.NewReader("legacy"), "old.md", "text/markdown")
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	if err := storage.DeleteFile(path); err != nil {
+		t.Fatalf("DeleteFile() error = %v", err)
+	}
+	if exists, _ := local.FileExists(path); exists {
+		t.Error("unindexed file should be deleted directly")
+	}
+
+	if _, err := storage.UploadFile(strings.NewReader(""), "empty.md", "text/markdown"); err == nil {
+		t.Error("empty uploads should be rejected")
+	}
+}
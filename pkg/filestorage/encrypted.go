@@ -0,0 +1,573 @@
+package filestorage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrUnknownKey is returned when a file was encrypted with a master key
+	// that is not in the keyring
+	ErrUnknownKey = errors.New("unknown encryption key")
+
+	// ErrDecrypt is returned when an encrypted file fails authentication,
+	// because it was modified or truncated
+	ErrDecrypt = errors.New("failed to decrypt file")
+)
+
+// Encrypted file format. A file starts with a fixed-size header:
+//
+//	magic (8) | key ID length (1) | key ID, zero-padded (32) |
+//	wrapped data key (60) | nonce prefix (7)
+//
+// followed by the content in chunks of encryptedChunkSize bytes, each
+// sealed with AES-256-GCM under the data key and followed by its 16-byte
+// tag. A chunk's nonce is the prefix, the chunk index and a flag marking
+// the last chunk, so chunks cannot be reordered, dropped or truncated
+// unnoticed; the header is authenticated with every chunk.
+const (
+	encryptedMagic     = "\x00TFENC1\x00"
+	encryptedChunkSize = 64 << 10
+
+	maxKeyIDLength   = 32
+	dataKeySize      = 32
+	wrappedKeySize   = 12 + dataKeySize + 16 // Nonce, key and tag
+	noncePrefixSize  = 7
+	encryptedTagSize = 16
+
+	encryptedHeaderSize = len(encryptedMagic) + 1 + maxKeyIDLength + wrappedKeySize + noncePrefixSize
+)
+
+// MasterKey is a named AES-256 key that wraps the data keys of files
+type MasterKey struct {
+	ID  string
+	Key []byte
+}
+
+// Keyring holds the master keys files can be decrypted with. New files are
+// encrypted with the primary key; keys retired by a rotation stay in the
+// keyring so files they wrapped can still be read.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring whose primary key is the first one
+func NewKeyring(keys ...MasterKey) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("keyring needs at least one key")
+	}
+	keyring := &Keyring{primary: keys[0].ID, keys: make(map[string]cipher.AEAD)}
+	for _, key := range keys {
+		if key.ID == "" || len(key.ID) > maxKeyIDLength || strings.ContainsRune(key.ID, 0) {
+			return nil, fmt.Errorf("key ID %q must be 1 to %d bytes", key.ID, maxKeyIDLength)
+		}
+		if _, dup := keyring.keys[key.ID]; dup {
+			return nil, fmt.Errorf("duplicate key ID %q", key.ID)
+		}
+		if len(key.Key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes, got %d", key.ID, len(key.Key))
+		}
+		aead, err := newGCM(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", key.ID, err)
+		}
+		keyring.keys[key.ID] = aead
+	}
+	return keyring, nil
+}
+
+// ParseKeyring parses comma-separated "<id>:<base64 key>" pairs, as in
+// FILE_STORAGE_ENCRYPTION_KEYS. The first key is the primary key.
+func ParseKeyring(value string) (*Keyring, error) {
+	var keys []MasterKey
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("encryption key %q must be <id>:<base64 key>", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %q: %w", id, err)
+		}
+		keys = append(keys, MasterKey{ID: strings.TrimSpace(id), Key: key})
+	}
+	return NewKeyring(keys...)
+}
+
+// wrap seals a data key with the primary key
+func (k *Keyring) wrap(dataKey []byte) (string, []byte, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	aead := k.keys[k.primary]
+	return k.primary, aead.Seal(nonce, nonce, dataKey, []byte(k.primary)), nil
+}
+
+// unwrap opens a data key wrapped by the named key
+func (k *Keyring) unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+	dataKey, err := aead.Open(nil, wrapped[:12], wrapped[12:], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: data key does not match key %q", ErrDecrypt, keyID)
+	}
+	return dataKey, nil
+}
+
+// EncryptedFileStorage encrypts files at rest on top of another storage
+// (envelope encryption). Each file gets its own random AES-256 data key,
+// stored in the file's header wrapped by a master key from the keyring.
+// Rotating the master key only changes which key wraps new data keys, so
+// existing files are not rewritten; the old key must stay in the keyring
+// while files it wrapped exist.
+//
+// Content is encrypted and decrypted in chunks while it streams, so large
+// files are never held in memory and ranges only decrypt the chunks they
+// cover. Files stored before encryption was enabled are read as they are.
+type EncryptedFileStorage struct {
+	storage FileStorageServiceV2
+	keys    *Keyring
+}
+
+// NewEncryptedFileStorage creates an encrypting storage over storage
+func NewEncryptedFileStorage(storage FileStorageService, keys *Keyring) *EncryptedFileStorage {
+	return &EncryptedFileStorage{
+		storage: AdaptV1(storage),
+		keys:    keys,
+	}
+}
+
+// UploadFile encrypts and stores a file
+func (e *EncryptedFileStorage) UploadFile(file io.Reader, filename string, mimeType string) (string, error) {
+	return e.Upload(context.Background(), file, filename, mimeType)
+}
+
+// GetFile retrieves and decrypts a file
+func (e *EncryptedFileStorage) GetFile(path string) (io.Reader, error) {
+	return e.Open(context.Background(), path)
+}
+
+// DeleteFile removes a file from the underlying storage
+func (e *EncryptedFileStorage) DeleteFile(path string) error {
+	return e.Delete(context.Background(), path)
+}
+
+// FileExists checks if a file exists in the underlying storage
+func (e *EncryptedFileStorage) FileExists(path string) (bool, error) {
+	return e.Exists(context.Background(), path)
+}
+
+// GetFileInfo returns information about the decrypted file
+func (e *EncryptedFileStorage) GetFileInfo(path string) (*FileInfo, error) {
+	return e.Stat(context.Background(), path)
+}
+
+// Upload encrypts file with a new data key while it is stored
+func (e *EncryptedFileStorage) Upload(ctx context.Context, file io.Reader, filename string, mimeType string) (string, error) {
+	if file == nil {
+		return "", fmt.Errorf("file reader cannot be nil")
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	keyID, wrapped, err := e.keys.wrap(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	header := &encryptedHeader{keyID: keyID, wrappedKey: wrapped, noncePrefix: make([]byte, noncePrefixSize)}
+	if _, err := rand.Read(header.noncePrefix); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	encrypted := &encryptReader{
+		aead:    aead,
+		header:  header,
+		source:  bufio.NewReaderSize(file, encryptedChunkSize),
+		pending: header.marshal(),
+	}
+	return e.storage.Upload(ctx, encrypted, filename, mimeType)
+}
+
+// Open decrypts a whole file while it is read
+func (e *EncryptedFileStorage) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := e.storage.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, encryptedHeaderSize)
+	n, err := io.ReadFull(rc, prefix)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		rc.Close()
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	header, err := parseEncryptedHeader(prefix[:n])
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	if header == nil {
+		// Stored before encryption was enabled
+		return &readCloser{Reader: io.MultiReader(bytes.NewReader(prefix[:n]), rc), Closer: rc}, nil
+	}
+
+	decrypted, err := e.decryptReader(header, rc, 0, -1)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	return &readCloser{Reader: decrypted, Closer: rc}, nil
+}
+
+// OpenRange decrypts part of a file, reading only the chunks the range
+// covers
+func (e *EncryptedFileStorage) OpenRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	info, err := e.storage.Stat(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	header, err := e.readHeader(ctx, path, info.Size)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return e.storage.OpenRange(ctx, path, offset, length)
+	}
+
+	size, err := decryptedSize(info.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	if err := checkRange(offset, size); err != nil {
+		return nil, err
+	}
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+
+	// Read whole chunks from the one holding offset to the one holding
+	// the last byte, then drop what lies outside the range
+	first := offset / encryptedChunkSize
+	last := chunkCount(size) - 1
+	through := last
+	if end > offset {
+		through = (end - 1) / encryptedChunkSize
+	}
+	cipherOffset := int64(encryptedHeaderSize) + first*(encryptedChunkSize+encryptedTagSize)
+	cipherLength := (through - first + 1) * (encryptedChunkSize + encryptedTagSize)
+
+	rc, err := e.storage.OpenRange(ctx, path, cipherOffset, cipherLength)
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := e.decryptReader(header, rc, first, last)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	if _, err := io.CopyN(io.Discard, decrypted, offset-first*encryptedChunkSize); err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	return &readCloser{Reader: io.LimitReader(decrypted, end-offset), Closer: rc}, nil
+}
+
+// Delete removes a file from the underlying storage
+func (e *EncryptedFileStorage) Delete(ctx context.Context, path string) error {
+	return e.storage.Delete(ctx, path)
+}
+
+// Exists checks if a file exists in the underlying storage
+func (e *EncryptedFileStorage) Exists(ctx context.Context, path string) (bool, error) {
+	return e.storage.Exists(ctx, path)
+}
+
+// Stat returns information about a file with the size of its decrypted
+// content. The underlying checksum is of the encrypted content, so it is
+// left out for encrypted files.
+func (e *EncryptedFileStorage) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	info, err := e.storage.Stat(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return e.decryptedInfo(ctx, info)
+}
+
+// List lists the files in the underlying storage with their decrypted
+// sizes, which takes reading the header of each file
+func (e *EncryptedFileStorage) List(ctx context.Context, prefix string) ([]*FileInfo, error) {
+	files, err := e.storage.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, info := range files {
+		if files[i], err = e.decryptedInfo(ctx, info); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// decryptedInfo returns info with the decrypted size of an encrypted file
+func (e *EncryptedFileStorage) decryptedInfo(ctx context.Context, info *FileInfo) (*FileInfo, error) {
+	header, err := e.readHeader(ctx, info.Path, info.Size)
+	if err != nil || header == nil {
+		return info, err
+	}
+	size, err := decryptedSize(info.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", info.Path, err)
+	}
+	decrypted := *info
+	decrypted.Size = size
+	decrypted.Checksum = ""
+	return &decrypted, nil
+}
+
+// readHeader reads the header of a stored file of size bytes, returning nil
+// for files that are not encrypted
+func (e *EncryptedFileStorage) readHeader(ctx context.Context, path string, size int64) (*encryptedHeader, error) {
+	if size < int64(encryptedHeaderSize) {
+		return nil, nil
+	}
+	rc, err := e.storage.OpenRange(ctx, path, 0, int64(encryptedHeaderSize))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data := make([]byte, encryptedHeaderSize)
+	if _, err := io.ReadFull(rc, data); err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	header, err := parseEncryptedHeader(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	return header, nil
+}
+
+// decryptReader unwraps the file's data key and decrypts r, which starts
+// at chunk first. last is the index of the file's last chunk, or -1 to
+// find it at the end of r.
+func (e *EncryptedFileStorage) decryptReader(header *encryptedHeader, r io.Reader, first, last int64) (io.Reader, error) {
+	dataKey, err := e.keys.unwrap(header.keyID, header.wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		aead:   aead,
+		header: header,
+		source: bufio.NewReaderSize(r, encryptedChunkSize+encryptedTagSize),
+		index:  first,
+		last:   last,
+	}, nil
+}
+
+// encryptedHeader is the header of an encrypted file
+type encryptedHeader struct {
+	keyID       string
+	wrappedKey  []byte
+	noncePrefix []byte
+	raw         []byte // The header as stored, authenticated with each chunk
+}
+
+// marshal encodes the header, keeping the result in h.raw
+func (h *encryptedHeader) marshal() []byte {
+	data := make([]byte, 0, encryptedHeaderSize)
+	data = append(data, encryptedMagic...)
+	data = append(data, byte(len(h.keyID)))
+	data = append(data, h.keyID...)
+	data = append(data, make([]byte, maxKeyIDLength-len(h.keyID))...)
+	data = append(data, h.wrappedKey...)
+	data = append(data, h.noncePrefix...)
+	h.raw = data
+	return data
+}
+
+// parseEncryptedHeader decodes a header, returning nil when data does not
+// start with one
+func parseEncryptedHeader(data []byte) (*encryptedHeader, error) {
+	if len(data) < encryptedHeaderSize || string(data[:len(encryptedMagic)]) != encryptedMagic {
+		return nil, nil
+	}
+	data = data[:encryptedHeaderSize]
+	rest := data[len(encryptedMagic):]
+
+	idLength := int(rest[0])
+	if idLength == 0 || idLength > maxKeyIDLength {
+		return nil, fmt.Errorf("%w: invalid header", ErrDecrypt)
+	}
+	rest = rest[1:]
+	header := &encryptedHeader{keyID: string(rest[:idLength]), raw: data}
+	rest = rest[maxKeyIDLength:]
+	header.wrappedKey, rest = rest[:wrappedKeySize], rest[wrappedKeySize:]
+	header.noncePrefix = rest[:noncePrefixSize]
+	return header, nil
+}
+
+// chunkNonce returns the nonce of a chunk
+func (h *encryptedHeader) chunkNonce(index int64, last bool) []byte {
+	nonce := make([]byte, 0, 12)
+	nonce = append(nonce, h.noncePrefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, uint32(index))
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// chunkCount returns the number of chunks holding size bytes; empty files
+// have one empty chunk
+func chunkCount(size int64) int64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + encryptedChunkSize - 1) / encryptedChunkSize
+}
+
+// decryptedSize returns the content size of an encrypted file of size bytes
+func decryptedSize(size int64) (int64, error) {
+	body := size - int64(encryptedHeaderSize)
+	full := body / (encryptedChunkSize + encryptedTagSize)
+	rest := body % (encryptedChunkSize + encryptedTagSize)
+	if body < encryptedTagSize || (rest > 0 && rest < encryptedTagSize) {
+		return 0, fmt.Errorf("%w: file is truncated", ErrDecrypt)
+	}
+	if rest == 0 {
+		return full * encryptedChunkSize, nil
+	}
+	return full*encryptedChunkSize + rest - encryptedTagSize, nil
+}
+
+// encryptReader produces the header and the encrypted chunks of source
+type encryptReader struct {
+	aead    cipher.AEAD
+	header  *encryptedHeader
+	source  *bufio.Reader
+	index   int64
+	pending []byte
+	done    bool
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if r.index > 1<<32-1 {
+			return 0, fmt.Errorf("file is too large to encrypt")
+		}
+
+		chunk := make([]byte, encryptedChunkSize, encryptedChunkSize+encryptedTagSize)
+		n, err := io.ReadFull(r.source, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		// A full chunk is the last one when nothing follows it
+		last := n < encryptedChunkSize
+		if !last {
+			if _, err := r.source.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+
+		r.pending = r.aead.Seal(chunk[:0], r.header.chunkNonce(r.index, last), chunk[:n], r.header.raw)
+		r.index++
+		r.done = last
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// decryptReader produces the content of the encrypted chunks in source
+type decryptReader struct {
+	aead    cipher.AEAD
+	header  *encryptedHeader
+	source  *bufio.Reader
+	index   int64
+	last    int64 // -1 when unknown
+	pending []byte
+	done    bool
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		chunk := make([]byte, encryptedChunkSize+encryptedTagSize)
+		n, err := io.ReadFull(r.source, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		last := r.index == r.last
+		if r.last < 0 {
+			last = n < len(chunk)
+			if !last {
+				if _, err := r.source.Peek(1); err == io.EOF {
+					last = true
+				} else if err != nil {
+					return 0, err
+				}
+			}
+		}
+
+		// Chunks cut short fail here, since their tag is missing or the
+		// nonce does not mark them as the last one
+		plain, err := r.aead.Open(chunk[:0], r.header.chunkNonce(r.index, last), chunk[:n], r.header.raw)
+		if err != nil {
+			return 0, fmt.Errorf("%w: chunk %d failed authentication", ErrDecrypt, r.index)
+		}
+		r.pending = plain
+		r.index++
+		r.done = last
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// newGCM returns AES-GCM with key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
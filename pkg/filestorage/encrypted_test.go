@@ -0,0 +1,217 @@
+package filestorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testMasterKey(t *testing.T, id string) MasterKey {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return MasterKey{ID: id, Key: key}
+}
+
+func newTestEncryptedStorage(t *testing.T, keys ...MasterKey) (*EncryptedFileStorage, FileStorageService, string) {
+	t.Helper()
+	dir := t.TempDir()
+	local, err := NewLocalFileStorage(dir)
+	if err != nil {
+		t.Fatalf("NewLocalFileStorage() error = %v", err)
+	}
+	keyring, err := NewKeyring(keys...)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	return NewEncryptedFileStorage(local, keyring), local, dir
+}
+
+func TestEncryptedFileStorage_RoundTrip(t *testing.T) {
+	storage, local, dir := newTestEncryptedStorage(t, testMasterKey(t, "k1"))
+	ctx := context.Background()
+
+	sizes := []int{0, 1, encryptedChunkSize - 1, encryptedChunkSize, encryptedChunkSize + 1, 3*encryptedChunkSize + 5}
+	for _, size := range sizes {
+		passport := []byte("여권번호 M12345678 ")
+		content := bytes.Repeat(passport, size/len(passport)+1)[:size]
+		path, err := storage.Upload(ctx, bytes.NewReader(content), "trip.md", "text/markdown")
+		if err != nil {
+			t.Fatalf("Upload(%d bytes) error = %v", size, err)
+		}
+
+		stored, _ := os.ReadFile(filepath.Join(dir, path))
+		if size >= len(passport) && bytes.Contains(stored, passport) {
+			t.Errorf("%d bytes: stored file contains plaintext", size)
+		}
+		if raw, _ := local.GetFileInfo(path); raw.Size != int64(len(stored)) {
+			t.Errorf("%d bytes: underlying size = %d, want %d", size, raw.Size, len(stored))
+		}
+
+		rc, err := storage.Open(ctx, path)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("%d bytes: Open() read %d bytes, %v", size, len(got), err)
+		}
+
+		info, err := storage.Stat(ctx, path)
+		if err != nil || info.Size != int64(size) || info.Checksum != "" {
+			t.Errorf("%d bytes: Stat() = %+v, %v", size, info, err)
+		}
+	}
+}
+
+func TestEncryptedFileStorage_OpenRange(t *testing.T) {
+	storage, _, _ := newTestEncryptedStorage(t, testMasterKey(t, "k1"))
+	ctx := context.Background()
+
+	content := make([]byte, 2*encryptedChunkSize+100)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	path, err := storage.Upload(ctx, bytes.NewReader(content), "photo.png", "image/png")
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	tests := []struct{ offset, length int64 }{
+		{0, 10},
+		{encryptedChunkSize - 5, 10}, // Across a chunk boundary
+		{encryptedChunkSize, encryptedChunkSize},
+		{2 * encryptedChunkSize, -1},
+		{100, -1},
+		{int64(len(content)) - 1, 1000}, // Past the end is shortened
+	}
+	for _, tt := range tests {
+		rc, err := storage.OpenRange(ctx, path, tt.offset, tt.length)
+		if err != nil {
+			t.Fatalf("OpenRange(%d, %d) error = %v", tt.offset, tt.length, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+
+		end := int64(len(content))
+		if tt.length >= 0 && tt.offset+tt.length < end {
+			end = tt.offset + tt.length
+		}
+		if err != nil || !bytes.Equal(got, content[tt.offset:end]) {
+			t.Errorf("OpenRange(%d, %d) read %d bytes, %v; want %d", tt.offset, tt.length, len(got), err, end-tt.offset)
+		}
+	}
+
+	if _, err := storage.OpenRange(ctx, path, int64(len(content)), 1); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("OpenRange() past the end error = %v, want ErrInvalidRange", err)
+	}
+}
+
+func TestEncryptedFileStorage_KeyRotation(t *testing.T) {
+	oldKey, newKey := testMasterKey(t, "2024"), testMasterKey(t, "2025")
+	before, local, _ := newTestEncryptedStorage(t, oldKey)
+
+	oldPath, err := before.UploadFile(strings.NewReader("booking ABC123"), "a.md", "text/markdown")
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+
+	// The new key encrypts new files; the old one still opens old files
+	keyring, _ := NewKeyring(newKey, oldKey)
+	rotated := NewEncryptedFileStorage(local, keyring)
+	newPath, err := rotated.UploadFile(strings.NewReader("booking XYZ789"), "b.md", "text/markdown")
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	for path, want := range map[string]string{oldPath: "booking ABC123", newPath: "booking XYZ789"} {
+		reader, err := rotated.GetFile(path)
+		if err != nil {
+			t.Fatalf("GetFile(%s) error = %v", path, err)
+		}
+		if got, _ := io.ReadAll(reader); string(got) != want {
+			t.Errorf("GetFile(%s) = %q, want %q", path, got, want)
+		}
+	}
+
+	if _, err := before.GetFile(newPath); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("GetFile() without the new key error = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestEncryptedFileStorage_Tampering(t *testing.T) {
+	storage, _, dir := newTestEncryptedStorage(t, testMasterKey(t, "k1"))
+	content := bytes.Repeat([]byte("x"), encryptedChunkSize+10)
+	path, err := storage.UploadFile(bytes.NewReader(content), "a.md", "text/markdown")
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	fullPath := filepath.Join(dir, path)
+	stored, _ := os.ReadFile(fullPath)
+
+	read := func() error {
+		reader, err := storage.GetFile(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(reader)
+		return err
+	}
+
+	flipped := bytes.Clone(stored)
+	flipped[encryptedHeaderSize+5] ^= 1
+	os.WriteFile(fullPath, flipped, 0644)
+	if err := read(); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("reading a modified file error = %v, want ErrDecrypt", err)
+	}
+
+	// Dropping the last chunk leaves a valid-looking file
+	os.WriteFile(fullPath, stored[:encryptedHeaderSize+encryptedChunkSize+encryptedTagSize], 0644)
+	if err := read(); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("reading a truncated file error = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestEncryptedFileStorage_PlaintextFiles(t *testing.T) {
+	storage, local, _ := newTestEncryptedStorage(t, testMasterKey(t, "k1"))
+
+	// Files stored before encryption was enabled are read as they are
+	path, err := local.UploadFile(strings.NewReader("# 오래된 일정"), "old.md", "text/markdown")
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	reader, err := storage.GetFile(path)
+	if err != nil {
+		t.Fatalf("GetFile() error = %v", err)
+	}
+	if got, _ := io.ReadAll(reader); string(got) != "# 오래된 일정" {
+		t.Errorf("GetFile() = %q", got)
+	}
+	info, err := storage.GetFileInfo(path)
+	if err != nil || info.Size != int64(len("# 오래된 일정")) || info.Checksum == "" {
+		t.Errorf("GetFileInfo() = %+v, %v", info, err)
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	keyring, err := ParseKeyring("2025:" + key + ", 2024:" + key)
+	if err != nil || keyring.primary != "2025" || len(keyring.keys) != 2 {
+		t.Errorf("ParseKeyring() = %+v, %v", keyring, err)
+	}
+
+	for _, invalid := range []string{"", "2025", "2025:short", "a:" + key + ",a:" + key, strings.Repeat("k", 33) + ":" + key} {
+		if _, err := ParseKeyring(invalid); err == nil {
+			t.Errorf("ParseKeyring(%q) should fail", invalid)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package filestorage
 
 import (
 	"io"
+	"time"
 )
 
 // FileStorageService defines the interface for file storage operations
@@ -55,5 +56,11 @@ type FileInfo struct {
 	Path     string `json:"path"`     // Relative path of the file
 	Size     int64  `json:"size"`     // File size in bytes
 	MimeType string `json:"mimeType"` // MIME type of the file
-	// Add more fields as needed (e.g., CreatedAt, ModifiedAt, etc.)
+
+	// ModTime is when the file was last written; zero if unknown
+	ModTime time.Time `json:"modTime"`
+
+	// Checksum is the hex-encoded SHA-256 of the content. Stat fills it in
+	// when the backend knows it; List leaves it empty.
+	Checksum string `json:"checksum,omitempty"`
 }
@@ -1,18 +1,40 @@
 package filestorage
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+// localTempPrefix names the temporary files content is written to before
+// it is moved into place
+const localTempPrefix = ".upload-"
+
 // LocalFileStorage implements FileStorageService using the local filesystem
 type LocalFileStorage struct {
 	baseDir string // Base directory for storing files
+
+	// checksums caches the SHA-256 of files by path, so Stat only hashes
+	// a file again after it changed on disk
+	checksums sync.Map // map[string]localChecksum
+}
+
+// localChecksum is a cached checksum and the file state it was computed for
+type localChecksum struct {
+	size    int64
+	modTime time.Time
+	sum     string
 }
 
 // NewLocalFileStorage creates a new LocalFileStorage instance
@@ -46,6 +68,32 @@ func NewLocalFileStorage(basePath string) (FileStorageService, error) {
 
 // UploadFile uploads a file to the local filesystem
 func (lfs *LocalFileStorage) UploadFile(file io.Reader, filename string, mimeType string) (string, error) {
+	return lfs.Upload(context.Background(), file, filename, mimeType)
+}
+
+// GetFile retrieves a file from the local filesystem
+func (lfs *LocalFileStorage) GetFile(path string) (io.Reader, error) {
+	return lfs.Open(context.Background(), path)
+}
+
+// DeleteFile removes a file from the local filesystem
+func (lfs *LocalFileStorage) DeleteFile(path string) error {
+	return lfs.Delete(context.Background(), path)
+}
+
+// FileExists checks if a file exists in the local filesystem
+func (lfs *LocalFileStorage) FileExists(path string) (bool, error) {
+	return lfs.Exists(context.Background(), path)
+}
+
+// GetFileInfo returns information about a file
+func (lfs *LocalFileStorage) GetFileInfo(path string) (*FileInfo, error) {
+	return lfs.Stat(context.Background(), path)
+}
+
+// Upload uploads a file to the local filesystem, stopping if ctx is
+// cancelled while the content is copied
+func (lfs *LocalFileStorage) Upload(ctx context.Context, file io.Reader, filename string, mimeType string) (string, error) {
 	if file == nil {
 		return "", fmt.Errorf("file reader cannot be nil")
 	}
@@ -54,6 +102,10 @@ func (lfs *LocalFileStorage) UploadFile(file io.Reader, filename string, mimeTyp
 		return "", fmt.Errorf("filename cannot be empty")
 	}
 
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
 	// Generate a unique filename to prevent collisions
 	uniqueID := uuid.New().String()
 	ext := filepath.Ext(filename)
@@ -61,71 +113,94 @@ func (lfs *LocalFileStorage) UploadFile(file io.Reader, filename string, mimeTyp
 		// If no extension, try to determine from MIME type
 		ext = getExtensionFromMimeType(mimeType)
 	}
-	
+
 	uniqueFilename := uniqueID + ext
 	relativePath := filepath.Join("uploads", uniqueFilename)
-	fullPath := filepath.Join(lfs.baseDir, relativePath)
+	if err := lfs.writeFile(ctx, filepath.Join(lfs.baseDir, relativePath), file); err != nil {
+		return "", err
+	}
+
+	// Return the relative path (Unix-style separators for consistency)
+	return strings.ReplaceAll(relativePath, "\\", "/"), nil
+}
 
+// UploadAt stores the content of file at path, replacing any file there
+func (lfs *LocalFileStorage) UploadAt(ctx context.Context, path string, file io.Reader, mimeType string) error {
+	if file == nil {
+		return fmt.Errorf("file reader cannot be nil")
+	}
+
+	fullPath, err := lfs.resolvePath(ctx, path)
+	if err != nil {
+		return err
+	}
+	return lfs.writeFile(ctx, fullPath, file)
+}
+
+// writeFile writes the content of file to fullPath. The content is
+// written to a temporary file next to it first, so an interrupted write
+// never leaves a partial file at fullPath.
+func (lfs *LocalFileStorage) writeFile(ctx context.Context, fullPath string, file io.Reader) error {
 	// Ensure the uploads directory exists
 	uploadDir := filepath.Dir(fullPath)
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create upload directory: %w", err)
+		return fmt.Errorf("failed to create upload directory: %w", err)
 	}
 
 	// Create the file
-	destFile, err := os.Create(fullPath)
+	destFile, err := os.CreateTemp(uploadDir, localTempPrefix+"*")
 	if err != nil {
-		return "", fmt.Errorf("failed to create file %s: %w", fullPath, err)
+		return fmt.Errorf("failed to create file %s: %w", fullPath, err)
 	}
+	tempPath := destFile.Name()
 	defer destFile.Close()
 
-	// Copy the file content
-	bytesWritten, err := io.Copy(destFile, file)
+	// Copy the file content, hashing it on the way
+	hash := sha256.New()
+	bytesWritten, err := io.Copy(destFile, io.TeeReader(&contextReader{ctx: ctx, r: file}, hash))
 	if err != nil {
 		// Clean up the file if copy failed
-		os.Remove(fullPath)
-		return "", fmt.Errorf("failed to write file content: %w", err)
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write file content: %w", err)
 	}
 
 	if bytesWritten == 0 {
 		// Clean up empty file
-		os.Remove(fullPath)
-		return "", fmt.Errorf("file is empty")
+		os.Remove(tempPath)
+		return fmt.Errorf("file is empty")
 	}
 
-	// Return the relative path (Unix-style separators for consistency)
-	return strings.ReplaceAll(relativePath, "\\", "/"), nil
-}
-
-// GetFile retrieves a file from the local filesystem
-func (lfs *LocalFileStorage) GetFile(path string) (io.Reader, error) {
-	if path == "" {
-		return nil, fmt.Errorf("path cannot be empty")
+	if err := destFile.Close(); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write file content: %w", err)
 	}
-
-	// Construct the full path
-	fullPath := filepath.Join(lfs.baseDir, path)
-	
-	// Security check: ensure the path is within baseDir
-	absBaseDir, err := filepath.Abs(lfs.baseDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get absolute base directory: %w", err)
+	if err := os.Chmod(tempPath, 0644); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write file content: %w", err)
 	}
-	
-	absFullPath, err := filepath.Abs(fullPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get absolute file path: %w", err)
+	if err := os.Rename(tempPath, fullPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to create file %s: %w", fullPath, err)
 	}
-	
-	if !strings.HasPrefix(absFullPath, absBaseDir) {
-		return nil, fmt.Errorf("path traversal detected: %s", path)
+	if info, err := os.Stat(fullPath); err == nil {
+		lfs.checksums.Store(fullPath, localChecksum{size: info.Size(), modTime: info.ModTime(), sum: hex.EncodeToString(hash.Sum(nil))})
+	}
+	return nil
+}
+
+// Open opens a file in the local filesystem. The returned *os.File also
+// implements io.ReaderAt and io.Seeker.
+func (lfs *LocalFileStorage) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	fullPath, err := lfs.resolvePath(ctx, path)
+	if err != nil {
+		return nil, err
 	}
 
 	// Open the file
 	file, err := os.Open(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("file not found: %s", path)
+			return nil, notFoundError(path)
 		}
 		return nil, fmt.Errorf("failed to open file %s: %w", path, err)
 	}
@@ -133,63 +208,55 @@ func (lfs *LocalFileStorage) GetFile(path string) (io.Reader, error) {
 	return file, nil
 }
 
-// DeleteFile removes a file from the local filesystem
-func (lfs *LocalFileStorage) DeleteFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("path cannot be empty")
+// OpenRange opens part of a file in the local filesystem
+func (lfs *LocalFileStorage) OpenRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := lfs.Open(ctx, path)
+	if err != nil {
+		return nil, err
 	}
+	file := rc.(*os.File)
 
-	// Construct the full path
-	fullPath := filepath.Join(lfs.baseDir, path)
-	
-	// Security check: ensure the path is within baseDir
-	absBaseDir, err := filepath.Abs(lfs.baseDir)
+	info, err := file.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to get absolute base directory: %w", err)
+		file.Close()
+		return nil, fmt.Errorf("failed to get file info: %w", err)
 	}
-	
-	absFullPath, err := filepath.Abs(fullPath)
-	if err != nil {
-		return fmt.Errorf("failed to get absolute file path: %w", err)
+	if err := checkRange(offset, info.Size()); err != nil {
+		file.Close()
+		return nil, err
 	}
-	
-	if !strings.HasPrefix(absFullPath, absBaseDir) {
-		return fmt.Errorf("path traversal detected: %s", path)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek file %s: %w", path, err)
+	}
+
+	return limitReadCloser(file, length), nil
+}
+
+// Delete removes a file from the local filesystem
+func (lfs *LocalFileStorage) Delete(ctx context.Context, path string) error {
+	fullPath, err := lfs.resolvePath(ctx, path)
+	if err != nil {
+		return err
 	}
 
 	// Remove the file
 	if err := os.Remove(fullPath); err != nil {
 		if os.IsNotExist(err) {
-			return fmt.Errorf("file not found: %s", path)
+			return notFoundError(path)
 		}
 		return fmt.Errorf("failed to delete file %s: %w", path, err)
 	}
+	lfs.checksums.Delete(fullPath)
 
 	return nil
 }
 
-// FileExists checks if a file exists in the local filesystem
-func (lfs *LocalFileStorage) FileExists(path string) (bool, error) {
-	if path == "" {
-		return false, fmt.Errorf("path cannot be empty")
-	}
-
-	// Construct the full path
-	fullPath := filepath.Join(lfs.baseDir, path)
-	
-	// Security check: ensure the path is within baseDir
-	absBaseDir, err := filepath.Abs(lfs.baseDir)
+// Exists checks if a file exists in the local filesystem
+func (lfs *LocalFileStorage) Exists(ctx context.Context, path string) (bool, error) {
+	fullPath, err := lfs.resolvePath(ctx, path)
 	if err != nil {
-		return false, fmt.Errorf("failed to get absolute base directory: %w", err)
-	}
-	
-	absFullPath, err := filepath.Abs(fullPath)
-	if err != nil {
-		return false, fmt.Errorf("failed to get absolute file path: %w", err)
-	}
-	
-	if !strings.HasPrefix(absFullPath, absBaseDir) {
-		return false, fmt.Errorf("path traversal detected: %s", path)
+		return false, err
 	}
 
 	_, err = os.Stat(fullPath)
@@ -203,35 +270,18 @@ func (lfs *LocalFileStorage) FileExists(path string) (bool, error) {
 	return true, nil
 }
 
-// GetFileInfo returns information about a file
-func (lfs *LocalFileStorage) GetFileInfo(path string) (*FileInfo, error) {
-	if path == "" {
-		return nil, fmt.Errorf("path cannot be empty")
-	}
-
-	// Construct the full path
-	fullPath := filepath.Join(lfs.baseDir, path)
-	
-	// Security check: ensure the path is within baseDir
-	absBaseDir, err := filepath.Abs(lfs.baseDir)
+// Stat returns information about a file in the local filesystem
+func (lfs *LocalFileStorage) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	fullPath, err := lfs.resolvePath(ctx, path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get absolute base directory: %w", err)
-	}
-	
-	absFullPath, err := filepath.Abs(fullPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get absolute file path: %w", err)
-	}
-	
-	if !strings.HasPrefix(absFullPath, absBaseDir) {
-		return nil, fmt.Errorf("path traversal detected: %s", path)
+		return nil, err
 	}
 
 	// Get file information
 	fileInfo, err := os.Stat(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("file not found: %s", path)
+			return nil, notFoundError(path)
 		}
 		return nil, fmt.Errorf("failed to get file info: %w", err)
 	}
@@ -239,13 +289,137 @@ func (lfs *LocalFileStorage) GetFileInfo(path string) (*FileInfo, error) {
 	// Determine MIME type from file extension
 	mimeType := getMimeTypeFromExtension(filepath.Ext(path))
 
+	checksum, err := lfs.checksum(fullPath, fileInfo)
+	if err != nil {
+		return nil, err
+	}
+
 	return &FileInfo{
 		Path:     path,
 		Size:     fileInfo.Size(),
 		MimeType: mimeType,
+		ModTime:  fileInfo.ModTime(),
+		Checksum: checksum,
 	}, nil
 }
 
+// checksum returns the SHA-256 of a file, hashing it only when the cached
+// value was computed for a different size or modification time
+func (lfs *LocalFileStorage) checksum(fullPath string, info os.FileInfo) (string, error) {
+	if cached, ok := lfs.checksums.Load(fullPath); ok {
+		entry := cached.(localChecksum)
+		if entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+			return entry.sum, nil
+		}
+	}
+
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s: %w", fullPath, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash file %s: %w", fullPath, err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	lfs.checksums.Store(fullPath, localChecksum{size: info.Size(), modTime: info.ModTime(), sum: sum})
+	return sum, nil
+}
+
+// List returns the files under the base directory whose relative paths
+// start with prefix
+func (lfs *LocalFileStorage) List(ctx context.Context, prefix string) ([]*FileInfo, error) {
+	if strings.Contains(prefix, "..") {
+		return nil, fmt.Errorf("path traversal detected: %s", prefix)
+	}
+
+	// Only walk the directory the prefix points into
+	root := lfs.baseDir
+	if dir := prefix[:strings.LastIndex(prefix, "/")+1]; dir != "" {
+		root = filepath.Join(lfs.baseDir, filepath.FromSlash(dir))
+	}
+
+	var files []*FileInfo
+	err := filepath.WalkDir(root, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && fullPath == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Skip files being written by writeFile
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), localTempPrefix) {
+			return nil
+		}
+
+		relative, err := filepath.Rel(lfs.baseDir, fullPath)
+		if err != nil {
+			return err
+		}
+		relative = filepath.ToSlash(relative)
+		if !strings.HasPrefix(relative, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, &FileInfo{
+			Path:     relative,
+			Size:     info.Size(),
+			MimeType: getMimeTypeFromExtension(filepath.Ext(relative)),
+			ModTime:  info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	// WalkDir visits files in lexical order of their path elements, which
+	// differs from plain string order when names contain "." or "-"
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// resolvePath returns the full path of a relative path, rejecting paths
+// outside the base directory
+func (lfs *LocalFileStorage) resolvePath(ctx context.Context, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path cannot be empty")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// Construct the full path
+	fullPath := filepath.Join(lfs.baseDir, path)
+
+	// Security check: ensure the path is within baseDir
+	absBaseDir, err := filepath.Abs(lfs.baseDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute base directory: %w", err)
+	}
+
+	absFullPath, err := filepath.Abs(fullPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute file path: %w", err)
+	}
+
+	if !strings.HasPrefix(absFullPath, absBaseDir) {
+		return "", fmt.Errorf("path traversal detected: %s", path)
+	}
+
+	return fullPath, nil
+}
+
 // getExtensionFromMimeType attempts to determine file extension from MIME type
 func getExtensionFromMimeType(mimeType string) string {
 	switch mimeType {
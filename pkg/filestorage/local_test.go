@@ -1,6 +1,7 @@
 package filestorage
 
 import (
+	"context"
 	"io"
 	"os"
 	"path/filepath"
@@ -397,6 +398,39 @@ func TestLocalFileStorage_GetFileInfo(t *testing.T) {
 	}
 }
 
+func TestLocalFileStorage_UploadAt(t *testing.T) {
+	storage, err := NewLocalFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	local := storage.(*LocalFileStorage)
+	ctx := context.Background()
+
+	// Writing again replaces the file
+	for _, content := range []string{"# 초안", "# 제주 여행"} {
+		if err := local.UploadAt(ctx, "uploads/trip.md", strings.NewReader(content), "text/markdown"); err != nil {
+			t.Fatalf("UploadAt() error = %v", err)
+		}
+	}
+	info, err := local.Stat(ctx, "uploads/trip.md")
+	if err != nil || info.Size != int64(len("# 제주 여행")) {
+		t.Errorf("Stat() = %+v, %v", info, err)
+	}
+	if files, _ := local.List(ctx, "uploads/"); len(files) != 1 {
+		t.Errorf("List() = %d files, want 1", len(files))
+	}
+
+	if err := local.UploadAt(ctx, "../escape.md", strings.NewReader("x"), ""); err == nil {
+		t.Error("UploadAt() outside the base directory should fail")
+	}
+	if err := local.UploadAt(ctx, "uploads/empty.md", strings.NewReader(""), ""); err == nil {
+		t.Error("UploadAt() of an empty file should fail")
+	}
+	if exists, _ := local.Exists(ctx, "uploads/empty.md"); exists {
+		t.Error("a failed UploadAt() should not leave a file")
+	}
+}
+
 func TestLocalFileStorage_PathTraversalSecurity(t *testing.T) {
 	// Create a temporary directory for testing
 	tempDir, err := os.MkdirTemp("", "tripflow-test-*")
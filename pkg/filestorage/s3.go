@@ -0,0 +1,652 @@
+package filestorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// minS3PartSize is the smallest part S3 accepts in a multipart upload,
+	// other than the last one
+	minS3PartSize = 5 << 20
+
+	// defaultS3PartSize is the part size used when S3Config.PartSize is unset
+	defaultS3PartSize = 8 << 20
+
+	// checksumHeader carries the SHA-256 of single-request uploads as user
+	// metadata. Multipart uploads are hashed only after their first part
+	// is sent, so they have none.
+	checksumHeader = "X-Amz-Meta-Sha256"
+)
+
+// S3Config holds configuration for S3-compatible object storage
+type S3Config struct {
+	Endpoint        string // e.g. "http://localhost:9000"; empty means AWS for the region
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Optional, for temporary credentials
+	Prefix          string // Optional key prefix, e.g. "tripflow/"
+	ForcePathStyle  bool   // Address the bucket in the path instead of the host name
+	PartSize        int64  // Multipart part size in bytes; at least 5 MiB
+
+	// HTTPClient sends the requests; http.DefaultClient when nil
+	HTTPClient *http.Client
+}
+
+// S3FileStorage implements FileStorageService on an S3-compatible object
+// store. Files larger than one part are sent as multipart uploads.
+type S3FileStorage struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	pathStyle bool
+	partSize  int64
+	client    *http.Client
+	signer    *sigV4Signer
+	now       func() time.Time
+}
+
+// NewS3FileStorage creates a new S3FileStorage instance
+// Parameters:
+//   - config: bucket, credentials and endpoint of the object store
+// Returns:
+//   - FileStorageService: interface implementation
+//   - error: any error that occurred during initialization
+func NewS3FileStorage(config *S3Config) (FileStorageService, error) {
+	if config == nil {
+		return nil, fmt.Errorf("s3 config cannot be nil")
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket cannot be empty")
+	}
+	if config.Region == "" {
+		return nil, fmt.Errorf("s3 region cannot be empty")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("s3 credentials cannot be empty")
+	}
+
+	rawEndpoint := config.Endpoint
+	pathStyle := config.ForcePathStyle
+	if rawEndpoint == "" {
+		rawEndpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(rawEndpoint, "/"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", config.Endpoint)
+	}
+	// Bucket names with dots do not match the wildcard TLS certificate
+	if strings.Contains(config.Bucket, ".") {
+		pathStyle = true
+	}
+
+	partSize := config.PartSize
+	if partSize == 0 {
+		partSize = defaultS3PartSize
+	}
+	if partSize < minS3PartSize {
+		partSize = minS3PartSize
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	prefix := strings.Trim(config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &S3FileStorage{
+		endpoint:  endpoint,
+		bucket:    config.Bucket,
+		prefix:    prefix,
+		pathStyle: pathStyle,
+		partSize:  partSize,
+		client:    client,
+		signer: &sigV4Signer{
+			accessKeyID:     config.AccessKeyID,
+			secretAccessKey: config.SecretAccessKey,
+			sessionToken:    config.SessionToken,
+			region:          config.Region,
+		},
+		now: time.Now,
+	}, nil
+}
+
+// S3Error is an error response returned by the object store
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3 request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3 request failed with status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// UploadFile uploads a file to the bucket
+func (s *S3FileStorage) UploadFile(file io.Reader, filename string, mimeType string) (string, error) {
+	return s.Upload(context.Background(), file, filename, mimeType)
+}
+
+// GetFile retrieves a file from the bucket; the returned reader is the
+// response body and must be closed
+func (s *S3FileStorage) GetFile(path string) (io.Reader, error) {
+	return s.Open(context.Background(), path)
+}
+
+// DeleteFile removes a file from the bucket
+func (s *S3FileStorage) DeleteFile(path string) error {
+	return s.Delete(context.Background(), path)
+}
+
+// FileExists checks if a file exists in the bucket
+func (s *S3FileStorage) FileExists(path string) (bool, error) {
+	return s.Exists(context.Background(), path)
+}
+
+// GetFileInfo returns information about a file
+func (s *S3FileStorage) GetFileInfo(path string) (*FileInfo, error) {
+	return s.Stat(context.Background(), path)
+}
+
+// Upload uploads a file to the bucket
+func (s *S3FileStorage) Upload(ctx context.Context, file io.Reader, filename string, mimeType string) (string, error) {
+	if file == nil {
+		return "", fmt.Errorf("file reader cannot be nil")
+	}
+
+	if filename == "" {
+		return "", fmt.Errorf("filename cannot be empty")
+	}
+
+	// Generate a unique key the same way LocalFileStorage names files
+	ext := filepath.Ext(filename)
+	if ext == "" {
+		ext = getExtensionFromMimeType(mimeType)
+	}
+	relativePath := path.Join("uploads", uuid.New().String()+ext)
+	if err := s.put(ctx, relativePath, file, mimeType); err != nil {
+		return "", err
+	}
+	return relativePath, nil
+}
+
+// UploadAt stores the content of file under the key for path, replacing
+// any object there
+func (s *S3FileStorage) UploadAt(ctx context.Context, path string, file io.Reader, mimeType string) error {
+	if file == nil {
+		return fmt.Errorf("file reader cannot be nil")
+	}
+	if path == "" {
+		return fmt.Errorf("path cannot be empty")
+	}
+	return s.put(ctx, path, file, mimeType)
+}
+
+// put uploads the content of file to the key for path
+func (s *S3FileStorage) put(ctx context.Context, path string, file io.Reader, mimeType string) error {
+	if mimeType == "" {
+		mimeType = getMimeTypeFromExtension(filepath.Ext(path))
+	}
+
+	// Read one part ahead to decide between a single PUT and a multipart
+	// upload without buffering the whole file
+	first, err := readPart(file, s.partSize)
+	if err != nil {
+		return fmt.Errorf("failed to read file content: %w", err)
+	}
+	if len(first) == 0 {
+		return fmt.Errorf("file is empty")
+	}
+
+	if int64(len(first)) < s.partSize {
+		if err := s.putObject(ctx, path, first, mimeType); err != nil {
+			return fmt.Errorf("failed to upload file: %w", err)
+		}
+		return nil
+	}
+
+	if err := s.multipartUpload(ctx, path, first, file, mimeType); err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	return nil
+}
+
+// Open retrieves a file from the bucket; the returned reader is the
+// response body
+func (s *S3FileStorage) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, _, err := s.get(ctx, path, nil)
+	return rc, err
+}
+
+// OpenRange retrieves part of a file with a ranged GET
+func (s *S3FileStorage) OpenRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: offset %d", ErrInvalidRange, offset)
+	}
+	if length == 0 {
+		// HTTP ranges cannot be empty, so only check the start
+		info, err := s.Stat(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkRange(offset, info.Size); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange += strconv.FormatInt(offset+length-1, 10)
+	}
+	rc, partial, err := s.get(ctx, path, http.Header{"Range": {byteRange}})
+	if errors.Is(err, ErrInvalidRange) && offset == 0 {
+		// S3 refuses every range of an empty object
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	if err != nil || partial {
+		return rc, err
+	}
+
+	// Stores that ignore the Range header send the whole object
+	if _, err := io.CopyN(io.Discard, rc, offset); err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to seek file %s: %w", path, err)
+	}
+	return limitReadCloser(rc, length), nil
+}
+
+// get sends a GET request for an object, optionally for a range, and
+// reports whether the response holds only the requested range
+func (s *S3FileStorage) get(ctx context.Context, path string, header http.Header) (io.ReadCloser, bool, error) {
+	if err := validateObjectPath(path); err != nil {
+		return nil, false, err
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, path, nil, nil, header)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, false, nil
+	case http.StatusPartialContent:
+		return resp.Body, true, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, false, notFoundError(path)
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return nil, false, fmt.Errorf("%w: %s for %s", ErrInvalidRange, header.Get("Range"), path)
+	default:
+		defer resp.Body.Close()
+		return nil, false, fmt.Errorf("failed to open file %s: %w", path, readS3Error(resp))
+	}
+}
+
+// Delete removes a file from the bucket
+func (s *S3FileStorage) Delete(ctx context.Context, path string) error {
+	// S3 reports success when deleting a missing key, so check first to
+	// report missing files the way LocalFileStorage does
+	exists, err := s.Exists(ctx, path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return notFoundError(path)
+	}
+
+	resp, err := s.do(ctx, http.MethodDelete, path, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete file %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to delete file %s: %w", path, readS3Error(resp))
+	}
+
+	return nil
+}
+
+// Exists checks if a file exists in the bucket
+func (s *S3FileStorage) Exists(ctx context.Context, path string) (bool, error) {
+	resp, err := s.head(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check file existence: %w", readS3Error(resp))
+	}
+}
+
+// Stat returns information about a file in the bucket
+func (s *S3FileStorage) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	resp, err := s.head(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, notFoundError(path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get file info: %w", readS3Error(resp))
+	}
+
+	// Match LocalFileStorage, which derives the MIME type from the extension
+	mimeType := getMimeTypeFromExtension(filepath.Ext(path))
+	if mimeType == "application/octet-stream" && resp.Header.Get("Content-Type") != "" {
+		mimeType = resp.Header.Get("Content-Type")
+	}
+
+	// Unparsable dates leave ModTime zero rather than failing the call
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	return &FileInfo{
+		Path:     path,
+		Size:     resp.ContentLength,
+		MimeType: mimeType,
+		ModTime:  modTime,
+		Checksum: resp.Header.Get(checksumHeader),
+	}, nil
+}
+
+// List returns the files in the bucket whose paths start with prefix,
+// following ListObjectsV2 continuation tokens
+func (s *S3FileStorage) List(ctx context.Context, prefix string) ([]*FileInfo, error) {
+	var files []*FileInfo
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", err)
+		}
+
+		var result struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = readS3Error(resp)
+		} else {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			key := strings.TrimPrefix(object.Key, s.prefix)
+			files = append(files, &FileInfo{
+				Path:     key,
+				Size:     object.Size,
+				MimeType: getMimeTypeFromExtension(filepath.Ext(key)),
+				ModTime:  object.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// head sends a HEAD request for an object
+func (s *S3FileStorage) head(ctx context.Context, path string) (*http.Response, error) {
+	if err := validateObjectPath(path); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, path, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	return resp, nil
+}
+
+// putObject stores body under a single PUT request, recording its SHA-256
+// as object metadata so Stat can report it
+func (s *S3FileStorage) putObject(ctx context.Context, path string, body []byte, mimeType string) error {
+	header := http.Header{"Content-Type": {mimeType}, checksumHeader: {hashHex(body)}}
+	resp, err := s.do(ctx, http.MethodPut, path, nil, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readS3Error(resp)
+	}
+	return nil
+}
+
+// completedPart is one part listed in a CompleteMultipartUpload request
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// multipartUpload uploads first and the rest of file as the parts of a
+// multipart upload, aborting it if any part fails
+func (s *S3FileStorage) multipartUpload(ctx context.Context, path string, first []byte, file io.Reader, mimeType string) error {
+	uploadID, err := s.createMultipartUpload(ctx, path, mimeType)
+	if err != nil {
+		return err
+	}
+
+	parts, err := s.uploadParts(ctx, path, uploadID, first, file)
+	if err == nil {
+		err = s.completeMultipartUpload(ctx, path, uploadID, parts)
+	}
+	if err != nil {
+		// Abandoned parts are billed until the upload is aborted, so abort
+		// even when ctx is what failed
+		if resp, abortErr := s.do(context.Background(), http.MethodDelete, path, url.Values{"uploadId": {uploadID}}, nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// createMultipartUpload starts a multipart upload and returns its ID
+func (s *S3FileStorage) createMultipartUpload(ctx context.Context, path, mimeType string) (string, error) {
+	resp, err := s.do(ctx, http.MethodPost, path, url.Values{"uploads": {""}}, nil, http.Header{"Content-Type": {mimeType}})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", readS3Error(resp)
+	}
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadID == "" {
+		return "", fmt.Errorf("invalid CreateMultipartUpload response: %v", err)
+	}
+	return result.UploadID, nil
+}
+
+// uploadParts sends first and then successive parts read from file
+func (s *S3FileStorage) uploadParts(ctx context.Context, path, uploadID string, first []byte, file io.Reader) ([]completedPart, error) {
+	var parts []completedPart
+	part := first
+	for number := 1; len(part) > 0; number++ {
+		query := url.Values{
+			"partNumber": {strconv.Itoa(number)},
+			"uploadId":   {uploadID},
+		}
+		resp, err := s.do(ctx, http.MethodPut, path, query, part, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, readS3Error(resp)
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+		if int64(len(part)) < s.partSize {
+			break
+		}
+		if part, err = readPart(file, s.partSize); err != nil {
+			return nil, fmt.Errorf("failed to read file content: %w", err)
+		}
+	}
+	return parts, nil
+}
+
+// completeMultipartUpload assembles the uploaded parts into the object
+func (s *S3FileStorage) completeMultipartUpload(ctx context.Context, path, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPost, path, url.Values{"uploadId": {uploadID}}, body, http.Header{"Content-Type": {"application/xml"}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// CompleteMultipartUpload can fail after responding 200, in which case
+	// the body holds an error document instead of the result
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || bytes.Contains(data, []byte("<Error>")) {
+		return parseS3Error(resp.StatusCode, data)
+	}
+	return nil
+}
+
+// do sends a signed request for the object at path, or for the bucket
+// when path is empty
+func (s *S3FileStorage) do(ctx context.Context, method, path string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(path, query), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = hashHex(body)
+	}
+	s.signer.sign(req, payloadHash, s.now())
+
+	return s.client.Do(req)
+}
+
+// objectURL returns the URL of the object stored for path
+func (s *S3FileStorage) objectURL(path string, query url.Values) string {
+	u := *s.endpoint
+	key := ""
+	if path != "" {
+		key = s.prefix + path
+	}
+	if s.pathStyle {
+		u.Path = s.endpoint.Path + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + s.endpoint.Host
+		u.Path = s.endpoint.Path + "/" + key
+	}
+	// Encode the path the way it is signed
+	u.RawPath = sigV4EncodePath(u.Path)
+	u.RawQuery = sigV4Query(query)
+	return u.String()
+}
+
+// readPart reads up to size bytes, returning fewer only at the end of r
+func readPart(r io.Reader, size int64) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return buf[:n], err
+}
+
+// readS3Error reads the error document of a failed response
+func readS3Error(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return parseS3Error(resp.StatusCode, data)
+}
+
+// parseS3Error decodes an S3 error document
+func parseS3Error(statusCode int, data []byte) error {
+	s3Err := &S3Error{StatusCode: statusCode}
+	xml.Unmarshal(data, s3Err)
+	return s3Err
+}
+
+// validateObjectPath rejects empty paths and paths that would escape the
+// key prefix
+func validateObjectPath(p string) error {
+	if p == "" {
+		return fmt.Errorf("path cannot be empty")
+	}
+	if strings.HasPrefix(p, "/") || strings.Contains(p, "\\") {
+		return fmt.Errorf("path traversal detected: %s", p)
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." || segment == "." {
+			return fmt.Errorf("path traversal detected: %s", p)
+		}
+	}
+	return nil
+}
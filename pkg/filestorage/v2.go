@@ -0,0 +1,331 @@
+package filestorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrNotFound is wrapped by errors for files that do not exist
+	ErrNotFound = errors.New("file not found")
+
+	// ErrInvalidRange is returned when a range starts past the end of a file
+	ErrInvalidRange = errors.New("invalid range")
+
+	// ErrListNotSupported is returned by List on adapted storages that
+	// cannot enumerate their files
+	ErrListNotSupported = errors.New("listing files is not supported")
+)
+
+// FileStorageServiceV2 is the context-aware successor of FileStorageService.
+// Readers are returned as io.ReadCloser, files can be read in ranges, and
+// stored files can be listed. Errors for missing files wrap ErrNotFound.
+//
+// LocalFileStorage and S3FileStorage implement both interfaces; AdaptV1 and
+// AsV1 convert between them while callers migrate.
+type FileStorageServiceV2 interface {
+	// Upload stores the content of file and returns its unique relative path
+	Upload(ctx context.Context, file io.Reader, filename string, mimeType string) (string, error)
+
+	// Open returns the whole content of a file; the caller must close it
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+
+	// OpenRange returns length bytes of a file starting at offset, or the
+	// rest of the file when length is negative. Ranges that start at or
+	// past the end of a non-empty file fail with ErrInvalidRange; ranges
+	// that run past the end are shortened.
+	OpenRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error)
+
+	// Delete removes a file
+	Delete(ctx context.Context, path string) error
+
+	// Exists reports whether a file exists
+	Exists(ctx context.Context, path string) (bool, error)
+
+	// Stat returns information about a file
+	Stat(ctx context.Context, path string) (*FileInfo, error)
+
+	// List returns the files whose paths start with prefix, sorted by path
+	List(ctx context.Context, prefix string) ([]*FileInfo, error)
+}
+
+// KeyedUploader is implemented by storages that can store a file at a
+// path chosen by the caller. Files copied between such storages keep their
+// paths, so records and links that refer to them stay valid.
+type KeyedUploader interface {
+	// UploadAt stores the content of file at path, replacing any file there
+	UploadAt(ctx context.Context, path string, file io.Reader, mimeType string) error
+}
+
+// notFoundError returns an error wrapping ErrNotFound for path
+func notFoundError(path string) error {
+	return fmt.Errorf("%w: %s", ErrNotFound, path)
+}
+
+// AdaptV1 returns a FileStorageServiceV2 backed by a FileStorageService.
+// Storages that already implement the v2 interface are returned as they
+// are; others get contexts checked before each call, range reads served by
+// seeking or skipping, and List failing with ErrListNotSupported.
+func AdaptV1(storage FileStorageService) FileStorageServiceV2 {
+	if v2, ok := storage.(FileStorageServiceV2); ok {
+		return v2
+	}
+	return &v1Adapter{storage: storage}
+}
+
+// AsV1 returns a FileStorageService backed by a FileStorageServiceV2, for
+// callers that have not migrated; every call uses context.Background
+func AsV1(storage FileStorageServiceV2) FileStorageService {
+	if v1, ok := storage.(FileStorageService); ok {
+		return v1
+	}
+	if adapter, ok := storage.(*v1Adapter); ok {
+		return adapter.storage
+	}
+	return &v2Adapter{storage: storage}
+}
+
+// v1Adapter implements FileStorageServiceV2 on a FileStorageService
+type v1Adapter struct {
+	storage FileStorageService
+}
+
+func (a *v1Adapter) Upload(ctx context.Context, file io.Reader, filename string, mimeType string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return a.storage.UploadFile(&contextReader{ctx: ctx, r: file}, filename, mimeType)
+}
+
+func (a *v1Adapter) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	reader, err := a.storage.GetFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if rc, ok := reader.(io.ReadCloser); ok {
+		return rc, nil
+	}
+	return io.NopCloser(reader), nil
+}
+
+func (a *v1Adapter) OpenRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	info, err := a.Stat(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRange(offset, info.Size); err != nil {
+		return nil, err
+	}
+
+	rc, err := a.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if seeker, ok := rc.(io.Seeker); ok {
+		_, err = seeker.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, rc, offset)
+	}
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to seek file %s: %w", path, err)
+	}
+	return limitReadCloser(rc, length), nil
+}
+
+func (a *v1Adapter) Delete(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.storage.DeleteFile(path)
+}
+
+func (a *v1Adapter) Exists(ctx context.Context, path string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return a.storage.FileExists(path)
+}
+
+func (a *v1Adapter) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.storage.GetFileInfo(path)
+}
+
+func (a *v1Adapter) List(ctx context.Context, prefix string) ([]*FileInfo, error) {
+	return nil, ErrListNotSupported
+}
+
+// v2Adapter implements FileStorageService on a FileStorageServiceV2
+type v2Adapter struct {
+	storage FileStorageServiceV2
+}
+
+func (a *v2Adapter) UploadFile(file io.Reader, filename string, mimeType string) (string, error) {
+	return a.storage.Upload(context.Background(), file, filename, mimeType)
+}
+
+func (a *v2Adapter) GetFile(path string) (io.Reader, error) {
+	return a.storage.Open(context.Background(), path)
+}
+
+func (a *v2Adapter) DeleteFile(path string) error {
+	return a.storage.Delete(context.Background(), path)
+}
+
+func (a *v2Adapter) FileExists(path string) (bool, error) {
+	return a.storage.Exists(context.Background(), path)
+}
+
+func (a *v2Adapter) GetFileInfo(path string) (*FileInfo, error) {
+	return a.storage.Stat(context.Background(), path)
+}
+
+// NewReaderAt returns an io.ReaderAt over a stored file and the file's
+// size, so it can be wrapped in an io.SectionReader. Each ReadAt issues a
+// range read.
+func NewReaderAt(ctx context.Context, storage FileStorageServiceV2, path string) (io.ReaderAt, int64, error) {
+	info, err := storage.Stat(ctx, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &rangeReaderAt{ctx: ctx, storage: storage, path: path, size: info.Size}, info.Size, nil
+}
+
+// rangeReaderAt implements io.ReaderAt with OpenRange
+type rangeReaderAt struct {
+	ctx     context.Context
+	storage FileStorageServiceV2
+	path    string
+	size    int64
+}
+
+func (r *rangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	want := int64(len(p))
+	if remaining := r.size - off; want > remaining {
+		want = remaining
+	}
+	rc, err := r.storage.OpenRange(r.ctx, r.path, off, want)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	n, err := io.ReadFull(rc, p[:want])
+	if err == nil && int(want) < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// NewReadSeeker returns an io.ReadSeekCloser over a stored file of the
+// given size, for http.ServeContent. Nothing is read until the first Read,
+// which opens the rest of the file from the current offset in one range
+// read; seeking elsewhere closes it.
+func NewReadSeeker(ctx context.Context, storage FileStorageServiceV2, path string, size int64) io.ReadSeekCloser {
+	return &rangeReadSeeker{ctx: ctx, storage: storage, path: path, size: size}
+}
+
+// rangeReadSeeker implements io.ReadSeekCloser with OpenRange
+type rangeReadSeeker struct {
+	ctx     context.Context
+	storage FileStorageServiceV2
+	path    string
+	size    int64
+	offset  int64
+	body    io.ReadCloser // Open range starting at offset, if any
+}
+
+func (r *rangeReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.storage.OpenRange(r.ctx, r.path, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *rangeReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *rangeReadSeeker) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// checkRange validates the start of a range against the file size
+func checkRange(offset, size int64) error {
+	if offset < 0 || (offset >= size && !(offset == 0 && size == 0)) {
+		return fmt.Errorf("%w: offset %d of %d bytes", ErrInvalidRange, offset, size)
+	}
+	return nil
+}
+
+// limitReadCloser limits rc to length bytes, or leaves it whole when
+// length is negative
+func limitReadCloser(rc io.ReadCloser, length int64) io.ReadCloser {
+	if length < 0 {
+		return rc
+	}
+	return &readCloser{Reader: io.LimitReader(rc, length), Closer: rc}
+}
+
+// readCloser pairs a reader with the closer of the stream it reads from
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// contextReader stops reading once its context is done, so long copies
+// can be cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,367 @@
+package filestorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readerOnlyStorage is a FileStorageService that only implements the v1
+// interface and returns plain readers, like third-party implementations
+type readerOnlyStorage struct {
+	files map[string]string
+}
+
+func (s *readerOnlyStorage) UploadFile(file io.Reader, filename string, mimeType string) (string, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	s.files[filename] = string(data)
+	return filename, nil
+}
+
+func (s *readerOnlyStorage) GetFile(path string) (io.Reader, error) {
+	content, ok := s.files[path]
+	if !ok {
+		return nil, notFoundError(path)
+	}
+	// Hide strings.Reader's Seek so ranges are served by skipping
+	return io.MultiReader(strings.NewReader(content)), nil
+}
+
+func (s *readerOnlyStorage) DeleteFile(path string) error {
+	delete(s.files, path)
+	return nil
+}
+
+func (s *readerOnlyStorage) FileExists(path string) (bool, error) {
+	_, ok := s.files[path]
+	return ok, nil
+}
+
+func (s *readerOnlyStorage) GetFileInfo(path string) (*FileInfo, error) {
+	content, ok := s.files[path]
+	if !ok {
+		return nil, notFoundError(path)
+	}
+	return &FileInfo{Path: path, Size: int64(len(content))}, nil
+}
+
+// testV2Storages returns a local, an S3 and an adapted v1 storage, each
+// holding "uploads/trip.md" with the given content
+func testV2Storages(t *testing.T, content string) map[string]FileStorageServiceV2 {
+	t.Helper()
+
+	dir := t.TempDir()
+	local, err := NewLocalFileStorage(dir)
+	if err != nil {
+		t.Fatalf("NewLocalFileStorage() error = %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "uploads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "uploads", "trip.md"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fake, server := newFakeS3(t)
+	fake.objects["uploads/trip.md"] = []byte(content)
+
+	return map[string]FileStorageServiceV2{
+		"local":   AdaptV1(local),
+		"s3":      newTestS3Storage(t, server.URL),
+		"adapted": AdaptV1(&readerOnlyStorage{files: map[string]string{"uploads/trip.md": content}}),
+	}
+}
+
+func TestFileStorageServiceV2_OpenRange(t *testing.T) {
+	content := "0123456789abcdef"
+	ctx := context.Background()
+
+	tests := []struct {
+		name           string
+		offset, length int64
+		want           string
+		wantErr        error
+	}{
+		{name: "Whole file", offset: 0, length: -1, want: content},
+		{name: "Middle", offset: 4, length: 6, want: "456789"},
+		{name: "Rest", offset: 10, length: -1, want: "abcdef"},
+		{name: "Past the end is shortened", offset: 12, length: 100, want: "cdef"},
+		{name: "Empty", offset: 3, length: 0, want: ""},
+		{name: "Start past the end", offset: 16, length: 1, wantErr: ErrInvalidRange},
+	}
+
+	for name, storage := range testV2Storages(t, content) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				rc, err := storage.OpenRange(ctx, "uploads/trip.md", tt.offset, tt.length)
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Errorf("OpenRange() error = %v, want %v", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("OpenRange() error = %v", err)
+				}
+				defer rc.Close()
+				got, _ := io.ReadAll(rc)
+				if string(got) != tt.want {
+					t.Errorf("OpenRange() = %q, want %q", got, tt.want)
+				}
+			})
+		}
+
+		t.Run(name+"/Not found", func(t *testing.T) {
+			if _, err := storage.Open(ctx, "uploads/missing.md"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Open() error = %v, want ErrNotFound", err)
+			}
+			if _, err := storage.OpenRange(ctx, "uploads/missing.md", 0, 1); !errors.Is(err, ErrNotFound) {
+				t.Errorf("OpenRange() error = %v, want ErrNotFound", err)
+			}
+			if _, err := storage.Stat(ctx, "uploads/missing.md"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Stat() error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestFileStorageServiceV2_IgnoredRange(t *testing.T) {
+	fake, server := newFakeS3(t)
+	storage := newTestS3Storage(t, server.URL)
+	fake.objects["uploads/a.md"] = []byte("0123456789")
+	fake.ignoreRange = true
+
+	rc, err := storage.OpenRange(context.Background(), "uploads/a.md", 3, 4)
+	if err != nil {
+		t.Fatalf("OpenRange() error = %v", err)
+	}
+	defer rc.Close()
+	if got, _ := io.ReadAll(rc); string(got) != "3456" {
+		t.Errorf("OpenRange() = %q, want 3456 from a server that ignores ranges", got)
+	}
+}
+
+func TestFileStorageServiceV2_ReaderAt(t *testing.T) {
+	content := "제주 여행 일정: Day 1, Day 2"
+	ctx := context.Background()
+
+	for name, storage := range testV2Storages(t, content) {
+		t.Run(name, func(t *testing.T) {
+			readerAt, size, err := NewReaderAt(ctx, storage, "uploads/trip.md")
+			if err != nil {
+				t.Fatalf("NewReaderAt() error = %v", err)
+			}
+			section := io.NewSectionReader(readerAt, int64(len("제주 ")), size)
+			got, err := io.ReadAll(io.LimitReader(section, int64(len("여행"))))
+			if err != nil || string(got) != "여행" {
+				t.Errorf("section read = %q, %v; want 여행", got, err)
+			}
+
+			buf := make([]byte, 10)
+			n, err := readerAt.ReadAt(buf, size-4)
+			if n != 4 || err != io.EOF || string(buf[:n]) != "ay 2" {
+				t.Errorf("ReadAt() at the end = %d, %v, %q", n, err, buf[:n])
+			}
+		})
+	}
+}
+
+func TestFileStorageServiceV2_List(t *testing.T) {
+	ctx := context.Background()
+	for name, storage := range testV2Storages(t, "x") {
+		if name == "adapted" {
+			if _, err := storage.List(ctx, ""); !errors.Is(err, ErrListNotSupported) {
+				t.Errorf("adapted List() error = %v, want ErrListNotSupported", err)
+			}
+			continue
+		}
+
+		t.Run(name, func(t *testing.T) {
+			var want []string
+			for _, filename := range []string{"b.png", "a.md", "c.gif"} {
+				path, err := storage.Upload(ctx, strings.NewReader("content"), filename, "")
+				if err != nil {
+					t.Fatalf("Upload() error = %v", err)
+				}
+				want = append(want, path)
+			}
+			want = append(want, "uploads/trip.md")
+
+			files, err := storage.List(ctx, "uploads/")
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			var got []string
+			for _, file := range files {
+				got = append(got, file.Path)
+				if file.Path == "uploads/trip.md" && (file.Size != 1 || file.MimeType != "text/markdown") {
+					t.Errorf("List() entry = %+v", file)
+				}
+			}
+			if len(got) != len(want) {
+				t.Fatalf("List() = %v, want %d files", got, len(want))
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i-1] >= got[i] {
+					t.Errorf("List() = %v, should be sorted", got)
+				}
+			}
+
+			if files, err := storage.List(ctx, "uploads/trip"); err != nil || len(files) != 1 {
+				t.Errorf("List(uploads/trip) = %v, %v; want one file", files, err)
+			}
+			if files, err := storage.List(ctx, "other/"); err != nil || len(files) != 0 {
+				t.Errorf("List(other/) = %v, %v; want none", files, err)
+			}
+		})
+	}
+}
+
+func TestFileStorageServiceV2_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for name, storage := range testV2Storages(t, "content") {
+		t.Run(name, func(t *testing.T) {
+			if _, err := storage.Upload(ctx, strings.NewReader("x"), "a.md", ""); !errors.Is(err, context.Canceled) {
+				t.Errorf("Upload() error = %v, want context.Canceled", err)
+			}
+			if _, err := storage.Open(ctx, "uploads/trip.md"); !errors.Is(err, context.Canceled) {
+				t.Errorf("Open() error = %v, want context.Canceled", err)
+			}
+			if _, err := storage.Exists(ctx, "uploads/trip.md"); !errors.Is(err, context.Canceled) {
+				t.Errorf("Exists() error = %v, want context.Canceled", err)
+			}
+		})
+	}
+}
+
+func TestAdapters(t *testing.T) {
+	local, err := NewLocalFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalFileStorage() error = %v", err)
+	}
+	if AdaptV1(local) != local.(FileStorageServiceV2) || AsV1(local.(FileStorageServiceV2)) != local {
+		t.Error("storages implementing both interfaces should not be wrapped")
+	}
+
+	v1 := &readerOnlyStorage{files: map[string]string{}}
+	if AsV1(AdaptV1(v1)) != v1 {
+		t.Error("AsV1(AdaptV1(s)) should return s")
+	}
+
+	// The v1 view of a v2-only storage returns closable readers
+	roundTrip := AsV1(struct{ FileStorageServiceV2 }{AdaptV1(local)})
+	path, err := roundTrip.UploadFile(strings.NewReader("hello"), "a.md", "text/markdown")
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	reader, err := roundTrip.GetFile(path)
+	if err != nil {
+		t.Fatalf("GetFile() error = %v", err)
+	}
+	if _, ok := reader.(io.Closer); !ok {
+		t.Errorf("GetFile() = %T, should be closable", reader)
+	}
+	reader.(io.Closer).Close()
+}
+
+func TestFileStorageServiceV2_ReadSeeker(t *testing.T) {
+	content := "0123456789abcdef"
+	ctx := context.Background()
+
+	for name, storage := range testV2Storages(t, content) {
+		t.Run(name, func(t *testing.T) {
+			rs := NewReadSeeker(ctx, storage, "uploads/trip.md", int64(len(content)))
+			defer rs.Close()
+
+			if size, err := rs.Seek(0, io.SeekEnd); err != nil || size != int64(len(content)) {
+				t.Errorf("Seek(0, SeekEnd) = %d, %v", size, err)
+			}
+			if _, err := rs.Seek(10, io.SeekStart); err != nil {
+				t.Fatalf("Seek() error = %v", err)
+			}
+			buf := make([]byte, 3)
+			if _, err := io.ReadFull(rs, buf); err != nil || string(buf) != "abc" {
+				t.Errorf("Read() after Seek = %q, %v; want abc", buf, err)
+			}
+			if _, err := io.ReadFull(rs, buf); err != nil || string(buf) != "def" {
+				t.Errorf("second Read() = %q, %v; want def", buf, err)
+			}
+
+			if _, err := rs.Seek(-14, io.SeekCurrent); err != nil {
+				t.Fatalf("Seek() error = %v", err)
+			}
+			if got, _ := io.ReadAll(io.LimitReader(rs, 4)); string(got) != "2345" {
+				t.Errorf("Read() after seeking back = %q, want 2345", got)
+			}
+		})
+	}
+}
+
+func TestFileStorageServiceV2_Metadata(t *testing.T) {
+	ctx := context.Background()
+	content := "# 제주 여행"
+	wantSum := hashHex([]byte(content))
+
+	dir := t.TempDir()
+	local, err := NewLocalFileStorage(dir)
+	if err != nil {
+		t.Fatalf("NewLocalFileStorage() error = %v", err)
+	}
+	_, server := newFakeS3(t)
+	storages := map[string]FileStorageServiceV2{
+		"local": AdaptV1(local),
+		"s3":    newTestS3Storage(t, server.URL),
+	}
+
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			path, err := storage.Upload(ctx, strings.NewReader(content), "trip.md", "text/markdown")
+			if err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+			info, err := storage.Stat(ctx, path)
+			if err != nil {
+				t.Fatalf("Stat() error = %v", err)
+			}
+			if info.Checksum != wantSum {
+				t.Errorf("Stat() checksum = %q, want %q", info.Checksum, wantSum)
+			}
+			if info.ModTime.IsZero() {
+				t.Error("Stat() should report the modification time")
+			}
+
+			files, err := storage.List(ctx, path)
+			if err != nil || len(files) != 1 || !files[0].ModTime.Equal(info.ModTime) {
+				t.Errorf("List() = %v, %v; want ModTime %v", files, err, info.ModTime)
+			}
+		})
+	}
+
+	t.Run("local file changed on disk", func(t *testing.T) {
+		path, err := local.UploadFile(strings.NewReader(content), "trip.md", "text/markdown")
+		if err != nil {
+			t.Fatalf("UploadFile() error = %v", err)
+		}
+		changed := content + "\n\nDay 1"
+		fullPath := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.WriteFile(fullPath, []byte(changed), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := local.GetFileInfo(path)
+		if err != nil {
+			t.Fatalf("GetFileInfo() error = %v", err)
+		}
+		if info.Checksum != hashHex([]byte(changed)) {
+			t.Errorf("GetFileInfo() checksum = %q, should be recomputed after the file changed", info.Checksum)
+		}
+	})
+}
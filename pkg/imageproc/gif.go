@@ -0,0 +1,58 @@
+package imageproc
+
+import "encoding/binary"
+
+// gifFrames counts the frames of a GIF file and the pixels they decode to
+// by walking its blocks, without decompressing any image data. It stops
+// counting at the first malformed block and leaves reporting that to the
+// decoder.
+func gifFrames(data []byte) (frames int, pixels int64) {
+	// Header and logical screen descriptor
+	if len(data) < 13 {
+		return 0, 0
+	}
+	pos := 13 + colorTableSize(data[10])
+
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // Extension: label, then data sub-blocks
+			pos = skipSubBlocks(data, pos+2)
+		case 0x2C: // Image descriptor
+			if pos+10 > len(data) {
+				return frames, pixels
+			}
+			width := int64(binary.LittleEndian.Uint16(data[pos+5:]))
+			height := int64(binary.LittleEndian.Uint16(data[pos+7:]))
+			frames++
+			pixels += width * height
+			// Local color table and LZW minimum code size precede the data
+			pos = skipSubBlocks(data, pos+10+colorTableSize(data[pos+9])+1)
+		default: // Trailer or garbage
+			return frames, pixels
+		}
+	}
+	return frames, pixels
+}
+
+// colorTableSize returns the size in bytes of the color table a GIF
+// descriptor's packed flags announce
+func colorTableSize(flags byte) int {
+	if flags&0x80 == 0 {
+		return 0
+	}
+	return 3 << (int(flags&0x07) + 1)
+}
+
+// skipSubBlocks returns the position after the data sub-blocks starting at
+// pos, or len(data) when they run past the end
+func skipSubBlocks(data []byte, pos int) int {
+	for pos < len(data) {
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos
+		}
+		pos += size
+	}
+	return len(data)
+}
@@ -0,0 +1,317 @@
+// Package imageproc validates, sanitizes and resizes uploaded images using
+// only the standard library decoders and encoders.
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// Supported image formats, as reported by image.DecodeConfig
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+)
+
+// jpegQuality is the quality used when re-encoding JPEG images
+const jpegQuality = 88
+
+var (
+	// ErrUnsupportedFormat is returned for content that is not a JPEG, PNG or GIF
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+
+	// ErrTooLarge is returned when an image exceeds the dimension limits
+	ErrTooLarge = errors.New("image dimensions exceed the limit")
+)
+
+// Limits bounds the dimensions of accepted images. Checking them before
+// decoding protects against small files that decode to huge bitmaps.
+type Limits struct {
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int64
+
+	// Animated GIFs decode every frame, so their frame count and the
+	// pixels of all frames together are bounded too
+	MaxFrames      int
+	MaxTotalPixels int64
+}
+
+// DefaultLimits are the limits applied to uploaded images
+var DefaultLimits = Limits{
+	MaxWidth:       8000,
+	MaxHeight:      8000,
+	MaxPixels:      40_000_000,
+	MaxFrames:      500,
+	MaxTotalPixels: 100_000_000,
+}
+
+// Image is a decoded, sanitized image ready to be stored
+type Image struct {
+	Format   string
+	MimeType string
+	Width    int
+	Height   int
+	Data     []byte      // Re-encoded bytes without EXIF or other metadata
+	Image    image.Image // First frame, upright
+}
+
+// Sniff detects the image format from the leading bytes of a file, ignoring
+// whatever extension or content type the client claimed
+func Sniff(header []byte) (format, mimeType string, err error) {
+	mimeType = http.DetectContentType(header)
+	switch mimeType {
+	case "image/jpeg":
+		return FormatJPEG, mimeType, nil
+	case "image/png":
+		return FormatPNG, mimeType, nil
+	case "image/gif":
+		return FormatGIF, mimeType, nil
+	}
+	return "", mimeType, fmt.Errorf("%w: %s", ErrUnsupportedFormat, mimeType)
+}
+
+// CheckDimensions reads only the image header and checks it against limits
+func CheckDimensions(data []byte, limits Limits) (image.Config, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return image.Config{}, "", fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return image.Config{}, "", fmt.Errorf("%w: empty image", ErrUnsupportedFormat)
+	}
+	if (limits.MaxWidth > 0 && config.Width > limits.MaxWidth) ||
+		(limits.MaxHeight > 0 && config.Height > limits.MaxHeight) ||
+		(limits.MaxPixels > 0 && int64(config.Width)*int64(config.Height) > limits.MaxPixels) {
+		return image.Config{}, "", fmt.Errorf("%w: %dx%d", ErrTooLarge, config.Width, config.Height)
+	}
+	return config, format, nil
+}
+
+// Sanitize validates an uploaded image and re-encodes it, which drops EXIF
+// (including GPS location), XMP, comments and any other embedded metadata.
+// JPEG images are rotated according to their EXIF orientation first, since
+// that information is lost with the metadata.
+func Sanitize(data []byte, limits Limits) (*Image, error) {
+	format, mimeType, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, decoded, err := CheckDimensions(data, limits); err != nil {
+		return nil, err
+	} else if decoded != format {
+		return nil, fmt.Errorf("%w: content is %s but decodes as %s", ErrUnsupportedFormat, format, decoded)
+	}
+
+	var buf bytes.Buffer
+	var frame image.Image
+
+	switch format {
+	case FormatJPEG:
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode JPEG: %w", err)
+		}
+		frame = applyOrientation(img, jpegOrientation(data))
+		if err := jpeg.Encode(&buf, frame, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, fmt.Errorf("failed to encode JPEG: %w", err)
+		}
+
+	case FormatPNG:
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode PNG: %w", err)
+		}
+		frame = img
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("failed to encode PNG: %w", err)
+		}
+
+	case FormatGIF:
+		frames, pixels := gifFrames(data)
+		if (limits.MaxFrames > 0 && frames > limits.MaxFrames) ||
+			(limits.MaxTotalPixels > 0 && pixels > limits.MaxTotalPixels) {
+			return nil, fmt.Errorf("%w: %d frames of %d pixels in total", ErrTooLarge, frames, pixels)
+		}
+
+		// Keep every frame of animations; only metadata blocks are dropped
+		animation, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode GIF: %w", err)
+		}
+		frame = animation.Image[0]
+		if err := gif.EncodeAll(&buf, animation); err != nil {
+			return nil, fmt.Errorf("failed to encode GIF: %w", err)
+		}
+	}
+
+	bounds := frame.Bounds()
+	return &Image{
+		Format:   format,
+		MimeType: mimeType,
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Data:     buf.Bytes(),
+		Image:    frame,
+	}, nil
+}
+
+// Encode encodes a resized variant. GIF variants are stored as PNG since
+// only the first frame is kept.
+func Encode(img image.Image, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatJPEG:
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	default:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+}
+
+// Resize scales img to the given width, keeping the aspect ratio. Each
+// destination pixel averages the source pixels it covers, which gives
+// clean downscaling without an external imaging library. Images are never
+// scaled up.
+func Resize(img image.Image, width int) *image.NRGBA {
+	src := toNRGBA(img)
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if width <= 0 || width >= sw {
+		return src
+	}
+	height := int(float64(sh)*float64(width)/float64(sw) + 0.5)
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xScale := float64(sw) / float64(width)
+	yScale := float64(sh) / float64(height)
+
+	for dy := 0; dy < height; dy++ {
+		y0 := float64(dy) * yScale
+		y1 := y0 + yScale
+		for dx := 0; dx < width; dx++ {
+			x0 := float64(dx) * xScale
+			x1 := x0 + xScale
+
+			// Weighted sums of premultiplied colour so transparent pixels
+			// do not darken the edges
+			var r, g, b, a, total float64
+			for sy := int(y0); sy < sh && float64(sy) < y1; sy++ {
+				wy := overlap(y0, y1, sy)
+				row := src.Pix[sy*src.Stride:]
+				for sx := int(x0); sx < sw && float64(sx) < x1; sx++ {
+					w := wy * overlap(x0, x1, sx)
+					p := row[sx*4 : sx*4+4]
+					alpha := float64(p[3])
+					r += float64(p[0]) * alpha * w
+					g += float64(p[1]) * alpha * w
+					b += float64(p[2]) * alpha * w
+					a += alpha * w
+					total += w
+				}
+			}
+
+			i := dy*dst.Stride + dx*4
+			if a > 0 {
+				dst.Pix[i] = clamp(r / a)
+				dst.Pix[i+1] = clamp(g / a)
+				dst.Pix[i+2] = clamp(b / a)
+			}
+			dst.Pix[i+3] = clamp(a / total)
+		}
+	}
+
+	return dst
+}
+
+// overlap returns how much of the unit cell starting at i lies in [lo, hi)
+func overlap(lo, hi float64, i int) float64 {
+	start, end := float64(i), float64(i+1)
+	if lo > start {
+		start = lo
+	}
+	if hi < end {
+		end = hi
+	}
+	if end <= start {
+		return 0
+	}
+	return end - start
+}
+
+// clamp rounds v into a colour channel value
+func clamp(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// toNRGBA converts any image into an NRGBA image whose bounds start at 0,0
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Rect.Min == (image.Point{}) {
+		return nrgba
+	}
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Rect, img, bounds.Min, draw.Src)
+	return dst
+}
+
+// applyOrientation returns img turned upright for an EXIF orientation value
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	src := toNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // Rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // Mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // Rotated 90° clockwise to display
+				dx, dy = h-1-y, x
+			case 7: // Mirrored along the top-right diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotated 90° counter-clockwise to display
+				dx, dy = y, w-1-x
+			}
+			dst.SetNRGBA(dx, dy, src.NRGBAAt(x, y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,222 @@
+package imageproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage returns a w x h image, red on the left half and blue on the right
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.NRGBA{B: 255, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// jpegWithOrientation encodes img as JPEG with an EXIF segment holding the
+// orientation and a GPS marker string
+func jpegWithOrientation(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	// Little-endian TIFF header with one IFD entry, followed by a fake GPS payload
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00")
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], exifOrientationTag)
+	binary.LittleEndian.PutUint16(entry[2:], 3)
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0)
+	tiff = append(tiff, []byte("GPS 33.4996N 126.5312E")...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, encoded[:2]...)
+	out = append(out, segment...)
+	return append(out, encoded[2:]...)
+}
+
+func TestSniff(t *testing.T) {
+	img := testImage(4, 4)
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "PNG", data: encodePNG(t, img), want: FormatPNG},
+		{name: "JPEG", data: jpegWithOrientation(t, img, 1), want: FormatJPEG},
+		{name: "GIF", data: []byte("GIF89a\x01\x00\x01\x00"), want: FormatGIF},
+		{name: "HTML", data: []byte("<html><script>alert(1)</script>"), wantErr: true},
+		{name: "Text", data: []byte("# Trip"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, _, err := Sniff(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Sniff() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUnsupportedFormat) {
+				t.Errorf("Sniff() error = %v, want ErrUnsupportedFormat", err)
+			}
+			if format != tt.want {
+				t.Errorf("Sniff() = %s, want %s", format, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitize_Limits(t *testing.T) {
+	data := encodePNG(t, testImage(100, 50))
+
+	if _, err := Sanitize(data, Limits{MaxWidth: 80}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Sanitize() error = %v, want ErrTooLarge for width", err)
+	}
+	if _, err := Sanitize(data, Limits{MaxPixels: 4000}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Sanitize() error = %v, want ErrTooLarge for pixels", err)
+	}
+	if _, err := Sanitize(data, DefaultLimits); err != nil {
+		t.Errorf("Sanitize() error = %v", err)
+	}
+
+	// A valid header followed by garbage must not pass
+	truncated := append(append([]byte{}, data[:40]...), make([]byte, 64)...)
+	if _, err := Sanitize(truncated, DefaultLimits); err == nil {
+		t.Error("Sanitize() should reject a corrupt PNG")
+	}
+}
+
+func TestSanitize_GIFFrameLimits(t *testing.T) {
+	animation := &gif.GIF{}
+	for i := 0; i < 5; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 20, 10), palette.Plan9)
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if frames, pixels := gifFrames(data); frames != 5 || pixels != 1000 {
+		t.Errorf("gifFrames() = %d, %d; want 5, 1000", frames, pixels)
+	}
+	if _, err := Sanitize(data, Limits{MaxFrames: 4}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Sanitize() error = %v, want ErrTooLarge for frames", err)
+	}
+	if _, err := Sanitize(data, Limits{MaxTotalPixels: 999}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Sanitize() error = %v, want ErrTooLarge for total pixels", err)
+	}
+	img, err := Sanitize(data, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Sanitize() error = %v", err)
+	}
+	if decoded, err := gif.DecodeAll(bytes.NewReader(img.Data)); err != nil || len(decoded.Image) != 5 {
+		t.Errorf("sanitized GIF should keep 5 frames, got %v", err)
+	}
+}
+
+func TestSanitize_StripsEXIFAndOrients(t *testing.T) {
+	data := jpegWithOrientation(t, testImage(40, 20), 6)
+	if got := jpegOrientation(data); got != 6 {
+		t.Fatalf("jpegOrientation() = %d, want 6", got)
+	}
+
+	img, err := Sanitize(data, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Sanitize() error = %v", err)
+	}
+	if bytes.Contains(img.Data, []byte("Exif")) || bytes.Contains(img.Data, []byte("GPS")) {
+		t.Error("Sanitize() kept EXIF metadata")
+	}
+	if got := jpegOrientation(img.Data); got != 1 {
+		t.Errorf("jpegOrientation() after Sanitize = %d, want 1", got)
+	}
+
+	// Rotated 90° clockwise: the red left half ends up on top
+	if img.Width != 20 || img.Height != 40 {
+		t.Fatalf("Sanitize() size = %dx%d, want 20x40", img.Width, img.Height)
+	}
+	top := color.NRGBAModel.Convert(img.Image.At(10, 5)).(color.NRGBA)
+	bottom := color.NRGBAModel.Convert(img.Image.At(10, 35)).(color.NRGBA)
+	if top.R < 200 || top.B > 60 {
+		t.Errorf("top pixel = %v, want red", top)
+	}
+	if bottom.B < 200 || bottom.R > 60 {
+		t.Errorf("bottom pixel = %v, want blue", bottom)
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := testImage(100, 50)
+
+	resized := Resize(src, 10)
+	if got := resized.Bounds(); got.Dx() != 10 || got.Dy() != 5 {
+		t.Fatalf("Resize() size = %dx%d, want 10x5", got.Dx(), got.Dy())
+	}
+	if c := resized.NRGBAAt(0, 0); c.R != 255 || c.B != 0 || c.A != 255 {
+		t.Errorf("left pixel = %v, want opaque red", c)
+	}
+	if c := resized.NRGBAAt(9, 4); c.B != 255 || c.R != 0 {
+		t.Errorf("right pixel = %v, want blue", c)
+	}
+
+	if got := Resize(src, 200).Bounds(); got.Dx() != 100 {
+		t.Errorf("Resize() should not upscale, got width %d", got.Dx())
+	}
+
+	// Transparent pixels must not darken their opaque neighbours
+	half := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	half.SetNRGBA(0, 0, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	if c := Resize(half, 1).NRGBAAt(0, 0); c.R != 255 || c.A < 127 || c.A > 128 {
+		t.Errorf("Resize() of half-transparent = %v, want white at half alpha", c)
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	src := testImage(4, 2)
+	for orientation := 1; orientation <= 8; orientation++ {
+		got := applyOrientation(src, orientation).Bounds()
+		wantW, wantH := 4, 2
+		if orientation >= 5 {
+			wantW, wantH = 2, 4
+		}
+		if got.Dx() != wantW || got.Dy() != wantH {
+			t.Errorf("applyOrientation(%d) size = %dx%d, want %dx%d", orientation, got.Dx(), got.Dy(), wantW, wantH)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Package tus implements the server side of the tus 1.0 resumable upload
+// protocol (https://tus.io/protocols/resumable-upload): header parsing and
+// a store keeping partial uploads on disk until they are complete.
+package tus
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+)
+
+// Protocol constants sent in tus headers
+const (
+	Version    = "1.0.0"
+	Extensions = "creation,creation-with-upload,expiration,checksum,termination"
+
+	// ChecksumAlgorithms lists the Upload-Checksum algorithms accepted
+	ChecksumAlgorithms = "md5,sha1,sha256"
+
+	// ContentType is the content type of PATCH request bodies
+	ContentType = "application/offset+octet-stream"
+
+	// StatusChecksumMismatch is the status returned when a chunk does not
+	// match its Upload-Checksum
+	StatusChecksumMismatch = 460
+)
+
+// ErrUnsupportedChecksum is returned for Upload-Checksum headers naming an
+// algorithm not in ChecksumAlgorithms
+var ErrUnsupportedChecksum = errors.New("unsupported checksum algorithm")
+
+// ParseMetadata parses an Upload-Metadata header: comma-separated pairs of
+// a key and an optional base64-encoded value
+func ParseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		if key == "" || strings.ContainsAny(key, " ,") {
+			return nil, fmt.Errorf("invalid metadata key %q", key)
+		}
+		if _, dup := metadata[key]; dup {
+			return nil, fmt.Errorf("duplicate metadata key %q", key)
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata value for %q: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// EncodeMetadata formats metadata as an Upload-Metadata header, sorted by key
+func EncodeMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key
+		if value := metadata[key]; value != "" {
+			pairs[i] += " " + base64.StdEncoding.EncodeToString([]byte(value))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Checksum is a parsed Upload-Checksum header
+type Checksum struct {
+	Algorithm string
+	Digest    []byte
+}
+
+// ParseChecksum parses an Upload-Checksum header: an algorithm name and the
+// base64-encoded digest of the request body
+func ParseChecksum(header string) (*Checksum, error) {
+	algorithm, encoded, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok {
+		return nil, fmt.Errorf("invalid Upload-Checksum header")
+	}
+	if newHash(algorithm) == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedChecksum, algorithm)
+	}
+	digest, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Upload-Checksum digest: %w", err)
+	}
+	return &Checksum{Algorithm: algorithm, Digest: digest}, nil
+}
+
+// newHash returns a hash for a checksum algorithm, or nil if unsupported
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	}
+	return nil
+}
@@ -0,0 +1,401 @@
+package tus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned by Store, each matching a tus response status
+var (
+	ErrNotFound         = errors.New("upload not found")                   // 404
+	ErrExpired          = errors.New("upload expired")                     // 410
+	ErrOffsetMismatch   = errors.New("upload offset does not match")       // 409
+	ErrTooLarge         = errors.New("upload exceeds its declared length") // 413
+	ErrChecksumMismatch = errors.New("checksum mismatch")                  // 460
+	ErrLocked           = errors.New("upload is being written")            // 423
+)
+
+// sweepInterval is how often Create removes expired uploads
+const sweepInterval = 10 * time.Minute
+
+// Info describes an upload in progress
+type Info struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`   // Declared size in bytes
+	Offset    int64             `json:"offset"`   // Bytes received so far
+	Metadata  map[string]string `json:"metadata"` // From Upload-Metadata
+	Owner     string            `json:"owner,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+
+	// Result is set once the finished upload has been committed, so that
+	// repeating the final request does not commit it twice
+	Result map[string]string `json:"result,omitempty"`
+}
+
+// Complete reports whether every declared byte has been received
+func (i *Info) Complete() bool {
+	return i.Offset == i.Length
+}
+
+// Config holds configuration for Store
+type Config struct {
+	Dir    string        // Directory holding partial uploads
+	Expiry time.Duration // How long an upload survives without progress
+}
+
+// DefaultConfig returns the configuration from TUS_UPLOAD_DIR and
+// TUS_UPLOAD_EXPIRY (a Go duration), defaulting to a temporary directory
+// and 24 hours
+func DefaultConfig() *Config {
+	dir := os.Getenv("TUS_UPLOAD_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "tripflow-uploads")
+	}
+	expiry, err := time.ParseDuration(os.Getenv("TUS_UPLOAD_EXPIRY"))
+	if err != nil || expiry <= 0 {
+		expiry = 24 * time.Hour
+	}
+	return &Config{Dir: dir, Expiry: expiry}
+}
+
+// Store keeps partial uploads on disk: the received bytes in <id>.bin and
+// their Info in <id>.info. Writes to one upload are serialized; a second
+// concurrent write fails with ErrLocked.
+type Store struct {
+	dir    string
+	expiry time.Duration
+	now    func() time.Time
+
+	locks      sync.Map // Upload IDs being written
+	committing sync.Map // Upload IDs whose data is being committed
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewStore creates a Store, using DefaultConfig when config is nil
+func NewStore(config *Config) (*Store, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory %s: %w", config.Dir, err)
+	}
+	return &Store{
+		dir:    config.Dir,
+		expiry: config.Expiry,
+		now:    time.Now,
+	}, nil
+}
+
+// Create starts an upload of length bytes
+func (s *Store) Create(length int64, metadata map[string]string, owner string) (*Info, error) {
+	if length < 0 {
+		return nil, fmt.Errorf("upload length cannot be negative")
+	}
+	s.sweepIfDue()
+
+	now := s.now()
+	info := &Info{
+		ID:        strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Length:    length,
+		Metadata:  metadata,
+		Owner:     owner,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.expiry),
+	}
+	if err := os.WriteFile(s.dataPath(info.ID), nil, 0644); err != nil {
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	if err := s.save(info); err != nil {
+		os.Remove(s.dataPath(info.ID))
+		return nil, err
+	}
+	return info, nil
+}
+
+// Get returns an upload's Info
+func (s *Store) Get(id string) (*Info, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(s.infoPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload %s: %w", id, err)
+	}
+
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to read upload %s: %w", id, err)
+	}
+	if !s.now().Before(info.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	return &info, nil
+}
+
+// Write appends the body of a PATCH request at offset, which must equal
+// the bytes received so far. When checksum is set the chunk is kept only
+// if it matches; otherwise the bytes received before a failed read are
+// kept so the client can resume after them. Each write extends the expiry.
+func (s *Store) Write(ctx context.Context, id string, offset int64, body io.Reader, checksum *Checksum) (*Info, error) {
+	if _, busy := s.locks.LoadOrStore(id, struct{}{}); busy {
+		return nil, ErrLocked
+	}
+	defer s.locks.Delete(id)
+
+	info, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != info.Offset {
+		return info, ErrOffsetMismatch
+	}
+	if info.Complete() {
+		// Repeating the final request is allowed; its data may be gone
+		if n, _ := body.Read(make([]byte, 1)); n > 0 {
+			return info, ErrTooLarge
+		}
+		return info, nil
+	}
+
+	file, err := os.OpenFile(s.dataPath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload %s: %w", id, err)
+	}
+	defer file.Close()
+
+	// Drop anything a crashed write left past the recorded offset
+	if err := file.Truncate(info.Offset); err != nil {
+		return nil, fmt.Errorf("failed to prepare upload %s: %w", id, err)
+	}
+	if _, err := file.Seek(info.Offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to prepare upload %s: %w", id, err)
+	}
+
+	var reader io.Reader = &contextReader{ctx: ctx, r: body}
+	var digest hash.Hash
+	if checksum != nil {
+		digest = newHash(checksum.Algorithm)
+		reader = io.TeeReader(reader, digest)
+	}
+
+	// Read one byte past the declared length to detect oversized bodies
+	remaining := info.Length - info.Offset
+	written, copyErr := io.Copy(file, io.LimitReader(reader, remaining+1))
+	switch {
+	case written > remaining:
+		copyErr = ErrTooLarge
+	case copyErr == nil && digest != nil && !bytes.Equal(digest.Sum(nil), checksum.Digest):
+		copyErr = ErrChecksumMismatch
+	}
+
+	if copyErr != nil && (digest != nil || written > remaining) {
+		// The chunk cannot be trusted in part
+		file.Truncate(info.Offset)
+		return info, copyErr
+	}
+
+	info.Offset += written
+	info.ExpiresAt = s.now().Add(s.expiry)
+	if err := s.save(info); err != nil {
+		return nil, err
+	}
+	return info, copyErr
+}
+
+// CommitFunc moves the data of a finished upload elsewhere and returns a
+// result describing where it went
+type CommitFunc func(info *Info, data *os.File) (map[string]string, error)
+
+// Commit calls commit with the data of a finished upload once. The result
+// is recorded in Info.Result and the data freed; later calls return the
+// recorded Info without calling commit again. If commit fails the data is
+// kept, so a repeated final request can retry.
+func (s *Store) Commit(id string, commit CommitFunc) (*Info, error) {
+	if _, busy := s.locks.LoadOrStore(id, struct{}{}); busy {
+		return nil, ErrLocked
+	}
+	defer s.locks.Delete(id)
+
+	info, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if info.Result != nil {
+		return info, nil
+	}
+	if !info.Complete() {
+		return nil, fmt.Errorf("upload %s is not complete", id)
+	}
+
+	data, err := os.Open(s.dataPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload %s: %w", id, err)
+	}
+	s.committing.Store(id, struct{}{})
+	result, err := commit(info, data)
+	s.committing.Delete(id)
+	data.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	info.Result = result
+	if err := s.save(info); err != nil {
+		return nil, err
+	}
+	os.Remove(s.dataPath(id))
+	return info, nil
+}
+
+// Terminate removes an upload
+func (s *Store) Terminate(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	if _, busy := s.locks.LoadOrStore(id, struct{}{}); busy {
+		return ErrLocked
+	}
+	defer s.locks.Delete(id)
+	s.remove(id)
+	return nil
+}
+
+// Sweep removes uploads that expired before now and returns how many
+func (s *Store) Sweep() (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list uploads: %w", err)
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".info")
+		if !ok || !validID(id) {
+			continue
+		}
+		if _, err := s.Get(id); errors.Is(err, ErrExpired) {
+			if _, busy := s.locks.Load(id); !busy {
+				s.remove(id)
+				removed++
+			}
+		}
+	}
+	return removed, nil
+}
+
+// Staged returns the declared bytes and the number of an owner's uploads
+// that have been started but not committed. Expired uploads and uploads
+// whose commit is running are not counted; the commit accounts for the
+// latter.
+func (s *Store) Staged(owner string) (bytes int64, uploads int64, err error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list uploads: %w", err)
+	}
+
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".info")
+		if !ok || !validID(id) {
+			continue
+		}
+		if _, busy := s.committing.Load(id); busy {
+			continue
+		}
+		info, err := s.Get(id)
+		if err != nil || info.Owner != owner || info.Result != nil {
+			continue
+		}
+		bytes += info.Length
+		uploads++
+	}
+	return bytes, uploads, nil
+}
+
+// sweepIfDue runs Sweep at most once per sweepInterval
+func (s *Store) sweepIfDue() {
+	s.mu.Lock()
+	due := s.now().Sub(s.lastSweep) >= sweepInterval
+	if due {
+		s.lastSweep = s.now()
+	}
+	s.mu.Unlock()
+
+	if due {
+		s.Sweep()
+	}
+}
+
+// save writes an upload's Info, replacing the previous one atomically
+func (s *Store) save(info *Info) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to save upload %s: %w", info.ID, err)
+	}
+	tmp := s.infoPath(info.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to save upload %s: %w", info.ID, err)
+	}
+	if err := os.Rename(tmp, s.infoPath(info.ID)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save upload %s: %w", info.ID, err)
+	}
+	return nil
+}
+
+func (s *Store) remove(id string) {
+	os.Remove(s.dataPath(id))
+	os.Remove(s.infoPath(id))
+}
+
+func (s *Store) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+func (s *Store) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".info")
+}
+
+// validID reports whether id looks like an ID made by Create, so request
+// paths cannot name other files
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := strconv.ParseUint(id[:16], 16, 64)
+	if err == nil {
+		_, err = strconv.ParseUint(id[16:], 16, 64)
+	}
+	return err == nil
+}
+
+// contextReader stops reading once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
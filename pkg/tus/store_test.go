@@ -0,0 +1,233 @@
+package tus
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := NewStore(&Config{Dir: t.TempDir(), Expiry: time.Hour})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	return store
+}
+
+func TestParseMetadata(t *testing.T) {
+	header := "filename 7KCc7KO8Lm1k,filetype dGV4dC9tYXJrZG93bg==,is_draft"
+	metadata, err := ParseMetadata(header)
+	if err != nil {
+		t.Fatalf("ParseMetadata() error = %v", err)
+	}
+	if metadata["filename"] != "제주.md" || metadata["filetype"] != "text/markdown" {
+		t.Errorf("ParseMetadata() = %v", metadata)
+	}
+	if value, ok := metadata["is_draft"]; !ok || value != "" {
+		t.Errorf("keys without values should map to \"\", got %q, %v", value, ok)
+	}
+	if got := EncodeMetadata(metadata); got != "filename 7KCc7KO8Lm1k,filetype dGV4dC9tYXJrZG93bg==,is_draft" {
+		t.Errorf("EncodeMetadata() = %q", got)
+	}
+
+	for _, invalid := range []string{"filename !!!", "a YQ==,a Yg=="} {
+		if _, err := ParseMetadata(invalid); err == nil {
+			t.Errorf("ParseMetadata(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	checksum, err := ParseChecksum("sha1 Kq5sNclPz7QV2+lfQIuc6R7oRu0=")
+	if err != nil || checksum.Algorithm != "sha1" || len(checksum.Digest) != sha1.Size {
+		t.Errorf("ParseChecksum() = %+v, %v", checksum, err)
+	}
+	if _, err := ParseChecksum("crc32 AAAA"); !errors.Is(err, ErrUnsupportedChecksum) {
+		t.Errorf("ParseChecksum(crc32) error = %v, want ErrUnsupportedChecksum", err)
+	}
+	if _, err := ParseChecksum("sha1"); err == nil {
+		t.Error("ParseChecksum() without a digest should fail")
+	}
+}
+
+func TestStore_ResumeAndCommit(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	content := "# 제주 여행\n\nDay 1: 성산일출봉"
+
+	info, err := store.Create(int64(len(content)), map[string]string{"filename": "jeju.md"}, "user-1")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// The connection drops after 10 bytes; those bytes are kept
+	dropped := io.MultiReader(strings.NewReader(content[:10]), iotest.ErrReader(io.ErrUnexpectedEOF))
+	info, err = store.Write(ctx, info.ID, 0, dropped, nil)
+	if !errors.Is(err, io.ErrUnexpectedEOF) || info.Offset != 10 {
+		t.Fatalf("interrupted Write() = %+v, %v; want offset 10", info, err)
+	}
+
+	if _, err := store.Write(ctx, info.ID, 0, strings.NewReader(content), nil); !errors.Is(err, ErrOffsetMismatch) {
+		t.Errorf("Write() at a stale offset error = %v, want ErrOffsetMismatch", err)
+	}
+
+	got, err := store.Get(info.ID)
+	if err != nil || got.Offset != 10 || got.Metadata["filename"] != "jeju.md" || got.Owner != "user-1" {
+		t.Fatalf("Get() = %+v, %v", got, err)
+	}
+
+	info, err = store.Write(ctx, info.ID, 10, strings.NewReader(content[10:]), nil)
+	if err != nil || !info.Complete() {
+		t.Fatalf("resumed Write() = %+v, %v; want complete", info, err)
+	}
+
+	commits := 0
+	commit := func(info *Info, data *os.File) (map[string]string, error) {
+		commits++
+		stored, _ := io.ReadAll(data)
+		if string(stored) != content {
+			t.Errorf("committed data = %q, want %q", stored, content)
+		}
+		return map[string]string{"file_id": "f1"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		info, err = store.Commit(info.ID, commit)
+		if err != nil || info.Result["file_id"] != "f1" {
+			t.Fatalf("Commit() = %+v, %v", info, err)
+		}
+	}
+	if commits != 1 {
+		t.Errorf("commit ran %d times, want once", commits)
+	}
+
+	// Repeating the final PATCH after the commit is harmless
+	if _, err := store.Write(ctx, info.ID, info.Length, strings.NewReader(""), nil); err != nil {
+		t.Errorf("repeated final Write() error = %v", err)
+	}
+}
+
+func TestStore_Checksum(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	info, err := store.Create(10, nil, "")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	chunk := "01234"
+	sum := sha1.Sum([]byte(chunk))
+	good := &Checksum{Algorithm: "sha1", Digest: sum[:]}
+	bad := &Checksum{Algorithm: "sha1", Digest: make([]byte, sha1.Size)}
+
+	if _, err := store.Write(ctx, info.ID, 0, strings.NewReader(chunk), bad); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Write() with a wrong checksum error = %v, want ErrChecksumMismatch", err)
+	}
+	if got, _ := store.Get(info.ID); got.Offset != 0 {
+		t.Errorf("offset after a checksum mismatch = %d, want 0", got.Offset)
+	}
+
+	// A checksummed chunk cut short is discarded as a whole
+	dropped := io.MultiReader(strings.NewReader("012"), iotest.ErrReader(io.ErrUnexpectedEOF))
+	if _, err := store.Write(ctx, info.ID, 0, dropped, good); err == nil {
+		t.Fatal("interrupted Write() should fail")
+	}
+	if got, _ := store.Get(info.ID); got.Offset != 0 {
+		t.Errorf("offset after an interrupted checksummed chunk = %d, want 0", got.Offset)
+	}
+
+	if info, err = store.Write(ctx, info.ID, 0, strings.NewReader(chunk), good); err != nil || info.Offset != 5 {
+		t.Errorf("Write() with a matching checksum = %+v, %v", info, err)
+	}
+
+	if _, err := store.Write(ctx, info.ID, 5, strings.NewReader("5678901"), nil); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Write() past the length error = %v, want ErrTooLarge", err)
+	}
+	if got, _ := store.Get(info.ID); got.Offset != 5 {
+		t.Errorf("offset after an oversized chunk = %d, want 5", got.Offset)
+	}
+}
+
+func TestStore_Expiry(t *testing.T) {
+	store := newTestStore(t)
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	stale, _ := store.Create(4, nil, "")
+	now = now.Add(30 * time.Minute)
+	active, _ := store.Create(4, nil, "")
+
+	// Progress extends the expiry
+	now = now.Add(20 * time.Minute)
+	if _, err := store.Write(context.Background(), active.ID, 0, strings.NewReader("ab"), nil); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	now = now.Add(20 * time.Minute)
+	if _, err := store.Get(stale.ID); !errors.Is(err, ErrExpired) {
+		t.Errorf("Get() of an abandoned upload error = %v, want ErrExpired", err)
+	}
+	if removed, err := store.Sweep(); err != nil || removed != 1 {
+		t.Errorf("Sweep() = %d, %v; want 1", removed, err)
+	}
+	if _, err := store.Get(stale.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Sweep() error = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Get(active.ID); err != nil {
+		t.Errorf("active upload should survive, got %v", err)
+	}
+
+	if _, err := store.Get("../../etc/passwd"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of an invalid ID error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStore_Terminate(t *testing.T) {
+	store := newTestStore(t)
+	info, _ := store.Create(4, nil, "")
+	if err := store.Terminate(info.ID); err != nil {
+		t.Fatalf("Terminate() error = %v", err)
+	}
+	if _, err := store.Get(info.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Terminate() error = %v, want ErrNotFound", err)
+	}
+	if entries, _ := os.ReadDir(store.dir); len(entries) != 0 {
+		t.Errorf("upload directory should be empty, has %d entries", len(entries))
+	}
+}
+
+func TestStore_Staged(t *testing.T) {
+	store := newTestStore(t)
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	store.Create(100, nil, "alice")
+	now = now.Add(30 * time.Minute)
+	committed, _ := store.Create(2, nil, "alice")
+	store.Write(context.Background(), committed.ID, 0, strings.NewReader("ab"), nil)
+	store.Create(4, nil, "alice")
+	store.Create(8, nil, "bob")
+	if bytes, uploads, err := store.Staged("alice"); err != nil || bytes != 106 || uploads != 3 {
+		t.Errorf("Staged() = %d, %d, %v; want 106, 3", bytes, uploads, err)
+	}
+
+	// A running commit accounts for its own upload
+	store.Commit(committed.ID, func(info *Info, data *os.File) (map[string]string, error) {
+		if bytes, uploads, _ := store.Staged("alice"); bytes != 104 || uploads != 2 {
+			t.Errorf("Staged() during Commit() = %d, %d; want 104, 2", bytes, uploads)
+		}
+		return map[string]string{"file_id": "1"}, nil
+	})
+
+	// Committed and expired uploads are no longer staged
+	now = now.Add(45 * time.Minute)
+	if bytes, uploads, err := store.Staged("alice"); err != nil || bytes != 4 || uploads != 1 {
+		t.Errorf("Staged() = %d, %d, %v; want 4, 1", bytes, uploads, err)
+	}
+}